@@ -0,0 +1,140 @@
+package moat
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- Access Log ---
+//
+// With MOAT_ACCESS_LOG naming a file (or "-" for stdout), moat also writes
+// one line per request in Apache's combined log format, or the Common Log
+// Format with MOAT_ACCESS_LOG_FORMAT=common, for standard log analysers. The
+// access log is kept apart from the slog output and uses the wall clock.
+
+// clfTime is the Common Log Format's timestamp layout
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+var (
+	accessLog      io.Writer
+	accessCombined bool
+	accessLogMutex sync.Mutex
+)
+
+// openAccessLog starts the access log MOAT_ACCESS_LOG and
+// MOAT_ACCESS_LOG_FORMAT ask for, if any
+func openAccessLog() error {
+	combined := true
+	switch format := os.Getenv("MOAT_ACCESS_LOG_FORMAT"); format {
+	case "", "combined":
+	case "common":
+		combined = false
+	default:
+		return fmt.Errorf("MOAT_ACCESS_LOG_FORMAT must be common or combined, got %q", format)
+	}
+
+	path := os.Getenv("MOAT_ACCESS_LOG")
+	switch path {
+	case "":
+		return nil
+	case "-":
+		setAccessLog(os.Stdout, combined)
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	setAccessLog(f, combined)
+	return nil
+}
+
+// setAccessLog sends access log lines to w, or stops them if w is nil
+func setAccessLog(w io.Writer, combined bool) {
+	accessLogMutex.Lock()
+	defer accessLogMutex.Unlock()
+	accessLog, accessCombined = w, combined
+}
+
+// accessWriter notes the status and size of a response
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *accessWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *accessWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// clfField returns v, or "-" if it's empty
+func clfField(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+// withAccessLog writes a line to the access log for each request next
+// answers
+func withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessLogMutex.Lock()
+		out, combined := accessLog, accessCombined
+		accessLogMutex.Unlock()
+		if out == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		aw := &accessWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		user, _, _ := r.BasicAuth()
+		status, size := aw.status, "-"
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if aw.bytes > 0 {
+			size = strconv.Itoa(aw.bytes)
+		}
+		line := fmt.Sprintf("%s - %s [%s] %q %d %s", host, clfField(user), start.Format(clfTime),
+			r.Method+" "+r.RequestURI+" "+r.Proto, status, size)
+		if combined {
+			line += fmt.Sprintf(" %q %q", clfField(r.Referer()), clfField(r.UserAgent()))
+		}
+
+		accessLogMutex.Lock()
+		defer accessLogMutex.Unlock()
+		fmt.Fprintln(out, line)
+	})
+}
@@ -0,0 +1,57 @@
+package moat
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	setAccessLog(&buf, true)
+	t.Cleanup(func() { setAccessLog(nil, false) })
+	handler := setupRouter()
+
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record?x=1", nil)
+	req.RemoteAddr = "192.0.2.7:51234"
+	req.Header.Set("User-Agent", "orcid-client/1.0")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	combined := regexp.MustCompile(`^192\.0\.2\.7 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [-+]\d{4}\] "GET /v3\.0/0000-0001-2345-6789/record\?x=1 HTTP/1\.1" 200 \d+ "-" "orcid-client/1\.0"\n$`)
+	if !combined.MatchString(buf.String()) {
+		t.Errorf("Expected a combined log line, got %q", buf.String())
+	}
+
+	buf.Reset()
+	setAccessLog(&buf, false)
+	req = httptest.NewRequest("DELETE", "/v3.0/0000-0001-2345-6789/work/999999", nil)
+	req.SetBasicAuth("APP-123", "secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if line := buf.String(); !strings.Contains(line, ` - APP-123 [`) || !strings.Contains(line, `"DELETE /v3.0/0000-0001-2345-6789/work/999999 HTTP/1.1" 4`) || strings.Contains(line, `"-" "-"`) {
+		t.Errorf("Expected a common log line with the user and error status, got %q", line)
+	}
+}
+
+func TestOpenAccessLog(t *testing.T) {
+	t.Cleanup(func() { setAccessLog(nil, false) })
+	path := filepath.Join(t.TempDir(), "access.log")
+	t.Setenv("MOAT_ACCESS_LOG", path)
+	t.Setenv("MOAT_ACCESS_LOG_FORMAT", "common")
+	if err := openAccessLog(); err != nil {
+		t.Fatal(err)
+	}
+	setupRouter().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/.well-known/openid-configuration", nil))
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"GET /.well-known/openid-configuration HTTP/1.1" 200`) {
+		t.Errorf("Expected the request in %s, got %q", path, data)
+	}
+
+	t.Setenv("MOAT_ACCESS_LOG_FORMAT", "apache")
+	if err := openAccessLog(); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,345 @@
+package moat
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"moat/orciderr"
+)
+
+// --- Stored Activity Handlers ---
+//
+// Stored activities are persisted in the store: POST saves the submitted item
+// under a new put-code, and GET, PUT and DELETE operate on what was saved.
+// registerActivity wires up all four routes for a section given the full item
+// type.
+
+// storedActivity is implemented by pointers to the full activity types, so the
+// generic handlers can read and stamp put-codes
+type storedActivity[T any] interface {
+	*T
+	getPutCode() int
+	setPutCode(putCode int)
+}
+
+// ActivitySource is who added an activity, as ORCID reports it
+type ActivitySource struct {
+	SourceOrcid    *OrcidIdentifier `json:"source-orcid,omitempty" xml:"source-orcid,omitempty"`
+	SourceClientID *OrcidIdentifier `json:"source-client-id,omitempty" xml:"source-client-id,omitempty"`
+	SourceName     *Value           `json:"source-name,omitempty" xml:"source-name,omitempty"`
+}
+
+// clientID returns the client that added the activity, or "" if none did
+func (s *ActivitySource) clientID() string {
+	if s == nil || s.SourceClientID == nil {
+		return ""
+	}
+	return s.SourceClientID.Path
+}
+
+// ActivityMeta is the attribution ORCID adds to a stored activity. Types that
+// embed it have it filled in on POST and PUT.
+type ActivityMeta struct {
+	Visibility       string          `json:"visibility,omitempty" xml:"visibility,attr,omitempty"`
+	CreatedDate      *LastModified   `json:"created-date,omitempty" xml:"created-date,omitempty"`
+	LastModifiedDate *LastModified   `json:"last-modified-date,omitempty" xml:"last-modified-date,omitempty"`
+	Source           *ActivitySource `json:"source,omitempty" xml:"source,omitempty"`
+}
+
+func (m *ActivityMeta) activityMeta() *ActivityMeta { return m }
+
+// attributedActivity is implemented by activity types that embed ActivityMeta
+type attributedActivity interface {
+	activityMeta() *ActivityMeta
+}
+
+// stampActivity fills in v's attribution, keeping the created date, source
+// and (unless v sets its own) visibility of old, the item being replaced, if
+// there is one. clientID is the client writing v, which becomes its source;
+// without one (no token) the researcher is.
+func stampActivity(orcid, clientID string, v, old any) {
+	a, ok := v.(attributedActivity)
+	if !ok {
+		return
+	}
+	now := &LastModified{Value: clock.Now().UnixMilli()}
+	m := a.activityMeta()
+	m.CreatedDate, m.LastModifiedDate = now, now
+	m.Source = &ActivitySource{
+		SourceOrcid: &OrcidIdentifier{Uri: "https://orcid.org/" + orcid, Path: orcid, Host: "orcid.org"},
+		SourceName:  &Value{Value: "MOAT Service"},
+	}
+	if clientID != "" {
+		m.Source = &ActivitySource{
+			SourceClientID: &OrcidIdentifier{Uri: "https://orcid.org/client/" + clientID, Path: clientID, Host: "orcid.org"},
+			SourceName:     &Value{Value: clientName(clientID)},
+		}
+	}
+	if prev, ok := old.(attributedActivity); ok && prev.activityMeta().CreatedDate != nil {
+		m.CreatedDate = prev.activityMeta().CreatedDate
+		m.Source = prev.activityMeta().Source
+		if m.Visibility == "" {
+			m.Visibility = prev.activityMeta().Visibility
+		}
+	}
+	if m.Visibility == "" {
+		m.Visibility = "public"
+	}
+}
+
+// registerActivity adds GET/POST/PUT/DELETE routes for /v3.0/{orcid}/{section}
+func registerActivity[T any, P storedActivity[T]](mux *routeMux, section string) {
+	item := "/v3.0/{orcid}/" + section + "/{putCode}"
+	mux.HandleFunc("GET "+item, getActivityHandler[T, P](section))
+	mux.HandleFunc("POST /v3.0/{orcid}/"+section, postActivityHandler[T, P](section))
+	mux.HandleFunc("PUT "+item, putActivityHandler[T, P](section))
+	mux.HandleFunc("DELETE "+item, deleteActivityHandler(section))
+}
+
+func activityLocation(orcid, section string, putCode int) string {
+	return fmt.Sprintf("https://api.orcid.org/v3.0/%s/%s/%d", orcid, section, putCode)
+}
+
+// loadActivity fetches and decodes one stored item
+func loadActivity[T any](s *Store, orcid, section string, putCode int) (*T, bool) {
+	items, ok := s.Items(orcid, section)
+	if !ok {
+		return nil, false
+	}
+	for _, it := range items {
+		if it.PutCode == putCode {
+			var v T
+			if err := json.Unmarshal(it.Data, &v); err != nil {
+				return nil, false
+			}
+			return &v, true
+		}
+	}
+	return nil, false
+}
+
+// activityNotFound answers a request for a put-code that isn't in section:
+// 9038 when the record itself doesn't exist, 9016 when only the item is
+// missing
+func activityNotFound(w http.ResponseWriter, r *http.Request, section string) {
+	orcid := r.PathValue("orcid")
+	if !storeFor(r).HasUser(orcid) {
+		writeError(w, r, recordNotFound(orcid))
+		return
+	}
+	writeError(w, r, itemNotFound(section, r.PathValue("putCode")))
+}
+
+func getActivityHandler[T any, P storedActivity[T]](section string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		putCode, err := strconv.Atoi(r.PathValue("putCode"))
+		if err != nil {
+			activityNotFound(w, r, section)
+			return
+		}
+
+		orcid := r.PathValue("orcid")
+		v, ok := loadActivity[T](storeFor(r), orcid, section, putCode)
+		if !ok || !viewerFor(r, orcid).visibleActivity(v) {
+			activityNotFound(w, r, section)
+			return
+		}
+		writeResponse(w, r, v)
+	}
+}
+
+func postActivityHandler[T any, P storedActivity[T]](section string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orcid := r.PathValue("orcid")
+		if !storeFor(r).HasUser(orcid) {
+			writeError(w, r, recordNotFound(r.PathValue("orcid")))
+			return
+		}
+
+		var v T
+		if err := decodeBody(r, &v); err != nil {
+			writeError(w, r, invalidPayload(section, err))
+			return
+		}
+		if e := validateActivity(P(&v)); e != nil {
+			writeError(w, r, e)
+			return
+		}
+
+		// A put-code in the body is kept if it is free, so tests can pin one
+		putCode := P(&v).getPutCode()
+		if putCode == 0 {
+			putCode = ids.PutCode(orcid)
+		} else {
+			ids.ReservePutCode(orcid, putCode)
+		}
+		P(&v).setPutCode(putCode)
+		stampActivity(orcid, tokenClientID(r), P(&v), nil)
+		data, _ := json.Marshal(v)
+		err := storeFor(r).UpdateItems(orcid, section, func(items map[int]*Item) error {
+			if _, taken := items[putCode]; taken {
+				return orciderr.Newf(orciderr.PutCodeConflict, "Conflict: An item with put-code %d already exists", putCode)
+			}
+			items[putCode] = createdItem(putCode, data)
+			return nil
+		})
+		var e *orciderr.Error
+		switch {
+		case errors.As(err, &e):
+			writeError(w, r, e)
+			return
+		case err != nil:
+			writeError(w, r, recordNotFound(r.PathValue("orcid")))
+			return
+		}
+
+		type PutCodeResponse struct {
+			XMLName xml.Name `json:"-" xml:"response"`
+			PutCode int      `json:"put-code" xml:"put-code"`
+		}
+
+		w.Header().Set("Location", activityLocation(orcid, section, putCode))
+		writeResponseStatus(w, r, http.StatusCreated, PutCodeResponse{PutCode: putCode})
+	}
+}
+
+func putActivityHandler[T any, P storedActivity[T]](section string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orcid := r.PathValue("orcid")
+		putCode, err := strconv.Atoi(r.PathValue("putCode"))
+		if err != nil {
+			activityNotFound(w, r, section)
+			return
+		}
+		old, ok := loadActivity[T](storeFor(r), orcid, section, putCode)
+		if !ok {
+			activityNotFound(w, r, section)
+			return
+		}
+
+		var v T
+		if err := decodeBody(r, &v); err != nil {
+			writeError(w, r, invalidPayload(section, err))
+			return
+		}
+		if pc := P(&v).getPutCode(); pc != 0 && pc != putCode {
+			writeError(w, r, orciderr.New(orciderr.PutCodeMismatch))
+			return
+		}
+		if e := validateActivity(P(&v)); e != nil {
+			writeError(w, r, e)
+			return
+		}
+
+		P(&v).setPutCode(putCode)
+		stampActivity(orcid, tokenClientID(r), P(&v), P(old))
+		data, _ := json.Marshal(v)
+		storeFor(r).PutItem(orcid, section, putCode, data)
+
+		w.Header().Set("Location", activityLocation(orcid, section, putCode))
+		writeResponse(w, r, &v)
+	}
+}
+
+func deleteActivityHandler(section string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		putCode, err := strconv.Atoi(r.PathValue("putCode"))
+		if err != nil || !storeFor(r).DeleteItem(r.PathValue("orcid"), section, putCode) {
+			activityNotFound(w, r, section)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// --- Works ---
+
+func (w *GenericWorkResponse) getPutCode() int        { return w.PutCode }
+func (w *GenericWorkResponse) setPutCode(putCode int) { w.PutCode = putCode }
+
+// --- Affiliations ---
+
+// Affiliation holds the fields shared by the full affiliation types; each
+// type embeds it next to its own XML element name
+type Affiliation struct {
+	PutCode        int       `json:"put-code" xml:"put-code,attr,omitempty"`
+	DepartmentName string    `json:"department-name" xml:"department-name"`
+	RoleTitle      string    `json:"role-title" xml:"role-title"`
+	Organization   Org       `json:"organization" xml:"organization"`
+	StartDate      *DateYear `json:"start-date,omitempty" xml:"start-date,omitempty"`
+	EndDate        *DateYear `json:"end-date,omitempty" xml:"end-date,omitempty"`
+	ActivityMeta
+}
+
+func (a *Affiliation) getPutCode() int        { return a.PutCode }
+func (a *Affiliation) setPutCode(putCode int) { a.PutCode = putCode }
+
+type GenericEmploymentResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/employment employment"`
+	Affiliation
+}
+
+type GenericEducationResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/education education"`
+	Affiliation
+}
+
+type GenericInvitedPositionResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/invited-position invited-position"`
+	Affiliation
+}
+
+type GenericMembershipResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/membership membership"`
+	Affiliation
+}
+
+type GenericQualificationResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/qualification qualification"`
+	Affiliation
+}
+
+// --- Funding ---
+
+type GenericFundingResponse struct {
+	XMLName      xml.Name     `json:"-" xml:"http://www.orcid.org/ns/funding funding"`
+	PutCode      int          `json:"put-code" xml:"put-code,attr,omitempty"`
+	Type         string       `json:"type" xml:"type"`
+	Title        Title        `json:"title" xml:"title"`
+	Organization Org          `json:"organization" xml:"organization"`
+	StartDate    DateYear     `json:"start-date" xml:"start-date"`
+	EndDate      *DateYear    `json:"end-date,omitempty" xml:"end-date,omitempty"`
+	Amount       *Amount      `json:"amount,omitempty" xml:"amount,omitempty"`
+	ExternalIDs  *ExternalIDs `json:"external-ids,omitempty" xml:"external-ids,omitempty"`
+	ActivityMeta
+}
+
+type Amount struct {
+	CurrencyCode string `json:"currency-code" xml:"currency-code,attr"`
+	Value        string `json:"value" xml:",chardata"`
+}
+
+func (f *GenericFundingResponse) getPutCode() int        { return f.PutCode }
+func (f *GenericFundingResponse) setPutCode(putCode int) { f.PutCode = putCode }
+
+// --- Peer Review ---
+
+type GenericPeerReviewResponse struct {
+	XMLName               xml.Name     `json:"-" xml:"http://www.orcid.org/ns/peer-review peer-review"`
+	PutCode               int          `json:"put-code" xml:"put-code,attr,omitempty"`
+	ReviewerRole          string       `json:"reviewer-role" xml:"reviewer-role"`
+	ReviewType            string       `json:"review-type" xml:"review-type"`
+	ReviewURL             *Value       `json:"review-url,omitempty" xml:"review-url,omitempty"`
+	ReviewCompletionDate  *DateYear    `json:"review-completion-date,omitempty" xml:"review-completion-date,omitempty"`
+	ReviewGroupID         string       `json:"review-group-id" xml:"review-group-id"`
+	ConveningOrganization Org          `json:"convening-organization" xml:"convening-organization"`
+	ExternalIDs           *ExternalIDs `json:"review-identifiers,omitempty" xml:"review-identifiers,omitempty"`
+	ActivityMeta
+}
+
+func (p *GenericPeerReviewResponse) getPutCode() int        { return p.PutCode }
+func (p *GenericPeerReviewResponse) setPutCode(putCode int) { p.PutCode = putCode }
@@ -0,0 +1,456 @@
+package moat
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"moat/orciderr"
+)
+
+// crudLifecycle posts body to /v3.0/{orcid}/{section}, then exercises GET,
+// PUT (with updated) and DELETE on the created put-code. check, if set, runs
+// after the PUT and before the DELETE.
+func crudLifecycle(t *testing.T, orcid, section, body, updated string, check func(putCode int)) {
+	t.Helper()
+	handler := setupRouter()
+	base := "/v3.0/" + orcid + "/" + section
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		var req *http.Request
+		if body != "" {
+			req = httptest.NewRequest(method, path, strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+		} else {
+			req = httptest.NewRequest(method, path, nil)
+		}
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", base, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v", w.Code)
+	}
+	if w.Header().Get("Location") == "" {
+		t.Error("Expected Location header")
+	}
+	var created struct {
+		PutCode int `json:"put-code"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil || created.PutCode == 0 {
+		t.Fatalf("Expected put-code in response: %v", err)
+	}
+	item := base + "/" + strconv.Itoa(created.PutCode)
+
+	if w := do("GET", item, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status OK on GET, got %v", w.Code)
+	}
+
+	w = do("PUT", item, updated)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status OK on PUT, got %v", w.Code)
+	}
+
+	if check != nil {
+		check(created.PutCode)
+	}
+
+	if w := do("DELETE", item, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status No Content on DELETE, got %v", w.Code)
+	}
+	if w := do("GET", item, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found after DELETE, got %v", w.Code)
+	}
+	if w := do("DELETE", item, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found on second DELETE, got %v", w.Code)
+	}
+}
+
+func TestFundingCRUD(t *testing.T) {
+	orcid := "0000-0006-9009-0000"
+	crudLifecycle(t, orcid, "funding",
+		`{"type": "grant", "title": {"title": {"value": "Original Grant"}}, "organization": {"name": "NSF"},
+		  "amount": {"currency-code": "USD", "value": "1000"}}`,
+		`{"type": "grant", "title": {"title": {"value": "Renamed Grant"}}, "organization": {"name": "NSF"}}`,
+		func(putCode int) {
+			fundings, _ := store.Activities(orcid)
+			for _, g := range fundings.Fundings.Group {
+				for _, fs := range g.FundingSummary {
+					if fs.PutCode == putCode && fs.Title.Title.Value == "Renamed Grant" {
+						return
+					}
+				}
+			}
+			t.Errorf("Expected updated funding %d in activities, got %+v", putCode, fundings.Fundings)
+		})
+}
+
+func TestFundingPutCodeMismatch(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0006-9009-0000"
+
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/funding", strings.NewReader(`{"type": "award", "title": {"title": {"value": "Prize"}}}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	loc := w.Header().Get("Location")
+	path := loc[strings.Index(loc, "/v3.0/"):]
+
+	req = httptest.NewRequest("PUT", path, strings.NewReader(`{"put-code": 1, "type": "award", "title": {"title": {"value": "Prize"}}}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status Bad Request, got %v", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "<error-code>9034</error-code>") {
+		t.Errorf("Expected error code 9034, got %s", w.Body)
+	}
+}
+
+func TestFundingXML(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	orcid := "0000-0006-9009-0000"
+
+	body := `<funding:funding xmlns:common="http://www.orcid.org/ns/common" xmlns:funding="http://www.orcid.org/ns/funding">
+  <funding:type>grant</funding:type>
+  <funding:title><common:title>XML Grant</common:title></funding:title>
+  <common:start-date><common:year>2021</common:year></common:start-date>
+  <funding:organization><common:name>NSF</common:name></funding:organization>
+</funding:funding>`
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/funding", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/vnd.orcid+xml")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected an XML funding to be created, got %v: %s", w.Code, w.Body)
+	}
+	loc := w.Header().Get("Location")
+
+	req = httptest.NewRequest("GET", loc[strings.Index(loc, "/v3.0/"):], nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var funding GenericFundingResponse
+	if err := json.NewDecoder(w.Body).Decode(&funding); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if funding.Title.Title.Value != "XML Grant" || funding.StartDate.Year.Value != "2021" || funding.Organization.Name != "NSF" {
+		t.Errorf("Expected the XML funding back, got %+v", funding)
+	}
+}
+
+func TestErrorBodies(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		code                     orciderr.Code
+	}{
+		{"unknown put-code", "GET", "/v3.0/" + orcid + "/funding/99999999", "", http.StatusNotFound, orciderr.ItemNotFound},
+		{"unknown record", "GET", "/v3.0/0000-0009-9999-9999/person", "", http.StatusNotFound, orciderr.RecordNotFound},
+		{"invalid payload", "POST", "/v3.0/" + orcid + "/funding", "{", http.StatusBadRequest, orciderr.InvalidMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %v, got %v", tt.status, w.Code)
+			}
+			e, err := orciderr.Decode(w.Body)
+			if err != nil || e.ErrorCode != tt.code || e.ResponseCode != tt.status || e.DeveloperMessage == "" {
+				t.Errorf("Expected error code %d, got %+v, %v", tt.code, e, err)
+			}
+		})
+	}
+
+	// Without an Accept header the body is ORCID's XML error
+	req := httptest.NewRequest("GET", "/v3.0/"+orcid+"/funding/99999999", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if !strings.Contains(w.Header().Get("Content-Type"), "xml") || !strings.Contains(w.Body.String(), "<error-code>9016</error-code>") {
+		t.Errorf("Expected an XML error body, got %s", w.Body)
+	}
+}
+
+func TestPostPutCodeConflict(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	orcid := "0000-0006-9009-0000"
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/funding", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	first, second := post(`{"type": "award", "title": {"title": {"value": "Prize"}}}`), post(`{"type": "award", "title": {"title": {"value": "Prize"}}}`)
+	a, b := first.Header().Get("Location"), second.Header().Get("Location")
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+		t.Fatalf("Expected two creates, got %v and %v", first.Code, second.Code)
+	}
+	pa, _ := strconv.Atoi(a[strings.LastIndex(a, "/")+1:])
+	pb, _ := strconv.Atoi(b[strings.LastIndex(b, "/")+1:])
+	if pb != pa+1 {
+		t.Errorf("Expected sequential put-codes, got %d then %d", pa, pb)
+	}
+
+	w := post(`{"put-code": 555555, "type": "award", "title": {"title": {"value": "Prize"}}}`)
+	if w.Code != http.StatusCreated || !strings.HasSuffix(w.Header().Get("Location"), "/funding/555555") {
+		t.Errorf("Expected a free put-code to be kept, got %v %s", w.Code, w.Header().Get("Location"))
+	}
+
+	w = post(`{"put-code": ` + strconv.Itoa(pa) + `, "type": "award", "title": {"title": {"value": "Prize"}}}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "9035") {
+		t.Errorf("Expected a 409 for a put-code in use, got %v: %s", w.Code, w.Body)
+	}
+}
+
+func TestEducationCRUD(t *testing.T) {
+	orcid := "0000-0003-3003-4004"
+	crudLifecycle(t, orcid, "education",
+		`{"department-name": "Biology", "role-title": "PhD", "organization": {"name": "Mock University",
+		  "address": {"city": "Portland", "region": "OR", "country": "US"}},
+		  "start-date": {"year": {"value": "2015"}, "month": {"value": "09"}}}`,
+		`{"department-name": "Biology", "role-title": "PhD", "organization": {"name": "Mock University"},
+		  "start-date": {"year": {"value": "2015"}}, "end-date": {"year": {"value": "2020"}}}`,
+		func(putCode int) {
+			activities, _ := store.Activities(orcid)
+			for _, g := range activities.Educations.AffiliationGroup {
+				for _, es := range g.Summaries {
+					if es.PutCode == putCode && es.EndDate != nil && es.EndDate.Year.Value == "2020" {
+						return
+					}
+				}
+			}
+			t.Errorf("Expected updated education %d in activities, got %+v", putCode, activities.Educations)
+		})
+}
+
+func TestEducationXML(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0003-3003-4004"
+
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/education", strings.NewReader(`{"role-title": "BSc", "organization": {"name": "Mock College"}}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	loc := w.Header().Get("Location")
+
+	req = httptest.NewRequest("GET", loc[strings.Index(loc, "/v3.0/"):], nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `<education xmlns="http://www.orcid.org/ns/education" put-code="`) || !strings.Contains(body, `visibility="public"`) ||
+		!strings.Contains(body, "<role-title>BSc</role-title>") {
+		t.Errorf("Unexpected education XML: %s", body)
+	}
+}
+
+func TestInvitedPositionCRUD(t *testing.T) {
+	orcid := "0000-0002-1001-2002"
+	crudLifecycle(t, orcid, "invited-position",
+		`{"role-title": "Visiting Professor", "organization": {"name": "Mock Institute"}, "start-date": {"year": {"value": "2022"}}}`,
+		`{"role-title": "Visiting Fellow", "organization": {"name": "Mock Institute"}, "start-date": {"year": {"value": "2022"}}}`,
+		func(putCode int) {
+			activities, _ := store.Activities(orcid)
+			for _, g := range activities.InvitedPositions.AffiliationGroup {
+				for _, s := range g.Summaries {
+					if s.PutCode == putCode && s.RoleTitle == "Visiting Fellow" {
+						return
+					}
+				}
+			}
+			t.Errorf("Expected updated invited position %d in activities, got %+v", putCode, activities.InvitedPositions)
+		})
+}
+
+func TestMembershipCRUD(t *testing.T) {
+	orcid := "0000-0004-5005-6006"
+	crudLifecycle(t, orcid, "membership",
+		`{"role-title": "Member", "organization": {"name": "American Chemical Society"}, "start-date": {"year": {"value": "2010"}}}`,
+		`{"role-title": "Fellow", "organization": {"name": "American Chemical Society"}, "start-date": {"year": {"value": "2010"}}}`,
+		func(putCode int) {
+			activities, _ := store.Activities(orcid)
+			for _, g := range activities.Memberships.AffiliationGroup {
+				for _, s := range g.Summaries {
+					if s.PutCode == putCode && s.RoleTitle == "Fellow" {
+						return
+					}
+				}
+			}
+			t.Errorf("Expected updated membership %d in activities, got %+v", putCode, activities.Memberships)
+		})
+}
+
+func TestQualificationCRUD(t *testing.T) {
+	orcid := "0000-0005-7007-8008"
+	crudLifecycle(t, orcid, "qualification",
+		`{"department-name": "HR", "role-title": "Certified Auditor", "organization": {"name": "Mock Board"}}`,
+		`{"department-name": "HR", "role-title": "Chartered Auditor", "organization": {"name": "Mock Board"}}`,
+		func(putCode int) {
+			activities, _ := store.Activities(orcid)
+			for _, g := range activities.Qualifications.AffiliationGroup {
+				for _, s := range g.Summaries {
+					if s.PutCode == putCode && s.RoleTitle == "Chartered Auditor" {
+						return
+					}
+				}
+			}
+			t.Errorf("Expected updated qualification %d in activities, got %+v", putCode, activities.Qualifications)
+		})
+}
+
+func TestHandleGetFundings(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0003-3003-4004"
+
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/funding", strings.NewReader(`{"type": "grant", "title": {"title": {"value": "Summary Grant"}}}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	req = httptest.NewRequest("GET", "/v3.0/"+orcid+"/fundings", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+	body := w.Body.String()
+	if !xmlElements(t, body)[xml.Name{Space: activitiesNS, Local: "fundings"}] || !strings.Contains(body, "Summary Grant") {
+		t.Errorf("Unexpected fundings XML: %s", body)
+	}
+}
+
+func TestHandleGetEducations(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0002-1001-2002"
+
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/education", strings.NewReader(`{"role-title": "MSc", "organization": {"name": "Summary University"}}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	req = httptest.NewRequest("GET", "/v3.0/"+orcid+"/educations", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+	var resp EducationsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	found := false
+	for _, g := range resp.AffiliationGroup {
+		for _, s := range g.Summaries {
+			found = found || s.Organization.Name == "Summary University"
+		}
+	}
+	if !found {
+		t.Errorf("Expected posted education in affiliation groups, got %+v", resp)
+	}
+}
+
+func TestHandleGetPeerReviewsGroupedByGroupID(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0004-5005-6006"
+
+	for _, body := range []string{
+		`{"reviewer-role": "reviewer", "review-type": "review", "review-group-id": "issn:2222-2222", "convening-organization": {"name": "B Journal"}}`,
+		`{"reviewer-role": "reviewer", "review-type": "review", "review-group-id": "issn:1111-1111", "convening-organization": {"name": "A Journal"}}`,
+		`{"reviewer-role": "editor", "review-type": "review", "review-group-id": "issn:1111-1111", "convening-organization": {"name": "A Journal"}}`,
+	} {
+		req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/peer-review", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status Created, got %v", w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/v3.0/"+orcid+"/peer-reviews", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp PeerReviewsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Group) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(resp.Group))
+	}
+	if id := resp.Group[0].ExternalIDs.ExternalID[0].Value; id != "issn:1111-1111" {
+		t.Errorf("Expected first group issn:1111-1111, got %s", id)
+	}
+	if n := len(resp.Group[0].PeerReviewGroup); n != 2 {
+		t.Errorf("Expected 2 reviews in first group, got %d", n)
+	}
+}
+
+func TestSourceAttribution(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0006-9009-0000"
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	registerClient(OAuthClient{ClientID: "APP-SRC", ClientSecret: "s3cret", Name: "Example Repository"})
+	t.Cleanup(resetClients)
+	token := testToken("APP-SRC", orcid, "/read-limited /activities/update /person/update")
+
+	post := func(path, body, token string) string {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status Created, got %v", w.Code)
+		}
+		loc := w.Header().Get("Location")
+		req = httptest.NewRequest("GET", loc[strings.Index(loc, "/v3.0/"):], nil)
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	var work GenericWorkResponse
+	json.Unmarshal([]byte(post("/v3.0/"+orcid+"/work", `{"type": "data-set", "title": {"title": {"value": "Member data"}}}`, token)), &work)
+	if s := work.Source; s == nil || s.SourceClientID == nil || s.SourceClientID.Path != "APP-SRC" || s.SourceOrcid != nil || s.SourceName.Value != "Example Repository" {
+		t.Errorf("Expected the client as source, got %+v", work.Source)
+	}
+
+	var own GenericWorkResponse
+	json.Unmarshal([]byte(post("/v3.0/"+orcid+"/work", `{"type": "data-set", "title": {"title": {"value": "Own data"}}}`, "")), &own)
+	if s := own.Source; s == nil || s.SourceClientID != nil || s.SourceOrcid == nil || s.SourceOrcid.Path != orcid {
+		t.Errorf("Expected the researcher as source without a token, got %+v", own.Source)
+	}
+
+	var address AddressResponse
+	json.Unmarshal([]byte(post("/v3.0/"+orcid+"/address", `{"Country": "NZ"}`, token)), &address)
+	if s := address.Source; s == nil || s.SourceClientID == nil || s.SourceClientID.Path != "APP-SRC" || s.SourceName.Value != "Example Repository" {
+		t.Errorf("Expected the client as the address source, got %+v", address.Source)
+	}
+}
@@ -0,0 +1,207 @@
+package moat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"moat/models"
+)
+
+// --- Admin API ---
+//
+// Endpoints under /__admin/ are moat's control plane. They are not part of
+// the ORCID API and always speak JSON.
+
+// AdminItem describes one stored activity or biographical item
+type AdminItem struct {
+	PutCode    int    `json:"put-code"`
+	Source     string `json:"source"`
+	Visibility string `json:"visibility"`
+}
+
+// AdminItemsResponse lists a user's stored put-codes grouped by item type:
+// the activity sections and the person's list sections (address, keyword,
+// ...)
+type AdminItemsResponse struct {
+	ORCID string                 `json:"orcid"`
+	Items map[string][]AdminItem `json:"items"`
+}
+
+// storedItemMeta pulls the attribution fields out of a stored item's JSON
+type storedItemMeta struct {
+	Visibility string `json:"visibility"`
+	Source     *struct {
+		SourceName *Value `json:"source-name"`
+	} `json:"source"`
+}
+
+func handleAdminListItems(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+
+	sections, ok := storeFor(r).Sections(orcid)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	resp := AdminItemsResponse{ORCID: orcid, Items: make(map[string][]AdminItem)}
+	for _, section := range sections {
+		items, _ := storeFor(r).Items(orcid, section)
+		list := []AdminItem{}
+		for _, it := range items {
+			item := AdminItem{PutCode: it.PutCode, Source: "MOAT Service", Visibility: "public"}
+			var meta storedItemMeta
+			if err := json.Unmarshal(it.Data, &meta); err == nil {
+				if meta.Visibility != "" {
+					item.Visibility = meta.Visibility
+				}
+				if meta.Source != nil && meta.Source.SourceName != nil {
+					item.Source = meta.Source.SourceName.Value
+				}
+			}
+			list = append(list, item)
+		}
+		resp.Items[section] = list
+	}
+	if person, ok := storeFor(r).Person(orcid); ok {
+		for section, list := range personAdminItems(person) {
+			resp.Items[section] = list
+		}
+	}
+
+	writeResponse(w, r, resp)
+}
+
+// adminPersonItem describes one person list item
+func adminPersonItem(putCode, visibility string, source *models.Source) AdminItem {
+	item := AdminItem{Source: "MOAT Service", Visibility: "public"}
+	item.PutCode, _ = strconv.Atoi(putCode)
+	if visibility != "" {
+		item.Visibility = visibility
+	}
+	if source != nil && source.SourceName != nil {
+		item.Source = source.SourceName.Value
+	}
+	return item
+}
+
+// personAdminItems lists the put-codes in p's list sections, by the path
+// segment of a single item
+func personAdminItems(p models.Person) map[string][]AdminItem {
+	items := map[string][]AdminItem{
+		"address":             {},
+		"external-identifier": {},
+		"keyword":             {},
+		"other-name":          {},
+		"researcher-url":      {},
+	}
+	if p.Addresses != nil {
+		for _, a := range p.Addresses.Addresses {
+			items["address"] = append(items["address"], adminPersonItem(a.PutCode, a.Visibility, a.Source))
+		}
+	}
+	if p.ExternalIdentifiers != nil {
+		for _, e := range p.ExternalIdentifiers.ExternalIdentifiers {
+			items["external-identifier"] = append(items["external-identifier"], adminPersonItem(e.PutCode, e.Visibility, e.Source))
+		}
+	}
+	if p.Keywords != nil {
+		for _, k := range p.Keywords.Keywords {
+			items["keyword"] = append(items["keyword"], adminPersonItem(k.PutCode, k.Visibility, k.Source))
+		}
+	}
+	if p.OtherNames != nil {
+		for _, o := range p.OtherNames.OtherNames {
+			items["other-name"] = append(items["other-name"], adminPersonItem(o.PutCode, o.Visibility, o.Source))
+		}
+	}
+	if p.ResearcherUrls != nil {
+		for _, u := range p.ResearcherUrls.ResearcherUrls {
+			items["researcher-url"] = append(items["researcher-url"], adminPersonItem(u.PutCode, u.Visibility, u.Source))
+		}
+	}
+	return items
+}
+
+// seedStates are the stores as they were after startup seeding, which
+// POST /__admin/reset returns to. Tenants start from, and reset to, the
+// default store's.
+var (
+	seedStates     = make(map[*Store]Snapshot)
+	seedStateMutex sync.Mutex
+)
+
+// captureSeedState records s as it is now as the state to reset it to
+func captureSeedState(s *Store) {
+	snap := s.Snapshot()
+	seedStateMutex.Lock()
+	seedStates[s] = snap
+	seedStateMutex.Unlock()
+}
+
+// seedFor returns the state s resets to
+func seedFor(s *Store) Snapshot {
+	seedStateMutex.Lock()
+	defer seedStateMutex.Unlock()
+	if snap, ok := seedStates[s]; ok {
+		return snap
+	}
+	return seedStates[store]
+}
+
+// handleAdminReset puts the store back to its seeded state, forgets every
+// OAuth client, code and token issued since startup, restores the startup
+// fault rules and maintenance setting, refills the rate limit buckets,
+// restarts the scenarios, drops the stubs, empties the request journal and
+// puts the clock right. A tenant's reset only touches its own store, since
+// the rest is shared.
+func handleAdminReset(w http.ResponseWriter, r *http.Request) {
+	resetState(storeFor(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// resetState puts s back to its seeded state and, unless s is a tenant's,
+// everything else too
+func resetState(s *Store) {
+	s.Restore(seedFor(s))
+	resetJourneys(s)
+	if !slices.Contains(tenantStores(), s) {
+		resetOAuth()
+		resetClients()
+		resetFaults()
+		resetRateLimits()
+		resetScenarios()
+		clearStubs()
+		clearJournal()
+		clock.Reset()
+		resetMaintenance()
+	}
+}
+
+// handleAdminGetState exports the whole store as one JSON document
+func handleAdminGetState(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, storeFor(r).Snapshot())
+}
+
+// handleAdminPutState replaces the whole store with an exported document
+func handleAdminPutState(w http.ResponseWriter, r *http.Request) {
+	var snap Snapshot
+	if err := json.NewDecoder(r.Body).Decode(&snap); err != nil {
+		http.Error(w, "Invalid state: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for i, u := range snap.Users {
+		if u.ORCID == "" {
+			http.Error(w, fmt.Sprintf("Invalid state: user %d has no orcid", i), http.StatusBadRequest)
+			return
+		}
+	}
+
+	storeFor(r).Restore(snap)
+	reserveSnapshotPutCodes(snap)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,199 @@
+// Package admin is a client for moat's control plane, the /__admin/
+// endpoints, so Go integration tests can seed users, stub responses and
+// verify the calls their code made with typed calls. It uses only the
+// standard library and doesn't import moat itself, so it works as well
+// against a moat binary as against moat.New in the same process.
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Client calls a moat server's admin endpoints
+type Client struct {
+	// BaseURL is moat's address, such as http://localhost:8080
+	BaseURL string
+	// HTTPClient makes the calls; nil means http.DefaultClient
+	HTTPClient *http.Client
+	// Tenant, if set, picks the X-Moat-Tenant store the calls act on
+	Tenant string
+}
+
+// New returns a Client for the moat at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Error is an admin call moat refused
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("moat: %d %s", e.StatusCode, e.Message)
+}
+
+// User is a researcher to add, as POST /__admin/users takes it
+type User struct {
+	// ORCID is the user's iD; moat generates one if it's empty
+	ORCID      string   `json:"orcid,omitempty"`
+	GivenNames string   `json:"given-names"`
+	FamilyName string   `json:"family-name,omitempty"`
+	Biography  string   `json:"biography,omitempty"`
+	Emails     []string `json:"emails,omitempty"`
+}
+
+// Response is a canned response
+type Response struct {
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// Template renders Body from the request
+	Template bool `json:"template,omitempty"`
+}
+
+// Stub answers the requests it matches with canned responses
+type Stub struct {
+	// ID is set by moat
+	ID int `json:"id,omitempty"`
+	// Method and Path (a path.Match pattern) match requests; empty matches any
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	// Query holds parameters the request must have, with these values
+	Query map[string]string `json:"query,omitempty"`
+	// BodyContains is a substring and BodyMatches a regular expression the
+	// request body must have
+	BodyContains string `json:"body_contains,omitempty"`
+	BodyMatches  string `json:"body_matches,omitempty"`
+	Response
+	// Responses, instead of a single response, are given in turn, one per
+	// matching request, and the last repeats
+	Responses []Response `json:"responses,omitempty"`
+	// Calls counts the requests the stub has matched
+	Calls int `json:"calls,omitempty"`
+}
+
+// Verification describes calls moat should have received. With none of
+// Count, AtLeast and AtMost set, at least one call is expected.
+type Verification struct {
+	Method string `json:"method,omitempty"`
+	// Path is a path.Match pattern
+	Path    string `json:"path,omitempty"`
+	Handler string `json:"handler,omitempty"`
+	Status  int    `json:"status,omitempty"`
+	// BodyContains is a substring and BodyMatches a regular expression the
+	// request body must have
+	BodyContains string `json:"body_contains,omitempty"`
+	BodyMatches  string `json:"body_matches,omitempty"`
+	Count        *int   `json:"count,omitempty"`
+	AtLeast      *int   `json:"at_least,omitempty"`
+	AtMost       *int   `json:"at_most,omitempty"`
+}
+
+// Request is a call moat received, from its request journal
+type Request struct {
+	ID        int         `json:"id"`
+	Time      time.Time   `json:"time"`
+	Method    string      `json:"method"`
+	Path      string      `json:"path"`
+	Query     string      `json:"query,omitempty"`
+	Headers   http.Header `json:"headers"`
+	Body      string      `json:"body,omitempty"`
+	Handler   string      `json:"handler"`
+	Status    int         `json:"status"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// VerificationResult says whether a verification passed, with the calls
+// that matched it
+type VerificationResult struct {
+	Pass     bool      `json:"pass"`
+	Expected string    `json:"expected"`
+	Count    int       `json:"count"`
+	Requests []Request `json:"requests"`
+}
+
+// CreateUser adds u and returns its iD
+func (c *Client) CreateUser(ctx context.Context, u User) (string, error) {
+	resp, err := c.do(ctx, "POST", "/__admin/users", u, nil)
+	if err != nil {
+		return "", err
+	}
+	return path.Base(resp.Header.Get("Location")), nil
+}
+
+// Reset puts moat back to its seeded state, dropping stubs, tokens and the
+// request journal
+func (c *Client) Reset(ctx context.Context) error {
+	_, err := c.do(ctx, "POST", "/__admin/reset", nil, nil)
+	return err
+}
+
+// Stub registers s and returns it as moat stored it, with its ID
+func (c *Client) Stub(ctx context.Context, s Stub) (Stub, error) {
+	var added Stub
+	_, err := c.do(ctx, "POST", "/__admin/stubs", s, &added)
+	return added, err
+}
+
+// VerifyCalls checks v against the calls moat has received. The error is
+// only for a failed call; the result says whether the verification passed.
+func (c *Client) VerifyCalls(ctx context.Context, v Verification) (VerificationResult, error) {
+	var res VerificationResult
+	_, err := c.do(ctx, "POST", "/__admin/verify", v, &res)
+	return res, err
+}
+
+// do makes an admin call, sending in as JSON and decoding the answer into
+// out
+func (c *Client) do(ctx context.Context, method, path string, in, out any) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Tenant != "" {
+		req.Header.Set("X-Moat-Tenant", c.Tenant)
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(resp.Body)
+		return resp, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("moat: decoding %s %s: %w", method, path, err)
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"moat"
+)
+
+func get(t *testing.T, url string) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestClient(t *testing.T) {
+	ts := httptest.NewServer(moat.New())
+	defer ts.Close()
+	c := New(ts.URL + "/")
+	ctx := context.Background()
+
+	orcid, err := c.CreateUser(ctx, User{GivenNames: "Ada", FamilyName: "Lovelace", Emails: []string{"ada@example.org"}})
+	if err != nil || orcid == "" {
+		t.Fatalf("Expected a generated iD, got %q %v", orcid, err)
+	}
+	if code := get(t, ts.URL+"/v3.0/"+orcid+"/person"); code != http.StatusOK {
+		t.Errorf("Expected the new user served, got %v", code)
+	}
+	var e *Error
+	if _, err := c.CreateUser(ctx, User{ORCID: orcid, GivenNames: "Ada"}); !errors.As(err, &e) || e.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a 409 Error for a duplicate, got %v", err)
+	}
+
+	stub, err := c.Stub(ctx, Stub{Method: "GET", Path: "/v3.0/*/works", Response: Response{Status: http.StatusServiceUnavailable}})
+	if err != nil || stub.ID == 0 {
+		t.Fatalf("Expected the stub added, got %+v %v", stub, err)
+	}
+	if code := get(t, ts.URL+"/v3.0/"+orcid+"/works"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the stubbed status, got %v", code)
+	}
+
+	one := 1
+	res, err := c.VerifyCalls(ctx, Verification{Method: "GET", Path: "/v3.0/*/works", Count: &one})
+	if err != nil || !res.Pass || len(res.Requests) != 1 || res.Requests[0].Status != http.StatusServiceUnavailable {
+		t.Errorf("Expected one stubbed call, got %+v %v", res, err)
+	}
+	if res, _ := c.VerifyCalls(ctx, Verification{Method: "DELETE"}); res.Pass {
+		t.Error("Expected no DELETE calls")
+	}
+
+	if err := c.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if code := get(t, ts.URL+"/v3.0/"+orcid+"/person"); code != http.StatusNotFound {
+		t.Errorf("Expected the user gone after Reset, got %v", code)
+	}
+	if code := get(t, ts.URL+"/v3.0/"+orcid+"/works"); code == http.StatusServiceUnavailable {
+		t.Error("Expected the stub gone after Reset")
+	}
+}
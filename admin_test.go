@@ -0,0 +1,154 @@
+package moat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHandleAdminListItems(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0004-5005-6006"
+
+	body := `{"bulk": [{"work": {"type": "book", "title": {"title": {"value": "Listed"}}}}]}`
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/works", strings.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var created BulkResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil || len(created.Bulk) != 1 || created.Bulk[0].Work == nil {
+		t.Fatalf("Failed to create work: %v %+v", err, created)
+	}
+
+	req = httptest.NewRequest("GET", "/__admin/users/"+orcid+"/items", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+
+	var resp AdminItemsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	found := false
+	for _, item := range resp.Items["work"] {
+		if item.PutCode == created.Bulk[0].Work.PutCode {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected put-code %d in work items, got %+v", created.Bulk[0].Work.PutCode, resp.Items)
+	}
+	if _, ok := resp.Items["employment"]; !ok {
+		t.Error("Expected an employment group, even if empty")
+	}
+	if _, ok := resp.Items["keyword"]; !ok {
+		t.Error("Expected a keyword group, even if empty")
+	}
+
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	req = httptest.NewRequest("POST", "/v3.0/"+orcid+"/address",
+		strings.NewReader(`<address:address xmlns:address="http://www.orcid.org/ns/address"><address:country>IS</address:country></address:address>`))
+	req.Header.Set("Content-Type", "application/vnd.orcid+xml")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	putCode, _ := strconv.Atoi(path.Base(w.Header().Get("Location")))
+
+	req = httptest.NewRequest("GET", "/__admin/users/"+orcid+"/items", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	resp = AdminItemsResponse{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Items["address"]) != 1 || resp.Items["address"][0].PutCode != putCode || putCode == 0 {
+		t.Errorf("Expected address %d among the items, got %+v", putCode, resp.Items["address"])
+	}
+}
+
+func TestHandleAdminListItemsUnknownUser(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/__admin/users/0000-0000-0000-0000/items", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found, got %v", w.Code)
+	}
+}
+
+func TestHandleAdminReset(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	orcid := "0000-0003-3003-4004"
+
+	req := httptest.NewRequest("DELETE", "/v3.0/"+orcid+"/employment/789012", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the seeded employment to be deleted, got %v", w.Code)
+	}
+	token := defaultTokenResponse(context.Background())
+	recordToken("APP-123", token)
+
+	req = httptest.NewRequest("POST", "/__admin/reset", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status No Content, got %v", w.Code)
+	}
+
+	if _, ok := loadActivity[GenericEmploymentResponse](store, orcid, sectionEmployment, 789012); !ok {
+		t.Error("Expected the seeded employment back after reset")
+	}
+	if _, ok := lookupToken(token.AccessToken); ok {
+		t.Error("Expected issued tokens to be forgotten after reset")
+	}
+}
+
+func TestHandleAdminState(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+
+	req := httptest.NewRequest("GET", "/__admin/state", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+	exported := w.Body.String()
+
+	// Change the store, then import the export to undo it
+	store.DeleteItem("0000-0003-3003-4004", sectionWork, 123456)
+
+	req = httptest.NewRequest("PUT", "/__admin/state", strings.NewReader(exported))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status No Content, got %v: %s", w.Code, w.Body.String())
+	}
+	if _, ok := loadActivity[GenericWorkResponse](store, "0000-0003-3003-4004", sectionWork, 123456); !ok {
+		t.Error("Expected the imported state to bring the work back")
+	}
+	if person, ok := store.Person("0000-0003-3003-4004"); !ok || person.Name.GivenNames != "Wei" {
+		t.Error("Expected Wei's person in the imported state")
+	}
+
+	req = httptest.NewRequest("PUT", "/__admin/state", strings.NewReader(`{"users": [{"person": {}}]}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a user without an orcid to be refused, got %v", w.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package moat
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"moat/orciderr"
+)
+
+// --- Bulk Works ---
+
+const (
+	// maxBulkWorks is the most works ORCID accepts in one bulk request
+	maxBulkWorks = 100
+
+	// maxBatchFetch is the most put-codes ORCID serves in one batch GET
+	maxBatchFetch = 50
+)
+
+// BulkWorksRequest is the payload accepted by POST /works
+type BulkWorksRequest struct {
+	XMLName xml.Name   `json:"-" xml:"http://www.orcid.org/ns/bulk bulk"`
+	Bulk    []BulkItem `json:"bulk" xml:",any"`
+}
+
+// BulkResponse interleaves created works and per-item errors in the order
+// the items were submitted, the same way production does
+type BulkResponse struct {
+	XMLName xml.Name   `json:"-" xml:"http://www.orcid.org/ns/bulk bulk"`
+	Bulk    []BulkItem `json:"bulk" xml:"item"`
+}
+
+// BulkItem holds exactly one of a work or an error
+type BulkItem struct {
+	Work  *GenericWorkResponse `json:"work,omitempty"`
+	Error *orciderr.Error      `json:"error,omitempty"`
+}
+
+// MarshalXML writes the work or error element directly, without a wrapper,
+// so the XML bulk body is a flat mix of work and error elements
+func (b BulkItem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if b.Error != nil {
+		return e.Encode(b.Error)
+	}
+	return e.Encode(b.Work)
+}
+
+// UnmarshalXML reads one work element of an XML bulk body
+func (b *BulkItem) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	b.Work = &GenericWorkResponse{}
+	return d.DecodeElement(b.Work, &start)
+}
+
+func handlePostWorks(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+
+	if !storeFor(r).HasUser(orcid) {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
+	}
+
+	var req BulkWorksRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, r, invalidPayload("bulk", err))
+		return
+	}
+	if len(req.Bulk) > maxBulkWorks {
+		e := orciderr.Newf(orciderr.TooManyBulkItems, "Bad Request: A bulk request can contain at most %d works, got %d", maxBulkWorks, len(req.Bulk))
+		writeError(w, r, e)
+		return
+	}
+
+	resp := BulkResponse{}
+	for _, item := range req.Bulk {
+		resp.Bulk = append(resp.Bulk, createBulkWork(storeFor(r), orcid, tokenClientID(r), item.Work))
+	}
+
+	writeResponse(w, r, resp)
+}
+
+func handleGetWorks(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+
+	if !storeFor(r).HasUser(orcid) {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
+	}
+
+	putCodes := strings.Split(r.PathValue("putCodes"), ",")
+	if len(putCodes) > maxBatchFetch {
+		e := orciderr.Newf(orciderr.TooManyBulkItems, "Bad Request: A batch request can fetch at most %d works, got %d", maxBatchFetch, len(putCodes))
+		writeError(w, r, e)
+		return
+	}
+
+	v := viewerFor(r, orcid)
+	resp := BulkResponse{}
+	for _, raw := range putCodes {
+		putCode, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			resp.Bulk = append(resp.Bulk, BulkItem{Error: orciderr.Newf(orciderr.InvalidParameter, "Bad Request: Invalid put-code %q", raw)})
+			continue
+		}
+		work, ok := loadActivity[GenericWorkResponse](storeFor(r), orcid, sectionWork, putCode)
+		if !ok || !v.visibleActivity(work) {
+			resp.Bulk = append(resp.Bulk, BulkItem{Error: orciderr.Newf(orciderr.ItemNotFound, "Not Found: No work found with put-code %d", putCode)})
+			continue
+		}
+		resp.Bulk = append(resp.Bulk, BulkItem{Work: work})
+	}
+
+	writeResponse(w, r, resp)
+}
+
+// createBulkWork validates and stores a single work from a bulk request,
+// returning either the stored work or the error that prevented storing it.
+// clientID is the client making the request, recorded as the work's source.
+func createBulkWork(s *Store, orcid, clientID string, work *GenericWorkResponse) BulkItem {
+	if work == nil {
+		return BulkItem{Error: orciderr.Newf(orciderr.InvalidMessage, "Bad Request: Invalid incoming message: bulk item has no work")}
+	}
+	if e := work.validate(); e != nil {
+		return BulkItem{Error: e}
+	}
+
+	// A duplicate is returned from UpdateItems as the item's error, so the
+	// works section is left untouched
+	err := s.UpdateItems(orcid, sectionWork, func(works map[int]*Item) error {
+		for _, it := range sortedItems(works) {
+			var existing GenericWorkResponse
+			if err := json.Unmarshal(it.Data, &existing); err != nil {
+				continue
+			}
+			if dup, ok := sharedExternalID(&existing, work); ok {
+				return orciderr.Newf(orciderr.DuplicateExternalID,
+					"Conflict: You have already added this activity (matched by external identifiers %s:%s), put-code %d",
+					dup.Type, dup.Value, it.PutCode)
+			}
+		}
+
+		putCode := ids.PutCode(orcid)
+		work.PutCode = putCode
+		stampActivity(orcid, clientID, work, nil)
+		data, _ := json.Marshal(work)
+		works[putCode] = createdItem(putCode, data)
+		return nil
+	})
+	var e *orciderr.Error
+	switch {
+	case errors.As(err, &e):
+		return BulkItem{Error: e}
+	case err != nil:
+		return BulkItem{Error: recordNotFound(orcid)}
+	}
+	return BulkItem{Work: work}
+}
+
+// sharedExternalID returns the first self external identifier present on both works
+func sharedExternalID(a, b *GenericWorkResponse) (ExternalID, bool) {
+	if a.ExternalIDs == nil || b.ExternalIDs == nil {
+		return ExternalID{}, false
+	}
+	for _, x := range a.ExternalIDs.ExternalID {
+		if x.Relationship != "" && x.Relationship != "self" {
+			continue
+		}
+		for _, y := range b.ExternalIDs.ExternalID {
+			if x.Type == y.Type && x.Value == y.Value {
+				return x, true
+			}
+		}
+	}
+	return ExternalID{}, false
+}
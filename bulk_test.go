@@ -0,0 +1,157 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlePostWorksMixedResults(t *testing.T) {
+	handler := setupRouter()
+	body := `{"bulk": [
+		{"work": {"type": "journal-article", "title": {"title": {"value": "First"}},
+			"external-ids": {"external-id": [{"external-id-type": "doi", "external-id-value": "10.1/bulk-a", "external-id-relationship": "self"}]}}},
+		{"work": {"type": "journal-article", "title": {"title": {"value": "Duplicate"}},
+			"external-ids": {"external-id": [{"external-id-type": "doi", "external-id-value": "10.1/bulk-a", "external-id-relationship": "self"}]}}},
+		{"work": {"type": "journal-article"}}
+	]}`
+
+	req := httptest.NewRequest("POST", "/v3.0/0000-0003-3003-4004/works", strings.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+
+	var resp BulkResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Bulk) != 3 {
+		t.Fatalf("Expected 3 bulk items, got %d", len(resp.Bulk))
+	}
+	if resp.Bulk[0].Work == nil || resp.Bulk[0].Work.PutCode == 0 {
+		t.Errorf("Expected first item to be a created work, got %+v", resp.Bulk[0])
+	}
+	if resp.Bulk[1].Error == nil || resp.Bulk[1].Error.ErrorCode != 9021 {
+		t.Errorf("Expected duplicate external-id error, got %+v", resp.Bulk[1])
+	}
+	if resp.Bulk[2].Error == nil || resp.Bulk[2].Error.ResponseCode != http.StatusBadRequest {
+		t.Errorf("Expected schema error, got %+v", resp.Bulk[2])
+	}
+}
+
+func TestHandlePostWorksDuplicate(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	orcid := "0000-0003-3003-4004"
+	doi := `{"type": "book", "title": {"title": {"value": "Twice"}},
+		"external-ids": {"external-id": [{"external-id-type": "doi", "external-id-value": "10.1/twice", "external-id-relationship": "self"}]}}`
+	for _, putCode := range []int{900003, 900002, 900001} {
+		store.PutItem(orcid, sectionWork, putCode, []byte(doi))
+	}
+	before, _ := store.Modified(orcid, sectionWork)
+
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/works", strings.NewReader(`{"bulk": [{"work": `+doi+`}]}`))
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp BulkResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Bulk) != 1 || resp.Bulk[0].Error == nil || !strings.HasSuffix(resp.Bulk[0].Error.DeveloperMessage, "put-code 900001") {
+		t.Errorf("Expected the duplicate reported against the lowest put-code, got %+v", resp.Bulk)
+	}
+	if after, _ := store.Modified(orcid, sectionWork); !after.Equal(before) {
+		t.Errorf("Expected a rejected duplicate to leave the works unmodified, got %v then %v", before, after)
+	}
+}
+
+func TestHandlePostWorksTooMany(t *testing.T) {
+	handler := setupRouter()
+	items := make([]string, maxBulkWorks+1)
+	for i := range items {
+		items[i] = `{"work": {"type": "book", "title": {"title": {"value": "Too many"}}}}`
+	}
+	body := `{"bulk": [` + strings.Join(items, ",") + `]}`
+
+	req := httptest.NewRequest("POST", "/v3.0/0000-0003-3003-4004/works", strings.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status Bad Request, got %v", w.Code)
+	}
+	stored, _ := store.Items("0000-0003-3003-4004", sectionWork)
+	for _, it := range stored {
+		if strings.Contains(string(it.Data), "Too many") {
+			t.Fatal("Expected no works stored from a rejected bulk request")
+		}
+	}
+}
+
+func TestHandleGetWorksBatch(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/works/123456,999,abc", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+
+	var resp BulkResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Bulk) != 3 {
+		t.Fatalf("Expected 3 bulk items, got %d", len(resp.Bulk))
+	}
+	if resp.Bulk[0].Work == nil || resp.Bulk[0].Work.Title.Title.Value != "Mock Paper Title" {
+		t.Errorf("Expected the seeded work first, got %+v", resp.Bulk[0])
+	}
+	if resp.Bulk[1].Error == nil || resp.Bulk[1].Error.ResponseCode != http.StatusNotFound {
+		t.Errorf("Expected not-found error second, got %+v", resp.Bulk[1])
+	}
+	if resp.Bulk[2].Error == nil || resp.Bulk[2].Error.ResponseCode != http.StatusBadRequest {
+		t.Errorf("Expected invalid put-code error third, got %+v", resp.Bulk[2])
+	}
+}
+
+func TestHandlePostWorksXML(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	body := `<bulk:bulk xmlns:bulk="http://www.orcid.org/ns/bulk" xmlns:common="http://www.orcid.org/ns/common" xmlns:work="http://www.orcid.org/ns/work">
+  <work:work><work:title><common:title>First XML</common:title></work:title><work:type>book</work:type></work:work>
+  <work:work><work:title><common:title>Second XML</common:title></work:title><work:type>book</work:type></work:work>
+</bulk:bulk>`
+
+	req := httptest.NewRequest("POST", "/v3.0/0000-0003-3003-4004/works", strings.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/vnd.orcid+xml")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp BulkResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Bulk) != 2 || resp.Bulk[0].Work == nil || resp.Bulk[0].Work.Title.Title.Value != "First XML" ||
+		resp.Bulk[1].Work == nil || resp.Bulk[1].Work.Title.Title.Value != "Second XML" {
+		t.Errorf("Expected both XML works created, got %+v", resp.Bulk)
+	}
+}
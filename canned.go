@@ -0,0 +1,128 @@
+package moat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// --- Canned Responses ---
+//
+// Stubs and scenario steps answer with a CannedResponse. With "template"
+// set, its body is a text/template rendered per request, so one response
+// can serve many cases: {{.orcid}} and {{.putCode}} come from the path, and
+// the fixture template functions are there along with {{randInt}}.
+
+// CannedResponse is a fixed reply given instead of moat's own
+type CannedResponse struct {
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// Template renders Body from the request
+	Template bool `json:"template,omitempty"`
+
+	tmpl *template.Template
+}
+
+var (
+	templateRand  *mathrand.Rand
+	templateMutex sync.Mutex
+)
+
+// templateFuncs are the fixture functions plus randInt, which returns a
+// random number below its argument, or below a million without one
+var templateFuncs = template.FuncMap{
+	"randInt": func(n ...int) int {
+		limit := 1000000
+		if len(n) > 0 && n[0] > 0 {
+			limit = n[0]
+		}
+		templateMutex.Lock()
+		defer templateMutex.Unlock()
+		if templateRand == nil {
+			templateRand = ids.Rand()
+		}
+		return templateRand.IntN(limit)
+	},
+}
+
+func init() {
+	for name, fn := range fixtureFuncs {
+		templateFuncs[name] = fn
+	}
+}
+
+// empty reports whether c has nothing to say, so moat should answer
+func (c *CannedResponse) empty() bool {
+	return c.Status == 0 && c.Body == "" && len(c.Headers) == 0
+}
+
+// validate checks c's status and parses its template
+func (c *CannedResponse) validate() error {
+	if c.Status != 0 && (c.Status < 100 || c.Status > 599) {
+		return errors.New("status must be an HTTP status code")
+	}
+	if c.Template {
+		tmpl, err := template.New("body").Funcs(templateFuncs).Option("missingkey=zero").Parse(c.Body)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+		c.tmpl = tmpl
+	}
+	return nil
+}
+
+// templateData is what a response template sees of r
+func templateData(r *http.Request) map[string]any {
+	orcid, _ := pathORCID(r)
+	putCode := ""
+	if last := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]; last != "" && strings.Trim(last, "0123456789") == "" {
+		putCode = last
+	}
+	return map[string]any{
+		"orcid":   orcid,
+		"putCode": putCode,
+		"method":  r.Method,
+		"path":    r.URL.Path,
+		"query":   r.URL.Query(),
+		"headers": r.Header,
+		"body":    peekBody(r),
+	}
+}
+
+// write sends c, 200 unless it has a status, with a Content-Type guessed
+// from the body unless it sets one
+func (c *CannedResponse) write(w http.ResponseWriter, r *http.Request) {
+	body := c.Body
+	if c.tmpl != nil {
+		var buf bytes.Buffer
+		if err := c.tmpl.Execute(&buf, templateData(r)); err != nil {
+			http.Error(w, "Response template failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		body = buf.String()
+	}
+
+	for k, v := range c.Headers {
+		w.Header().Set(k, v)
+	}
+	if w.Header().Get("Content-Type") == "" {
+		switch trimmed := strings.TrimSpace(body); {
+		case strings.HasPrefix(trimmed, "<"):
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		case strings.HasPrefix(trimmed, "{"), strings.HasPrefix(trimmed, "["):
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		}
+	}
+	status := c.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
@@ -0,0 +1,55 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponseTemplates(t *testing.T) {
+	t.Cleanup(clearStubs)
+	t.Cleanup(func() { scenarios = nil })
+	handler := setupRouter()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/__admin/stubs", `{"path": "/v3.0/*/work/*", "template": true,
+		"body": "{\"orcid\": \"{{.orcid}}\", \"put-code\": {{.putCode}}, \"n\": {{randInt 10}}, \"year\": \"{{now | date \"2006\"}}\", \"q\": \"{{.query.Get \"q\"}}\"}"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the stub to be added, got %v: %s", w.Code, w.Body)
+	}
+	for _, orcid := range []string{"0000-0001-2345-6789", "0000-0002-1825-0097"} {
+		w := do("GET", "/v3.0/"+orcid+"/work/42?q=x", "")
+		want := `{"orcid": "` + orcid + `", "put-code": 42, "n": `
+		if !strings.HasPrefix(w.Body.String(), want) || !strings.HasSuffix(w.Body.String(), `"year": "`+time.Now().UTC().Format("2006")+`", "q": "x"}`) {
+			t.Errorf("Expected the template rendered for %s, got %s", orcid, w.Body)
+		}
+	}
+	if w := do("POST", "/__admin/stubs", `{"template": true, "body": "{{.orcid"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a bad template to be rejected, got %v", w.Code)
+	}
+	clearStubs()
+
+	// Scenario body files ending in .tmpl are templates, as fixtures are
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "echo.xml.tmpl"), []byte(`<echo method="{{.method}}">{{.body}}</echo>`), 0o644)
+	file := filepath.Join(dir, "scenarios.json")
+	os.WriteFile(file, []byte(`{"scenarios": [{"name": "echo", "steps": [
+		{"path": "/v3.0/*/work", "status": 400, "body_file": "echo.xml.tmpl"}
+	]}]}`), 0o644)
+	if err := loadScenarios(file); err != nil {
+		t.Fatal(err)
+	}
+	w = do("POST", "/v3.0/0000-0001-2345-6789/work", "sent")
+	if w.Code != http.StatusBadRequest || w.Body.String() != `<echo method="POST">sent</echo>` {
+		t.Errorf("Expected the scenario template rendered, got %v: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,165 @@
+package moat
+
+import (
+	"bytes"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --- Chaos Mode ---
+//
+// Chaos mode breaks responses at the network level, where fault rules only
+// choose the status: a MOAT_CHAOS fraction of requests have their response
+// cut off by a dropped connection ("reset"), sent short of its
+// Content-Length ("truncate"), or followed by random bytes ("garbage").
+// MOAT_CHAOS_MODES picks which of those happen. /__admin/ is never broken,
+// and the journal records the response as moat meant to send it.
+
+var chaosModes = []string{"reset", "truncate", "garbage"}
+
+// chaosConfig is how often chaos strikes and how
+type chaosConfig struct {
+	Rate  float64
+	Modes []string
+}
+
+var (
+	chaos      chaosConfig
+	chaosRand  *mathrand.Rand
+	chaosMutex sync.Mutex
+)
+
+// getChaos reads MOAT_CHAOS and MOAT_CHAOS_MODES; every mode is used unless
+// MOAT_CHAOS_MODES lists some
+func getChaos() (chaosConfig, error) {
+	v := os.Getenv("MOAT_CHAOS")
+	if v == "" {
+		return chaosConfig{}, nil
+	}
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil || rate <= 0 || rate > 1 {
+		return chaosConfig{}, fmt.Errorf("MOAT_CHAOS must be a fraction of requests between 0 and 1, got %q", v)
+	}
+	c := chaosConfig{Rate: rate, Modes: chaosModes}
+	if v := os.Getenv("MOAT_CHAOS_MODES"); v != "" {
+		c.Modes = nil
+		for _, mode := range strings.Split(v, ",") {
+			mode = strings.TrimSpace(mode)
+			if !slices.Contains(chaosModes, mode) {
+				return chaosConfig{}, fmt.Errorf("MOAT_CHAOS_MODES: unknown mode %q, expected %s", mode, strings.Join(chaosModes, ", "))
+			}
+			c.Modes = append(c.Modes, mode)
+		}
+	}
+	return c, nil
+}
+
+// setChaos replaces the chaos settings; a zero rate turns chaos off
+func setChaos(c chaosConfig) {
+	chaosMutex.Lock()
+	defer chaosMutex.Unlock()
+	chaos = c
+}
+
+// chaosFor picks how r's response breaks, if it does
+func chaosFor(r *http.Request) (string, bool) {
+	if strings.HasPrefix(r.URL.Path, "/__admin/") {
+		return "", false
+	}
+	chaosMutex.Lock()
+	defer chaosMutex.Unlock()
+	if chaos.Rate == 0 {
+		return "", false
+	}
+	if chaosRand == nil {
+		chaosRand = ids.Rand()
+	}
+	if chaosRand.Float64() >= chaos.Rate {
+		return "", false
+	}
+	return pick(chaosRand, chaos.Modes), true
+}
+
+// garbage returns some random bytes to send after a body
+func garbage() []byte {
+	chaosMutex.Lock()
+	defer chaosMutex.Unlock()
+	b := make([]byte, 8+chaosRand.IntN(57))
+	for i := range b {
+		b[i] = byte(chaosRand.UintN(256))
+	}
+	return b
+}
+
+// bufferedResponse holds a handler's response so chaos can break it
+type bufferedResponse struct {
+	w      http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.w.Header()
+}
+
+func (b *bufferedResponse) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// withChaos serves next, breaking the responses chaos picks
+func withChaos(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mode, ok := chaosFor(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buf := &bufferedResponse{w: w}
+		next.ServeHTTP(buf, r)
+		body := buf.body.Bytes()
+		if buf.status == 0 {
+			buf.status = http.StatusOK
+		}
+		// A response with no body can only be broken by dropping it
+		if len(body) == 0 {
+			mode = "reset"
+		}
+
+		h := w.Header()
+		switch mode {
+		case "truncate":
+			h.Set("Content-Length", strconv.Itoa(len(body)))
+			w.WriteHeader(buf.status)
+			w.Write(body[:len(body)/2])
+		case "garbage":
+			h.Del("Content-Length")
+			w.WriteHeader(buf.status)
+			w.Write(body)
+			w.Write(garbage())
+		default:
+			if len(body) > 0 {
+				h.Set("Content-Length", strconv.Itoa(len(body)))
+				w.WriteHeader(buf.status)
+				w.Write(body[:len(body)/2])
+				if f, ok := w.(http.Flusher); ok {
+					f.Flush()
+				}
+			}
+			// The server drops the connection without finishing the response
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
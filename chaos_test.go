@@ -0,0 +1,73 @@
+package moat
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChaos(t *testing.T) {
+	server := httptest.NewServer(setupRouter())
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { setChaos(chaosConfig{}) })
+	url := server.URL + "/v3.0/0000-0001-2345-6789/record"
+
+	get := func(url string) ([]byte, error) {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Accept", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+	want, err := get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setChaos(chaosConfig{Rate: 1, Modes: []string{"truncate"}})
+	if body, err := get(url); !errors.Is(err, io.ErrUnexpectedEOF) || !bytes.HasPrefix(want, body) {
+		t.Errorf("Expected a truncated body, got %v after %d of %d bytes", err, len(body), len(want))
+	}
+
+	setChaos(chaosConfig{Rate: 1, Modes: []string{"garbage"}})
+	if body, err := get(url); err != nil || len(body) <= len(want) || !bytes.HasPrefix(body, want) {
+		t.Errorf("Expected the body followed by garbage, got %v with %d of %d bytes", err, len(body), len(want))
+	}
+
+	setChaos(chaosConfig{Rate: 1, Modes: []string{"reset"}})
+	if _, err := get(url); err == nil {
+		t.Error("Expected the connection to be dropped")
+	}
+	if _, err := get(server.URL + "/__admin/faults"); err != nil {
+		t.Errorf("Expected the admin API never to be broken, got %v", err)
+	}
+}
+
+func TestGetChaos(t *testing.T) {
+	tests := []struct {
+		rate, modes string
+		wantModes   int
+		wantErr     bool
+	}{
+		{"", "", 0, false},
+		{"0.1", "", 3, false},
+		{"1", "reset, garbage", 2, false},
+		{"0", "", 0, true},
+		{"2", "", 0, true},
+		{"0.5", "explode", 0, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("MOAT_CHAOS", tt.rate)
+		t.Setenv("MOAT_CHAOS_MODES", tt.modes)
+		got, err := getChaos()
+		if (err != nil) != tt.wantErr || len(got.Modes) != tt.wantModes {
+			t.Errorf("getChaos(%q, %q) = %+v, %v", tt.rate, tt.modes, got, err)
+		}
+	}
+}
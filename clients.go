@@ -0,0 +1,151 @@
+package moat
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// --- OAuth Clients ---
+//
+// Until a client is registered through /__admin/clients, the token endpoint
+// accepts any client_id, as moat always has. Once the registry has an entry,
+// every authorize and token request must come from a registered client, with
+// one of its redirect URIs, and may only ask for that client's allowed scopes.
+
+// OAuthClient is a registered API client
+type OAuthClient struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// Name is the source-name of items the client creates
+	Name         string   `json:"name,omitempty"`
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+var (
+	clients      = make(map[string]OAuthClient)
+	clientsMutex sync.Mutex
+)
+
+var (
+	errInvalidClient    = errors.New("Client authentication failed")
+	errRedirectMismatch = errors.New("Redirect URI doesn't match your registered redirect URIs")
+)
+
+// registerClient adds or replaces c in the registry
+func registerClient(c OAuthClient) {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	clients[c.ClientID] = c
+}
+
+// resetClients empties the registry, reopening the OAuth endpoints to any
+// client
+func resetClients() {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	clear(clients)
+}
+
+// clientName returns the name a client is shown under as the source of
+// items: its registered name, or else its client_id
+func clientName(clientID string) string {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+	if c, ok := clients[clientID]; ok && c.Name != "" {
+		return c.Name
+	}
+	return clientID
+}
+
+// authenticateClient checks the client_id and client_secret of a token
+// request, from the form or HTTP Basic auth. With no clients registered it
+// accepts any client_id and returns a client with no restrictions.
+func authenticateClient(r *http.Request) (OAuthClient, error) {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+
+	id := requestClientID(r)
+	if id == "" {
+		return OAuthClient{}, errors.New("Missing client_id")
+	}
+	if len(clients) == 0 {
+		return OAuthClient{ClientID: id}, nil
+	}
+	secret := r.FormValue("client_secret")
+	if secret == "" {
+		_, secret, _ = r.BasicAuth()
+	}
+	c, ok := clients[id]
+	if !ok || secret != c.ClientSecret {
+		return c, errInvalidClient
+	}
+	return c, nil
+}
+
+// authorizeClient looks up the client of an authorize request and checks
+// that redirectURI is one of its registered URIs. With no clients registered
+// any client and redirect_uri are accepted.
+func authorizeClient(clientID, redirectURI string) (OAuthClient, error) {
+	clientsMutex.Lock()
+	defer clientsMutex.Unlock()
+
+	if len(clients) == 0 {
+		return OAuthClient{ClientID: clientID}, nil
+	}
+	c, ok := clients[clientID]
+	switch {
+	case !ok:
+		return c, errInvalidClient
+	case !slices.Contains(c.RedirectURIs, redirectURI):
+		return c, errRedirectMismatch
+	}
+	return c, nil
+}
+
+// checkScope returns an error if scope asks for anything c may not have. A
+// client registered without scopes may ask for any.
+func (c OAuthClient) checkScope(scope string) error {
+	if len(c.Scopes) == 0 {
+		return nil
+	}
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(c.Scopes, s) {
+			return errors.New("Scope " + s + " is not allowed for client " + c.ClientID)
+		}
+	}
+	return nil
+}
+
+func handleAdminRegisterClient(w http.ResponseWriter, r *http.Request) {
+	var c OAuthClient
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "Invalid client: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if c.ClientID == "" {
+		http.Error(w, "client_id is required", http.StatusBadRequest)
+		return
+	}
+	if c.ClientSecret == "" {
+		c.ClientSecret = ids.Token()
+	}
+	registerClient(c)
+	writeResponseStatus(w, r, http.StatusCreated, c)
+}
+
+func handleAdminListClients(w http.ResponseWriter, r *http.Request) {
+	clientsMutex.Lock()
+	list := []OAuthClient{}
+	for _, c := range clients {
+		list = append(list, c)
+	}
+	clientsMutex.Unlock()
+
+	slices.SortFunc(list, func(a, b OAuthClient) int { return strings.Compare(a.ClientID, b.ClientID) })
+	writeResponse(w, r, list)
+}
@@ -0,0 +1,121 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- Mock Clock ---
+//
+// moat's notion of now (last-modified and created dates, token expiry,
+// id_token times and item expiry) comes from clock rather than time.Now, so
+// tests can freeze it or move it forward through /__admin/clock instead of
+// sleeping. Request timing and rate limiting stay on the wall clock.
+
+// mockClock is the wall clock shifted by an offset, or stopped
+type mockClock struct {
+	mu     sync.Mutex
+	offset time.Duration
+	frozen bool
+	at     time.Time // the frozen time
+}
+
+var clock = &mockClock{}
+
+// Now returns moat's current time
+func (c *mockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.frozen {
+		return c.at
+	}
+	return time.Now().Add(c.offset)
+}
+
+// Set moves the clock to t, frozen there or running on from it
+func (c *mockClock) Set(t time.Time, frozen bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = time.Until(t)
+	c.frozen = frozen
+	c.at = t
+}
+
+// Advance moves the clock forward by d, frozen or not
+func (c *mockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset += d
+	c.at = c.at.Add(d)
+}
+
+// Reset goes back to the wall clock
+func (c *mockClock) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.offset = 0
+	c.frozen = false
+}
+
+// clockState is the clock as the admin API reports and sets it
+type clockState struct {
+	Now    time.Time `json:"now"`
+	Frozen bool      `json:"frozen"`
+}
+
+func (c *mockClock) state() clockState {
+	now := c.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return clockState{Now: now, Frozen: c.frozen}
+}
+
+// handleAdminGetClock reports moat's time and whether it's frozen
+func handleAdminGetClock(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, clock.state())
+}
+
+// handleAdminPutClock sets moat's time, frozen or running; without a time
+// it freezes or unfreezes the clock where it is
+func handleAdminPutClock(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Now    *time.Time `json:"now"`
+		Frozen bool       `json:"frozen"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid clock: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	t := clock.Now()
+	if body.Now != nil {
+		t = *body.Now
+	}
+	clock.Set(t, body.Frozen)
+	writeResponse(w, r, clock.state())
+}
+
+// handleAdminAdvanceClock moves moat's time forward by a Go duration
+func handleAdminAdvanceClock(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		By string `json:"by"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid advance: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	d, err := time.ParseDuration(body.By)
+	if err != nil || d < 0 {
+		http.Error(w, `Invalid advance: "by" must be a non-negative duration such as 90m`, http.StatusBadRequest)
+		return
+	}
+	clock.Advance(d)
+	writeResponse(w, r, clock.state())
+}
+
+// handleAdminResetClock goes back to the wall clock
+func handleAdminResetClock(w http.ResponseWriter, r *http.Request) {
+	clock.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMockClock(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	t.Cleanup(clock.Reset)
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	state := func(w *httptest.ResponseRecorder) clockState {
+		t.Helper()
+		var s clockState
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Expected the clock, got %v: %s", w.Code, w.Body)
+		}
+		return s
+	}
+
+	frozen := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if s := state(do("PUT", "/__admin/clock", `{"now": "2030-01-02T03:04:05Z", "frozen": true}`)); !s.Now.Equal(frozen) || !s.Frozen {
+		t.Errorf("Expected the clock frozen at %v, got %+v", frozen, s)
+	}
+	w := do("POST", "/v3.0/"+orcid+"/work", `{"type": "book", "title": {"title": {"value": "Frozen"}}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the work to be created, got %v: %s", w.Code, w.Body)
+	}
+	var work GenericWorkResponse
+	json.Unmarshal(do("GET", w.Header().Get("Location"), "").Body.Bytes(), &work)
+	if work.LastModifiedDate == nil || work.LastModifiedDate.Value != frozen.UnixMilli() {
+		t.Errorf("Expected the work last modified at the frozen time, got %+v", work.LastModifiedDate)
+	}
+
+	token := testToken("APP-CLOCK", orcid, "/read-limited")
+	if s := state(do("POST", "/__admin/clock/advance", `{"by": "876000h"}`)); !s.Now.Equal(frozen.Add(876000 * time.Hour)) {
+		t.Errorf("Expected the frozen clock to advance a century, got %+v", s)
+	}
+	req := httptest.NewRequest("GET", "/v3.0/"+orcid+"/record", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	memberAPI(handler).ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the token to have expired, got %v", w.Code)
+	}
+
+	if w := do("POST", "/__admin/clock/advance", `{"by": "-1h"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for going backwards, got %v", w.Code)
+	}
+	if w := do("DELETE", "/__admin/clock", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %v", w.Code)
+	}
+	if s := state(do("GET", "/__admin/clock", "")); s.Frozen || time.Since(s.Now).Abs() > time.Minute {
+		t.Errorf("Expected the wall clock back, got %+v", s)
+	}
+}
+
+func TestRunningClockSet(t *testing.T) {
+	t.Cleanup(clock.Reset)
+	past := time.Now().Add(-24 * time.Hour)
+	clock.Set(past, false)
+	if got := clock.Now(); got.Before(past) || got.Sub(past) > time.Minute {
+		t.Errorf("Expected the clock to run on from a day ago, got %v", got)
+	}
+	clock.Advance(time.Hour)
+	if got := clock.Now(); got.Sub(past) < time.Hour {
+		t.Errorf("Expected the clock an hour on, got %v", got)
+	}
+}
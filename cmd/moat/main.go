@@ -0,0 +1,8 @@
+// Command moat runs the ORCID v3 mock service; see package moat.
+package main
+
+import "moat"
+
+func main() {
+	moat.Main()
+}
@@ -0,0 +1,123 @@
+package moat
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// --- Login and Consent Page ---
+//
+// By default /oauth/authorize redirects straight back with a code. With
+// MOAT_CONSENT_PAGE set, it instead serves a small HTML page listing the
+// seeded researchers and the requested scopes, so browser-driven tests can
+// click through the 3-legged flow. The page posts back to /oauth/authorize,
+// and the chosen researcher is remembered against the issued code so the
+// token exchange returns them.
+
+// consentPage is set from MOAT_CONSENT_PAGE at startup
+var consentPage bool
+
+type consentUser struct {
+	ORCID string
+	Name  string
+}
+
+type consentData struct {
+	ClientID    string
+	RedirectURI string
+	State       string
+	Scope       string
+	Nonce       string
+	Scopes      []string
+	Users       []consentUser
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><title>MOAT - Authorize {{.ClientID}}</title></head>
+<body>
+<h1>Sign in to MOAT</h1>
+<form method="post" action="authorize">
+<input type="hidden" name="client_id" value="{{.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="scope" value="{{.Scope}}">
+<input type="hidden" name="nonce" value="{{.Nonce}}">
+<fieldset>
+<legend>Researcher</legend>
+{{range $i, $u := .Users}}<label><input type="radio" name="orcid" value="{{$u.ORCID}}"{{if eq $i 0}} checked{{end}}> {{$u.Name}} ({{$u.ORCID}})</label><br>
+{{end}}</fieldset>
+<p><strong>{{.ClientID}}</strong> is asking to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+<button type="submit" name="action" value="authorize" id="authorize">Authorize access</button>
+<button type="submit" name="action" value="deny" id="deny">Deny access</button>
+</form>
+</body>
+</html>
+`))
+
+// serveConsentPage renders the login and consent form for an authorize
+// request
+func serveConsentPage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data := consentData{
+		ClientID:    query.Get("client_id"),
+		RedirectURI: query.Get("redirect_uri"),
+		State:       query.Get("state"),
+		Scope:       query.Get("scope"),
+		Nonce:       query.Get("nonce"),
+		Scopes:      strings.Fields(query.Get("scope")),
+	}
+	s := storeFor(r)
+	for _, orcid := range s.ORCIDs() {
+		u := consentUser{ORCID: orcid, Name: researcherName(s, orcid)}
+		if u.Name == "" {
+			u.Name = orcid
+		}
+		data.Users = append(data.Users, u)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	consentTemplate.Execute(w, data)
+}
+
+// handleConsent handles the consent form, redirecting back to the client
+// with a code or an access_denied error
+func handleConsent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	redirectURI := r.PostFormValue("redirect_uri")
+	state := r.PostFormValue("state")
+	if !checkAuthorizeRequest(w, r, r.PostFormValue("client_id"), redirectURI, r.PostFormValue("scope"), state) {
+		return
+	}
+
+	params := url.Values{}
+	if r.PostFormValue("action") == "deny" {
+		params.Set("error", "access_denied")
+		params.Set("error_description", "User denied access")
+		http.Redirect(w, r, authorizeRedirect(redirectURI, params, state), http.StatusFound)
+		return
+	}
+
+	orcid := r.PostFormValue("orcid")
+	if !storeFor(r).HasUser(orcid) {
+		http.Error(w, fmt.Sprintf("Unknown researcher %q", orcid), http.StatusBadRequest)
+		return
+	}
+	params.Set("code", issueCode(authGrant{
+		ClientID:    r.PostFormValue("client_id"),
+		RedirectURI: redirectURI,
+		ORCID:       orcid,
+		Scope:       r.PostFormValue("scope"),
+		Nonce:       r.PostFormValue("nonce"),
+	}))
+	http.Redirect(w, r, authorizeRedirect(redirectURI, params, state), http.StatusFound)
+}
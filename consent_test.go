@@ -0,0 +1,84 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestConsentPageFlow(t *testing.T) {
+	consentPage = true
+	defer func() { consentPage = false }()
+	handler := setupRouter()
+
+	req := httptest.NewRequest("GET", "/oauth/authorize?client_id=APP-UI&redirect_uri=http://example.com/cb&state=xyz&scope=/authenticate+/read-limited", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+	page := w.Body.String()
+	for _, want := range []string{"John Smith", `value="0000-0002-1001-2002"`, "<li>/read-limited</li>", `id="authorize"`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected %s on consent page", want)
+		}
+	}
+
+	form := url.Values{
+		"client_id":    {"APP-UI"},
+		"redirect_uri": {"http://example.com/cb"},
+		"state":        {"xyz"},
+		"scope":        {"/authenticate /read-limited"},
+		"orcid":        {"0000-0002-1001-2002"},
+		"action":       {"authorize"},
+	}
+	req = httptest.NewRequest("POST", "/oauth/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusFound || err != nil {
+		t.Fatalf("Expected a redirect, got %v %q", w.Code, w.Header().Get("Location"))
+	}
+	if loc.Query().Get("state") != "xyz" || loc.Query().Get("code") == "" {
+		t.Fatalf("Expected code and state in redirect, got %s", loc)
+	}
+
+	data := url.Values{
+		"client_id":    {"APP-UI"},
+		"redirect_uri": {"http://example.com/cb"},
+		"grant_type":   {"authorization_code"},
+		"code":         {loc.Query().Get("code")},
+	}
+	req = httptest.NewRequest("POST", "/oauth/token", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var token TokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&token); err != nil {
+		t.Fatalf("Failed to decode token: %v", err)
+	}
+	if token.ORCID != "0000-0002-1001-2002" || token.Name != "John Smith" || token.Scope != "/authenticate /read-limited" {
+		t.Errorf("Expected John's token with the consented scopes, got %+v", token)
+	}
+}
+
+func TestConsentPageDeny(t *testing.T) {
+	handler := setupRouter()
+	form := url.Values{"redirect_uri": {"http://example.com/cb"}, "state": {"s1"}, "action": {"deny"}}
+	req := httptest.NewRequest("POST", "/oauth/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	loc := w.Header().Get("Location")
+	if !strings.Contains(loc, "error=access_denied") || !strings.Contains(loc, "state=s1") {
+		t.Errorf("Expected access_denied redirect with state, got %s", loc)
+	}
+}
@@ -0,0 +1,147 @@
+package moat
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// --- CORS ---
+//
+// So browser apps can call moat directly, every response carries CORS
+// headers, errors included (a member token's 401 or a public surface's 405
+// too), and OPTIONS preflights are answered before anything else sees
+// them. By default any origin may call and read the headers clients need
+// (Location, ETag, Retry-After and the like). MOAT_CORS_ORIGINS lists the
+// origins allowed instead ("none" turns CORS off), MOAT_CORS_METHODS the
+// methods, MOAT_CORS_HEADERS the request headers (by default whatever the
+// preflight asks for) and MOAT_CORS_EXPOSE the response headers scripts
+// may read.
+
+// corsConfig is who may call moat from a browser, and how
+type corsConfig struct {
+	// Origins are the allowed origins; "*" allows any and none turns CORS off
+	Origins []string
+	Methods []string
+	// Headers are the allowed request headers; none allows what's asked for
+	Headers []string
+	Expose  []string
+}
+
+// defaultCORS lets any origin call the whole API
+var defaultCORS = corsConfig{
+	Origins: []string{"*"},
+	Methods: []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS"},
+	Expose: []string{
+		"Location", "ETag", "Last-Modified", "Retry-After", "WWW-Authenticate",
+		"X-Request-Id", "X-Rate-Limit-Limit", "X-Rate-Limit-Remaining", "X-Rate-Limit-Reset",
+	},
+}
+
+// corsMaxAge is how long, in seconds, browsers may cache a preflight
+const corsMaxAge = "600"
+
+var (
+	cors      = defaultCORS
+	corsMutex sync.Mutex
+)
+
+// envList splits a comma-separated environment variable, or returns def if
+// it's unset
+func envList(name string, def []string) []string {
+	v := os.Getenv(name)
+	if v == "" {
+		return slices.Clone(def)
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getCORS reads the MOAT_CORS_* settings
+func getCORS() corsConfig {
+	c := corsConfig{
+		Origins: envList("MOAT_CORS_ORIGINS", defaultCORS.Origins),
+		Methods: envList("MOAT_CORS_METHODS", defaultCORS.Methods),
+		Headers: envList("MOAT_CORS_HEADERS", nil),
+		Expose:  envList("MOAT_CORS_EXPOSE", defaultCORS.Expose),
+	}
+	if slices.Equal(c.Origins, []string{"none"}) {
+		c.Origins = nil
+	}
+	for i, m := range c.Methods {
+		c.Methods[i] = strings.ToUpper(m)
+	}
+	return c
+}
+
+// setCORS replaces the CORS settings
+func setCORS(c corsConfig) {
+	corsMutex.Lock()
+	defer corsMutex.Unlock()
+	cors = c
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin for origin, or "" if
+// it may not call
+func (c corsConfig) allowOrigin(origin string) string {
+	switch {
+	case slices.Contains(c.Origins, "*"):
+		return "*"
+	case origin != "" && slices.Contains(c.Origins, origin):
+		return origin
+	}
+	return ""
+}
+
+// isPreflight reports whether r is a CORS preflight, which browsers send
+// without credentials
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// withCORS adds CORS headers to next's responses and answers preflights
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		corsMutex.Lock()
+		c := cors
+		corsMutex.Unlock()
+
+		h := w.Header()
+		origin := r.Header.Get("Origin")
+		allowed := c.allowOrigin(origin)
+		if allowed != "" {
+			h.Set("Access-Control-Allow-Origin", allowed)
+			if allowed != "*" {
+				h.Add("Vary", "Origin")
+			}
+		}
+
+		if !isPreflight(r) {
+			if allowed != "" && len(c.Expose) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(c.Expose, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// A preflight: a 204 whose headers say whether the call may go ahead
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		if allowed != "" && slices.Contains(c.Methods, method) {
+			h.Set("Access-Control-Allow-Methods", strings.Join(c.Methods, ", "))
+			if len(c.Headers) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(c.Headers, ", "))
+			} else if asked := r.Header.Get("Access-Control-Request-Headers"); asked != "" {
+				h.Set("Access-Control-Allow-Headers", asked)
+			}
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
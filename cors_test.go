@@ -0,0 +1,103 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	t.Cleanup(func() { setCORS(defaultCORS) })
+	handler := setupRouter()
+	do := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	record := "/v3.0/0000-0001-2345-6789/record"
+	preflight := map[string]string{
+		"Origin":                         "http://localhost:5173",
+		"Access-Control-Request-Method":  "PUT",
+		"Access-Control-Request-Headers": "authorization, content-type",
+	}
+
+	w := do("GET", record, map[string]string{"Origin": "http://localhost:5173"})
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || !strings.Contains(w.Header().Get("Access-Control-Expose-Headers"), "Location") {
+		t.Errorf("Expected any origin allowed with Location exposed, got %v", w.Header())
+	}
+
+	w = do("OPTIONS", "/v3.0/0000-0001-2345-6789/work/1", preflight)
+	if w.Code != http.StatusNoContent || !strings.Contains(w.Header().Get("Access-Control-Allow-Methods"), "PUT") ||
+		w.Header().Get("Access-Control-Allow-Headers") != "authorization, content-type" || w.Header().Get("Access-Control-Max-Age") == "" {
+		t.Errorf("Expected the preflight allowed, got %v %v", w.Code, w.Header())
+	}
+
+	setCORS(corsConfig{Origins: []string{"https://app.example.edu"}, Methods: []string{"GET"}, Expose: []string{"ETag"}})
+	w = do("GET", record, map[string]string{"Origin": "https://app.example.edu"})
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.edu" || w.Header().Get("Vary") != "Origin" || w.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("Expected the listed origin echoed, got %v", w.Header())
+	}
+	if w := do("GET", record, map[string]string{"Origin": "https://evil.example.com"}); w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("Expected other origins refused")
+	}
+	preflight["Origin"] = "https://app.example.edu"
+	if w := do("OPTIONS", record, preflight); w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("Expected PUT refused, got %v", w.Header())
+	}
+}
+
+func TestGetCORS(t *testing.T) {
+	t.Setenv("MOAT_CORS_ORIGINS", "https://a.example, https://b.example")
+	t.Setenv("MOAT_CORS_METHODS", "get,post")
+	t.Setenv("MOAT_CORS_HEADERS", "")
+	t.Setenv("MOAT_CORS_EXPOSE", "")
+	c := getCORS()
+	if len(c.Origins) != 2 || c.Origins[1] != "https://b.example" || strings.Join(c.Methods, ",") != "GET,POST" || len(c.Expose) != len(defaultCORS.Expose) {
+		t.Errorf("Unexpected settings %+v", c)
+	}
+	t.Setenv("MOAT_CORS_ORIGINS", "none")
+	if c := getCORS(); c.allowOrigin("https://a.example") != "" {
+		t.Error("Expected none to turn CORS off")
+	}
+}
+
+func TestCORSPreflightOnSurfaces(t *testing.T) {
+	for name, handler := range map[string]http.Handler{"public": publicAPI(setupRouter()), "member": memberAPI(setupRouter())} {
+		req := httptest.NewRequest("OPTIONS", "/v3.0/0000-0001-2345-6789/record", nil)
+		req.Header.Set("Origin", "http://localhost:5173")
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") == "" {
+			t.Errorf("Expected the %s surface to answer preflights, got %v", name, w.Code)
+		}
+	}
+}
+
+func TestCORSOnSurfaceErrors(t *testing.T) {
+	record := "/v3.0/0000-0001-2345-6789/record"
+	for _, tc := range []struct {
+		name    string
+		handler http.Handler
+		method  string
+		path    string
+		code    int
+	}{
+		{"public write", publicAPI(setupRouter()), "POST", "/v3.0/0000-0001-2345-6789/work", http.StatusMethodNotAllowed},
+		{"public admin", publicAPI(setupRouter()), "GET", "/__admin/users", http.StatusNotFound},
+		{"member without token", memberAPI(setupRouter()), "GET", record, http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Origin", "http://localhost:5173")
+		w := httptest.NewRecorder()
+		tc.handler.ServeHTTP(w, req)
+		if w.Code != tc.code || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Errorf("%s: expected %d with CORS headers, got %d %v", tc.name, tc.code, w.Code, w.Header())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package moat
+
+import (
+	_ "embed"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// --- Dashboard ---
+//
+// GET /__admin/ is a small web page over the admin API for demos and for
+// working out why an integration test failed: the researchers in the store
+// and what they hold, the tokens issued, and the latest requests, with
+// buttons to reset state. Its links are relative, so it works under a
+// /tenants/{name}/ prefix too.
+
+// dashboardRequests is how many journal entries the dashboard shows
+const dashboardRequests = 50
+
+//go:embed web/dashboard.html
+var dashboardPage string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"date": fixtureFuncs["date"],
+}).Parse(dashboardPage))
+
+type dashboardSection struct {
+	Name  string
+	Count int
+}
+
+type dashboardUser struct {
+	ORCID    string
+	Name     string
+	Status   *RecordStatus
+	Sections []dashboardSection
+}
+
+type dashboardToken struct {
+	Token string
+	issuedToken
+	Expired bool
+}
+
+type dashboardData struct {
+	Now      time.Time
+	Frozen   bool
+	Tenant   string
+	Users    []dashboardUser
+	Tokens   []dashboardToken
+	Requests []JournalEntry
+}
+
+// tenantOf returns the name of the tenant whose store s is, or "" for the
+// default store
+func tenantOf(s *Store) string {
+	tenantsMutex.Lock()
+	defer tenantsMutex.Unlock()
+	for name, t := range tenants {
+		if t == s {
+			return name
+		}
+	}
+	return ""
+}
+
+// handleAdminDashboard renders the dashboard
+func handleAdminDashboard(w http.ResponseWriter, r *http.Request) {
+	s := storeFor(r)
+	state := clock.state()
+	data := dashboardData{Now: state.Now, Frozen: state.Frozen, Tenant: tenantOf(s)}
+
+	for _, orcid := range s.ORCIDs() {
+		u := dashboardUser{ORCID: orcid, Status: s.Status(orcid)}
+		if p, ok := s.Person(orcid); ok && p.Name != nil {
+			u.Name = strings.TrimSpace(p.Name.GivenNames + " " + p.Name.FamilyName)
+		}
+		sections, _ := s.Sections(orcid)
+		for _, section := range sections {
+			if items, _ := s.Items(orcid, section); len(items) > 0 {
+				u.Sections = append(u.Sections, dashboardSection{Name: section, Count: len(items)})
+			}
+		}
+		data.Users = append(data.Users, u)
+	}
+
+	for token, t := range listTokens() {
+		data.Tokens = append(data.Tokens, dashboardToken{Token: token, issuedToken: t, Expired: t.expired()})
+	}
+	slices.SortFunc(data.Tokens, func(a, b dashboardToken) int { return b.Expires.Compare(a.Expires) })
+
+	entries := journalEntries()
+	entries = entries[max(0, len(entries)-dashboardRequests):]
+	slices.Reverse(entries)
+	data.Requests = entries
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "Unable to render dashboard", "error", err)
+	}
+}
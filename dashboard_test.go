@@ -0,0 +1,42 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminDashboard(t *testing.T) {
+	t.Cleanup(clearJournal)
+	handler := withTenant(setupRouter())
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	token := testToken("APP-DASHBOARD", "0000-0001-2345-6789", "/read-limited")
+	do("/v3.0/0000-0001-2345-6789/record")
+
+	w := do("/__admin/")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("Expected an HTML page, got %v %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	page := w.Body.String()
+	for _, want := range []string{
+		`<code>0000-0001-2345-6789</code>`,
+		token,
+		"APP-DASHBOARD",
+		"GET /v3.0/0000-0001-2345-6789/record",
+		`data-path="reset"`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected the dashboard to show %q", want)
+		}
+	}
+
+	t.Cleanup(func() { delete(tenants, "dashboard") })
+	if w := do("/tenants/dashboard/__admin/"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<code>dashboard</code>") {
+		t.Errorf("Expected a tenant's dashboard to name it, got %v", w.Code)
+	}
+}
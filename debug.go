@@ -0,0 +1,25 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// --- Profiling ---
+//
+// With --debug the main port also serves Go's net/http/pprof handlers under
+// /debug/pprof/, to profile moat under heavy load tests. They are off by
+// default and never on the public API port.
+
+// withPprof serves the pprof handlers under /debug/pprof/ and everything
+// else from next
+func withPprof(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/", next)
+	return mux
+}
@@ -0,0 +1,29 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPprof(t *testing.T) {
+	handler := withPprof(setupRouter())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("Expected the pprof index, got %v", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the API still served, got %v", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	setupRouter().ServeHTTP(w, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected no pprof without --debug, got %v", w.Code)
+	}
+}
@@ -0,0 +1,112 @@
+package moat
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Slow Drip ---
+//
+// With MOAT_DRIP_DELAY set, response bodies are written MOAT_DRIP_BYTES at a
+// time (16 by default), flushed, with the delay between chunks, so clients'
+// read timeouts and streaming parsers can be exercised. /__admin/ always
+// answers at full speed.
+
+const defaultDripBytes = 16
+
+// dripConfig is the chunk size and the pause between chunks
+type dripConfig struct {
+	Bytes int
+	Delay time.Duration
+}
+
+var (
+	drip      dripConfig
+	dripMutex sync.Mutex
+)
+
+// getDrip reads MOAT_DRIP_DELAY, a duration such as 200ms, and
+// MOAT_DRIP_BYTES
+func getDrip() (dripConfig, error) {
+	v := os.Getenv("MOAT_DRIP_DELAY")
+	if v == "" {
+		return dripConfig{}, nil
+	}
+	delay, err := time.ParseDuration(v)
+	if err != nil || delay <= 0 {
+		return dripConfig{}, fmt.Errorf("MOAT_DRIP_DELAY must be a positive duration such as 200ms, got %q", v)
+	}
+	d := dripConfig{Bytes: defaultDripBytes, Delay: delay}
+	if v := os.Getenv("MOAT_DRIP_BYTES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return dripConfig{}, fmt.Errorf("MOAT_DRIP_BYTES must be a positive number, got %q", v)
+		}
+		d.Bytes = n
+	}
+	return d, nil
+}
+
+// setDrip replaces the drip settings; a zero delay turns dripping off
+func setDrip(d dripConfig) {
+	dripMutex.Lock()
+	defer dripMutex.Unlock()
+	drip = d
+}
+
+// dripWriter writes a body a chunk at a time
+type dripWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	drip    dripConfig
+	started bool
+}
+
+func (d *dripWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if d.started {
+			select {
+			case <-time.After(d.drip.Delay):
+			case <-d.r.Context().Done():
+				return written, d.r.Context().Err()
+			}
+		}
+		d.started = true
+		chunk := p[:min(d.drip.Bytes, len(p))]
+		n, err := d.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		d.Flush()
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (d *dripWriter) Flush() {
+	if f, ok := d.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withDrip serves next, dripping its response bodies while MOAT_DRIP_DELAY
+// is set
+func withDrip(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dripMutex.Lock()
+		d := drip
+		dripMutex.Unlock()
+		if d.Delay == 0 || strings.HasPrefix(r.URL.Path, "/__admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&dripWriter{ResponseWriter: w, r: r, drip: d}, r)
+	})
+}
@@ -0,0 +1,61 @@
+package moat
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// writeCounter counts the writes that reach the client
+type writeCounter struct {
+	*httptest.ResponseRecorder
+	writes int
+}
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.ResponseRecorder.Write(p)
+}
+
+func TestSlowDrip(t *testing.T) {
+	handler := setupRouter()
+	get := func(path string) (*writeCounter, time.Duration) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/json")
+		w := &writeCounter{ResponseRecorder: httptest.NewRecorder()}
+		start := time.Now()
+		handler.ServeHTTP(w, req)
+		return w, time.Since(start)
+	}
+	path := "/v3.0/0000-0001-2345-6789/biography"
+	want, _ := get(path)
+
+	setDrip(dripConfig{Bytes: 64, Delay: time.Millisecond})
+	t.Cleanup(func() { setDrip(dripConfig{}) })
+	w, took := get(path)
+	chunks := (want.Body.Len() + 63) / 64
+	if w.Body.String() != want.Body.String() {
+		t.Errorf("Expected the same body, got %s", w.Body)
+	}
+	if w.writes != chunks || !w.Flushed {
+		t.Errorf("Expected %d flushed chunks, got %d", chunks, w.writes)
+	}
+	if min := time.Duration(chunks-1) * time.Millisecond; took < min {
+		t.Errorf("Expected at least %v between chunks, took %v", min, took)
+	}
+
+	if w, _ := get("/__admin/faults"); w.writes != 1 {
+		t.Errorf("Expected the admin API never to drip, got %d writes", w.writes)
+	}
+}
+
+func TestDripStopsWhenClientLeaves(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	ctx, cancel := context.WithCancel(req.Context())
+	cancel()
+	d := &dripWriter{ResponseWriter: httptest.NewRecorder(), r: req.WithContext(ctx), drip: dripConfig{Bytes: 1, Delay: time.Hour}}
+	if n, err := d.Write([]byte("abc")); n != 1 || err == nil {
+		t.Errorf("Expected to stop after the first byte, wrote %d: %v", n, err)
+	}
+}
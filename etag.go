@@ -0,0 +1,61 @@
+package moat
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+)
+
+// --- ETags ---
+//
+// Record, person and section GETs carry an ETag built from when the parts of
+// the record they show last changed and the store's write count for them (so
+// writes under a frozen clock still change it), plus what the caller may see
+// and the response type, so a client's cached copy is only reused for the same
+// view. A matching If-None-Match gets 304 with no body.
+
+// recordSections is everything /record shows: the person and every activity
+// section
+var recordSections = append([]string{""}, activitySections...)
+
+// etagFor returns the ETag of r's view of sections of orcid's record
+func etagFor(r *http.Request, orcid string, sections ...string) (string, bool) {
+	modified, ok := storeFor(r).Modified(orcid, sections...)
+	if !ok {
+		return "", false
+	}
+	version, _ := storeFor(r).Version(orcid, sections...)
+	v := viewerFor(r, orcid)
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s|%s|%t|%s", r.URL.Path, responseType(r), v.limited, v.clientID)
+	return fmt.Sprintf(`"%x-%x-%x"`, modified.UnixNano(), version, h.Sum32()), true
+}
+
+// notModified sets the ETag for r's view of sections of orcid's record, and
+// answers 304 if the client already has it. It reports whether the response
+// has been written.
+func notModified(w http.ResponseWriter, r *http.Request, orcid string, sections ...string) bool {
+	etag, ok := etagFor(r, orcid, sections...)
+	if !ok {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	if !etagMatches(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, comparing
+// weakly as RFC 9110 asks
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
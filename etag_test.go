@@ -0,0 +1,87 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETags(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	get := func(path, accept, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, section := range []string{"record", "person", "activities", "fundings", "address"} {
+		path := "/v3.0/" + orcid + "/" + section
+		etag := get(path, "application/json", "").Header().Get("ETag")
+		if etag == "" {
+			t.Fatalf("Expected an ETag on %s", path)
+		}
+		if w := get(path, "application/json", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Errorf("Expected 304 with no body for %s, got %v", path, w.Code)
+		}
+		if w := get(path, "application/json", `"stale", W/`+etag); w.Code != http.StatusNotModified {
+			t.Errorf("Expected a weak match in a list to count for %s, got %v", path, w.Code)
+		}
+		if w := get(path, "application/xml", etag); w.Code != http.StatusOK {
+			t.Errorf("Expected the XML view of %s to have its own ETag, got %v", path, w.Code)
+		}
+	}
+
+	// A write to a section changes the ETags that cover it, and only those
+	record := get("/v3.0/"+orcid+"/record", "application/json", "").Header().Get("ETag")
+	person := get("/v3.0/"+orcid+"/person", "application/json", "").Header().Get("ETag")
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/funding", strings.NewReader(`{"type": "grant", "title": {"title": {"value": "New Grant"}}}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if w := get("/v3.0/"+orcid+"/record", "application/json", record); w.Code != http.StatusOK {
+		t.Errorf("Expected the record to have changed, got %v", w.Code)
+	}
+	if w := get("/v3.0/"+orcid+"/person", "application/json", person); w.Code != http.StatusNotModified {
+		t.Errorf("Expected the person to be unchanged, got %v", w.Code)
+	}
+}
+
+func TestETagFrozenClock(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	clock.Set(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true)
+	t.Cleanup(clock.Reset)
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	do := func(method, path, body, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/v3.0/"+orcid+"/funding", `{"type": "grant", "title": {"title": {"value": "Frozen Grant"}}}`, "")
+	loc := w.Header().Get("Location")
+	item := loc[strings.Index(loc, "/v3.0/"):]
+	etag := do("GET", "/v3.0/"+orcid+"/fundings", "", "").Header().Get("ETag")
+
+	do("PUT", item, `{"type": "grant", "title": {"title": {"value": "Thawed Grant"}}}`, "")
+	if w := do("GET", "/v3.0/"+orcid+"/fundings", "", etag); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Expected a PUT under a frozen clock to change the ETag, got %v %s", w.Code, w.Header().Get("ETag"))
+	}
+}
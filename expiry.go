@@ -0,0 +1,55 @@
+package moat
+
+import (
+	"log/slog"
+	"time"
+)
+
+// --- Expiry of Created Data ---
+//
+// A long-lived shared instance gains items with every CI run that posts to
+// it. With MOAT_ITEM_TTL set (seconds or a Go duration), items created
+// through the API (activities, bulk works, notifications and group-id
+// records) expire that long after creation, and a background sweep removes
+// them. Seeded and imported items never expire, and updating an item keeps
+// its original expiry.
+
+// itemTTL is how long created items live; 0 keeps them forever
+var itemTTL time.Duration
+
+func getItemTTL() (time.Duration, error) {
+	return envDuration("MOAT_ITEM_TTL")
+}
+
+// createdItem returns a new Item for data created through the API, due to
+// expire after itemTTL
+func createdItem(putCode int, data []byte) *Item {
+	it := &Item{PutCode: putCode, Data: data, Modified: clock.Now()}
+	if itemTTL > 0 {
+		it.Expires = it.Modified.Add(itemTTL)
+	}
+	return it
+}
+
+// sweepInterval is how often expired items are looked for: a tenth of the
+// TTL, between a second and a minute
+func sweepInterval(ttl time.Duration) time.Duration {
+	return min(max(ttl/10, time.Second), time.Minute)
+}
+
+// startExpiry makes created items expire after ttl and starts the sweep
+func startExpiry(ttl time.Duration) {
+	itemTTL = ttl
+	go func() {
+		for range time.Tick(sweepInterval(ttl)) {
+			now := clock.Now()
+			n := store.ExpireItems(now)
+			for _, s := range tenantStores() {
+				n += s.ExpireItems(now)
+			}
+			if n > 0 {
+				slog.Info("Expired created items", "count", n)
+			}
+		}
+	}()
+}
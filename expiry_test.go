@@ -0,0 +1,49 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreatedItemsExpire(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() {
+		itemTTL = 0
+		store.Restore(saved)
+	})
+	itemTTL = time.Hour
+	handler := setupRouter()
+	orcid := "0000-0006-9009-0000"
+
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/funding", strings.NewReader(`{"type": "award", "title": {"title": {"value": "Prize"}}}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v", w.Code)
+	}
+	item := w.Header().Get("Location")
+	item = item[strings.Index(item, "/v3.0/"):]
+
+	// An update keeps the original expiry
+	req = httptest.NewRequest("PUT", item, strings.NewReader(`{"type": "grant"}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if n := store.ExpireItems(time.Now()); n != 0 {
+		t.Errorf("Expected nothing to expire yet, removed %d", n)
+	}
+	if n := store.ExpireItems(time.Now().Add(2 * time.Hour)); n != 1 {
+		t.Errorf("Expected only the created funding to expire, removed %d", n)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", item, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the expired funding to be gone, got %v", w.Code)
+	}
+	if _, ok := loadActivity[GenericWorkResponse](store, "0000-0001-2345-6789", sectionWork, 123456); !ok {
+		t.Error("Expected seeded items to be kept")
+	}
+}
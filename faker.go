@@ -0,0 +1,139 @@
+package moat
+
+import (
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand/v2"
+	"os"
+	"strconv"
+)
+
+// --- Fake Researchers ---
+//
+// MOAT_SEED_COUNT=n adds n generated researchers at startup, each with a
+// handful of works, an employment and usually an education, so search,
+// pagination and load tests have more than six people to work with. The
+// names and institutions come from small built-in lists rather than a faker
+// library.
+
+// fakeORCIDBase is the sequence number generated iDs start after, well clear
+// of the demo users and fixture templates
+const fakeORCIDBase = 800_000_000
+
+var (
+	fakeGivenNames = []string{
+		"Amara", "Björn", "Camila", "Dmitri", "Emeka", "Fatima", "Gabriel", "Hana",
+		"Ibrahim", "Julia", "Kenji", "Leila", "Mateo", "Nadia", "Oscar", "Priyanka",
+		"Quentin", "Rosa", "Sven", "Tanvi", "Umar", "Valentina", "William", "Xin",
+		"Yara", "Zoltan", "Aisha", "Lucas", "Mei", "Noah",
+	}
+	fakeFamilyNames = []string{
+		"Okafor", "Lindqvist", "Rodríguez", "Ivanov", "Nwosu", "Haddad", "Silva", "Tanaka",
+		"Kowalski", "Müller", "Nakamura", "Rahimi", "Fernández", "Kaur", "O'Brien", "Dubois",
+		"Andersen", "Rossi", "Nguyen", "Mehta", "Khan", "Moreau", "Zhang", "Novak",
+		"Park", "Horvath", "Mensah", "Costa", "Wong", "Schmidt",
+	}
+	fakeInstitutions = []Org{
+		{Name: "University of Oxford", Address: &OrgAddress{City: "Oxford", Country: "GB"}},
+		{Name: "Massachusetts Institute of Technology", Address: &OrgAddress{City: "Cambridge", Region: "MA", Country: "US"}},
+		{Name: "University of Tokyo", Address: &OrgAddress{City: "Tokyo", Country: "JP"}},
+		{Name: "ETH Zurich", Address: &OrgAddress{City: "Zurich", Country: "CH"}},
+		{Name: "University of Cape Town", Address: &OrgAddress{City: "Cape Town", Country: "ZA"}},
+		{Name: "Universidade de São Paulo", Address: &OrgAddress{City: "São Paulo", Country: "BR"}},
+		{Name: "University of Toronto", Address: &OrgAddress{City: "Toronto", Region: "ON", Country: "CA"}},
+		{Name: "Sorbonne Université", Address: &OrgAddress{City: "Paris", Country: "FR"}},
+		{Name: "University of Melbourne", Address: &OrgAddress{City: "Melbourne", Region: "VIC", Country: "AU"}},
+		{Name: "Indian Institute of Science", Address: &OrgAddress{City: "Bangalore", Country: "IN"}},
+		{Name: "University of Oregon", Address: &OrgAddress{City: "Eugene", Region: "OR", Country: "US"}},
+		{Name: "Karolinska Institutet", Address: &OrgAddress{City: "Stockholm", Country: "SE"}},
+	}
+	fakeFields = []string{
+		"Physics", "Chemistry", "Computer Science", "Biology", "History",
+		"Mathematics", "Economics", "Linguistics", "Neuroscience", "Geology",
+	}
+	fakeRoles     = []string{"Professor", "Associate Professor", "Lecturer", "Research Fellow", "Postdoctoral Researcher", "Research Scientist"}
+	fakeDegrees   = []string{"PhD", "MSc", "BSc", "MA"}
+	fakeAdjs      = []string{"Scalable", "Robust", "Novel", "Comparative", "Longitudinal", "Bayesian", "Distributed", "Early"}
+	fakeTopics    = []string{"Inference", "Dynamics", "Networks", "Synthesis", "Modelling", "Measurement", "Archives", "Signalling"}
+	fakeContexts  = []string{"in Coastal Ecosystems", "for Open Science", "under Uncertainty", "in Medieval Europe", "at Low Temperature", "in Urban Populations"}
+	fakeWorkTypes = []string{"journal-article", "journal-article", "journal-article", "book-chapter", "conference-paper", "data-set", "preprint"}
+)
+
+// getSeedCount parses MOAT_SEED_COUNT, returning 0 when it is unset
+func getSeedCount() (int, error) {
+	v := os.Getenv("MOAT_SEED_COUNT")
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("MOAT_SEED_COUNT must be a non-negative number, got %q", v)
+	}
+	return n, nil
+}
+
+func pick[T any](rng *mathrand.Rand, list []T) T {
+	return list[rng.IntN(len(list))]
+}
+
+// seedFakeResearchers adds n generated researchers to the store
+func seedFakeResearchers(n int, rng *mathrand.Rand) {
+	thisYear := clock.Now().UTC().Year()
+	for i := 1; i <= n; i++ {
+		orcid := orcidFromNumber(fakeORCIDBase + i)
+		given, family := pick(rng, fakeGivenNames), pick(rng, fakeFamilyNames)
+		field := pick(rng, fakeFields)
+		bio := fmt.Sprintf("%s %s works in %s.", given, family, field)
+		store.AddUser(orcid, createMockPerson(orcid, given, family, bio))
+
+		for range 1 + rng.IntN(8) {
+			putCode := ids.PutCode(orcid)
+			title := fmt.Sprintf("%s %s %s", pick(rng, fakeAdjs), pick(rng, fakeTopics), pick(rng, fakeContexts))
+			work := GenericWorkResponse{
+				Type:            pick(rng, fakeWorkTypes),
+				PutCode:         putCode,
+				Title:           Title{Title: Value{Value: title}},
+				PublicationDate: DateYear{Year: Value{Value: strconv.Itoa(thisYear - rng.IntN(25))}},
+				ExternalIDs: &ExternalIDs{ExternalID: []ExternalID{{
+					Type:         "doi",
+					Value:        fmt.Sprintf("10.5555/moat.%d", putCode),
+					URL:          &Value{Value: fmt.Sprintf("https://doi.org/10.5555/moat.%d", putCode)},
+					Relationship: "self",
+				}}},
+				Contributors: &WorkContributors{Contributor: []WorkContributor{{
+					ContributorORCID: &OrcidIdentifier{Uri: "https://orcid.org/" + orcid, Path: orcid, Host: "orcid.org"},
+					CreditName:       &Value{Value: given + " " + family},
+					Attributes:       &ContributorAttributes{Sequence: "first", Role: "author"},
+				}}},
+			}
+			data, _ := json.Marshal(work)
+			store.PutItem(orcid, sectionWork, putCode, data)
+		}
+
+		start := thisYear - 1 - rng.IntN(20)
+		emp := GenericEmploymentResponse{Affiliation: Affiliation{
+			PutCode:        ids.PutCode(orcid),
+			DepartmentName: "Department of " + field,
+			RoleTitle:      pick(rng, fakeRoles),
+			Organization:   pick(rng, fakeInstitutions),
+			StartDate:      &DateYear{Year: Value{Value: strconv.Itoa(start)}},
+		}}
+		data, _ := json.Marshal(emp)
+		store.PutItem(orcid, sectionEmployment, emp.PutCode, data)
+
+		// Most researchers also studied somewhere, which search reports as a
+		// past institution
+		if rng.IntN(4) > 0 {
+			edu := GenericEducationResponse{Affiliation: Affiliation{
+				PutCode:        ids.PutCode(orcid),
+				DepartmentName: field,
+				RoleTitle:      pick(rng, fakeDegrees),
+				Organization:   pick(rng, fakeInstitutions),
+				StartDate:      &DateYear{Year: Value{Value: strconv.Itoa(start - 6)}},
+				EndDate:        &DateYear{Year: Value{Value: strconv.Itoa(start - 1)}},
+			}}
+			data, _ := json.Marshal(edu)
+			store.PutItem(orcid, sectionEducation, edu.PutCode, data)
+		}
+	}
+}
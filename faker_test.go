@@ -0,0 +1,44 @@
+package moat
+
+import (
+	"testing"
+)
+
+func TestSeedFakeResearchers(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	before := len(store.ORCIDs())
+
+	seedFakeResearchers(25, ids.Rand())
+
+	if got := len(store.ORCIDs()) - before; got != 25 {
+		t.Fatalf("Expected 25 new researchers, got %d", got)
+	}
+	for i := 1; i <= 25; i++ {
+		rec, ok := store.Record(orcidFromNumber(fakeORCIDBase + i))
+		if !ok {
+			t.Fatalf("Expected researcher %d", i)
+		}
+		if rec.Person.Name == nil || rec.Person.Name.GivenNames == "" {
+			t.Errorf("Expected a name for researcher %d", i)
+		}
+		if len(rec.Activities.Works.Group) == 0 || len(rec.Activities.Employment.AffiliationGroup) != 1 {
+			t.Errorf("Expected works and an employment for researcher %d, got %+v", i, rec.Activities)
+		}
+	}
+
+	if hits := searchStore(store, "*"); len(hits) < 25 {
+		t.Errorf("Expected the generated researchers to be searchable, got %d hits", len(hits))
+	}
+}
+
+func TestGetSeedCount(t *testing.T) {
+	t.Setenv("MOAT_SEED_COUNT", "500")
+	if n, err := getSeedCount(); err != nil || n != 500 {
+		t.Errorf("Expected 500, got %d (%v)", n, err)
+	}
+	t.Setenv("MOAT_SEED_COUNT", "lots")
+	if _, err := getSeedCount(); err == nil {
+		t.Error("Expected an error for a non-numeric count")
+	}
+}
@@ -0,0 +1,269 @@
+package moat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	mathrand "math/rand/v2"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"moat/orciderr"
+)
+
+// --- Fault Injection ---
+//
+// Fault rules make matching requests fail with a chosen status, so clients'
+// retry and error handling can be exercised: "the next 3 POSTs to a work
+// get 503", or "5% of everything gets 500". Rules come from MOAT_FAULTS at
+// startup or /__admin/faults at runtime; the first rule that matches a
+// request decides. /__admin/ itself is never faulted.
+
+// FaultRule describes which requests fail and how
+type FaultRule struct {
+	ID int `json:"id"`
+	// Method matches the request method; empty matches any
+	Method string `json:"method,omitempty"`
+	// Path is a path.Match pattern such as /v3.0/*/work; empty matches any
+	Path string `json:"path,omitempty"`
+	// Status is the HTTP status to answer with
+	Status int `json:"status,omitempty"`
+	// ErrorCode picks the ORCID error body; by default it follows Status
+	ErrorCode orciderr.Code `json:"error_code,omitempty"`
+	// Count is how many more requests fail before the rule is dropped; zero
+	// means no limit
+	Count int `json:"count,omitempty"`
+	// Rate is the fraction of matching requests that fail; zero means all
+	Rate float64 `json:"rate,omitempty"`
+}
+
+type faultFile struct {
+	Faults []FaultRule `json:"faults"`
+}
+
+var (
+	faults      []*FaultRule
+	seedFaults  []FaultRule
+	nextFaultID = 1
+	faultRand   *mathrand.Rand
+	faultMutex  sync.Mutex
+)
+
+// faultStatusCodes are the ORCID errors sent for statuses ORCID uses
+var faultStatusCodes = map[int]orciderr.Code{
+	http.StatusTooManyRequests:     orciderr.TooManyRequests,
+	http.StatusInternalServerError: orciderr.InternalError,
+	http.StatusServiceUnavailable:  orciderr.ServiceUnavailable,
+}
+
+// validate checks f and fills in the status from its error code
+func (f *FaultRule) validate() error {
+	if f.ErrorCode != 0 {
+		if _, ok := orciderr.Lookup(f.ErrorCode); !ok {
+			return fmt.Errorf("unknown error_code %d", f.ErrorCode)
+		}
+		if f.Status == 0 {
+			f.Status = f.ErrorCode.Status()
+		}
+	}
+	switch {
+	case f.Status < 100 || f.Status > 599:
+		return errors.New("status must be an HTTP status code")
+	case f.Count < 0:
+		return errors.New("count must not be negative")
+	case f.Rate < 0 || f.Rate > 1:
+		return errors.New("rate must be between 0 and 1")
+	}
+	if _, err := path.Match(f.Path, ""); err != nil {
+		return fmt.Errorf("invalid path pattern %q", f.Path)
+	}
+	return nil
+}
+
+// matches reports whether r is one of the requests f applies to
+func (f *FaultRule) matches(r *http.Request) bool {
+	return matchRequest(r, f.Method, f.Path)
+}
+
+// matchRequest reports whether r has method and a path matching pattern;
+// empty ones match anything
+func matchRequest(r *http.Request, method, pattern string) bool {
+	if method != "" && !strings.EqualFold(method, r.Method) {
+		return false
+	}
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, r.URL.Path)
+	return ok
+}
+
+// addFault registers f, returning it with its id
+func addFault(f FaultRule) FaultRule {
+	faultMutex.Lock()
+	defer faultMutex.Unlock()
+	f.ID = nextFaultID
+	nextFaultID++
+	faults = append(faults, &f)
+	return f
+}
+
+// loadFaults reads a fault file; its rules are also the ones
+// POST /__admin/reset returns to
+func loadFaults(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var f faultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	for i := range f.Faults {
+		if err := f.Faults[i].validate(); err != nil {
+			return fmt.Errorf("fault %d: %w", i, err)
+		}
+		seedFaults = append(seedFaults, addFault(f.Faults[i]))
+	}
+	return nil
+}
+
+// resetFaults puts the rules back to those loaded at startup
+func resetFaults() {
+	faultMutex.Lock()
+	defer faultMutex.Unlock()
+	faults = nil
+	for _, f := range seedFaults {
+		faults = append(faults, &f)
+	}
+}
+
+// listFaults returns a copy of the current rules
+func listFaults() []FaultRule {
+	faultMutex.Lock()
+	defer faultMutex.Unlock()
+	list := make([]FaultRule, len(faults))
+	for i, f := range faults {
+		list[i] = *f
+	}
+	return list
+}
+
+// removeFault drops the rule with id, reporting whether there was one
+func removeFault(id int) bool {
+	faultMutex.Lock()
+	defer faultMutex.Unlock()
+	for i, f := range faults {
+		if f.ID == id {
+			faults = append(faults[:i], faults[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// clearFaults drops every rule
+func clearFaults() {
+	faultMutex.Lock()
+	defer faultMutex.Unlock()
+	faults = nil
+}
+
+// faultFor returns the rule r should fail by, if any, using up one of its
+// count
+func faultFor(r *http.Request) (FaultRule, bool) {
+	if strings.HasPrefix(r.URL.Path, "/__admin/") {
+		return FaultRule{}, false
+	}
+	faultMutex.Lock()
+	defer faultMutex.Unlock()
+	for i, f := range faults {
+		if !f.matches(r) {
+			continue
+		}
+		if f.Rate > 0 {
+			if faultRand == nil {
+				faultRand = ids.Rand()
+			}
+			if faultRand.Float64() >= f.Rate {
+				continue
+			}
+		}
+		rule := *f
+		if f.Count > 0 {
+			if f.Count--; f.Count == 0 {
+				faults = append(faults[:i], faults[i+1:]...)
+			}
+		}
+		return rule, true
+	}
+	return FaultRule{}, false
+}
+
+// injectFault answers r with a fault if a rule applies, reporting whether it
+// did. /v3.0/ gets ORCID's error body, /oauth/ an RFC 6749 error, and
+// anything else plain text.
+func injectFault(w http.ResponseWriter, r *http.Request) bool {
+	f, ok := faultFor(r)
+	if !ok {
+		return false
+	}
+	message := fmt.Sprintf("%d %s: injected fault %d", f.Status, http.StatusText(f.Status), f.ID)
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v3.0/"):
+		code := f.ErrorCode
+		if code == 0 {
+			code = faultStatusCodes[f.Status]
+		}
+		e := orciderr.New(code)
+		if code == 0 {
+			e.DeveloperMessage = message
+		}
+		e.ResponseCode = f.Status
+		writeError(w, r, e)
+	case strings.HasPrefix(r.URL.Path, "/oauth/"):
+		writeOAuthError(w, f.Status, "server_error", message)
+	default:
+		http.Error(w, message, f.Status)
+	}
+	return true
+}
+
+// handleAdminListFaults lists the fault rules in the order they're tried
+func handleAdminListFaults(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, listFaults())
+}
+
+// handleAdminAddFault adds a fault rule after the existing ones
+func handleAdminAddFault(w http.ResponseWriter, r *http.Request) {
+	var f FaultRule
+	if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+		http.Error(w, "Invalid fault: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := f.validate(); err != nil {
+		http.Error(w, "Invalid fault: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeResponseStatus(w, r, http.StatusCreated, addFault(f))
+}
+
+// handleAdminDeleteFault removes one fault rule
+func handleAdminDeleteFault(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || !removeFault(id) {
+		http.Error(w, "Fault not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminClearFaults removes every fault rule
+func handleAdminClearFaults(w http.ResponseWriter, r *http.Request) {
+	clearFaults()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,116 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"moat/orciderr"
+)
+
+func TestFaultInjection(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	t.Cleanup(clearFaults)
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+	work := `{"type": "book", "title": {"title": {"value": "Retry Me"}}}`
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/__admin/faults", `{"method": "POST", "path": "/v3.0/*/work", "status": 503, "count": 2}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the fault to be added, got %v: %s", w.Code, w.Body)
+	}
+
+	if w := do("GET", "/v3.0/"+orcid+"/record", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected GETs to be unaffected, got %v", w.Code)
+	}
+	for i := range 2 {
+		w := do("POST", "/v3.0/"+orcid+"/work", work)
+		e, err := orciderr.Decode(w.Body)
+		if w.Code != http.StatusServiceUnavailable || err != nil || e.ErrorCode != orciderr.ServiceUnavailable {
+			t.Errorf("POST %d: expected 503 with 9041, got %v: %v, %v", i+1, w.Code, e, err)
+		}
+	}
+	if w := do("POST", "/v3.0/"+orcid+"/work", work); w.Code != http.StatusCreated {
+		t.Errorf("Expected the third POST to succeed, got %v: %s", w.Code, w.Body)
+	}
+	if list := listFaults(); len(list) != 0 {
+		t.Errorf("Expected the used-up rule to be dropped, got %+v", list)
+	}
+
+	// Every request, in each surface's own error format, until removed
+	do("POST", "/__admin/faults", `{"status": 500, "rate": 1}`)
+	if w := do("POST", "/oauth/token", "grant_type=client_credentials&client_id=APP-123"); w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"server_error"`) {
+		t.Errorf("Expected an OAuth server_error, got %v: %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/__admin/faults", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the admin API never to be faulted, got %v", w.Code)
+	}
+	if w := do("DELETE", "/__admin/faults/"+strconv.Itoa(listFaults()[0].ID), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the rule to be removed, got %v", w.Code)
+	}
+	if w := do("GET", "/v3.0/"+orcid+"/record", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected no faults after removal, got %v", w.Code)
+	}
+
+	// An ORCID error code sets the status too
+	do("POST", "/__admin/faults", `{"path": "/v3.0/*/person", "error_code": 9040, "rate": 0.5}`)
+	limited := 0
+	for range 200 {
+		if w := do("GET", "/v3.0/"+orcid+"/person", ""); w.Code == http.StatusTooManyRequests {
+			limited++
+		}
+	}
+	if limited < 50 || limited > 150 {
+		t.Errorf("Expected about half the requests to get 429, got %d of 200", limited)
+	}
+}
+
+func TestAdminAddFaultRejects(t *testing.T) {
+	handler := setupRouter()
+	for _, body := range []string{
+		`{"status": 42}`,
+		`{"status": 500, "rate": 2}`,
+		`{"status": 500, "count": -1}`,
+		`{"error_code": 1234}`,
+		`{"status": 500, "path": "/v3.0/[/work"}`,
+		`not json`,
+	} {
+		req := httptest.NewRequest("POST", "/__admin/faults", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, got %v", body, w.Code)
+		}
+	}
+}
+
+func TestLoadFaultsSurvivesReset(t *testing.T) {
+	t.Cleanup(func() {
+		seedFaults = nil
+		clearFaults()
+	})
+	path := filepath.Join(t.TempDir(), "faults.json")
+	os.WriteFile(path, []byte(`{"faults": [{"path": "/v3.0/search", "status": 502}]}`), 0o644)
+	if err := loadFaults(path); err != nil {
+		t.Fatal(err)
+	}
+
+	addFault(FaultRule{Status: 500})
+	resetFaults()
+	if list := listFaults(); len(list) != 1 || list[0].Status != 502 {
+		t.Errorf("Expected reset to keep only the loaded rule, got %+v", list)
+	}
+}
@@ -0,0 +1,247 @@
+package moat
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// --- Fixtures ---
+
+// Fixture is a file of users to seed the store with
+type Fixture struct {
+	Users []FixtureUser `json:"users"`
+}
+
+// FixtureUser is one researcher and the activities they start with
+type FixtureUser struct {
+	ORCID       string                      `json:"orcid"`
+	GivenNames  string                      `json:"given-names"`
+	FamilyName  string                      `json:"family-name"`
+	Biography   string                      `json:"biography"`
+	Emails      []string                    `json:"emails,omitempty"`
+	Works       []GenericWorkResponse       `json:"works"`
+	Employments []GenericEmploymentResponse `json:"employments"`
+}
+
+// fixtureFuncs are available to fixture templates (files ending in .tmpl)
+var fixtureFuncs = template.FuncMap{
+	// seq returns 1..n, for emitting n entries with range
+	"seq": func(n int) []int {
+		s := make([]int, n)
+		for i := range s {
+			s[i] = i + 1
+		}
+		return s
+	},
+	"add": func(a, b int) int { return a + b },
+	"sub": func(a, b int) int { return a - b },
+	"mul": func(a, b int) int { return a * b },
+
+	// Date arithmetic, written to read well in pipelines:
+	// {{ now | addYears -3 | date "2006" }}
+	"now":      func() time.Time { return clock.Now().UTC() },
+	"addDays":  func(n int, t time.Time) time.Time { return t.AddDate(0, 0, n) },
+	"addYears": func(n int, t time.Time) time.Time { return t.AddDate(n, 0, 0) },
+	"date":     func(layout string, t time.Time) string { return t.Format(layout) },
+
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+
+	// orcid builds a checksummed iD from a sequence number, e.g. orcid 42
+	// gives 0000-0000-0000-0423
+	"orcid": orcidFromNumber,
+}
+
+// loadFixtures seeds the store from MOAT_FIXTURES, which is either a fixture
+// file or a directory of records
+func loadFixtures(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return loadRecordDir(path)
+	}
+	return loadFixtureFile(path)
+}
+
+// loadRecordDir replaces the demo users with the records in dir, one full
+// OrcidRecord per .json or .xml file, as served by GET /record. Every file is
+// parsed before the store is touched, so a bad file changes nothing.
+func loadRecordDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var records []OrcidRecord
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".json" && ext != ".xml") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var rec OrcidRecord
+		if ext == ".xml" {
+			err = xml.Unmarshal(data, &rec)
+		} else {
+			err = json.Unmarshal(data, &rec)
+		}
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", path, err)
+		}
+		if rec.OrcidIdentifier.Path == "" {
+			rec.OrcidIdentifier.Path = rec.Person.Path
+		}
+		if rec.OrcidIdentifier.Path == "" {
+			return fmt.Errorf("%s: record has no orcid-identifier path", path)
+		}
+		records = append(records, rec)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("%s: no .json or .xml records found", dir)
+	}
+
+	store.Restore(Snapshot{})
+	for _, rec := range records {
+		seedRecord(rec)
+	}
+	return nil
+}
+
+// seedRecord adds a user from a full record. The activity summaries are
+// stored as the user's items, so they read back through the usual handlers.
+func seedRecord(rec OrcidRecord) {
+	orcid := rec.OrcidIdentifier.Path
+	rec.Person.Path = orcid
+	store.AddUser(orcid, rec.Person)
+
+	a := rec.Activities
+	for _, g := range a.Works.Group {
+		putSummaries(orcid, sectionWork, g.WorkSummary, func(v *WorkSummary) *int { return &v.PutCode })
+	}
+	for _, g := range a.Employment.AffiliationGroup {
+		putSummaries(orcid, sectionEmployment, g.Summaries, func(v *EmploymentSummary) *int { return &v.PutCode })
+	}
+	affiliations := map[string][]AffiliationSummary{}
+	for _, g := range a.Educations.AffiliationGroup {
+		affiliations[sectionEducation] = append(affiliations[sectionEducation], g.Summaries...)
+	}
+	for _, g := range a.InvitedPositions.AffiliationGroup {
+		affiliations[sectionInvitedPosition] = append(affiliations[sectionInvitedPosition], g.Summaries...)
+	}
+	for _, g := range a.Memberships.AffiliationGroup {
+		affiliations[sectionMembership] = append(affiliations[sectionMembership], g.Summaries...)
+	}
+	for _, g := range a.Qualifications.AffiliationGroup {
+		affiliations[sectionQualification] = append(affiliations[sectionQualification], g.Summaries...)
+	}
+	for section, list := range affiliations {
+		putSummaries(orcid, section, list, func(v *AffiliationSummary) *int { return &v.PutCode })
+	}
+	for _, g := range a.Fundings.Group {
+		putSummaries(orcid, sectionFunding, g.FundingSummary, func(v *FundingSummary) *int { return &v.PutCode })
+	}
+	for _, g := range a.PeerReviews.Group {
+		for _, d := range g.PeerReviewGroup {
+			putSummaries(orcid, sectionPeerReview, d.PeerReviewSummary, func(v *PeerReviewSummary) *int { return &v.PutCode })
+		}
+	}
+	for _, g := range a.ResearchResources.Group {
+		putSummaries(orcid, sectionResearchResource, g.ResearchResourceSummary, func(v *ResearchResourceSummary) *int { return &v.PutCode })
+	}
+}
+
+// putSummaries stores each summary as an item of section, keeping its
+// put-code or issuing one if it has none
+func putSummaries[T any](orcid, section string, list []T, putCode func(*T) *int) {
+	for i := range list {
+		pc := putCode(&list[i])
+		*pc = fixturePutCode(orcid, *pc)
+		data, _ := json.Marshal(list[i])
+		store.PutItem(orcid, section, *pc, data)
+	}
+}
+
+// loadFixtureFile seeds the store from one fixture file. Files ending in
+// .tmpl are expanded as Go templates before being parsed as JSON.
+func loadFixtureFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(path, ".tmpl") {
+		tmpl, err := template.New(filepath.Base(path)).Funcs(fixtureFuncs).Parse(string(data))
+		if err != nil {
+			return fmt.Errorf("parsing template %s: %w", path, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, nil); err != nil {
+			return fmt.Errorf("expanding template %s: %w", path, err)
+		}
+		data = buf.Bytes()
+	}
+
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for i, u := range f.Users {
+		if u.ORCID == "" || u.GivenNames == "" {
+			return fmt.Errorf("%s: user %d needs an orcid and given-names", path, i)
+		}
+		seedFixtureUser(store, u)
+	}
+	return nil
+}
+
+// seedFixtureUser adds u to s, replacing any user with the same iD
+func seedFixtureUser(s *Store, u FixtureUser) {
+	person := createMockPerson(u.ORCID, u.GivenNames, u.FamilyName, u.Biography)
+	if len(u.Emails) > 0 {
+		person.Emails = mockEmails(u.ORCID, u.Emails...)
+	}
+	s.AddUser(u.ORCID, person)
+
+	for _, work := range u.Works {
+		work.PutCode = fixturePutCode(u.ORCID, work.PutCode)
+		data, _ := json.Marshal(work)
+		s.PutItem(u.ORCID, sectionWork, work.PutCode, data)
+	}
+	for _, emp := range u.Employments {
+		emp.PutCode = fixturePutCode(u.ORCID, emp.PutCode)
+		data, _ := json.Marshal(emp)
+		s.PutItem(u.ORCID, sectionEmployment, emp.PutCode, data)
+	}
+}
+
+// fixturePutCode keeps a fixture's explicit put-code, or issues a new one
+func fixturePutCode(orcid string, putCode int) int {
+	if putCode == 0 {
+		return ids.PutCode(orcid)
+	}
+	ids.ReservePutCode(orcid, putCode)
+	return putCode
+}
+
+// orcidFromNumber formats n as a 15-digit base and appends the ISO 7064
+// Mod 11-2 check character
+func orcidFromNumber(n int) string {
+	base := fmt.Sprintf("%015d", n)
+	id := base + orcidCheckChar(base)
+	return id[0:4] + "-" + id[4:8] + "-" + id[8:12] + "-" + id[12:16]
+}
@@ -0,0 +1,81 @@
+package moat
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFixtureTemplate(t *testing.T) {
+	if err := loadFixtureFile("testdata/researchers.json.tmpl"); err != nil {
+		t.Fatalf("Failed to load fixture template: %v", err)
+	}
+
+	for n := 1; n <= 3; n++ {
+		orcid := orcidFromNumber(9000 + n)
+		rec, ok := store.Record(orcid)
+		if !ok {
+			t.Fatalf("Expected fixture user %s", orcid)
+		}
+		if rec.Person.Name.FamilyName != "Family" {
+			t.Errorf("Expected family name Family, got %s", rec.Person.Name.FamilyName)
+		}
+		if got := len(rec.Activities.Works.Group); got != 4 {
+			t.Errorf("Expected 4 works for %s, got %d", orcid, got)
+		}
+		if got := len(rec.Activities.Employment.AffiliationGroup); got != 1 {
+			t.Errorf("Expected 1 employment for %s, got %d", orcid, got)
+		}
+	}
+
+	items, _ := store.Items(orcidFromNumber(9001), sectionWork)
+	want := `"year":{"value":"` + time.Now().UTC().AddDate(-1, 0, 0).Format("2006") + `"}`
+	found := false
+	for _, it := range items {
+		if strings.Contains(string(it.Data), want) && strings.Contains(string(it.Data), "Paper 1 by tester1") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected a templated work dated last year for Paper 1")
+	}
+}
+
+func TestOrcidFromNumber(t *testing.T) {
+	if got := orcidFromNumber(21825009); got != "0000-0002-1825-0097" {
+		t.Errorf("Expected 0000-0002-1825-0097, got %s", got)
+	}
+}
+
+func TestLoadRecordDir(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+
+	if err := loadFixtures("testdata/records"); err != nil {
+		t.Fatalf("Failed to load records: %v", err)
+	}
+
+	if store.HasUser("0000-0001-2345-6789") {
+		t.Error("Expected the demo users to be replaced")
+	}
+
+	rec, ok := store.Record("0000-0007-1111-2222")
+	if !ok || rec.Person.Name == nil || rec.Person.Name.GivenNames != "Ada" {
+		t.Fatalf("Expected Ada's record from JSON, got %+v", rec.Person.Name)
+	}
+	if len(rec.Activities.Works.Group) != 1 || len(rec.Activities.Employment.AffiliationGroup) != 1 {
+		t.Errorf("Expected one work and one employment, got %+v", rec.Activities)
+	}
+	work, ok := loadActivity[GenericWorkResponse](store, "0000-0007-1111-2222", sectionWork, 700001)
+	if !ok || work.Title.Title.Value != "Notes on the Analytical Engine" {
+		t.Errorf("Expected the work to read back in full, got %+v", work)
+	}
+
+	rec, ok = store.Record("0000-0007-3333-4444")
+	if !ok || rec.Person.Name == nil || rec.Person.Name.FamilyName != "Babbage" {
+		t.Fatalf("Expected Charles's record from XML, got %+v", rec.Person.Name)
+	}
+	if len(rec.Activities.Works.Group) != 1 || rec.Activities.Works.Group[0].WorkSummary[0].Title.Title.Value != "On the Economy of Machinery" {
+		t.Errorf("Expected Charles's work, got %+v", rec.Activities.Works)
+	}
+}
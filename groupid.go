@@ -0,0 +1,190 @@
+package moat
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"moat/orciderr"
+)
+
+// --- Group ID Records ---
+//
+// Peer reviews reference a group (usually a journal) by its group-id, which
+// must exist before the review is deposited. Group-id records are global
+// rather than per user, and are kept in the store's groups.
+
+const defaultGroupPageSize = 100
+
+type GroupIDRecord struct {
+	XMLName     xml.Name `json:"-" xml:"group-id:group-id-record"`
+	PutCode     int      `json:"put-code" xml:"put-code"`
+	Name        string   `json:"name" xml:"name"`
+	GroupID     string   `json:"group-id" xml:"group-id"`
+	Description string   `json:"description" xml:"description"`
+	Type        string   `json:"type" xml:"type"`
+}
+
+type GroupIDRecordsResponse struct {
+	XMLName  xml.Name        `json:"-" xml:"group-id:group-id-records"`
+	Total    int             `json:"total" xml:"total"`
+	Page     int             `json:"page" xml:"page"`
+	PageSize int             `json:"page-size" xml:"page-size"`
+	Records  []GroupIDRecord `json:"group-id-record" xml:"group-id-record"`
+}
+
+// groupRecordRoutes serves /v3.0/group-id-record and its put-codes
+func groupRecordRoutes() *routeMux {
+	mux := newRouteMux()
+	mux.HandleFunc("GET /v3.0/group-id-record", handleListGroups)
+	mux.HandleFunc("POST /v3.0/group-id-record", handlePostGroup)
+	mux.HandleFunc("GET /v3.0/group-id-record/{putCode}", handleGetGroup)
+	mux.HandleFunc("PUT /v3.0/group-id-record/{putCode}", handlePutGroup)
+	mux.HandleFunc("DELETE /v3.0/group-id-record/{putCode}", handleDeleteGroup)
+	return mux
+}
+
+func groupLocation(putCode int) string {
+	return fmt.Sprintf("https://api.orcid.org/v3.0/group-id-record/%d", putCode)
+}
+
+func decodeGroups(items []*Item) []GroupIDRecord {
+	return decodeItems[GroupIDRecord](items, nil)
+}
+
+// readGroup decodes and checks a submitted group-id record
+func readGroup(r *http.Request) (GroupIDRecord, error) {
+	var g GroupIDRecord
+	if err := json.NewDecoder(r.Body).Decode(&g); err != nil {
+		return g, fmt.Errorf("invalid group-id-record payload")
+	}
+	if g.Name == "" || g.GroupID == "" || g.Type == "" {
+		return g, fmt.Errorf("name, group-id and type are required")
+	}
+	return g, nil
+}
+
+// handleListGroups returns one page of group-id records, optionally filtered
+// by a case-insensitive name match
+func handleListGroups(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := strings.ToLower(q.Get("name"))
+	page, err := strconv.Atoi(q.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(q.Get("page-size"))
+	if err != nil || pageSize < 1 {
+		pageSize = defaultGroupPageSize
+	}
+
+	var matched []GroupIDRecord
+	for _, g := range decodeGroups(storeFor(r).Groups()) {
+		if name == "" || strings.Contains(strings.ToLower(g.Name), name) {
+			matched = append(matched, g)
+		}
+	}
+
+	resp := GroupIDRecordsResponse{Total: len(matched), Page: page, PageSize: pageSize}
+	if start := (page - 1) * pageSize; start < len(matched) {
+		resp.Records = matched[start:min(start+pageSize, len(matched))]
+	}
+	writeResponse(w, r, resp)
+}
+
+func handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	putCode, err := strconv.Atoi(r.PathValue("putCode"))
+	if err != nil {
+		writeError(w, r, itemNotFound("group-id-record", r.PathValue("putCode")))
+		return
+	}
+	for _, g := range decodeGroups(storeFor(r).Groups()) {
+		if g.PutCode == putCode {
+			writeResponse(w, r, g)
+			return
+		}
+	}
+	writeError(w, r, itemNotFound("group-id-record", r.PathValue("putCode")))
+}
+
+func handlePostGroup(w http.ResponseWriter, r *http.Request) {
+	g, err := readGroup(r)
+	if err != nil {
+		writeError(w, r, invalidPayload("group-id-record", err))
+		return
+	}
+
+	err = storeFor(r).UpdateGroups(func(items map[int]*Item) error {
+		for _, existing := range decodeGroups(sortedItems(items)) {
+			if existing.GroupID == g.GroupID {
+				return fmt.Errorf("group-id %s already exists", g.GroupID)
+			}
+		}
+		g.PutCode = ids.PutCode("")
+		data, _ := json.Marshal(g)
+		items[g.PutCode] = createdItem(g.PutCode, data)
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, orciderr.Newf(orciderr.DuplicateExternalID, "Conflict: %v", err))
+		return
+	}
+
+	w.Header().Set("Location", groupLocation(g.PutCode))
+	writeResponseStatus(w, r, http.StatusCreated, g)
+}
+
+func handlePutGroup(w http.ResponseWriter, r *http.Request) {
+	putCode, err := strconv.Atoi(r.PathValue("putCode"))
+	if err != nil {
+		writeError(w, r, itemNotFound("group-id-record", r.PathValue("putCode")))
+		return
+	}
+	g, err := readGroup(r)
+	if err != nil {
+		writeError(w, r, invalidPayload("group-id-record", err))
+		return
+	}
+	if g.PutCode != 0 && g.PutCode != putCode {
+		writeError(w, r, orciderr.New(orciderr.PutCodeMismatch))
+		return
+	}
+
+	err = storeFor(r).UpdateGroups(func(items map[int]*Item) error {
+		old, ok := items[putCode]
+		if !ok {
+			return errItemNotFound
+		}
+		g.PutCode = putCode
+		data, _ := json.Marshal(g)
+		items[putCode] = &Item{PutCode: putCode, Data: data, Modified: clock.Now(), Expires: old.Expires}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, itemNotFound("group-id-record", r.PathValue("putCode")))
+		return
+	}
+
+	w.Header().Set("Location", groupLocation(putCode))
+	writeResponse(w, r, g)
+}
+
+func handleDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	putCode, err := strconv.Atoi(r.PathValue("putCode"))
+	found := false
+	if err == nil {
+		storeFor(r).UpdateGroups(func(items map[int]*Item) error {
+			_, found = items[putCode]
+			delete(items, putCode)
+			return nil
+		})
+	}
+	if !found {
+		writeError(w, r, itemNotFound("group-id-record", r.PathValue("putCode")))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
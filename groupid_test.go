@@ -0,0 +1,63 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGroupIDRecordLifecycle(t *testing.T) {
+	handler := setupRouter()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	group := `{"name": "Journal of Mock Results", "group-id": "issn:0000-0001", "description": "Mock journal", "type": "journal"}`
+	w := do("POST", "/v3.0/group-id-record", group)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v", w.Code)
+	}
+	var created GroupIDRecord
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil || created.PutCode == 0 {
+		t.Fatalf("Expected created group with put-code: %v", err)
+	}
+	if w := do("POST", "/v3.0/group-id-record", group); w.Code != http.StatusConflict {
+		t.Errorf("Expected status Conflict for duplicate group-id, got %v", w.Code)
+	}
+	if w := do("POST", "/v3.0/group-id-record", `{"name": "No type"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status Bad Request for incomplete group, got %v", w.Code)
+	}
+
+	w = do("GET", "/v3.0/group-id-record?name=mock+results", "")
+	var list GroupIDRecordsResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode group list: %v", err)
+	}
+	if list.Total != 1 || list.Records[0].GroupID != "issn:0000-0001" {
+		t.Errorf("Expected one matching group, got %+v", list)
+	}
+
+	item := "/v3.0/group-id-record/" + strconv.Itoa(created.PutCode)
+	w = do("PUT", item, `{"name": "Journal of Mock Findings", "group-id": "issn:0000-0001", "description": "Renamed", "type": "journal"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status OK on PUT, got %v", w.Code)
+	}
+	if w := do("GET", item, ""); !strings.Contains(w.Body.String(), "Mock Findings") {
+		t.Errorf("Expected renamed group, got %s", w.Body.String())
+	}
+
+	if w := do("DELETE", item, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status No Content, got %v", w.Code)
+	}
+	if w := do("GET", item, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found after DELETE, got %v", w.Code)
+	}
+}
@@ -0,0 +1,159 @@
+package moat
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	mathrand "math/rand/v2"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// --- Identifier Generation ---
+
+// IDService hands out put-codes, authorization codes and tokens. Put-codes
+// count up from minPutCode in a sequence per record, skipping any already
+// reserved, and are never handed out twice, even under concurrent requests.
+// Codes and tokens come from crypto/rand, or from a seeded PRNG after Seed;
+// tokens carry 122 random bits, so they aren't remembered, and issueCode
+// checks codes against the ones outstanding.
+type IDService struct {
+	mu       sync.Mutex
+	putCodes map[string]*putCodeSeq
+	// rng replaces crypto/rand once seeded
+	rng *mathrand.Rand
+}
+
+// NewIDService returns an IDService with nothing issued yet
+func NewIDService() *IDService {
+	return &IDService{
+		putCodes: make(map[string]*putCodeSeq),
+	}
+}
+
+const (
+	minPutCode  = 100000
+	authCodeLen = 6
+	authCodeSet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// putCodeSeq is one record's put-codes: the next to try, and every one taken
+type putCodeSeq struct {
+	next  int
+	taken map[int]struct{}
+}
+
+// seq returns orcid's put-code sequence; callers must hold mu. Items that
+// belong to no record, like group-id records, use the "" sequence.
+func (s *IDService) seq(orcid string) *putCodeSeq {
+	q, ok := s.putCodes[orcid]
+	if !ok {
+		q = &putCodeSeq{next: minPutCode, taken: make(map[int]struct{})}
+		s.putCodes[orcid] = q
+	}
+	return q
+}
+
+// Seed makes every later value come from a PRNG seeded with seed, so a run
+// that makes the same requests in the same order gets the same values
+func (s *IDService) Seed(seed uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rng = mathrand.New(mathrand.NewPCG(seed, seed))
+}
+
+// Rand returns a PRNG for other generated data. After Seed it is derived
+// from the seed; otherwise it is seeded from crypto/rand.
+func (s *IDService) Rand() *mathrand.Rand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.randomBytes(16)
+	return mathrand.New(mathrand.NewPCG(binary.LittleEndian.Uint64(b[:8]), binary.LittleEndian.Uint64(b[8:])))
+}
+
+// ReservePutCode marks one of orcid's put-codes as taken, e.g. for seeded
+// items
+func (s *IDService) ReservePutCode(orcid string, putCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq(orcid).taken[putCode] = struct{}{}
+}
+
+// PutCode returns the next of orcid's put-codes that has never been issued
+// or reserved
+func (s *IDService) PutCode(orcid string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := s.seq(orcid)
+	for {
+		putCode := q.next
+		q.next++
+		if _, taken := q.taken[putCode]; !taken {
+			q.taken[putCode] = struct{}{}
+			return putCode
+		}
+	}
+}
+
+// AuthCode returns a short ORCID-style authorization code, e.g. "Q70Y3A"
+func (s *IDService) AuthCode() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := make([]byte, authCodeLen)
+	for i := range b {
+		b[i] = authCodeSet[s.randomInt(len(authCodeSet))]
+	}
+	return string(b)
+}
+
+// Token returns a UUID-formatted access or refresh token
+func (s *IDService) Token() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.randomBytes(16)
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// randomInt returns a uniform random value in [0, n); callers must hold mu
+func (s *IDService) randomInt(n int) int {
+	if s.rng != nil {
+		return s.rng.IntN(n)
+	}
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return int(v.Int64())
+}
+
+// randomBytes returns n random bytes; callers must hold mu
+func (s *IDService) randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if s.rng != nil {
+		for i := range b {
+			b[i] = byte(s.rng.Uint32())
+		}
+		return b
+	}
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return b
+}
+
+// getRandomSeed parses MOAT_RANDOM_SEED, reporting whether it is set
+func getRandomSeed() (uint64, bool, error) {
+	v := os.Getenv("MOAT_RANDOM_SEED")
+	if v == "" {
+		return 0, false, nil
+	}
+	seed, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("MOAT_RANDOM_SEED must be a non-negative integer, got %q", v)
+	}
+	return seed, true, nil
+}
@@ -0,0 +1,86 @@
+package moat
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestIDServicePutCodesUniqueUnderConcurrency(t *testing.T) {
+	s := NewIDService()
+	s.ReservePutCode("0000-0001-2345-6789", 100050)
+
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				code := s.PutCode("0000-0001-2345-6789")
+				mu.Lock()
+				if seen[code] || code == 100050 {
+					t.Errorf("Put-code %d issued twice", code)
+				}
+				seen[code] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestIDServicePutCodesArePerRecordSequences(t *testing.T) {
+	s := NewIDService()
+	s.ReservePutCode("a", minPutCode+1)
+
+	got := []int{s.PutCode("a"), s.PutCode("a"), s.PutCode("b"), s.PutCode("a")}
+	want := []int{minPutCode, minPutCode + 2, minPutCode, minPutCode + 3}
+	if !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestIDServiceFormats(t *testing.T) {
+	s := NewIDService()
+
+	if code := s.AuthCode(); !regexp.MustCompile(`^[A-Z0-9]{6}$`).MatchString(code) {
+		t.Errorf("Unexpected auth code format %q", code)
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, b := s.Token(), s.Token()
+	if !uuid.MatchString(a) {
+		t.Errorf("Unexpected token format %q", a)
+	}
+	if a == b {
+		t.Error("Expected distinct tokens")
+	}
+}
+
+func TestIDServiceSeedIsReproducible(t *testing.T) {
+	run := func() []string {
+		s := NewIDService()
+		s.Seed(42)
+		var out []string
+		for range 5 {
+			out = append(out, strconv.Itoa(s.PutCode("0000-0001-2345-6789")), s.AuthCode(), s.Token())
+		}
+		out = append(out, strconv.Itoa(s.Rand().IntN(1000000)))
+		return out
+	}
+
+	first, second := run(), run()
+	if !slices.Equal(first, second) {
+		t.Errorf("Expected the same values from the same seed, got %v and %v", first, second)
+	}
+
+	other := NewIDService()
+	other.Seed(43)
+	if other.AuthCode() == first[1] && other.Token() == first[2] {
+		t.Error("Expected a different seed to give different values")
+	}
+}
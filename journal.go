@@ -0,0 +1,263 @@
+package moat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Request Journal ---
+//
+// Every request outside /__admin/ is recorded, so tests can assert exactly
+// what a client sent: its method, path, headers and body, the handler that
+// matched, and the status it got back. The journal is a ring buffer of the
+// last MOAT_JOURNAL_SIZE requests (1000 by default), read through
+// GET /__admin/requests.
+
+const defaultJournalSize = 1000
+
+// JournalEntry is one recorded request
+type JournalEntry struct {
+	ID      int         `json:"id"`
+	Time    time.Time   `json:"time"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Query   string      `json:"query,omitempty"`
+	Headers http.Header `json:"headers"`
+	Body    string      `json:"body,omitempty"`
+	Handler string      `json:"handler"`
+	Status  int         `json:"status"`
+	// RequestID is the X-Request-Id moat answered with
+	RequestID string `json:"request_id,omitempty"`
+}
+
+var (
+	journal       = make([]JournalEntry, 0, defaultJournalSize)
+	journalSize   = defaultJournalSize
+	journalStart  int // index of the oldest entry once journal is full
+	nextJournalID = 1
+	journalMutex  sync.Mutex
+)
+
+// getJournalSize reads MOAT_JOURNAL_SIZE; zero turns the journal off
+func getJournalSize() (int, error) {
+	v := os.Getenv("MOAT_JOURNAL_SIZE")
+	if v == "" {
+		return defaultJournalSize, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("MOAT_JOURNAL_SIZE must be a non-negative number, got %q", v)
+	}
+	return n, nil
+}
+
+// setJournalSize empties the journal and keeps up to n entries from now on
+func setJournalSize(n int) {
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+	journalSize = n
+	journal = make([]JournalEntry, 0, n)
+	journalStart = 0
+}
+
+// clearJournal forgets every recorded request
+func clearJournal() {
+	setJournalSize(journalSize)
+}
+
+// recordRequest adds e to the journal, dropping the oldest entry if it's full
+func recordRequest(e JournalEntry) {
+	if strings.HasPrefix(e.Path, "/__admin/") {
+		return
+	}
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+	if journalSize == 0 {
+		return
+	}
+	e.ID = nextJournalID
+	nextJournalID++
+	if len(journal) < journalSize {
+		journal = append(journal, e)
+		return
+	}
+	journal[journalStart] = e
+	journalStart = (journalStart + 1) % journalSize
+}
+
+// journalEntries returns the recorded requests, oldest first
+func journalEntries() []JournalEntry {
+	journalMutex.Lock()
+	defer journalMutex.Unlock()
+	list := make([]JournalEntry, 0, len(journal))
+	list = append(list, journal[journalStart:]...)
+	return append(list, journal[:journalStart]...)
+}
+
+// journalFilter selects entries by the query parameters of
+// GET /__admin/requests
+type journalFilter struct {
+	method, path, handler string
+	status                int
+}
+
+// parseJournalFilter reads the method, path, handler and status parameters
+func parseJournalFilter(r *http.Request) (journalFilter, error) {
+	q := r.URL.Query()
+	f := journalFilter{method: q.Get("method"), path: q.Get("path"), handler: q.Get("handler")}
+	if _, err := path.Match(f.path, ""); err != nil {
+		return f, fmt.Errorf("invalid path pattern %q", f.path)
+	}
+	if v := q.Get("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("invalid status %q", v)
+		}
+		f.status = status
+	}
+	return f, nil
+}
+
+// matches reports whether e passes f
+func (f journalFilter) matches(e JournalEntry) bool {
+	if f.method != "" && !strings.EqualFold(f.method, e.Method) {
+		return false
+	}
+	if f.path != "" {
+		if ok, _ := path.Match(f.path, e.Path); !ok {
+			return false
+		}
+	}
+	return (f.handler == "" || f.handler == e.Handler) && (f.status == 0 || f.status == e.Status)
+}
+
+// handleAdminListRequests returns the recorded requests, oldest first,
+// filtered by method, path (a path.Match pattern), handler and status, and
+// cut to the last limit of them
+func handleAdminListRequests(w http.ResponseWriter, r *http.Request) {
+	f, err := parseJournalFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list := []JournalEntry{}
+	for _, e := range journalEntries() {
+		if f.matches(e) {
+			list = append(list, e)
+		}
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		list = list[max(0, len(list)-n):]
+	}
+	writeResponse(w, r, list)
+}
+
+// handleAdminClearRequests empties the journal
+func handleAdminClearRequests(w http.ResponseWriter, r *http.Request) {
+	clearJournal()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Verification is a server-side assertion on the journal: how many recorded
+// requests match, optionally by body. With no count bounds it asks for at
+// least one.
+type Verification struct {
+	Method  string `json:"method,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Handler string `json:"handler,omitempty"`
+	Status  int    `json:"status,omitempty"`
+	// BodyContains is a substring and BodyMatches a regular expression the
+	// request body must have
+	BodyContains string `json:"body_contains,omitempty"`
+	BodyMatches  string `json:"body_matches,omitempty"`
+	// Count is the exact number expected; AtLeast and AtMost bound it
+	Count   *int `json:"count,omitempty"`
+	AtLeast *int `json:"at_least,omitempty"`
+	AtMost  *int `json:"at_most,omitempty"`
+}
+
+// VerificationResult reports whether a verification passed, with the
+// requests that matched it
+type VerificationResult struct {
+	Pass     bool           `json:"pass"`
+	Expected string         `json:"expected"`
+	Count    int            `json:"count"`
+	Requests []JournalEntry `json:"requests"`
+}
+
+// verify checks v against the journal
+func verify(v Verification) (VerificationResult, error) {
+	f := journalFilter{method: v.Method, path: v.Path, handler: v.Handler, status: v.Status}
+	if _, err := path.Match(f.path, ""); err != nil {
+		return VerificationResult{}, fmt.Errorf("invalid path pattern %q", f.path)
+	}
+	var body *regexp.Regexp
+	if v.BodyMatches != "" {
+		var err error
+		if body, err = regexp.Compile(v.BodyMatches); err != nil {
+			return VerificationResult{}, fmt.Errorf("invalid body_matches: %w", err)
+		}
+	}
+	if v.Count != nil && (v.AtLeast != nil || v.AtMost != nil) {
+		return VerificationResult{}, errors.New("count excludes at_least and at_most")
+	}
+
+	res := VerificationResult{Requests: []JournalEntry{}}
+	for _, e := range journalEntries() {
+		if !f.matches(e) || !strings.Contains(e.Body, v.BodyContains) || (body != nil && !body.MatchString(e.Body)) {
+			continue
+		}
+		res.Requests = append(res.Requests, e)
+	}
+	res.Count = len(res.Requests)
+
+	switch {
+	case v.Count != nil:
+		res.Expected = fmt.Sprintf("exactly %d", *v.Count)
+		res.Pass = res.Count == *v.Count
+	case v.AtLeast != nil && v.AtMost != nil:
+		res.Expected = fmt.Sprintf("between %d and %d", *v.AtLeast, *v.AtMost)
+		res.Pass = res.Count >= *v.AtLeast && res.Count <= *v.AtMost
+	case v.AtMost != nil:
+		res.Expected = fmt.Sprintf("at most %d", *v.AtMost)
+		res.Pass = res.Count <= *v.AtMost
+	default:
+		least := 1
+		if v.AtLeast != nil {
+			least = *v.AtLeast
+		}
+		res.Expected = fmt.Sprintf("at least %d", least)
+		res.Pass = res.Count >= least
+	}
+	return res, nil
+}
+
+// handleAdminVerify checks a verification against the journal. It answers
+// 200 either way; the result says whether it passed.
+func handleAdminVerify(w http.ResponseWriter, r *http.Request) {
+	var v Verification
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		http.Error(w, "Invalid verification: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := verify(v)
+	if err != nil {
+		http.Error(w, "Invalid verification: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeResponse(w, r, res)
+}
@@ -0,0 +1,142 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestJournal(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	clearJournal()
+	t.Cleanup(clearJournal)
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	list := func(query string) []JournalEntry {
+		t.Helper()
+		w := do("GET", "/__admin/requests"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected the journal, got %v: %s", w.Code, w.Body)
+		}
+		var entries []JournalEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	work := `{"type": "book", "title": {"title": {"value": "Journaled"}}}`
+	do("GET", "/v3.0/"+orcid+"/record?x=1", "")
+	do("POST", "/v3.0/"+orcid+"/work", work)
+	do("GET", "/v3.0/"+orcid+"/work/999999", "")
+
+	entries := list("")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 requests and no admin ones, got %+v", entries)
+	}
+	if e := entries[0]; e.Method != "GET" || e.Path != "/v3.0/"+orcid+"/record" || e.Query != "x=1" || e.Status != http.StatusOK || e.Handler != "handleGetRecord" {
+		t.Errorf("Unexpected first entry %+v", e)
+	}
+	if e := entries[1]; e.Body != work || e.Status != http.StatusCreated || e.Headers.Get("Accept") != "application/json" {
+		t.Errorf("Unexpected second entry %+v", e)
+	}
+	if entries[0].ID >= entries[1].ID {
+		t.Errorf("Expected ids to increase, got %d then %d", entries[0].ID, entries[1].ID)
+	}
+
+	if got := list("?method=post"); len(got) != 1 || got[0].Method != "POST" {
+		t.Errorf("Expected the POST alone, got %+v", got)
+	}
+	if got := list("?path=/v3.0/*/work/*&status=404"); len(got) != 1 || got[0].Status != http.StatusNotFound {
+		t.Errorf("Expected the missing work alone, got %+v", got)
+	}
+	if got := list("?limit=1"); len(got) != 1 || got[0].Path != "/v3.0/"+orcid+"/work/999999" {
+		t.Errorf("Expected the last request alone, got %+v", got)
+	}
+	if w := do("GET", "/__admin/requests?status=ok", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad status filter, got %v", w.Code)
+	}
+
+	if w := do("DELETE", "/__admin/requests", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %v", w.Code)
+	}
+	if got := list(""); len(got) != 0 {
+		t.Errorf("Expected an empty journal, got %+v", got)
+	}
+}
+
+func TestJournalRingBuffer(t *testing.T) {
+	setJournalSize(2)
+	t.Cleanup(func() { setJournalSize(defaultJournalSize) })
+	for _, p := range []string{"/a", "/b", "/c"} {
+		recordRequest(JournalEntry{Path: p})
+	}
+	recordRequest(JournalEntry{Path: "/__admin/requests"})
+
+	got := journalEntries()
+	if len(got) != 2 || got[0].Path != "/b" || got[1].Path != "/c" {
+		t.Errorf("Expected the last two requests, oldest first, got %+v", got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	clearJournal()
+	t.Cleanup(clearJournal)
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	for _, title := range []string{"First", "Second"} {
+		do("POST", "/v3.0/"+orcid+"/work", `{"type": "book", "title": {"title": {"value": "`+title+`"}}}`)
+	}
+	do("GET", "/v3.0/"+orcid+"/record", "")
+
+	tests := []struct {
+		verification string
+		pass         bool
+		count        int
+	}{
+		{`{"method": "POST", "path": "/v3.0/*/work", "count": 2}`, true, 2},
+		{`{"method": "POST", "path": "/v3.0/*/work", "count": 1}`, false, 2},
+		{`{"method": "POST", "body_contains": "Second"}`, true, 1},
+		{`{"body_matches": "\"value\": \"(First|Third)\""}`, true, 1},
+		{`{"handler": "handleGetRecord", "status": 200, "at_least": 1, "at_most": 1}`, true, 1},
+		{`{"method": "DELETE"}`, false, 0},
+		{`{"method": "DELETE", "at_most": 0}`, true, 0},
+	}
+	for _, tt := range tests {
+		w := do("POST", "/__admin/verify", tt.verification)
+		var res VerificationResult
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: expected a result, got %v: %s", tt.verification, w.Code, w.Body)
+		}
+		if res.Pass != tt.pass || res.Count != tt.count || len(res.Requests) != tt.count {
+			t.Errorf("%s: expected pass %v with %d, got %+v", tt.verification, tt.pass, tt.count, res)
+		}
+	}
+
+	for _, bad := range []string{`{"body_matches": "("}`, `{"count": 1, "at_least": 1}`, `{"path": "["}`} {
+		if w := do("POST", "/__admin/verify", bad); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", bad, w.Code)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package moat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// --- OAuth Journeys ---
+
+// Journey describes a complete OAuth flow for a single client_id: who
+// authorizes, what they grant, and where the flow should break. Journey
+// files are JSON documents, which are also valid YAML 1.2, so QA can keep
+// them alongside other YAML fixtures without moat needing a YAML library.
+type Journey struct {
+	Name          string   `json:"name"`
+	ClientID      string   `json:"client_id"`
+	ORCID         string   `json:"orcid"`
+	Scopes        []string `json:"scopes"`
+	DenyConsent   bool     `json:"deny_consent"`
+	ExpiresIn     int      `json:"expires_in"`
+	FailRefreshAt int      `json:"fail_refresh_at"`
+}
+
+type journeyFile struct {
+	Journeys []*Journey `json:"journeys"`
+}
+
+var (
+	journeys = make(map[string]*Journey)
+	// journeyRefreshes counts each journey's refreshes by store, so tenants
+	// and embedded servers each go through a journey on their own
+	journeyRefreshes = make(map[*Store]map[string]int)
+	journeyMutex     sync.Mutex
+)
+
+// loadJourneys reads a journey file and registers each journey by client_id,
+// replacing any journeys previously loaded for the same client.
+func loadJourneys(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var f journeyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	journeyMutex.Lock()
+	defer journeyMutex.Unlock()
+	for i, j := range f.Journeys {
+		if j.ClientID == "" {
+			return fmt.Errorf("journey %d (%q) has no client_id", i, j.Name)
+		}
+		journeys[j.ClientID] = j
+	}
+	return nil
+}
+
+// findJourney returns the journey registered for clientID, or nil
+func findJourney(clientID string) *Journey {
+	journeyMutex.Lock()
+	defer journeyMutex.Unlock()
+	return journeys[clientID]
+}
+
+// resetJourneys restarts every journey's refresh count in s
+func resetJourneys(s *Store) {
+	journeyMutex.Lock()
+	defer journeyMutex.Unlock()
+	delete(journeyRefreshes, s)
+}
+
+// nextRefreshFails records a refresh attempt in s and reports whether this
+// is the step the journey was told to fail on
+func (j *Journey) nextRefreshFails(s *Store) bool {
+	journeyMutex.Lock()
+	defer journeyMutex.Unlock()
+	counts, ok := journeyRefreshes[s]
+	if !ok {
+		counts = make(map[string]int)
+		journeyRefreshes[s] = counts
+	}
+	counts[j.ClientID]++
+	return j.FailRefreshAt > 0 && counts[j.ClientID] == j.FailRefreshAt
+}
+
+// tokenResponse builds the token a journey's user, in s, would receive
+func (j *Journey) tokenResponse(ctx context.Context, s *Store) TokenResponse {
+	resp := defaultTokenResponse(ctx)
+	if j.ORCID != "" {
+		resp.ORCID = j.ORCID
+		if name := researcherName(s, j.ORCID); name != "" {
+			resp.Name = name
+		}
+	}
+	if len(j.Scopes) > 0 {
+		resp.Scope = strings.Join(j.Scopes, " ")
+	}
+	if j.ExpiresIn > 0 {
+		resp.ExpiresIn = j.ExpiresIn
+	}
+	return resp
+}
@@ -0,0 +1,115 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeJourneyFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "journeys.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("Failed to write journey file: %v", err)
+	}
+	return path
+}
+
+func TestJourneyDeniedConsent(t *testing.T) {
+	path := writeJourneyFile(t, `{"journeys": [{"name": "denied", "client_id": "APP-DENY", "deny_consent": true}]}`)
+	if err := loadJourneys(path); err != nil {
+		t.Fatalf("Failed to load journeys: %v", err)
+	}
+
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/oauth/authorize?client_id=APP-DENY&redirect_uri=http://example.com&state=xyz", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected status Found, got %v", w.Code)
+	}
+	loc := w.Header().Get("Location")
+	if !strings.Contains(loc, "error=access_denied") || !strings.Contains(loc, "state=xyz") {
+		t.Errorf("Expected access_denied redirect with state, got %s", loc)
+	}
+}
+
+func TestJourneyTokenAndRefreshFailure(t *testing.T) {
+	path := writeJourneyFile(t, `{"journeys": [{
+		"name": "flaky refresh",
+		"client_id": "APP-FLAKY",
+		"orcid": "0000-0002-1001-2002",
+		"scopes": ["/authenticate"],
+		"expires_in": 60,
+		"fail_refresh_at": 2
+	}]}`)
+	if err := loadJourneys(path); err != nil {
+		t.Fatalf("Failed to load journeys: %v", err)
+	}
+
+	handler := withTenant(setupRouter())
+	req := httptest.NewRequest("GET", "/oauth/authorize?client_id=APP-FLAKY&redirect_uri=http://example.com/cb", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	loc, _ := url.Parse(w.Header().Get("Location"))
+
+	refreshToken, tenant := "", ""
+	token := func(grant string) *httptest.ResponseRecorder {
+		data := url.Values{}
+		data.Set("client_id", "APP-FLAKY")
+		data.Set("grant_type", grant)
+		data.Set("code", loc.Query().Get("code"))
+		data.Set("redirect_uri", "http://example.com/cb")
+		data.Set("refresh_token", refreshToken)
+		req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tenant != "" {
+			req.Header.Set(tenantHeader, tenant)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	t.Cleanup(func() { resetJourneys(store) })
+
+	w = token("authorization_code")
+	var resp TokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.ORCID != "0000-0002-1001-2002" || resp.Name != "John Smith" {
+		t.Errorf("Expected John Smith's token, got %s (%s)", resp.ORCID, resp.Name)
+	}
+	if resp.Scope != "/authenticate" || resp.ExpiresIn != 60 {
+		t.Errorf("Expected journey scope and lifetime, got %q/%d", resp.Scope, resp.ExpiresIn)
+	}
+	refreshToken = resp.RefreshToken
+
+	if w := token("refresh_token"); w.Code != http.StatusOK {
+		t.Errorf("Expected first refresh to succeed, got %v", w.Code)
+	}
+	if w := token("refresh_token"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected second refresh to fail, got %v", w.Code)
+	}
+
+	// A tenant goes through the journey from the start
+	tenant = "journey-1"
+	t.Cleanup(func() {
+		tenantsMutex.Lock()
+		delete(tenants, tenant)
+		tenantsMutex.Unlock()
+	})
+	if w := token("refresh_token"); w.Code != http.StatusOK {
+		t.Errorf("Expected the tenant's first refresh to succeed, got %v", w.Code)
+	}
+	if w := token("refresh_token"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the tenant's second refresh to fail, got %v", w.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package moat
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Latency ---
+//
+// With MOAT_LATENCY set (or WithLatency), every response waits that long
+// before it starts, as if ORCID were far away, so clients' timeouts and
+// concurrency can be exercised. /__admin/ always answers at once.
+
+var (
+	latency      time.Duration
+	latencyMutex sync.Mutex
+)
+
+// getLatency reads MOAT_LATENCY, a duration such as 150ms
+func getLatency() (time.Duration, error) {
+	v := os.Getenv("MOAT_LATENCY")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("MOAT_LATENCY must be a duration such as 150ms, got %q", v)
+	}
+	return d, nil
+}
+
+// setLatency replaces the added latency; zero turns it off
+func setLatency(d time.Duration) {
+	latencyMutex.Lock()
+	defer latencyMutex.Unlock()
+	latency = d
+}
+
+// withLatency serves next after the configured latency
+func withLatency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		latencyMutex.Lock()
+		d := latency
+		latencyMutex.Unlock()
+		if srv := serverFor(r.Context()); srv != nil && srv.latency != nil {
+			d = *srv.latency
+		}
+		if d > 0 && !strings.HasPrefix(r.URL.Path, "/__admin/") {
+			select {
+			case <-time.After(d):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
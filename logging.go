@@ -0,0 +1,111 @@
+package moat
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// --- Logging ---
+//
+// moat logs through slog: human-readable text by default, or one JSON
+// object per line with MOAT_LOG_FORMAT=json for log pipelines. Requests are
+// logged in full at Debug as they arrive and in a line at Info when answered,
+// so MOAT_LOG_LEVEL=info quiets a busy instance.
+//
+// Every request has an ID, the X-Request-Id it came with or a new one, sent
+// back in the response and added to everything logged with its context, so
+// a failing test's requests can be found in moat's logs.
+
+// getLogHandler builds the handler MOAT_LOG_FORMAT and MOAT_LOG_LEVEL ask
+// for, writing to w
+func getLogHandler(w io.Writer) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if v := os.Getenv("MOAT_LOG_LEVEL"); v != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(v)); err != nil {
+			return nil, fmt.Errorf("MOAT_LOG_LEVEL must be debug, info, warn or error, got %q", v)
+		}
+		opts.Level = level
+	}
+
+	switch format := strings.ToLower(os.Getenv("MOAT_LOG_FORMAT")); format {
+	case "", "text":
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	case "json":
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	default:
+		return nil, fmt.Errorf("MOAT_LOG_FORMAT must be text or json, got %q", format)
+	}
+}
+
+const requestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// requestID returns the ID of the request ctx belongs to, if any
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID returns a random UUID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// validRequestID reports whether a client's X-Request-Id is fit to log: up
+// to 200 printable ASCII characters
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 200 {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestID gives each request an ID, keeping a valid one the client
+// sent, and echoes it in the response
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// contextHandler adds the request ID from a log call's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := requestID(ctx); id != "" {
+		rec.AddAttrs(slog.String("request-id", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
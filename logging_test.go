@@ -0,0 +1,93 @@
+package moat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	t.Setenv("MOAT_LOG_FORMAT", "")
+	t.Setenv("MOAT_LOG_LEVEL", "")
+	h, err := getLogHandler(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.New(h).Debug("Request processed", "status", 200)
+	if !strings.Contains(buf.String(), "level=DEBUG") || !strings.Contains(buf.String(), "status=200") {
+		t.Errorf("Expected text at debug by default, got %q", buf.String())
+	}
+
+	buf.Reset()
+	t.Setenv("MOAT_LOG_FORMAT", "json")
+	t.Setenv("MOAT_LOG_LEVEL", "info")
+	if h, err = getLogHandler(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if h.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("Expected debug logs to be off at info")
+	}
+	slog.New(h).Info("Imported ORCID records", "records", 3)
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil || line["msg"] != "Imported ORCID records" || line["records"] != 3.0 {
+		t.Errorf("Expected a JSON line, got %q (%v)", buf.String(), err)
+	}
+
+	for _, env := range [][2]string{{"MOAT_LOG_FORMAT", "xml"}, {"MOAT_LOG_LEVEL", "loud"}} {
+		t.Setenv("MOAT_LOG_FORMAT", "")
+		t.Setenv("MOAT_LOG_LEVEL", "")
+		t.Setenv(env[0], env[1])
+		if _, err := getLogHandler(&buf); err == nil {
+			t.Errorf("Expected an error for %s=%s", env[0], env[1])
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	t.Cleanup(clearJournal)
+	var buf bytes.Buffer
+	saved := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(saved) })
+	t.Setenv("MOAT_LOG_FORMAT", "json")
+	t.Setenv("MOAT_LOG_LEVEL", "")
+	h, _ := getLogHandler(&buf)
+	slog.SetDefault(slog.New(h))
+	handler := setupRouter()
+
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil)
+	req.Header.Set(requestIDHeader, "ci-run-42")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if got := w.Header().Get(requestIDHeader); got != "ci-run-42" {
+		t.Errorf("Expected the client's request ID back, got %q", got)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for _, l := range lines {
+		var line map[string]any
+		if err := json.Unmarshal([]byte(l), &line); err != nil || line["request-id"] != "ci-run-42" {
+			t.Errorf("Expected every log line to carry the request ID, got %s", l)
+		}
+	}
+	if len(lines) < 2 {
+		t.Errorf("Expected the request to be logged, got %q", buf.String())
+	}
+	entries := journalEntries()
+	if len(entries) == 0 || entries[len(entries)-1].RequestID != "ci-run-42" {
+		t.Error("Expected the journal to keep the request ID")
+	}
+
+	for _, sent := range []string{"", "has space", strings.Repeat("x", 201)} {
+		req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil)
+		req.Header.Set(requestIDHeader, sent)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Header().Get(requestIDHeader); len(got) != 36 || got == sent {
+			t.Errorf("Expected a new UUID for %q, got %q", sent, got)
+		}
+	}
+}
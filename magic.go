@@ -0,0 +1,79 @@
+package moat
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"moat/orciderr"
+)
+
+// --- Magic ORCID iDs ---
+//
+// ORCID never issues iDs in the 0000-0000-0000 block, so moat reserves it for
+// iDs that fail in a fixed way with no setup, like a payment sandbox's magic
+// card numbers: /v3.0/0000-0000-0000-0500/record is always a 500. The last
+// four digits pick the behaviour, and the check digit is not checked.
+
+// magicPrefix starts every magic iD
+const magicPrefix = "0000-0000-0000-"
+
+// magicDelay is how long the slow magic iD waits before answering
+var magicDelay = 30 * time.Second
+
+// magicErrors are the magic iDs' suffixes and the errors they answer with
+var magicErrors = map[string]orciderr.Code{
+	"0401": orciderr.InvalidToken,
+	"0403": orciderr.InsufficientScope,
+	"0404": orciderr.RecordNotFound,
+	"0409": orciderr.RecordLocked,
+	"0429": orciderr.TooManyRequests,
+	"0500": orciderr.InternalError,
+	"0503": orciderr.ServiceUnavailable,
+}
+
+// magicSlow is the suffix of the iD that answers after magicDelay
+const magicSlow = "9999"
+
+// playMagicORCID answers r if it names a magic iD, reporting whether it did
+func playMagicORCID(w http.ResponseWriter, r *http.Request) bool {
+	orcid, ok := pathORCID(r)
+	if !ok {
+		return false
+	}
+	suffix, ok := strings.CutPrefix(orcid, magicPrefix)
+	if !ok {
+		return false
+	}
+
+	if suffix == magicSlow {
+		select {
+		case <-time.After(magicDelay):
+		case <-r.Context().Done():
+			return true
+		}
+		writeError(w, r, recordNotFound(orcid))
+		return true
+	}
+	code, ok := magicErrors[suffix]
+	if !ok {
+		return false
+	}
+	switch code {
+	case orciderr.TooManyRequests:
+		// As if ORCID's limit had been used up, refilling in a second
+		w.Header().Set("X-Rate-Limit-Limit", strconv.Itoa(orcidRateBurst))
+		w.Header().Set("X-Rate-Limit-Remaining", "0")
+		w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Unix()+1, 10))
+		w.Header().Set("Retry-After", "1")
+	case orciderr.ServiceUnavailable:
+		w.Header().Set("Retry-After", "1")
+	}
+	if code == orciderr.RecordNotFound {
+		writeError(w, r, recordNotFound(orcid))
+	} else {
+		writeError(w, r, orciderr.New(code))
+	}
+	return true
+}
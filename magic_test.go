@@ -0,0 +1,47 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"moat/orciderr"
+)
+
+func TestMagicORCIDs(t *testing.T) {
+	handler := setupRouter()
+	get := func(orcid string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v3.0/"+orcid+"/works", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for suffix, code := range magicErrors {
+		w := get(magicPrefix + suffix)
+		e, err := orciderr.Decode(w.Body)
+		if err != nil || e.ErrorCode != code || w.Code != code.Status() {
+			t.Errorf("%s: expected %d with status %d, got %v: %v, %v", suffix, code, code.Status(), w.Code, e, err)
+		}
+	}
+	if w := get(magicPrefix + "0429"); w.Header().Get("Retry-After") != "1" || w.Header().Get("X-Rate-Limit-Remaining") != "0" {
+		t.Errorf("Expected rate limit headers, got %v", w.Header())
+	}
+	if w := get(magicPrefix + "0200"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected an unreserved suffix to be an ordinary unknown iD, got %v", w.Code)
+	}
+
+	saved := magicDelay
+	magicDelay = 20 * time.Millisecond
+	t.Cleanup(func() { magicDelay = saved })
+	start := time.Now()
+	w := get(magicPrefix + magicSlow)
+	if took := time.Since(start); took < magicDelay {
+		t.Errorf("Expected a delay of %v, took %v", magicDelay, took)
+	}
+	if e, err := orciderr.Decode(w.Body); err != nil || e.ErrorCode != orciderr.RecordNotFound {
+		t.Errorf("Expected record not found after the delay, got %v: %v, %v", w.Code, e, err)
+	}
+}
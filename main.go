@@ -1,26 +1,55 @@
-package main
+package moat
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log/slog"
-	"math/rand"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	"moat/models"
+	"moat/orciderr"
 )
 
 // --- Configuration ---
+
+// envDuration parses the environment variable name, either a number of
+// seconds or a Go duration such as "5m", returning 0 when it is unset
+func envDuration(name string) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		v += "s"
+		if secs <= 0 {
+			return 0, errors.New(name + " must be positive")
+		}
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second {
+		return 0, errors.New(name + " must be at least one second")
+	}
+	return d, nil
+}
+
 func getPort() string {
 	if port := os.Getenv("MOAT_PORT"); port != "" {
 		if !strings.HasPrefix(port, ":") {
@@ -46,16 +75,17 @@ type TokenResponse struct {
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int    `json:"expires_in"`
 	Scope        string `json:"scope"`
-	Name         string `json:"name"`
-	ORCID        string `json:"orcid"`
+	Name         string `json:"name,omitempty"`
+	ORCID        string `json:"orcid,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
 }
 
 // OrcidRecord represents the root of the record response
 type OrcidRecord struct {
-	XMLName         xml.Name        `json:"-" xml:"record"`
-	OrcidIdentifier OrcidIdentifier `json:"orcid-identifier" xml:"orcid-identifier"`
-	Person          models.Person   `json:"person" xml:"person"`
-	Activities      Activities      `json:"activities-summary" xml:"activities-summary"`
+	XMLName         xml.Name        `json:"-" xml:"http://www.orcid.org/ns/record record"`
+	OrcidIdentifier OrcidIdentifier `json:"orcid-identifier" xml:"http://www.orcid.org/ns/common orcid-identifier"`
+	Person          models.Person   `json:"person" xml:"http://www.orcid.org/ns/person person"`
+	Activities      Activities      `json:"activities-summary" xml:"http://www.orcid.org/ns/activities activities-summary"`
 }
 
 type OrcidIdentifier struct {
@@ -64,47 +94,215 @@ type OrcidIdentifier struct {
 	Host string `json:"host" xml:"host"`
 }
 
+// Value is ORCID's {"value": ...} wrapper in JSON; in XML it is the element's
+// text, as in <common:title>...</common:title>
 type Value struct {
-	Value string `json:"value" xml:"value"`
+	Value string `json:"value" xml:",chardata"`
+}
+
+// UnmarshalXML reads the element's text, or the text of a <value> child, as
+// moat's own XML had it before it matched ORCID's
+func (v *Value) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var x struct {
+		Text  string  `xml:",chardata"`
+		Value *string `xml:"value"`
+	}
+	if err := d.DecodeElement(&x, &start); err != nil {
+		return err
+	}
+	v.Value = x.Text
+	if x.Value != nil {
+		v.Value = *x.Value
+	}
+	return nil
 }
 
 type Activities struct {
-	Works      WorkSummaryGroup       `json:"works" xml:"works"`
-	Employment EmploymentSummaryGroup `json:"employments" xml:"employments"`
+	LastModifiedDate  *LastModified                `json:"last-modified-date,omitempty" xml:"http://www.orcid.org/ns/common last-modified-date,omitempty"`
+	Works             WorkSummaryGroup             `json:"works" xml:"http://www.orcid.org/ns/activities works"`
+	Educations        EducationSummaryGroup        `json:"educations" xml:"http://www.orcid.org/ns/activities educations"`
+	Employment        EmploymentSummaryGroup       `json:"employments" xml:"http://www.orcid.org/ns/activities employments"`
+	Fundings          FundingSummaryGroup          `json:"fundings" xml:"http://www.orcid.org/ns/activities fundings"`
+	InvitedPositions  InvitedPositionSummaryGroup  `json:"invited-positions" xml:"http://www.orcid.org/ns/activities invited-positions"`
+	Memberships       MembershipSummaryGroup       `json:"memberships" xml:"http://www.orcid.org/ns/activities memberships"`
+	Qualifications    QualificationSummaryGroup    `json:"qualifications" xml:"http://www.orcid.org/ns/activities qualifications"`
+	PeerReviews       PeerReviewSummaryGroup       `json:"peer-reviews" xml:"http://www.orcid.org/ns/activities peer-reviews"`
+	ResearchResources ResearchResourceSummaryGroup `json:"research-resources" xml:"http://www.orcid.org/ns/activities research-resources"`
+}
+
+// ActivitiesResponse is the standalone /activities document
+type ActivitiesResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/activities activities-summary"`
+	Activities
+}
+
+// EducationsResponse is the standalone /educations document
+type EducationsResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/activities educations"`
+	EducationSummaryGroup
+}
+
+// EmploymentsResponse is the standalone /employments document
+type EmploymentsResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/activities employments"`
+	EmploymentSummaryGroup
+}
+
+// FundingsResponse is the standalone /fundings document
+type FundingsResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/activities fundings"`
+	FundingSummaryGroup
+}
+
+// PeerReviewsResponse is the standalone /peer-reviews document
+type PeerReviewsResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/activities peer-reviews"`
+	PeerReviewSummaryGroup
 }
 
 type WorkSummaryGroup struct {
-	Group []WorkGroup `json:"group" xml:"group"`
+	LastModifiedDate *LastModified `json:"last-modified-date,omitempty" xml:"http://www.orcid.org/ns/common last-modified-date,omitempty"`
+	Group            []WorkGroup   `json:"group" xml:"http://www.orcid.org/ns/activities group"`
 }
 
 type WorkGroup struct {
-	WorkSummary []WorkSummary `json:"work-summary" xml:"work-summary"`
+	WorkSummary []WorkSummary `json:"work-summary" xml:"http://www.orcid.org/ns/work work-summary"`
 }
 
 type WorkSummary struct {
-	PutCode      int          `json:"put-code" xml:"put-code"`
-	Title        Title        `json:"title" xml:"title"`
-	Type         string       `json:"type" xml:"type"`
-	LastModified LastModified `json:"last-modified-date" xml:"last-modified-date"`
+	Visibility   string        `json:"visibility,omitempty" xml:"visibility,attr,omitempty"`
+	PutCode      int           `json:"put-code" xml:"put-code"`
+	Title        Title         `json:"title" xml:"http://www.orcid.org/ns/work title"`
+	ExternalIDs  *ExternalIDs  `json:"external-ids,omitempty" xml:"http://www.orcid.org/ns/common external-ids,omitempty"`
+	URL          *Value        `json:"url,omitempty" xml:"http://www.orcid.org/ns/common url,omitempty"`
+	Type         string        `json:"type" xml:"http://www.orcid.org/ns/work type"`
+	JournalTitle *Value        `json:"journal-title,omitempty" xml:"http://www.orcid.org/ns/work journal-title,omitempty"`
+	CreatedDate  *LastModified `json:"created-date,omitempty" xml:"http://www.orcid.org/ns/common created-date,omitempty"`
+	LastModified LastModified  `json:"last-modified-date" xml:"http://www.orcid.org/ns/common last-modified-date"`
 }
 
 type EmploymentSummaryGroup struct {
-	AffiliationGroup []AffiliationGroup `json:"affiliation-group" xml:"affiliation-group"`
+	LastModifiedDate *LastModified      `json:"last-modified-date,omitempty" xml:"http://www.orcid.org/ns/common last-modified-date,omitempty"`
+	AffiliationGroup []AffiliationGroup `json:"affiliation-group" xml:"http://www.orcid.org/ns/activities affiliation-group"`
 }
 
 type AffiliationGroup struct {
-	Summaries []EmploymentSummary `json:"employment-summary" xml:"employment-summary"`
+	Summaries []EmploymentSummary `json:"employment-summary" xml:"http://www.orcid.org/ns/employment employment-summary"`
 }
 
 type EmploymentSummary struct {
-	PutCode        int    `json:"put-code" xml:"put-code"`
-	DepartmentName string `json:"department-name" xml:"department-name"`
-	RoleTitle      string `json:"role-title" xml:"role-title"`
-	Organization   Org    `json:"organization" xml:"organization"`
+	Visibility       string        `json:"visibility,omitempty" xml:"visibility,attr,omitempty"`
+	PutCode          int           `json:"put-code" xml:"put-code"`
+	DepartmentName   string        `json:"department-name" xml:"http://www.orcid.org/ns/common department-name"`
+	RoleTitle        string        `json:"role-title" xml:"http://www.orcid.org/ns/common role-title"`
+	Organization     Org           `json:"organization" xml:"http://www.orcid.org/ns/common organization"`
+	CreatedDate      *LastModified `json:"created-date,omitempty" xml:"http://www.orcid.org/ns/common created-date,omitempty"`
+	LastModifiedDate *LastModified `json:"last-modified-date,omitempty" xml:"http://www.orcid.org/ns/common last-modified-date,omitempty"`
+}
+
+type EducationSummaryGroup struct {
+	AffiliationGroup []EducationGroup `json:"affiliation-group" xml:"http://www.orcid.org/ns/activities affiliation-group"`
+}
+
+type EducationGroup struct {
+	Summaries []AffiliationSummary `json:"education-summary" xml:"http://www.orcid.org/ns/education education-summary"`
+}
+
+// AffiliationSummary is the summary shape shared by the affiliation sections
+// added after employments (educations, memberships, ...)
+type AffiliationSummary struct {
+	Visibility     string    `json:"visibility,omitempty" xml:"visibility,attr,omitempty"`
+	PutCode        int       `json:"put-code" xml:"put-code"`
+	DepartmentName string    `json:"department-name" xml:"http://www.orcid.org/ns/common department-name"`
+	RoleTitle      string    `json:"role-title" xml:"http://www.orcid.org/ns/common role-title"`
+	Organization   Org       `json:"organization" xml:"http://www.orcid.org/ns/common organization"`
+	StartDate      *DateYear `json:"start-date,omitempty" xml:"http://www.orcid.org/ns/common start-date,omitempty"`
+	EndDate        *DateYear `json:"end-date,omitempty" xml:"http://www.orcid.org/ns/common end-date,omitempty"`
+}
+
+type InvitedPositionSummaryGroup struct {
+	AffiliationGroup []InvitedPositionGroup `json:"affiliation-group" xml:"http://www.orcid.org/ns/activities affiliation-group"`
+}
+
+type InvitedPositionGroup struct {
+	Summaries []AffiliationSummary `json:"invited-position-summary" xml:"http://www.orcid.org/ns/invited-position invited-position-summary"`
+}
+
+type MembershipSummaryGroup struct {
+	AffiliationGroup []MembershipGroup `json:"affiliation-group" xml:"http://www.orcid.org/ns/activities affiliation-group"`
+}
+
+type MembershipGroup struct {
+	Summaries []AffiliationSummary `json:"membership-summary" xml:"http://www.orcid.org/ns/membership membership-summary"`
+}
+
+type QualificationSummaryGroup struct {
+	AffiliationGroup []QualificationGroup `json:"affiliation-group" xml:"http://www.orcid.org/ns/activities affiliation-group"`
+}
+
+type QualificationGroup struct {
+	Summaries []AffiliationSummary `json:"qualification-summary" xml:"http://www.orcid.org/ns/qualification qualification-summary"`
+}
+
+type FundingSummaryGroup struct {
+	Group []FundingGroup `json:"group" xml:"http://www.orcid.org/ns/activities group"`
+}
+
+type FundingGroup struct {
+	FundingSummary []FundingSummary `json:"funding-summary" xml:"http://www.orcid.org/ns/funding funding-summary"`
+}
+
+type FundingSummary struct {
+	Visibility   string `json:"visibility,omitempty" xml:"visibility,attr,omitempty"`
+	PutCode      int    `json:"put-code" xml:"put-code"`
+	Title        Title  `json:"title" xml:"http://www.orcid.org/ns/funding title"`
+	Type         string `json:"type" xml:"http://www.orcid.org/ns/funding type"`
+	Organization Org    `json:"organization" xml:"http://www.orcid.org/ns/common organization"`
+}
+
+type PeerReviewSummaryGroup struct {
+	Group []PeerReviewGroup `json:"group" xml:"http://www.orcid.org/ns/activities group"`
+}
+
+type PeerReviewGroup struct {
+	ExternalIDs     ExternalIDs            `json:"external-ids" xml:"http://www.orcid.org/ns/common external-ids"`
+	PeerReviewGroup []PeerReviewDuplicates `json:"peer-review-group" xml:"http://www.orcid.org/ns/activities peer-review-group"`
+}
+
+type PeerReviewDuplicates struct {
+	PeerReviewSummary []PeerReviewSummary `json:"peer-review-summary" xml:"http://www.orcid.org/ns/peer-review peer-review-summary"`
+}
+
+type PeerReviewSummary struct {
+	Visibility            string `json:"visibility,omitempty" xml:"visibility,attr,omitempty"`
+	PutCode               int    `json:"put-code" xml:"put-code"`
+	ReviewerRole          string `json:"reviewer-role" xml:"http://www.orcid.org/ns/peer-review reviewer-role"`
+	ReviewGroupID         string `json:"review-group-id" xml:"http://www.orcid.org/ns/peer-review review-group-id"`
+	ConveningOrganization Org    `json:"convening-organization" xml:"http://www.orcid.org/ns/peer-review convening-organization"`
+}
+
+type ResearchResourceSummaryGroup struct {
+	Group []ResearchResourceGroup `json:"group" xml:"http://www.orcid.org/ns/activities group"`
+}
+
+type ResearchResourceGroup struct {
+	ResearchResourceSummary []ResearchResourceSummary `json:"research-resource-summary" xml:"http://www.orcid.org/ns/research-resource research-resource-summary"`
+}
+
+type ResearchResourceSummary struct {
+	PutCode  int   `json:"put-code" xml:"put-code"`
+	Proposal Title `json:"proposal" xml:"http://www.orcid.org/ns/research-resource proposal"`
 }
 
 type Org struct {
-	Name string `json:"name" xml:"name"`
+	Name    string      `json:"name" xml:"name"`
+	Address *OrgAddress `json:"address,omitempty" xml:"address,omitempty"`
+}
+
+type OrgAddress struct {
+	City    string `json:"city" xml:"city"`
+	Region  string `json:"region,omitempty" xml:"region,omitempty"`
+	Country string `json:"country" xml:"country"`
 }
 
 type Title struct {
@@ -129,11 +327,11 @@ type SearchResult struct {
 // --- In-Memory Store ---
 
 var (
-	// Store works and employments by ORCID -> PutCode -> Data
-	// For simplicity, we store raw JSON bytes to mock persistence
-	dataStore   = make(map[string]map[string]map[int][]byte)
-	personStore = make(map[string]OrcidRecord)
-	storeMutex  sync.RWMutex
+	// store holds every user's person and activities; see store.go
+	store = NewStore()
+
+	// ids issues put-codes, auth codes and tokens; see ids.go
+	ids = NewIDService()
 
 	// Version is injected at build time
 	Version = "dev"
@@ -153,62 +351,395 @@ func init() {
 	}
 
 	for _, p := range people {
-		rec := createMockRecord(p.orcid, p.given, p.family, p.bio)
-		personStore[p.orcid] = rec
-
-		dataStore[p.orcid] = map[string]map[int][]byte{
-			"work":       make(map[int][]byte),
-			"employment": make(map[int][]byte),
-		}
+		store.AddUser(p.orcid, createMockPerson(p.orcid, p.given, p.family, p.bio))
+		seedMockActivities(p.orcid)
 	}
+	captureSeedState(store)
 }
 
 // --- Handlers ---
 
-func main() {
-	// Configure structured logger with Debug level
-	opts := &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+// Main runs the moat command: it reads the flags and MOAT_* settings, then
+// serves until SIGINT or SIGTERM
+func Main() {
+	logHandler, err := getLogHandler(os.Stdout)
+	if err != nil {
+		slog.Error("Invalid logging settings", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(slog.New(logHandler))
+
+	if path := os.Getenv("MOAT_JOURNEYS"); path != "" {
+		if err := loadJourneys(path); err != nil {
+			slog.Error("Unable to load OAuth journeys", "path", path, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if path := os.Getenv("MOAT_FAULTS"); path != "" {
+		if err := loadFaults(path); err != nil {
+			slog.Error("Unable to load fault rules", "path", path, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if dir := os.Getenv("MOAT_RECORDINGS"); dir != "" || os.Getenv("MOAT_PROXY") != "" {
+		if err := setupProxy(os.Getenv("MOAT_PROXY"), dir); err != nil {
+			slog.Error("Unable to set up record and replay", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Replaying ORCID recordings", "dir", dir, "upstream", os.Getenv("MOAT_PROXY"))
+	}
+
+	if path := os.Getenv("MOAT_SCENARIOS"); path != "" {
+		if err := loadScenarios(path); err != nil {
+			slog.Error("Unable to load scenarios", "path", path, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	rate, err := getRateLimit()
+	if err != nil {
+		slog.Error("Invalid rate limit", "error", err)
+		os.Exit(1)
+	}
+	if rate.Rate > 0 {
+		setRateLimit(rate)
+		slog.Info("Rate limiting", "rate", rate.Rate, "burst", rate.Burst)
+	}
+
+	size, err := getJournalSize()
+	if err != nil {
+		slog.Error("Invalid MOAT_JOURNAL_SIZE", "error", err)
+		os.Exit(1)
+	}
+	setJournalSize(size)
+
+	seedMaintenance, err = getMaintenance()
+	if err != nil {
+		slog.Error("Invalid MOAT_MAINTENANCE", "error", err)
+		os.Exit(1)
+	}
+	if seedMaintenance != nil {
+		resetMaintenance()
+		slog.Warn("Starting in maintenance mode", "retry-after", seedMaintenance.RetryAfter)
+	}
+
+	chaosSettings, err := getChaos()
+	if err != nil {
+		slog.Error("Invalid chaos mode", "error", err)
+		os.Exit(1)
+	}
+	if chaosSettings.Rate > 0 {
+		setChaos(chaosSettings)
+		slog.Warn("Chaos mode is on", "rate", chaosSettings.Rate, "modes", chaosSettings.Modes)
+	}
+
+	setCORS(getCORS())
+
+	dripSettings, err := getDrip()
+	if err != nil {
+		slog.Error("Invalid slow drip", "error", err)
+		os.Exit(1)
+	}
+	if dripSettings.Delay > 0 {
+		setDrip(dripSettings)
+		slog.Warn("Dripping responses", "bytes", dripSettings.Bytes, "delay", dripSettings.Delay)
+	}
+
+	delay, err := getLatency()
+	if err != nil {
+		slog.Error("Invalid MOAT_LATENCY", "error", err)
+		os.Exit(1)
+	}
+	if delay > 0 {
+		setLatency(delay)
+		slog.Warn("Adding latency", "latency", delay)
+	}
+
+	seed, seeded, err := getRandomSeed()
+	if err != nil {
+		slog.Error("Invalid MOAT_RANDOM_SEED", "error", err)
+		os.Exit(1)
+	}
+	if seeded {
+		ids.Seed(seed)
+	}
+
+	consentPage = os.Getenv("MOAT_CONSENT_PAGE") != ""
+
+	ttl, err := getTokenTTL()
+	if err != nil {
+		slog.Error("Invalid MOAT_TOKEN_TTL", "error", err)
+		os.Exit(1)
+	}
+	tokenTTL = ttl
+
+	expiry, err := getItemTTL()
+	if err != nil {
+		slog.Error("Invalid MOAT_ITEM_TTL", "error", err)
+		os.Exit(1)
 	}
-	logger := slog.New(slog.NewTextHandler(os.Stdout, opts))
-	slog.SetDefault(logger)
+	if expiry > 0 {
+		startExpiry(expiry)
+	}
+
+	if path := os.Getenv("MOAT_FIXTURES"); path != "" {
+		if err := loadFixtures(path); err != nil {
+			slog.Error("Unable to load fixtures", "path", path, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if path := os.Getenv("MOAT_IMPORT"); path != "" {
+		n, err := loadORCIDXML(path)
+		if err != nil {
+			slog.Error("Unable to import ORCID records", "path", path, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Imported ORCID records", "path", path, "records", n)
+	}
+
+	count, err := getSeedCount()
+	if err != nil {
+		slog.Error("Invalid MOAT_SEED_COUNT", "error", err)
+		os.Exit(1)
+	}
+	if count > 0 {
+		seedFakeResearchers(count, ids.Rand())
+		slog.Info("Generated researchers", "count", count)
+	}
+
+	captureSeedState(store)
 
-	handler := setupRouter()
+	storeSpec := flag.String("store", "", "storage backend: memory, file:<dir> or bolt:<file> (overrides MOAT_DATA_DIR)")
+	tlsCert := flag.String("tls-cert", "", "serve HTTPS with this PEM certificate (needs --tls-key)")
+	tlsKey := flag.String("tls-key", "", "PEM private key for --tls-cert")
+	tlsSelfSigned := flag.Bool("tls-self-signed", false, "serve HTTPS with a certificate for localhost made at startup")
+	debug := flag.Bool("debug", false, "serve net/http/pprof profiles under /debug/pprof/ on the main port")
+	flag.Parse()
 
+	var files snapshotFiles
+	if dir := os.Getenv("MOAT_DATA_DIR"); dir != "" {
+		files = &dataDir{path: dir}
+	}
+	if *storeSpec != "" {
+		var err error
+		if files, err = parseStoreSpec(*storeSpec); err != nil {
+			slog.Error("Invalid --store", "error", err)
+			os.Exit(1)
+		}
+	}
+	var data *saver
+	if files != nil {
+		if data, err = openSaver(files); err != nil {
+			slog.Error("Unable to open data store", "store", files, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := openAccessLog(); err != nil {
+		slog.Error("Unable to open access log", "error", err)
+		os.Exit(1)
+	}
+
+	shutdownTimeout, err := getShutdownTimeout()
+	if err != nil {
+		slog.Error("Invalid MOAT_SHUTDOWN_TIMEOUT", "error", err)
+		os.Exit(1)
+	}
+
+	tlsSettings, err := tlsConfig(*tlsCert, *tlsKey, *tlsSelfSigned)
+	if err != nil {
+		slog.Error("Invalid TLS settings", "error", err)
+		os.Exit(1)
+	}
+	scheme := "http"
+	if tlsSettings != nil {
+		scheme = "https"
+	}
+
+	hosts, err := getHosts()
+	if err != nil {
+		slog.Error("Invalid MOAT_HOSTS", "error", err)
+		os.Exit(1)
+	}
+
+	activated, err := activatedListeners()
+	if err != nil {
+		slog.Error("Unable to use systemd sockets", "error", err)
+		os.Exit(1)
+	}
+
+	pubPort := getPublicPort()
+	if activated != nil {
+		pubPort = ""
+		if l := activated["public"]; l != nil {
+			pubPort = listenerPort(l)
+		}
+	}
+	mainSurface := combinedSurface
+	if pubPort != "" || requireToken() {
+		mainSurface = memberSurface
+	}
+	api := setupRouter()
+	handler, pubHandler := onSurface(mainSurface, hosts, api), onSurface(publicSurface, hosts, api)
+	if *debug {
+		handler = withPprof(handler)
+	}
+
+	var servers []*http.Server
+	listeners := map[*http.Server]net.Listener{}
 	port := getPort()
+	if activated != nil {
+		port = listenerPort(activated["main"])
+	}
+	if pubPort != "" {
+		fmt.Printf("ORCID v3 public API running on %s\n", pubPort)
+		srv := &http.Server{Addr: pubPort, Handler: withTenant(pubHandler), TLSConfig: tlsSettings}
+		servers = append(servers, srv)
+		listeners[srv] = activated["public"]
+	}
+	srv := &http.Server{Addr: port, Handler: withTenant(handler), TLSConfig: tlsSettings}
+	servers = append(servers, srv)
+	listeners[srv] = activated["main"]
+
 	fmt.Printf("ORCID v3 Mock Service running on %s (Version: %s)\n", port, Version)
-	fmt.Printf("Try: curl -X POST http://localhost%s/oauth/token -d 'client_id=APP-123&grant_type=client_credentials'\n", port)
-	if err := http.ListenAndServe(port, handler); err != nil {
+	fmt.Printf("Try: curl -X POST %s://localhost%s/oauth/token -d 'client_id=APP-123&grant_type=client_credentials'\n", scheme, port)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = serve(ctx, servers, listeners, shutdownTimeout)
+	if data != nil {
+		if ferr := data.flush(); ferr != nil {
+			slog.Error("Unable to save data", "store", data.files, "error", ferr)
+		}
+	}
+	if err != nil {
 		slog.Error("Unable to start MOAT", "error", err)
+		os.Exit(1)
 	}
 }
 
 func setupRouter() http.Handler {
-	mux := http.NewServeMux()
+	// Middleware for logging and content type
+	return withRequestID(withAccessLog(withCORS(withDrip(withLatency(withChaos(middleware(routes().ServeMux)))))))
+}
+
+// routes registers every endpoint moat serves
+func routes() *routeMux {
+	mux := newRouteMux()
 
 	// 1. OAuth Token Endpoint
 	mux.HandleFunc("POST /oauth/token", handleToken)
 	mux.HandleFunc("GET /oauth/authorize", handleAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", handleConsent)
+	mux.HandleFunc("GET /oauth/userinfo", handleUserInfo)
+	mux.HandleFunc("GET /oauth/jwks", handleJWKS)
+	mux.HandleFunc("GET /.well-known/openid-configuration", handleDiscovery)
 
 	// 2. Record Retrieval (Public & Member)
 	mux.HandleFunc("GET /v3.0/{orcid}/record", handleGetRecord)
 	mux.HandleFunc("GET /v3.0/{orcid}/person", handleGetPerson)
+	mux.HandleFunc("GET /v3.0/{orcid}/activities", handleGetActivities)
+	mux.HandleFunc("GET /v3.0/{orcid}/educations", sectionSummaryHandler(sectionEducation, func(a Activities) any {
+		return EducationsResponse{EducationSummaryGroup: a.Educations}
+	}))
+	mux.HandleFunc("GET /v3.0/{orcid}/employments", sectionSummaryHandler(sectionEmployment, func(a Activities) any {
+		return EmploymentsResponse{EmploymentSummaryGroup: a.Employment}
+	}))
+	mux.HandleFunc("GET /v3.0/{orcid}/fundings", sectionSummaryHandler(sectionFunding, func(a Activities) any {
+		return FundingsResponse{FundingSummaryGroup: a.Fundings}
+	}))
+	mux.HandleFunc("GET /v3.0/{orcid}/peer-reviews", sectionSummaryHandler(sectionPeerReview, func(a Activities) any {
+		return PeerReviewsResponse{PeerReviewSummaryGroup: a.PeerReviews}
+	}))
 
 	// 3. Works (GET, POST, PUT, DELETE)
-	mux.HandleFunc("GET /v3.0/{orcid}/work/{putCode}", handleGetWork)
-	mux.HandleFunc("POST /v3.0/{orcid}/work", handlePostWork)
-	mux.HandleFunc("PUT /v3.0/{orcid}/work/{putCode}", handlePutWork)
+	registerActivity[GenericWorkResponse](mux, sectionWork)
 
-	// 4. Employment (GET, POST, PUT, DELETE)
-	mux.HandleFunc("GET /v3.0/{orcid}/employment/{putCode}", handleGetEmployment)
-	mux.HandleFunc("POST /v3.0/{orcid}/employment", handlePostEmployment)
-	mux.HandleFunc("PUT /v3.0/{orcid}/employment/{putCode}", handlePutEmployment)
+	mux.HandleFunc("POST /v3.0/{orcid}/works", handlePostWorks)
+	mux.HandleFunc("GET /v3.0/{orcid}/works/{putCodes}", handleGetWorks)
 
-	// 5. Search
+	// 4. Employment (GET, POST, PUT, DELETE)
+	registerActivity[GenericEmploymentResponse](mux, sectionEmployment)
+
+	// 5. Funding and other affiliations (GET, POST, PUT, DELETE)
+	registerActivity[GenericFundingResponse](mux, sectionFunding)
+	registerActivity[GenericEducationResponse](mux, sectionEducation)
+	registerActivity[GenericInvitedPositionResponse](mux, sectionInvitedPosition)
+	registerActivity[GenericMembershipResponse](mux, sectionMembership)
+	registerActivity[GenericQualificationResponse](mux, sectionQualification)
+	registerActivity[GenericPeerReviewResponse](mux, sectionPeerReview)
+
+	// 6. Biographical sections
+	mux.HandleFunc("GET /v3.0/{orcid}/personal-details", handleGetPersonalDetails)
+	mux.HandleFunc("GET /v3.0/{orcid}/biography", handleGetBiography)
+	mux.HandleFunc("GET /v3.0/{orcid}/email", handleGetEmails)
+	registerPersonSection(mux, "address", addressSection)
+	registerPersonSection(mux, "external-identifiers", externalIdentifierSection)
+
+	// 7. Notifications
+	mux.HandleFunc("POST /v3.0/{orcid}/notification-permission", handlePostNotification)
+	mux.HandleFunc("GET /v3.0/{orcid}/notification-permission/{putCode}", handleGetNotification)
+	mux.HandleFunc("DELETE /v3.0/{orcid}/notification-permission/{putCode}", handleArchiveNotification)
+
+	// 8. Search
 	mux.HandleFunc("GET /v3.0/search", handleSearch)
-
-	// Middleware for logging and content type
-	return middleware(mux)
+	mux.HandleFunc("GET /v3.0/csv-search", handleCSVSearch)
+
+	// 9. API description
+	mux.HandleFunc("GET /openapi.json", handleOpenAPI)
+	mux.HandleFunc("GET /docs", handleDocs)
+
+	// 10. Admin API
+	mux.HandleFunc("GET /__admin/{$}", handleAdminDashboard)
+	mux.HandleFunc("GET /__admin/users", handleAdminListUsers)
+	mux.HandleFunc("POST /__admin/users", handleAdminCreateUser)
+	mux.HandleFunc("GET /__admin/users/{orcid}", handleAdminGetUser)
+	mux.HandleFunc("PUT /__admin/users/{orcid}", handleAdminUpdateUser)
+	mux.HandleFunc("DELETE /__admin/users/{orcid}", handleAdminDeleteUser)
+	mux.HandleFunc("GET /__admin/users/{orcid}/items", handleAdminListItems)
+	mux.HandleFunc("GET /__admin/users/{orcid}/notifications", handleAdminListNotifications)
+	mux.HandleFunc("GET /__admin/users/{orcid}/status", handleAdminGetStatus)
+	mux.HandleFunc("PUT /__admin/users/{orcid}/status", handleAdminPutStatus)
+	mux.HandleFunc("DELETE /__admin/users/{orcid}/status", handleAdminDeleteStatus)
+	mux.HandleFunc("POST /__admin/import", handleAdminImport)
+	mux.HandleFunc("POST /__admin/reset", handleAdminReset)
+	mux.HandleFunc("GET /__admin/state", handleAdminGetState)
+	mux.HandleFunc("PUT /__admin/state", handleAdminPutState)
+	mux.HandleFunc("GET /__admin/clients", handleAdminListClients)
+	mux.HandleFunc("POST /__admin/clients", handleAdminRegisterClient)
+	mux.HandleFunc("GET /__admin/faults", handleAdminListFaults)
+	mux.HandleFunc("POST /__admin/faults", handleAdminAddFault)
+	mux.HandleFunc("DELETE /__admin/faults", handleAdminClearFaults)
+	mux.HandleFunc("DELETE /__admin/faults/{id}", handleAdminDeleteFault)
+	mux.HandleFunc("GET /__admin/scenarios", handleAdminListScenarios)
+	mux.HandleFunc("PUT /__admin/scenarios/{name}/state", handleAdminPutScenarioState)
+	mux.HandleFunc("GET /__admin/stubs", handleAdminListStubs)
+	mux.HandleFunc("POST /__admin/stubs", handleAdminAddStub)
+	mux.HandleFunc("DELETE /__admin/stubs", handleAdminClearStubs)
+	mux.HandleFunc("DELETE /__admin/stubs/{id}", handleAdminDeleteStub)
+	mux.HandleFunc("GET /__admin/requests", handleAdminListRequests)
+	mux.HandleFunc("DELETE /__admin/requests", handleAdminClearRequests)
+	mux.HandleFunc("GET /__admin/clock", handleAdminGetClock)
+	mux.HandleFunc("PUT /__admin/clock", handleAdminPutClock)
+	mux.HandleFunc("DELETE /__admin/clock", handleAdminResetClock)
+	mux.HandleFunc("POST /__admin/clock/advance", handleAdminAdvanceClock)
+	mux.HandleFunc("GET /__admin/maintenance", handleAdminGetMaintenance)
+	mux.HandleFunc("PUT /__admin/maintenance", handleAdminPutMaintenance)
+	mux.HandleFunc("DELETE /__admin/maintenance", handleAdminDeleteMaintenance)
+	mux.HandleFunc("POST /__admin/verify", handleAdminVerify)
+	mux.HandleFunc("GET /__admin/tenants", handleAdminListTenants)
+	mux.HandleFunc("DELETE /__admin/tenants/{name}", handleAdminDeleteTenant)
+
+	// 11. Group-id records. Their put-code routes would conflict with
+	// /v3.0/{orcid}/record and friends, so they get a mux of their own
+	groups := groupRecordRoutes()
+	root := newRouteMux()
+	root.mount("/", mux)
+	root.mount("/v3.0/group-id-record", groups)
+	root.mount("/v3.0/group-id-record/", groups)
+	return root
 }
 
 func middleware(next http.Handler) http.Handler {
@@ -218,11 +749,20 @@ func middleware(next http.Handler) http.Handler {
 		// Try to extract handler name if next is a ServeMux
 		handlerName := "unknown"
 		if mux, ok := next.(*http.ServeMux); ok {
-			if h, pattern := mux.Handler(r); pattern != "" {
+			h, pattern := mux.Handler(r)
+			for sub, ok := h.(*http.ServeMux); ok; sub, ok = h.(*http.ServeMux) {
+				h, pattern = sub.Handler(r)
+			}
+			if pattern != "" {
 				name := runtime.FuncForPC(reflect.ValueOf(h).Pointer()).Name()
 				if idx := strings.LastIndex(name, "."); idx != -1 {
 					name = name[idx+1:]
 				}
+				// Generated handlers are closures ("func1") or method values
+				// ("handleList-fm"); the route says more
+				if strings.HasPrefix(name, "func") || strings.HasSuffix(name, "-fm") {
+					name = pattern
+				}
 				handlerName = name
 			}
 		}
@@ -237,7 +777,7 @@ func middleware(next http.Handler) http.Handler {
 			}
 		}
 
-		slog.Debug("Handling request",
+		slog.DebugContext(r.Context(), "Handling request",
 			"handler-name", handlerName,
 			"headers", r.Header,
 			"body", bodyLog,
@@ -245,12 +785,47 @@ func middleware(next http.Handler) http.Handler {
 
 		// We do NOT set default Content-Type here anymore, because it depends on the endpoint and accept header.
 		// However, we can set a safe default like JSON if we want, but writeResponse will override it.
-		w.Header().Set("Access-Control-Allow-Origin", "*")
 
 		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
-		next.ServeHTTP(rw, r)
+		if offSurface(rw, r) {
+			// Not served on the surface it arrived on
+		} else if inMaintenance(rw, r) {
+			// ORCID is down for maintenance
+		} else if limitRate(rw, r) {
+			// Over the rate limit
+		} else if injectFault(rw, r) {
+			// A fault rule answered instead
+		} else if playStub(rw, r) {
+			// A stub answered instead
+		} else if playScenario(rw, r) {
+			// A scenario step answered instead
+		} else if playMagicORCID(rw, r) {
+			// A magic iD answered instead
+		} else if playRecording(rw, r) {
+			// Answered from the ORCID sandbox or a recording of it
+		} else if e := checkContentType(r); e != nil {
+			writeError(rw, r, e)
+		} else if e := checkORCID(r); e != nil {
+			writeError(rw, r, e)
+		} else if e := checkRecordStatus(r); e != nil {
+			writeError(rw, r, e)
+		} else {
+			next.ServeHTTP(rw, r)
+		}
 
-		slog.Info("Request processed",
+		recordRequest(JournalEntry{
+			Time:      start,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Query:     r.URL.RawQuery,
+			Headers:   r.Header.Clone(),
+			Body:      bodyLog,
+			Handler:   handlerName,
+			Status:    rw.status,
+			RequestID: requestID(r.Context()),
+		})
+
+		slog.InfoContext(r.Context(), "Request processed",
 			"method", r.Method,
 			"path", r.URL.Path,
 			"status", rw.status,
@@ -269,285 +844,193 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-// writeResponse handles content negotiation for /v3.0/ endpoints
-func writeResponse(w http.ResponseWriter, r *http.Request, data interface{}) {
-	accept := r.Header.Get("Accept")
+// --- Error Responses ---
 
-	// Check if request is for /v3.0/
-	isV3 := strings.HasPrefix(r.URL.Path, "/v3.0/")
+// writeError sends e as ORCID's error body, negotiated like any other response
+func writeError(w http.ResponseWriter, r *http.Request, e *orciderr.Error) {
+	writeResponseStatus(w, r, e.ResponseCode, e)
+}
 
-	// Default to JSON unless it's v3.0 AND (JSON is NOT explicitly requested OR XML IS requested)
-	// Actually, easier logic:
-	// If Accept contains "json", use JSON.
-	// Else if isV3, use XML.
-	// Else default to JSON.
+func recordNotFound(orcid string) *orciderr.Error {
+	return orciderr.Newf(orciderr.RecordNotFound, "Not Found: No record found for %s", orcid)
+}
 
-	useXML := false
-	if isV3 {
-		if strings.Contains(accept, "application/json") {
-			useXML = false
-		} else {
-			// If JSON is not requested, default to XML for v3.0
-			useXML = true
-		}
-	} else {
-		// Non-v3 endpoints (like oauth) default to JSON
-		useXML = false
-	}
+func itemNotFound(item, putCode string) *orciderr.Error {
+	return orciderr.Newf(orciderr.ItemNotFound, "Not Found: No %s found with put-code %s", item, putCode)
+}
 
-	if useXML {
-		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+func invalidPayload(item string, err error) *orciderr.Error {
+	return orciderr.Newf(orciderr.InvalidMessage, "Bad Request: Invalid incoming %s: %v", item, err)
+}
+
+// writeResponse handles content negotiation for /v3.0/ endpoints
+func writeResponse(w http.ResponseWriter, r *http.Request, data interface{}) {
+	writeResponseStatus(w, r, http.StatusOK, data)
+}
+
+// writeResponseStatus is writeResponse with a status other than 200. The status
+// is sent after Content-Type is set, so don't call WriteHeader beforehand.
+func writeResponseStatus(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
+	mediaType := responseType(r)
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.WriteHeader(status)
+
+	if strings.HasSuffix(mediaType, "xml") {
 		w.Write([]byte(xml.Header))
 		if err := xml.NewEncoder(w).Encode(data); err != nil {
-			slog.Error("Failed to encode XML response", "error", err)
+			slog.ErrorContext(r.Context(), "Failed to encode XML response", "error", err)
 		}
 	} else {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		if err := json.NewEncoder(w).Encode(data); err != nil {
-			slog.Error("Failed to encode JSON response", "error", err)
+			slog.ErrorContext(r.Context(), "Failed to encode JSON response", "error", err)
 		}
 	}
 }
 
-// --- Endpoint Implementations ---
-
-func handleToken(w http.ResponseWriter, r *http.Request) {
-	// Parse form data
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
-
-	// Mock response
-	resp := TokenResponse{
-		AccessToken:  "mock-access-token-12345",
-		TokenType:    "bearer",
-		RefreshToken: "mock-refresh-token-67890",
-		ExpiresIn:    631138518, // ~20 years
-		Scope:        "/read-limited /activities/update",
-		Name:         "Sofia Garcia",
-		ORCID:        "0000-0001-2345-6789",
+// decodeBody reads a request body as XML or JSON, going by its Content-Type
+func decodeBody(r *http.Request, v interface{}) error {
+	if isXMLBody(r) {
+		return xml.NewDecoder(r.Body).Decode(v)
 	}
-
-	// Token endpoint always returns JSON
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(w).Encode(resp)
+	return json.NewDecoder(r.Body).Decode(v)
 }
 
-func handleAuthorize(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	redirectURI := query.Get("redirect_uri")
-	state := query.Get("state")
-
-	if redirectURI == "" {
-		http.Error(w, "Missing redirect_uri", http.StatusBadRequest)
-		return
-	}
-
-	// In a real app, we would show a login screen here.
-	// Since this is a mock, we immediately redirect with a code.
-
-	code := "mock-auth-code-12345"
-	target := fmt.Sprintf("%s?code=%s", redirectURI, code)
-	if state != "" {
-		target += "&state=" + state
-	}
-
-	http.Redirect(w, r, target, http.StatusFound)
-}
+// --- Endpoint Implementations ---
 
 func handleGetRecord(w http.ResponseWriter, r *http.Request) {
 	orcid := r.PathValue("orcid")
+	if notModified(w, r, orcid, recordSections...) {
+		return
+	}
 
-	storeMutex.RLock()
-	record, ok := personStore[orcid]
-	storeMutex.RUnlock()
-
+	v := viewerFor(r, orcid)
+	record, ok := storeFor(r).VisibleRecord(orcid, v.item)
 	if !ok {
-		http.Error(w, "Record not found", http.StatusNotFound)
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
 		return
 	}
+	record.Person = v.person(record.Person)
 
 	writeResponse(w, r, record)
 }
 
 func handleGetPerson(w http.ResponseWriter, r *http.Request) {
 	orcid := r.PathValue("orcid")
+	if notModified(w, r, orcid, "") {
+		return
+	}
 
-	storeMutex.RLock()
-	record, ok := personStore[orcid]
-	storeMutex.RUnlock()
-
+	person, ok := personFor(r, orcid)
 	if !ok {
-		http.Error(w, "Person not found", http.StatusNotFound)
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
 		return
 	}
 
-	writeResponse(w, r, record.Person)
+	writeResponse(w, r, person)
 }
 
-// --- Generic Activity Handlers ---
-
-// Helper struct for generic responses (needs XML tags too)
-type GenericWorkResponse struct {
-	XMLName         xml.Name `json:"-" xml:"work:work"`
-	Type            string   `json:"type" xml:"type"`
-	PutCode         int      `json:"put-code" xml:"put-code"`
-	Title           Title    `json:"title" xml:"title"`
-	PublicationDate DateYear `json:"publication-date" xml:"publication-date"`
-}
-
-type DateYear struct {
-	Year Value `json:"year" xml:"year"`
-}
-
-func handleGetWork(w http.ResponseWriter, r *http.Request) {
-	// In a real mock, you'd fetch specific JSON from dataStore
-	// Here we return a generic work for any putCode
-	putCode, _ := strconv.Atoi(r.PathValue("putCode"))
+func handleGetActivities(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+	if notModified(w, r, orcid, activitySections...) {
+		return
+	}
 
-	response := GenericWorkResponse{
-		Type:    "work",
-		PutCode: putCode,
-		Title: Title{
-			Title: Value{Value: "Retrieved Mock Work"},
-		},
-		PublicationDate: DateYear{
-			Year: Value{Value: "2023"},
-		},
+	activities, ok := storeFor(r).VisibleActivities(orcid, viewerFor(r, orcid).item)
+	if !ok {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
 	}
 
-	writeResponse(w, r, response)
+	writeResponse(w, r, ActivitiesResponse{Activities: activities})
 }
 
-func handlePostWork(w http.ResponseWriter, r *http.Request) {
-	orcid := r.PathValue("orcid")
-	// Generate a new PutCode
-	newPutCode := rand.Intn(999999) + 100000
-
-	// In a real implementation, you would decode the body and save it
-	// body, _ := io.ReadAll(r.Body)
-	// saveToStore(orcid, "work", newPutCode, body)
-
-	w.Header().Set("Location", fmt.Sprintf("https://api.orcid.org/v3.0/%s/work/%d", orcid, newPutCode))
-	w.WriteHeader(http.StatusCreated)
+// sectionSummaryHandler serves a single section of the activities summary,
+// e.g. /fundings, wrapped by pick in its own root element
+func sectionSummaryHandler(section string, pick func(Activities) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		orcid := r.PathValue("orcid")
+		if notModified(w, r, orcid, section) {
+			return
+		}
+		activities, ok := storeFor(r).VisibleActivities(orcid, viewerFor(r, orcid).item)
+		if !ok {
+			writeError(w, r, recordNotFound(r.PathValue("orcid")))
+			return
+		}
 
-	// ORCID returns the put-code in the body as well sometimes, or just empty 201
-	// We'll mimic returning the put-code for convenience
-	// Create a simple struct for this response
-	type PutCodeResponse struct {
-		XMLName xml.Name `json:"-" xml:"response"`
-		PutCode int      `json:"put-code" xml:"put-code"`
+		writeResponse(w, r, pick(activities))
 	}
-
-	writeResponse(w, r, PutCodeResponse{PutCode: newPutCode})
 }
 
-func handlePutWork(w http.ResponseWriter, r *http.Request) {
-	orcid := r.PathValue("orcid")
-	putCode := r.PathValue("putCode")
-
-	// Update logic would go here
-
-	w.Header().Set("Location", fmt.Sprintf("https://api.orcid.org/v3.0/%s/work/%s", orcid, putCode))
-	w.WriteHeader(http.StatusOK)
-
-	type UpdateResponse struct {
-		XMLName xml.Name `json:"-" xml:"response"`
-		PutCode string   `json:"put-code" xml:"put-code"`
-		Status  string   `json:"status" xml:"status"`
-	}
+// --- Generic Activity Handlers ---
 
-	writeResponse(w, r, UpdateResponse{PutCode: putCode, Status: "updated"})
+// GenericWorkResponse is a work as moat stores it and serves it in JSON. Its
+// XML is ORCID's, written through models.Work (see workxml.go)
+type GenericWorkResponse struct {
+	Type             string            `json:"type"`
+	PutCode          int               `json:"put-code"`
+	Title            Title             `json:"title"`
+	JournalTitle     *Value            `json:"journal-title,omitempty"`
+	ShortDescription string            `json:"short-description,omitempty"`
+	Citation         *Citation         `json:"citation,omitempty"`
+	PublicationDate  DateYear          `json:"publication-date"`
+	ExternalIDs      *ExternalIDs      `json:"external-ids,omitempty"`
+	URL              *Value            `json:"url,omitempty"`
+	Contributors     *WorkContributors `json:"contributors,omitempty"`
+	LanguageCode     string            `json:"language-code,omitempty"`
+	ActivityMeta
 }
 
-// Helper structs for employment
-type GenericEmploymentResponse struct {
-	XMLName        xml.Name `json:"-" xml:"employment:employment"`
-	PutCode        int      `json:"put-code" xml:"put-code"`
-	DepartmentName string   `json:"department-name" xml:"department-name"`
-	RoleTitle      string   `json:"role-title" xml:"role-title"`
-	Organization   Org      `json:"organization" xml:"organization"`
-	StartDate      DateYear `json:"start-date" xml:"start-date"`
+// Citation is a work's citation in one of ORCID's citation types (bibtex,
+// ris, formatted-apa, ...)
+type Citation struct {
+	Type  string `json:"citation-type" xml:"citation-type"`
+	Value string `json:"citation-value" xml:"citation-value"`
 }
 
-func handleGetEmployment(w http.ResponseWriter, r *http.Request) {
-	putCode, _ := strconv.Atoi(r.PathValue("putCode"))
-
-	response := GenericEmploymentResponse{
-		PutCode:        putCode,
-		DepartmentName: "Mock Department",
-		RoleTitle:      "Mock Researcher",
-		Organization:   Org{Name: "Mock Org"},
-		StartDate: DateYear{
-			Year: Value{Value: "2020"},
-		},
-	}
-	writeResponse(w, r, response)
+type WorkContributors struct {
+	Contributor []WorkContributor `json:"contributor" xml:"contributor"`
 }
 
-func handlePostEmployment(w http.ResponseWriter, r *http.Request) {
-	orcid := r.PathValue("orcid")
-	newPutCode := rand.Intn(999999) + 100000
-
-	w.Header().Set("Location", fmt.Sprintf("https://api.orcid.org/v3.0/%s/employment/%d", orcid, newPutCode))
-	w.WriteHeader(http.StatusCreated)
-
-	type PutCodeResponse struct {
-		XMLName xml.Name `json:"-" xml:"response"`
-		PutCode int      `json:"put-code" xml:"put-code"`
-	}
-
-	writeResponse(w, r, PutCodeResponse{PutCode: newPutCode})
+// WorkContributor is one author, editor, ... of a work, named by iD, credit
+// name or both
+type WorkContributor struct {
+	ContributorORCID *OrcidIdentifier       `json:"contributor-orcid,omitempty" xml:"contributor-orcid,omitempty"`
+	CreditName       *Value                 `json:"credit-name,omitempty" xml:"credit-name,omitempty"`
+	ContributorEmail *Value                 `json:"contributor-email,omitempty" xml:"contributor-email,omitempty"`
+	Attributes       *ContributorAttributes `json:"contributor-attributes,omitempty" xml:"contributor-attributes,omitempty"`
 }
 
-func handlePutEmployment(w http.ResponseWriter, r *http.Request) {
-	orcid := r.PathValue("orcid")
-	putCode := r.PathValue("putCode")
-
-	w.Header().Set("Location", fmt.Sprintf("https://api.orcid.org/v3.0/%s/employment/%s", orcid, putCode))
-	w.WriteHeader(http.StatusOK)
-
-	type UpdateResponse struct {
-		XMLName xml.Name `json:"-" xml:"response"`
-		PutCode string   `json:"put-code" xml:"put-code"`
-		Status  string   `json:"status" xml:"status"`
-	}
-
-	writeResponse(w, r, UpdateResponse{PutCode: putCode, Status: "updated"})
+type ContributorAttributes struct {
+	Sequence string `json:"contributor-sequence,omitempty" xml:"contributor-sequence,omitempty"`
+	Role     string `json:"contributor-role,omitempty" xml:"contributor-role,omitempty"`
 }
 
-func handleSearch(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-
-	// Simple mock: if query contains "error", return error, else return fake results
-	if strings.Contains(query, "error") {
-		http.Error(w, "Search failed", http.StatusInternalServerError)
-		return
-	}
+type ExternalIDs struct {
+	ExternalID []ExternalID `json:"external-id" xml:"external-id"`
+}
 
-	resp := SearchResponse{
-		NumFound: 1,
-		Result: []SearchResult{
-			{
-				OrcidIdentifier: OrcidIdentifier{
-					Uri:  "https://orcid.org/0000-0001-2345-6789",
-					Path: "0000-0001-2345-6789",
-					Host: "orcid.org",
-				},
-			},
-		},
-	}
+type ExternalID struct {
+	Type         string `json:"external-id-type" xml:"external-id-type"`
+	Value        string `json:"external-id-value" xml:"external-id-value"`
+	URL          *Value `json:"external-id-url,omitempty" xml:"external-id-url,omitempty"`
+	Relationship string `json:"external-id-relationship,omitempty" xml:"external-id-relationship,omitempty"`
+}
 
-	writeResponse(w, r, resp)
+// DateYear is ORCID's fuzzy date: a year, optionally narrowed by month and day
+type DateYear struct {
+	Year  Value  `json:"year" xml:"year"`
+	Month *Value `json:"month,omitempty" xml:"month,omitempty"`
+	Day   *Value `json:"day,omitempty" xml:"day,omitempty"`
 }
 
-func createMockRecord(orcid, givenName, familyName, bio string) OrcidRecord {
-	now := time.Now().UTC().Format("2006-01-02T15:04:05Z")
+func createMockPerson(orcid, givenName, familyName, bio string) models.Person {
+	now := *timestamp()
 	strPtr := func(s string) *string { return &s }
 
-	person := models.Person{
-		Path: orcid,
+	return models.Person{
+		Path:             orcid,
+		LastModifiedDate: strPtr(now),
 		Name: &models.PersonName{
 			Visibility:       "PUBLIC",
 			CreatedDate:      strPtr(now),
@@ -562,26 +1045,7 @@ func createMockRecord(orcid, givenName, familyName, bio string) OrcidRecord {
 			LastModifiedDate: strPtr(now),
 			Content:          bio,
 		},
-		Emails: &models.Emails{
-			Emails: []*models.Email{
-				{
-					Visibility:       "PUBLIC",
-					CreatedDate:      strPtr(now),
-					LastModifiedDate: strPtr(now),
-					Email:            fmt.Sprintf("%s.%s@mock.edu", strings.ToLower(givenName), strings.ToLower(familyName)),
-					Source: &models.Source{
-						SourceOrcid: &models.SourceOrcid{
-							Uri:  fmt.Sprintf("https://orcid.org/%s", orcid),
-							Path: orcid,
-							Host: "orcid.org",
-						},
-						SourceName: &models.SourceName{
-							Value: "MOAT Service",
-						},
-					},
-				},
-			},
-		},
+		Emails: mockEmails(orcid, fmt.Sprintf("%s.%s@mock.edu", strings.ToLower(givenName), strings.ToLower(familyName))),
 		ResearcherUrls: &models.ResearcherUrls{
 			LastModifiedDate: strPtr(now),
 			ResearcherUrls: []*models.ResearcherUrl{
@@ -605,43 +1069,32 @@ func createMockRecord(orcid, givenName, familyName, bio string) OrcidRecord {
 			},
 		},
 	}
+}
 
-	return OrcidRecord{
-		OrcidIdentifier: OrcidIdentifier{
-			Uri:  fmt.Sprintf("https://orcid.org/%s", orcid),
-			Path: orcid,
-			Host: "orcid.org",
-		},
-		Person: person,
-		Activities: Activities{
-			Works: WorkSummaryGroup{
-				Group: []WorkGroup{
-					{
-						WorkSummary: []WorkSummary{
-							{
-								PutCode:      123456,
-								Title:        Title{Title: Value{Value: "Mock Paper Title"}},
-								Type:         "journal-article",
-								LastModified: LastModified{Value: time.Now().UnixMilli()},
-							},
-						},
-					},
-				},
-			},
-			Employment: EmploymentSummaryGroup{
-				AffiliationGroup: []AffiliationGroup{
-					{
-						Summaries: []EmploymentSummary{
-							{
-								PutCode:        789012,
-								DepartmentName: "Mock Department",
-								RoleTitle:      "Mock Researcher",
-								Organization:   Org{Name: "Mock University"},
-							},
-						},
-					},
-				},
-			},
-		},
+// seedMockActivities stores the demo work and employment every seeded user starts with
+func seedMockActivities(orcid string) {
+	work, _ := json.Marshal(GenericWorkResponse{
+		Type:    "journal-article",
+		PutCode: 123456,
+		Title:   Title{Title: Value{Value: "Mock Paper Title"}},
+	})
+	ids.ReservePutCode(orcid, 123456)
+	store.PutItem(orcid, sectionWork, 123456, work)
+
+	employment, _ := json.Marshal(GenericEmploymentResponse{Affiliation: Affiliation{
+		PutCode:        789012,
+		DepartmentName: "Mock Department",
+		RoleTitle:      "Mock Researcher",
+		Organization:   Org{Name: "Mock University"},
+	}})
+	ids.ReservePutCode(orcid, 789012)
+	store.PutItem(orcid, sectionEmployment, 789012, employment)
+}
+
+func newOrcidIdentifier(orcid string) OrcidIdentifier {
+	return OrcidIdentifier{
+		Uri:  fmt.Sprintf("https://orcid.org/%s", orcid),
+		Path: orcid,
+		Host: "orcid.org",
 	}
 }
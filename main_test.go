@@ -1,7 +1,9 @@
-package main
+package moat
 
 import (
 	"encoding/json"
+	"encoding/xml"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -9,6 +11,7 @@ import (
 	"testing"
 
 	"moat/models"
+	"moat/orciderr"
 )
 
 func TestHandleAuthorize(t *testing.T) {
@@ -120,7 +123,7 @@ func TestHandleGetPerson(t *testing.T) {
 
 func TestHandleGetWork(t *testing.T) {
 	handler := setupRouter()
-	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/work/123", nil)
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/work/123456", nil)
 	w := httptest.NewRecorder()
 
 	handler.ServeHTTP(w, req)
@@ -128,11 +131,33 @@ func TestHandleGetWork(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status OK, got %v", w.Code)
 	}
+
+	// Unknown put-codes are not found
+	req = httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/work/123", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found, got %v", w.Code)
+	}
+	if e, err := orciderr.Decode(w.Body); err != nil || e.ErrorCode != orciderr.ItemNotFound {
+		t.Errorf("Expected error code 9016, got %+v, %v", e, err)
+	}
+
+	// The same put-code on an unknown record is a missing record
+	req = httptest.NewRequest("GET", "/v3.0/0000-0009-9999-9999/work/123456", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if e, err := orciderr.Decode(w.Body); err != nil || w.Code != http.StatusNotFound || e.ErrorCode != orciderr.RecordNotFound {
+		t.Errorf("Expected error code 9038, got %v: %+v, %v", w.Code, e, err)
+	}
 }
 
 func TestHandlePostWork(t *testing.T) {
 	handler := setupRouter()
-	req := httptest.NewRequest("POST", "/v3.0/0000-0001-2345-6789/work", nil)
+	body := `{"type": "book", "title": {"title": {"value": "Round Trip"}}, "publication-date": {"year": {"value": "2024"}}}`
+	req := httptest.NewRequest("POST", "/v3.0/0000-0001-2345-6789/work", strings.NewReader(body))
 	w := httptest.NewRecorder()
 
 	handler.ServeHTTP(w, req)
@@ -141,14 +166,100 @@ func TestHandlePostWork(t *testing.T) {
 		t.Errorf("Expected status Created, got %v", w.Code)
 	}
 
-	if w.Header().Get("Location") == "" {
-		t.Error("Expected Location header")
+	location := w.Header().Get("Location")
+	if location == "" {
+		t.Fatal("Expected Location header")
+	}
+
+	req = httptest.NewRequest("GET", strings.TrimPrefix(location, "https://api.orcid.org"), nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var work GenericWorkResponse
+	if err := json.NewDecoder(w.Body).Decode(&work); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if work.Title.Title.Value != "Round Trip" || work.PublicationDate.Year.Value != "2024" {
+		t.Errorf("Expected the posted work back, got %+v", work)
+	}
+	if work.Source == nil || work.Source.SourceName.Value != "MOAT Service" || work.LastModifiedDate == nil {
+		t.Errorf("Expected source and last-modified-date to be filled in, got %+v", work.ActivityMeta)
+	}
+}
+
+func TestRichWorkRoundTrip(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	body := `{
+		"type": "journal-article",
+		"title": {"title": {"value": "Rich Metadata"}},
+		"journal-title": {"value": "Journal of Mock Studies"},
+		"short-description": "A work with every field set.",
+		"citation": {"citation-type": "bibtex", "citation-value": "@article{mock2024}"},
+		"publication-date": {"year": {"value": "2024"}, "month": {"value": "03"}},
+		"external-ids": {"external-id": [{"external-id-type": "doi", "external-id-value": "10.5555/rich", "external-id-url": {"value": "https://doi.org/10.5555/rich"}, "external-id-relationship": "self"}]},
+		"url": {"value": "https://example.org/rich"},
+		"contributors": {"contributor": [
+			{"contributor-orcid": {"uri": "https://orcid.org/0000-0001-2345-6789", "path": "0000-0001-2345-6789", "host": "orcid.org"},
+			 "credit-name": {"value": "S. Garcia"}, "contributor-attributes": {"contributor-sequence": "first", "contributor-role": "author"}},
+			{"credit-name": {"value": "A. Editor"}, "contributor-attributes": {"contributor-sequence": "additional", "contributor-role": "editor"}}
+		]},
+		"language-code": "en"
+	}`
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/work", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v: %s", w.Code, w.Body)
+	}
+	loc := w.Header().Get("Location")
+
+	req = httptest.NewRequest("GET", loc[strings.Index(loc, "/v3.0/"):], nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var work GenericWorkResponse
+	if err := json.NewDecoder(w.Body).Decode(&work); err != nil {
+		t.Fatal(err)
+	}
+	if work.JournalTitle == nil || work.JournalTitle.Value != "Journal of Mock Studies" ||
+		work.ShortDescription != "A work with every field set." || work.LanguageCode != "en" ||
+		work.URL == nil || work.URL.Value != "https://example.org/rich" {
+		t.Errorf("Expected the descriptive fields back, got %+v", work)
+	}
+	if work.Citation == nil || work.Citation.Type != "bibtex" || work.Citation.Value != "@article{mock2024}" {
+		t.Errorf("Expected the citation back, got %+v", work.Citation)
+	}
+	if id := work.ExternalIDs.ExternalID[0]; id.Relationship != "self" || id.URL == nil || id.URL.Value != "https://doi.org/10.5555/rich" {
+		t.Errorf("Expected the external id with its relationship and URL, got %+v", id)
+	}
+	if work.Contributors == nil || len(work.Contributors.Contributor) != 2 {
+		t.Fatalf("Expected both contributors, got %+v", work.Contributors)
+	}
+	if c := work.Contributors.Contributor[0]; c.ContributorORCID == nil || c.ContributorORCID.Path != orcid || c.Attributes.Role != "author" {
+		t.Errorf("Expected the first contributor's iD and role, got %+v", c)
+	}
+	if c := work.Contributors.Contributor[1]; c.CreditName.Value != "A. Editor" || c.Attributes.Sequence != "additional" {
+		t.Errorf("Expected the second contributor, got %+v", c)
+	}
+
+	req = httptest.NewRequest("GET", "/v3.0/"+orcid+"/activities", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `"journal-title":{"value":"Journal of Mock Studies"}`) {
+		t.Errorf("Expected the journal title in the work summary, got %s", w.Body)
 	}
 }
 
 func TestHandlePutWork(t *testing.T) {
 	handler := setupRouter()
-	req := httptest.NewRequest("PUT", "/v3.0/0000-0001-2345-6789/work/123", nil)
+	body := `{"type": "journal-article", "title": {"title": {"value": "Updated Paper"}}}`
+	req := httptest.NewRequest("PUT", "/v3.0/0000-0006-9009-0000/work/123456", strings.NewReader(body))
 	w := httptest.NewRecorder()
 
 	handler.ServeHTTP(w, req)
@@ -156,11 +267,51 @@ func TestHandlePutWork(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status OK, got %v", w.Code)
 	}
+
+	req = httptest.NewRequest("GET", "/v3.0/0000-0006-9009-0000/work/123456", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var work GenericWorkResponse
+	json.NewDecoder(w.Body).Decode(&work)
+	if work.Title.Title.Value != "Updated Paper" || work.PutCode != 123456 {
+		t.Errorf("Expected the updated work, got %+v", work)
+	}
+
+	req = httptest.NewRequest("PUT", "/v3.0/0000-0006-9009-0000/work/123", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found for an unknown put-code, got %v", w.Code)
+	}
+}
+
+func TestHandleGetEmployments(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/employments", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status OK, got %v", w.Code)
+	}
+
+	var resp EmploymentsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Errorf("Failed to decode response: %v", err)
+	}
+
+	if len(resp.AffiliationGroup) != 1 || resp.AffiliationGroup[0].Summaries[0].PutCode != 789012 {
+		t.Errorf("Expected the seeded employment, got %+v", resp)
+	}
 }
 
 func TestHandleGetEmployment(t *testing.T) {
 	handler := setupRouter()
-	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/employment/123", nil)
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/employment/789012", nil)
 	w := httptest.NewRecorder()
 
 	handler.ServeHTTP(w, req)
@@ -168,11 +319,33 @@ func TestHandleGetEmployment(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status OK, got %v", w.Code)
 	}
+
+	req = httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/employment/123", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found, got %v", w.Code)
+	}
+	if e, err := orciderr.Decode(w.Body); err != nil || e.ErrorCode != orciderr.ItemNotFound {
+		t.Errorf("Expected error code 9016, got %+v, %v", e, err)
+	}
+
+	// The same put-code on an unknown record is a missing record
+	req = httptest.NewRequest("GET", "/v3.0/0000-0009-9999-9999/employment/789012", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if e, err := orciderr.Decode(w.Body); err != nil || w.Code != http.StatusNotFound || e.ErrorCode != orciderr.RecordNotFound {
+		t.Errorf("Expected error code 9038, got %v: %+v, %v", w.Code, e, err)
+	}
 }
 
 func TestHandlePostEmployment(t *testing.T) {
 	handler := setupRouter()
-	req := httptest.NewRequest("POST", "/v3.0/0000-0001-2345-6789/employment", nil)
+	body := `{"department-name": "Physics", "role-title": "Lecturer", "organization": {"name": "Example University"},
+		"start-date": {"year": {"value": "2019"}}, "end-date": {"year": {"value": "2023"}}}`
+	req := httptest.NewRequest("POST", "/v3.0/0000-0001-2345-6789/employment", strings.NewReader(body))
 	w := httptest.NewRecorder()
 
 	handler.ServeHTTP(w, req)
@@ -181,14 +354,31 @@ func TestHandlePostEmployment(t *testing.T) {
 		t.Errorf("Expected status Created, got %v", w.Code)
 	}
 
-	if w.Header().Get("Location") == "" {
-		t.Error("Expected Location header")
+	location := w.Header().Get("Location")
+	if location == "" {
+		t.Fatal("Expected Location header")
+	}
+
+	req = httptest.NewRequest("GET", strings.TrimPrefix(location, "https://api.orcid.org"), nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var emp GenericEmploymentResponse
+	if err := json.NewDecoder(w.Body).Decode(&emp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if emp.Organization.Name != "Example University" || emp.RoleTitle != "Lecturer" ||
+		emp.StartDate == nil || emp.StartDate.Year.Value != "2019" || emp.EndDate == nil || emp.EndDate.Year.Value != "2023" {
+		t.Errorf("Expected the posted employment back, got %+v", emp)
 	}
 }
 
 func TestHandlePutEmployment(t *testing.T) {
 	handler := setupRouter()
-	req := httptest.NewRequest("PUT", "/v3.0/0000-0001-2345-6789/employment/123", nil)
+	orcid := "0000-0006-9009-0000"
+	body := `{"department-name": "History", "role-title": "Professor", "organization": {"name": "Mock University"}}`
+	req := httptest.NewRequest("PUT", "/v3.0/"+orcid+"/employment/789012", strings.NewReader(body))
 	w := httptest.NewRecorder()
 
 	handler.ServeHTTP(w, req)
@@ -196,11 +386,46 @@ func TestHandlePutEmployment(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status OK, got %v", w.Code)
 	}
+
+	req = httptest.NewRequest("GET", "/v3.0/"+orcid+"/employment/789012", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var emp GenericEmploymentResponse
+	json.NewDecoder(w.Body).Decode(&emp)
+	if emp.RoleTitle != "Professor" || emp.PutCode != 789012 {
+		t.Errorf("Expected the updated employment, got %+v", emp)
+	}
+}
+
+func TestHandleDeleteEmployment(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0005-7007-8008"
+
+	req := httptest.NewRequest("DELETE", "/v3.0/"+orcid+"/employment/789012", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status No Content, got %v", w.Code)
+	}
+
+	// Deleting again finds nothing
+	req = httptest.NewRequest("DELETE", "/v3.0/"+orcid+"/employment/789012", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found, got %v", w.Code)
+	}
+
+	seedMockActivities(orcid)
 }
 
 func TestHandleSearch(t *testing.T) {
 	handler := setupRouter()
-	req := httptest.NewRequest("GET", "/v3.0/search?q=test", nil)
+	req := httptest.NewRequest("GET", "/v3.0/search?q=family-name:garcia", nil)
 	req.Header.Set("Accept", "application/json")
 	w := httptest.NewRecorder()
 
@@ -231,3 +456,109 @@ func TestHandleSearchError(t *testing.T) {
 		t.Errorf("Expected status 500, got %v", w.Code)
 	}
 }
+
+func TestHandleGetRecordIncludesEmptySections(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	var raw struct {
+		Activities map[string]json.RawMessage `json:"activities-summary"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&raw); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	for _, section := range []string{"fundings", "peer-reviews", "research-resources"} {
+		if got := string(raw.Activities[section]); got != `{"group":[]}` {
+			t.Errorf("Expected empty %s container, got %s", section, got)
+		}
+	}
+}
+
+func TestHandleGetActivities(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/activities", nil)
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status OK, got %v", w.Code)
+	}
+
+	elements := xmlElements(t, w.Body.String())
+	for _, section := range []string{"works", "employments", "fundings", "memberships", "peer-reviews", "research-resources"} {
+		if !elements[xml.Name{Space: activitiesNS, Local: section}] {
+			t.Errorf("Expected activities:%s in activities XML", section)
+		}
+	}
+}
+
+const activitiesNS = "http://www.orcid.org/ns/activities"
+
+// xmlElements returns the namespace-resolved names of every element in body
+func xmlElements(t *testing.T, body string) map[xml.Name]bool {
+	t.Helper()
+	names := make(map[xml.Name]bool)
+	d := xml.NewDecoder(strings.NewReader(body))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("Invalid XML: %v\n%s", err, body)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			names[start.Name] = true
+		}
+	}
+}
+
+func TestRecordXMLNamespaces(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+
+	elements := xmlElements(t, w.Body.String())
+	for _, name := range []xml.Name{
+		{Space: "http://www.orcid.org/ns/record", Local: "record"},
+		{Space: "http://www.orcid.org/ns/common", Local: "orcid-identifier"},
+		{Space: "http://www.orcid.org/ns/person", Local: "person"},
+		{Space: "http://www.orcid.org/ns/personal-details", Local: "given-names"},
+		{Space: activitiesNS, Local: "activities-summary"},
+		{Space: activitiesNS, Local: "works"},
+		{Space: activitiesNS, Local: "group"},
+		{Space: "http://www.orcid.org/ns/work", Local: "work-summary"},
+		{Space: "http://www.orcid.org/ns/work", Local: "title"},
+		{Space: "http://www.orcid.org/ns/employment", Local: "employment-summary"},
+		{Space: "http://www.orcid.org/ns/common", Local: "organization"},
+	} {
+		if !elements[name] {
+			t.Errorf("Expected {%s}%s in record XML", name.Space, name.Local)
+		}
+	}
+
+	// The record reads back as a record fixture would
+	var rec OrcidRecord
+	if err := xml.Unmarshal(w.Body.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.OrcidIdentifier.Path != "0000-0001-2345-6789" || rec.Person.Name == nil {
+		t.Fatalf("Unexpected record read back: %+v", rec)
+	}
+	for _, g := range rec.Activities.Works.Group {
+		if g.WorkSummary[0].PutCode == 123456 && g.WorkSummary[0].Title.Title.Value == "Mock Paper Title" {
+			return
+		}
+	}
+	t.Errorf("Expected the mock work to read back, got %+v", rec.Activities.Works)
+}
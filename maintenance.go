@@ -0,0 +1,140 @@
+package moat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"moat/orciderr"
+)
+
+// --- Maintenance Mode ---
+//
+// During a maintenance window ORCID answers every API call with 503 and a
+// Retry-After header. The body is usually its 9041 error, but at times it
+// has been the HTML maintenance page whatever the Accept header, which is
+// what trips clients up. Maintenance is switched on with MOAT_MAINTENANCE
+// or PUT /__admin/maintenance, and only affects /v3.0/.
+
+// defaultRetryAfter is the Retry-After sent when none is configured
+const defaultRetryAfter = 600
+
+// Maintenance describes a maintenance window
+type Maintenance struct {
+	// RetryAfter is the Retry-After header, in seconds
+	RetryAfter int `json:"retry_after"`
+	// HTML sends the maintenance page to every client, not just browsers
+	HTML bool `json:"html,omitempty"`
+}
+
+var (
+	maintenance      *Maintenance
+	seedMaintenance  *Maintenance
+	maintenanceMutex sync.Mutex
+)
+
+// maintenancePage is ORCID's maintenance page
+const maintenancePage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ORCID - Maintenance</title>
+</head>
+<body>
+<h1>ORCID is down for maintenance</h1>
+<p>We are performing scheduled maintenance and will be back shortly. Thank you for your patience.</p>
+</body>
+</html>
+`
+
+// getMaintenance reads MOAT_MAINTENANCE: "html" for the HTML page, or the
+// Retry-After in seconds, or anything else for the default
+func getMaintenance() (*Maintenance, error) {
+	v := os.Getenv("MOAT_MAINTENANCE")
+	switch v {
+	case "":
+		return nil, nil
+	case "html":
+		return &Maintenance{RetryAfter: defaultRetryAfter, HTML: true}, nil
+	}
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs <= 0 {
+		return nil, fmt.Errorf(`MOAT_MAINTENANCE must be a Retry-After in seconds or "html", got %q`, v)
+	}
+	return &Maintenance{RetryAfter: secs}, nil
+}
+
+// setMaintenance starts a maintenance window, or ends it if m is nil
+func setMaintenance(m *Maintenance) {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+	maintenance = m
+}
+
+// resetMaintenance goes back to the MOAT_MAINTENANCE setting
+func resetMaintenance() {
+	setMaintenance(seedMaintenance)
+}
+
+func currentMaintenance() *Maintenance {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+	return maintenance
+}
+
+// inMaintenance answers r with ORCID's 503 if a maintenance window is on,
+// reporting whether it did
+func inMaintenance(w http.ResponseWriter, r *http.Request) bool {
+	m := currentMaintenance()
+	if m == nil || !strings.HasPrefix(r.URL.Path, "/v3.0/") {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(m.RetryAfter))
+	if m.HTML || strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(maintenancePage))
+		return true
+	}
+	writeError(w, r, orciderr.New(orciderr.ServiceUnavailable))
+	return true
+}
+
+// handleAdminGetMaintenance reports the maintenance window, or 404 if
+// there's none
+func handleAdminGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	m := currentMaintenance()
+	if m == nil {
+		http.Error(w, "Not in maintenance", http.StatusNotFound)
+		return
+	}
+	writeResponse(w, r, m)
+}
+
+// handleAdminPutMaintenance starts a maintenance window
+func handleAdminPutMaintenance(w http.ResponseWriter, r *http.Request) {
+	var m Maintenance
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, "Invalid maintenance: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if m.RetryAfter < 0 {
+		http.Error(w, "Invalid maintenance: retry_after must not be negative", http.StatusBadRequest)
+		return
+	}
+	if m.RetryAfter == 0 {
+		m.RetryAfter = defaultRetryAfter
+	}
+	setMaintenance(&m)
+	writeResponse(w, r, m)
+}
+
+// handleAdminDeleteMaintenance ends the maintenance window
+func handleAdminDeleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	setMaintenance(nil)
+	w.WriteHeader(http.StatusNoContent)
+}
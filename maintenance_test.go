@@ -0,0 +1,77 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"moat/orciderr"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	t.Cleanup(func() { setMaintenance(nil) })
+	handler := setupRouter()
+	do := func(method, path, accept, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	record := "/v3.0/0000-0001-2345-6789/record"
+
+	if w := do("GET", "/__admin/maintenance", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected no maintenance window, got %v", w.Code)
+	}
+	if w := do("PUT", "/__admin/maintenance", "", `{"retry_after": 120}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected maintenance to start, got %v: %s", w.Code, w.Body)
+	}
+
+	w := do("GET", record, "application/json", "")
+	e, err := orciderr.Decode(w.Body)
+	if w.Code != http.StatusServiceUnavailable || err != nil || e.ErrorCode != orciderr.ServiceUnavailable || w.Header().Get("Retry-After") != "120" {
+		t.Errorf("Expected 503 with 9041 and Retry-After 120, got %v %q: %v, %v", w.Code, w.Header().Get("Retry-After"), e, err)
+	}
+	if w := do("GET", record, "text/html,application/xhtml+xml", ""); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "down for maintenance") {
+		t.Errorf("Expected browsers to get the maintenance page, got %v: %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/oauth/token", "application/json", "grant_type=client_credentials&client_id=APP-123"); w.Code == http.StatusServiceUnavailable {
+		t.Error("Expected OAuth to stay up")
+	}
+
+	// ORCID has sent its HTML page to API clients too
+	do("PUT", "/__admin/maintenance", "", `{"html": true}`)
+	w = do("GET", record, "application/json", "")
+	if w.Code != http.StatusServiceUnavailable || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || w.Header().Get("Retry-After") != "600" {
+		t.Errorf("Expected the HTML page with the default Retry-After, got %v %q %q", w.Code, w.Header().Get("Content-Type"), w.Header().Get("Retry-After"))
+	}
+
+	if w := do("DELETE", "/__admin/maintenance", "", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %v", w.Code)
+	}
+	if w := do("GET", record, "application/json", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the API back, got %v", w.Code)
+	}
+}
+
+func TestGetMaintenance(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    *Maintenance
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"300", &Maintenance{RetryAfter: 300}, false},
+		{"html", &Maintenance{RetryAfter: defaultRetryAfter, HTML: true}, false},
+		{"0", nil, true},
+		{"soon", nil, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("MOAT_MAINTENANCE", tt.value)
+		got, err := getMaintenance()
+		if (err != nil) != tt.wantErr || (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+			t.Errorf("getMaintenance(%q) = %+v, %v", tt.value, got, err)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package moat
+
+import (
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"moat/orciderr"
+)
+
+// --- Media Types ---
+//
+// ORCID only reads request bodies in its XML and JSON types, and answers
+// anything else with 415. moat does the same for /v3.0/ writes, but still
+// reads a body sent with no Content-Type at all, as JSON, as it always has.
+
+// orcidMediaTypes are the Content-Types ORCID accepts on POST and PUT
+var orcidMediaTypes = []string{
+	"application/xml",
+	"application/json",
+	"application/vnd.orcid+xml",
+	"application/vnd.orcid+json",
+}
+
+// checkContentType returns a 415 error if r writes to the API with a body
+// type ORCID wouldn't accept
+func checkContentType(r *http.Request) *orciderr.Error {
+	if !strings.HasPrefix(r.URL.Path, "/v3.0/") || (r.Method != http.MethodPost && r.Method != http.MethodPut) {
+		return nil
+	}
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil || !slices.Contains(orcidMediaTypes, mediaType) {
+		return orciderr.Newf(orciderr.UnsupportedMediaType, "Unsupported Media Type: %s is not one of %s", ct, strings.Join(orcidMediaTypes, ", "))
+	}
+	return nil
+}
+
+// responseTypes are the types /v3.0/ can answer in, in order of preference
+// when the Accept header leaves a tie
+var responseTypes = []string{
+	"application/xml",
+	"application/json",
+	"application/vnd.orcid+xml",
+	"application/vnd.orcid+json",
+}
+
+// acceptRange is one media range of an Accept header
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept splits an Accept header into its media ranges, skipping any
+// that don't parse
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				q = 0
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType, q})
+	}
+	return ranges
+}
+
+// specificity is how closely the range matches mediaType: 2 for the type
+// itself, 1 for type/*, 0 for */* and -1 for no match
+func (a acceptRange) specificity(mediaType string) int {
+	switch {
+	case a.mediaType == mediaType:
+		return 2
+	case a.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(a.mediaType, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a.mediaType, "*")):
+		return 1
+	}
+	return -1
+}
+
+// negotiate picks the offered type the Accept header prefers: the highest
+// q-value, taken from the most specific range matching each type, then the
+// more specific match, then the range listed first, then offer order. It
+// returns "" if nothing offered is acceptable.
+func negotiate(header string, offered []string) string {
+	ranges := parseAccept(header)
+	best, bestQ, bestSpec, bestPos := "", 0.0, -1, 0
+	for _, mediaType := range offered {
+		q, spec, pos := 0.0, -1, 0
+		for i, a := range ranges {
+			if s := a.specificity(mediaType); s > spec {
+				q, spec, pos = a.q, s, i
+			}
+		}
+		if q == 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && (spec > bestSpec || (spec == bestSpec && pos < bestPos))) {
+			best, bestQ, bestSpec, bestPos = mediaType, q, spec, pos
+		}
+	}
+	return best
+}
+
+// responseType picks the media type of r's response. /v3.0/ answers in the
+// type its Accept header prefers, XML if it has none or accepts none of
+// them; everything else is JSON.
+func responseType(r *http.Request) string {
+	if !strings.HasPrefix(r.URL.Path, "/v3.0/") {
+		return "application/json"
+	}
+	if mediaType := negotiate(r.Header.Get("Accept"), responseTypes); mediaType != "" {
+		return mediaType
+	}
+	return "application/xml"
+}
+
+// isXMLBody reports whether r's body is one of ORCID's XML types
+func isXMLBody(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/xml" || mediaType == "application/vnd.orcid+xml"
+}
@@ -0,0 +1,118 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"moat/orciderr"
+)
+
+func TestUnsupportedMediaType(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	body := `{"type": "book", "title": {"title": {"value": "Typed"}}}`
+
+	tests := []struct {
+		contentType string
+		status      int
+	}{
+		{"application/json", http.StatusCreated},
+		{"application/json; charset=utf-8", http.StatusCreated},
+		{"application/vnd.orcid+json", http.StatusCreated},
+		{"", http.StatusCreated},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"application/json-patch+json", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v3.0/0000-0001-2345-6789/work", strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.status {
+			t.Errorf("Content-Type %q: expected status %v, got %v", tt.contentType, tt.status, w.Code)
+			continue
+		}
+		if tt.status != http.StatusUnsupportedMediaType {
+			continue
+		}
+		if e, err := orciderr.Decode(w.Body); err != nil || e.ErrorCode != orciderr.UnsupportedMediaType {
+			t.Errorf("Content-Type %q: expected error code 9013, got %+v, %v", tt.contentType, e, err)
+		}
+	}
+
+	// Only API writes are checked
+	req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader("client_id=APP-123&grant_type=client_credentials"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the token endpoint to take a form, got %v", w.Code)
+	}
+}
+
+func TestVendorMediaTypes(t *testing.T) {
+	handler := setupRouter()
+
+	tests := []struct {
+		accept, contentType string
+	}{
+		{"application/vnd.orcid+json", "application/vnd.orcid+json"},
+		{"application/vnd.orcid+xml", "application/vnd.orcid+xml"},
+		{"application/json", "application/json"},
+		{"", "application/xml"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/work/123456", nil)
+		req.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType+";") {
+			t.Errorf("Accept %q: expected %s, got %s", tt.accept, tt.contentType, got)
+		}
+		if isJSON := strings.HasPrefix(w.Body.String(), "{"); isJSON != strings.HasSuffix(tt.contentType, "json") {
+			t.Errorf("Accept %q: body doesn't match %s: %s", tt.accept, tt.contentType, w.Body)
+		}
+	}
+
+	// A vnd.orcid+xml body is read as XML
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	req := httptest.NewRequest("POST", "/v3.0/0000-0001-2345-6789/address", strings.NewReader(
+		`<address:address xmlns:address="http://www.orcid.org/ns/address"><address:country>IS</address:country></address:address>`))
+	req.Header.Set("Content-Type", "application/vnd.orcid+xml")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected a vnd.orcid+xml address to be created, got %v: %s", w.Code, w.Body)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept, want string
+	}{
+		{"", ""},
+		{"application/json", "application/json"},
+		{"application/xml;q=0.9, application/json", "application/json"},
+		{"application/json;q=0.5, application/xml;q=0.8", "application/xml"},
+		{"application/json, */*", "application/json"},
+		{"*/*", "application/xml"},
+		{"application/*;q=0.5, application/vnd.orcid+json", "application/vnd.orcid+json"},
+		{"application/*, application/xml;q=0", "application/json"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "application/xml"},
+		{"text/html", ""},
+		{"application/json;q=oops, application/xml;q=0.1", "application/xml"},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.accept, responseTypes); got != tt.want {
+			t.Errorf("Accept %q: expected %q, got %q", tt.accept, tt.want, got)
+		}
+	}
+}
@@ -79,6 +79,8 @@ type Emails struct {
 
 type Email struct {
 	Visibility       string  `xml:"visibility,attr,omitempty"`
+	Verified         *bool   `xml:"verified,attr,omitempty"`
+	Primary          *bool   `xml:"primary,attr,omitempty"`
 	CreatedDate      *string `xml:"http://www.orcid.org/ns/common created-date"`
 	LastModifiedDate *string `xml:"http://www.orcid.org/ns/common last-modified-date"`
 	Source           *Source `xml:"http://www.orcid.org/ns/common source"`
@@ -127,8 +129,9 @@ type ExternalIdentifier struct {
 }
 
 type Source struct {
-	SourceOrcid *SourceOrcid `xml:"http://www.orcid.org/ns/common source-orcid"`
-	SourceName  *SourceName  `xml:"http://www.orcid.org/ns/common source-name"`
+	SourceOrcid    *SourceOrcid    `xml:"http://www.orcid.org/ns/common source-orcid"`
+	SourceClientID *SourceClientID `xml:"http://www.orcid.org/ns/common source-client-id"`
+	SourceName     *SourceName     `xml:"http://www.orcid.org/ns/common source-name"`
 }
 
 type SourceOrcid struct {
@@ -137,6 +140,12 @@ type SourceOrcid struct {
 	Host string `xml:"http://www.orcid.org/ns/common host,omitempty"`
 }
 
+type SourceClientID struct {
+	Uri  string `xml:"http://www.orcid.org/ns/common uri,omitempty"`
+	Path string `xml:"http://www.orcid.org/ns/common path,omitempty"`
+	Host string `xml:"http://www.orcid.org/ns/common host,omitempty"`
+}
+
 type SourceName struct {
 	Value string `xml:",chardata"`
 }
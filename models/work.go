@@ -0,0 +1,101 @@
+package models
+
+import "encoding/xml"
+
+// Work is a v3.0 work element, as GET /v3.0/{orcid}/work/{put-code} returns
+// it in XML, with each element in its orcid.org namespace
+type Work struct {
+	XMLName           xml.Name `xml:"http://www.orcid.org/ns/work work"`
+	XmlnsCommon       string   `xml:"xmlns:common,attr,omitempty"`
+	XmlnsWork         string   `xml:"xmlns:work,attr,omitempty"`
+	XmlnsXsi          string   `xml:"xmlns:xsi,attr,omitempty"`
+	XsiSchemaLocation string   `xml:"http://www.w3.org/2001/XMLSchema-instance schemaLocation,attr,omitempty"`
+	PutCode           string   `xml:"put-code,attr,omitempty"`
+	Path              string   `xml:"path,attr,omitempty"`
+	Visibility        string   `xml:"visibility,attr,omitempty"`
+
+	CreatedDate      *string           `xml:"http://www.orcid.org/ns/common created-date"`
+	LastModifiedDate *string           `xml:"http://www.orcid.org/ns/common last-modified-date"`
+	Source           *Source           `xml:"http://www.orcid.org/ns/common source"`
+	Title            *WorkTitle        `xml:"http://www.orcid.org/ns/work title"`
+	JournalTitle     string            `xml:"http://www.orcid.org/ns/work journal-title,omitempty"`
+	ShortDescription string            `xml:"http://www.orcid.org/ns/work short-description,omitempty"`
+	Citation         *WorkCitation     `xml:"http://www.orcid.org/ns/work citation"`
+	Type             string            `xml:"http://www.orcid.org/ns/work type"`
+	PublicationDate  *PublicationDate  `xml:"http://www.orcid.org/ns/common publication-date"`
+	ExternalIds      *ExternalIds      `xml:"http://www.orcid.org/ns/common external-ids"`
+	Url              string            `xml:"http://www.orcid.org/ns/common url,omitempty"`
+	Contributors     *WorkContributors `xml:"http://www.orcid.org/ns/work contributors"`
+	LanguageCode     string            `xml:"http://www.orcid.org/ns/common language-code,omitempty"`
+	Country          *Country          `xml:"http://www.orcid.org/ns/common country"`
+}
+
+type WorkTitle struct {
+	Title           string           `xml:"http://www.orcid.org/ns/common title"`
+	Subtitle        string           `xml:"http://www.orcid.org/ns/common subtitle,omitempty"`
+	TranslatedTitle *TranslatedTitle `xml:"http://www.orcid.org/ns/common translated-title"`
+}
+
+type TranslatedTitle struct {
+	LanguageCode string `xml:"language-code,attr"`
+	Value        string `xml:",chardata"`
+}
+
+// WorkCitation is the work in one of ORCID's citation types (bibtex, ris,
+// formatted-apa, ...)
+type WorkCitation struct {
+	CitationType  string `xml:"http://www.orcid.org/ns/work citation-type"`
+	CitationValue string `xml:"http://www.orcid.org/ns/work citation-value"`
+}
+
+type PublicationDate struct {
+	Year  string `xml:"http://www.orcid.org/ns/common year"`
+	Month string `xml:"http://www.orcid.org/ns/common month,omitempty"`
+	Day   string `xml:"http://www.orcid.org/ns/common day,omitempty"`
+}
+
+type ExternalIds struct {
+	ExternalIds []*ExternalId `xml:"http://www.orcid.org/ns/common external-id"`
+}
+
+type ExternalId struct {
+	ExternalIdType         string                `xml:"http://www.orcid.org/ns/common external-id-type"`
+	ExternalIdValue        string                `xml:"http://www.orcid.org/ns/common external-id-value"`
+	ExternalIdNormalized   *ExternalIdNormalized `xml:"http://www.orcid.org/ns/common external-id-normalized"`
+	ExternalIdUrl          string                `xml:"http://www.orcid.org/ns/common external-id-url,omitempty"`
+	ExternalIdRelationship string                `xml:"http://www.orcid.org/ns/common external-id-relationship,omitempty"`
+}
+
+// ExternalIdNormalized is the value as ORCID normalizes it; it is computed,
+// so ORCID marks it transient and ignores it in submitted works
+type ExternalIdNormalized struct {
+	Transient bool   `xml:"transient,attr,omitempty"`
+	Value     string `xml:",chardata"`
+}
+
+type WorkContributors struct {
+	Contributors []*WorkContributor `xml:"http://www.orcid.org/ns/work contributor"`
+}
+
+type WorkContributor struct {
+	ContributorOrcid      *ContributorOrcid      `xml:"http://www.orcid.org/ns/common contributor-orcid"`
+	CreditName            string                 `xml:"http://www.orcid.org/ns/work credit-name,omitempty"`
+	ContributorEmail      string                 `xml:"http://www.orcid.org/ns/work contributor-email,omitempty"`
+	ContributorAttributes *ContributorAttributes `xml:"http://www.orcid.org/ns/work contributor-attributes"`
+}
+
+type ContributorOrcid struct {
+	Uri  string `xml:"http://www.orcid.org/ns/common uri,omitempty"`
+	Path string `xml:"http://www.orcid.org/ns/common path,omitempty"`
+	Host string `xml:"http://www.orcid.org/ns/common host,omitempty"`
+}
+
+type ContributorAttributes struct {
+	ContributorSequence string `xml:"http://www.orcid.org/ns/work contributor-sequence,omitempty"`
+	ContributorRole     string `xml:"http://www.orcid.org/ns/work contributor-role,omitempty"`
+}
+
+type Country struct {
+	Visibility string `xml:"visibility,attr,omitempty"`
+	Value      string `xml:",chardata"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"encoding/xml"
+	"os"
+	"testing"
+)
+
+func TestWorkRoundTrip(t *testing.T) {
+	originalData, err := os.ReadFile("testdata/work.xml")
+	if err != nil {
+		t.Fatalf("Failed to read test file: %v", err)
+	}
+
+	var w Work
+	if err := xml.Unmarshal(originalData, &w); err != nil {
+		t.Fatalf("Failed to unmarshal original XML: %v", err)
+	}
+	if w.PutCode != "733536" || w.Citation == nil || w.Citation.CitationType != "bibtex" ||
+		w.ExternalIds == nil || len(w.ExternalIds.ExternalIds) != 2 ||
+		w.Contributors == nil || len(w.Contributors.Contributors) != 2 {
+		t.Fatalf("Expected the put-code, citation, external IDs and contributors, got %+v", w)
+	}
+
+	generatedData, err := xml.MarshalIndent(w, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal work: %v", err)
+	}
+	if err := assertXMLEqual(originalData, generatedData); err != nil {
+		t.Errorf("XML Round-trip verification failed: %v", err)
+		t.Logf("Generated XML:\n%s", string(generatedData))
+	}
+}
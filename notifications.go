@@ -0,0 +1,153 @@
+package moat
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"moat/orciderr"
+)
+
+// --- Notifications ---
+//
+// Member clients can ask a researcher for permission via the notification
+// INBOX. Notifications are kept per user in the store's notification
+// section, which sits alongside the activity sections but is not part of
+// the activities summary.
+
+const sectionNotification = "notification"
+
+type NotificationPermission struct {
+	XMLName             xml.Name           `json:"-" xml:"notification:notification"`
+	PutCode             int                `json:"put-code" xml:"put-code"`
+	NotificationType    string             `json:"notification-type" xml:"notification-type"`
+	AuthorizationURL    *AuthorizationURL  `json:"authorization-url" xml:"authorization-url"`
+	NotificationSubject string             `json:"notification-subject,omitempty" xml:"notification-subject,omitempty"`
+	NotificationIntro   string             `json:"notification-intro,omitempty" xml:"notification-intro,omitempty"`
+	Items               *NotificationItems `json:"items,omitempty" xml:"items,omitempty"`
+	CreatedDate         string             `json:"created-date,omitempty" xml:"created-date,omitempty"`
+	ArchivedDate        string             `json:"archived-date,omitempty" xml:"archived-date,omitempty"`
+}
+
+type AuthorizationURL struct {
+	Path string `json:"path" xml:"path"`
+	Host string `json:"host" xml:"host"`
+}
+
+type NotificationItems struct {
+	Item []NotificationItem `json:"item" xml:"item"`
+}
+
+type NotificationItem struct {
+	ItemType   string      `json:"item-type" xml:"item-type"`
+	ItemName   string      `json:"item-name" xml:"item-name"`
+	ExternalID *ExternalID `json:"external-id,omitempty" xml:"external-id,omitempty"`
+}
+
+func notificationLocation(orcid string, putCode int) string {
+	return fmt.Sprintf("https://api.orcid.org/v3.0/%s/notification-permission/%d", orcid, putCode)
+}
+
+func handlePostNotification(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+	if !storeFor(r).HasUser(orcid) {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
+	}
+
+	var n NotificationPermission
+	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+		writeError(w, r, invalidPayload("notification", err))
+		return
+	}
+	if n.AuthorizationURL == nil || (n.AuthorizationURL.Path == "" && n.AuthorizationURL.Host == "") {
+		writeError(w, r, orciderr.Newf(orciderr.MissingRequiredElement, "Bad Request: authorization-url is required"))
+		return
+	}
+
+	n.PutCode = ids.PutCode(orcid)
+	n.NotificationType = "PERMISSION"
+	n.CreatedDate = *timestamp()
+	n.ArchivedDate = ""
+	data, _ := json.Marshal(n)
+	storeFor(r).UpdateItems(orcid, sectionNotification, func(items map[int]*Item) error {
+		items[n.PutCode] = createdItem(n.PutCode, data)
+		return nil
+	})
+
+	type PutCodeResponse struct {
+		XMLName xml.Name `json:"-" xml:"response"`
+		PutCode int      `json:"put-code" xml:"put-code"`
+	}
+
+	w.Header().Set("Location", notificationLocation(orcid, n.PutCode))
+	writeResponseStatus(w, r, http.StatusCreated, PutCodeResponse{PutCode: n.PutCode})
+}
+
+func handleGetNotification(w http.ResponseWriter, r *http.Request) {
+	putCode, err := strconv.Atoi(r.PathValue("putCode"))
+	if err != nil {
+		writeError(w, r, itemNotFound("notification", r.PathValue("putCode")))
+		return
+	}
+	n, ok := loadActivity[NotificationPermission](storeFor(r), r.PathValue("orcid"), sectionNotification, putCode)
+	if !ok {
+		writeError(w, r, itemNotFound("notification", r.PathValue("putCode")))
+		return
+	}
+	writeResponse(w, r, n)
+}
+
+// handleArchiveNotification flags a notification as archived. As in the real
+// API, DELETE doesn't remove it: the archived notification is returned and
+// stays readable.
+func handleArchiveNotification(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+	putCode, err := strconv.Atoi(r.PathValue("putCode"))
+	if err != nil {
+		writeError(w, r, itemNotFound("notification", r.PathValue("putCode")))
+		return
+	}
+
+	var n NotificationPermission
+	err = storeFor(r).UpdateItems(orcid, sectionNotification, func(items map[int]*Item) error {
+		it, ok := items[putCode]
+		if !ok {
+			return errItemNotFound
+		}
+		if err := json.Unmarshal(it.Data, &n); err != nil {
+			return err
+		}
+		if n.ArchivedDate == "" {
+			n.ArchivedDate = *timestamp()
+		}
+		data, _ := json.Marshal(n)
+		items[putCode] = &Item{PutCode: putCode, Data: data, Modified: clock.Now(), Expires: it.Expires}
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, itemNotFound("notification", r.PathValue("putCode")))
+		return
+	}
+	writeResponse(w, r, n)
+}
+
+// AdminNotificationsResponse lists every notification sent to a user
+type AdminNotificationsResponse struct {
+	ORCID         string                   `json:"orcid"`
+	Notifications []NotificationPermission `json:"notifications"`
+}
+
+func handleAdminListNotifications(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+	items, ok := storeFor(r).Items(orcid, sectionNotification)
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	resp := AdminNotificationsResponse{ORCID: orcid, Notifications: decodeItems[NotificationPermission](items, nil)}
+	writeResponse(w, r, resp)
+}
@@ -0,0 +1,62 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNotificationLifecycle(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0005-7007-8008"
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("POST", "/v3.0/"+orcid+"/notification-permission", `{"notification-intro": "No URL"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status Bad Request without authorization-url, got %v", w.Code)
+	}
+
+	w := do("POST", "/v3.0/"+orcid+"/notification-permission", `{
+		"notification-subject": "Connect your ORCID iD",
+		"authorization-url": {"path": "/oauth/authorize?client_id=APP-1", "host": "orcid.org"},
+		"items": {"item": [{"item-type": "work", "item-name": "Mock Paper"}]}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v", w.Code)
+	}
+	loc := w.Header().Get("Location")
+	item := loc[strings.Index(loc, "/v3.0/"):]
+
+	w = do("GET", item, "")
+	var n NotificationPermission
+	if err := json.NewDecoder(w.Body).Decode(&n); err != nil {
+		t.Fatalf("Failed to decode notification: %v", err)
+	}
+	if n.NotificationType != "PERMISSION" || n.CreatedDate == "" || n.ArchivedDate != "" {
+		t.Errorf("Unexpected notification %+v", n)
+	}
+
+	w = do("DELETE", item, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK on archive, got %v", w.Code)
+	}
+	if err := json.NewDecoder(w.Body).Decode(&n); err != nil || n.ArchivedDate == "" {
+		t.Errorf("Expected archived-date after DELETE: %v %+v", err, n)
+	}
+
+	w = do("GET", "/__admin/users/"+orcid+"/notifications", "")
+	var list AdminNotificationsResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode admin listing: %v", err)
+	}
+	if len(list.Notifications) != 1 || list.Notifications[0].ArchivedDate == "" {
+		t.Errorf("Expected one archived notification in admin listing, got %+v", list)
+	}
+}
@@ -0,0 +1,493 @@
+package moat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- OAuth ---
+//
+// /oauth/authorize issues single-use authorization codes, each bound to the
+// client_id and redirect_uri it was requested with and to the researcher who
+// approved it. /oauth/token checks and consumes them on the
+// authorization_code grant, so clients that lose their redirect_uri or reuse
+// a code get the invalid_grant a real server would send.
+
+// authGrant is what a researcher approved when a code was issued
+type authGrant struct {
+	ClientID    string
+	RedirectURI string
+	ORCID       string
+	Scope       string
+	Nonce       string
+}
+
+// issuedToken is an access token moat has handed out
+type issuedToken struct {
+	ClientID string
+	ORCID    string
+	Scope    string
+	// Expires is when the token stops working; for a refresh token, that is
+	// ORCID's full token lifetime after it was issued, whatever the access
+	// token's, so an expired access token can still be refreshed
+	Expires time.Time
+	// AccessToken is, for a refresh token, the access token issued with it
+	AccessToken string
+}
+
+// expired reports whether t is past its expires_in
+func (t issuedToken) expired() bool {
+	return clock.Now().After(t.Expires)
+}
+
+// defaultTokenLifetime is ORCID's ~20 year access token lifetime, in seconds
+const defaultTokenLifetime = 631138518
+
+// tokenTTL is the access token lifetime, set from MOAT_TOKEN_TTL at startup;
+// zero means the ORCID default
+var tokenTTL time.Duration
+
+// getTokenTTL parses MOAT_TOKEN_TTL, either a number of seconds or a Go
+// duration such as "5m"
+func getTokenTTL() (time.Duration, error) {
+	return envDuration("MOAT_TOKEN_TTL")
+}
+
+// tokenLifetime returns the expires_in for tokens issued in ctx, which may
+// come from a Server with its own lifetime
+func tokenLifetime(ctx context.Context) int {
+	ttl := tokenTTL
+	if srv := serverFor(ctx); srv != nil && srv.tokenTTL != nil {
+		ttl = *srv.tokenTTL
+	}
+	if ttl > 0 {
+		return int(ttl / time.Second)
+	}
+	return defaultTokenLifetime
+}
+
+// expiredTokenGrace is how long an expired access token is remembered, so
+// callers are told it expired rather than that it is unknown
+const expiredTokenGrace = 24 * time.Hour
+
+// minTokenSweep is the fewest remembered tokens recordToken sweeps at
+const minTokenSweep = 1024
+
+var (
+	grants        = make(map[string]authGrant)
+	tokens        = make(map[string]issuedToken)
+	refreshTokens = make(map[string]issuedToken)
+	// tokenSweepAt is how many tokens recordToken next sweeps at. It follows
+	// the live count, so sweeps stay rare however many tokens are in use.
+	tokenSweepAt = minTokenSweep
+	oauthMutex   sync.Mutex
+)
+
+// issueCode returns a new authorization code for grant, one that isn't
+// already waiting to be redeemed
+func issueCode(grant authGrant) string {
+	oauthMutex.Lock()
+	defer oauthMutex.Unlock()
+	for {
+		code := ids.AuthCode()
+		if _, taken := grants[code]; !taken {
+			grants[code] = grant
+			return code
+		}
+	}
+}
+
+// redeemCode consumes code and returns its grant, provided it was issued to
+// clientID for redirectURI. A code is gone after its first redemption,
+// successful or not.
+func redeemCode(code, clientID, redirectURI string) (authGrant, error) {
+	oauthMutex.Lock()
+	defer oauthMutex.Unlock()
+	g, ok := grants[code]
+	delete(grants, code)
+	switch {
+	case !ok:
+		return g, errors.New("Invalid authorization code: " + code)
+	case g.ClientID != clientID:
+		return g, errors.New("Authorization code was issued to another client")
+	case g.RedirectURI != redirectURI:
+		return g, errors.New("Redirect URI mismatch")
+	}
+	return g, nil
+}
+
+// recordToken remembers an issued access token, and its refresh token, so
+// later calls can look them up
+func recordToken(clientID string, resp TokenResponse) {
+	oauthMutex.Lock()
+	defer oauthMutex.Unlock()
+	t := issuedToken{
+		ClientID: clientID,
+		ORCID:    resp.ORCID,
+		Scope:    resp.Scope,
+		Expires:  clock.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+	}
+	tokens[resp.AccessToken] = t
+	if resp.RefreshToken != "" {
+		t.AccessToken = resp.AccessToken
+		t.Expires = clock.Now().Add(defaultTokenLifetime * time.Second)
+		refreshTokens[resp.RefreshToken] = t
+	}
+	if len(tokens)+len(refreshTokens) >= tokenSweepAt {
+		sweepTokens(clock.Now())
+		tokenSweepAt = max(2*(len(tokens)+len(refreshTokens)), minTokenSweep)
+	}
+}
+
+// sweepTokens drops refresh tokens that have expired and access tokens that
+// expired more than expiredTokenGrace before now; callers must hold
+// oauthMutex. Revoked tokens are already gone.
+func sweepTokens(now time.Time) {
+	maps.DeleteFunc(tokens, func(_ string, t issuedToken) bool {
+		return now.After(t.Expires.Add(expiredTokenGrace))
+	})
+	maps.DeleteFunc(refreshTokens, func(_ string, t issuedToken) bool {
+		return now.After(t.Expires)
+	})
+}
+
+// resetOAuth forgets every code and token issued so far
+func resetOAuth() {
+	oauthMutex.Lock()
+	defer oauthMutex.Unlock()
+	clear(grants)
+	clear(tokens)
+	clear(refreshTokens)
+	tokenSweepAt = minTokenSweep
+}
+
+// listTokens returns a copy of the access tokens issued so far, by token
+func listTokens() map[string]issuedToken {
+	oauthMutex.Lock()
+	defer oauthMutex.Unlock()
+	return maps.Clone(tokens)
+}
+
+// refreshGrant returns what refreshToken was issued for, provided it was
+// issued to clientID
+func refreshGrant(refreshToken, clientID string) (issuedToken, error) {
+	oauthMutex.Lock()
+	defer oauthMutex.Unlock()
+	t, ok := refreshTokens[refreshToken]
+	switch {
+	case !ok:
+		return t, errors.New("Invalid refresh token: " + refreshToken)
+	case t.ClientID != clientID:
+		return t, errors.New("Refresh token was issued to another client")
+	case t.expired():
+		return t, errors.New("Refresh token expired: " + refreshToken)
+	}
+	return t, nil
+}
+
+// revokeRefreshToken forgets refreshToken and the access token issued with it
+func revokeRefreshToken(refreshToken string) {
+	oauthMutex.Lock()
+	defer oauthMutex.Unlock()
+	if t, ok := refreshTokens[refreshToken]; ok {
+		delete(tokens, t.AccessToken)
+		delete(refreshTokens, refreshToken)
+	}
+}
+
+// refreshScope returns the scope a refreshed token gets: the original one,
+// or the requested part of it
+func refreshScope(original, requested string) (string, error) {
+	if requested == "" {
+		return original, nil
+	}
+	for _, s := range strings.Fields(requested) {
+		if !hasScope(original, s) {
+			return "", fmt.Errorf("Scope %s was not granted to the original token", s)
+		}
+	}
+	return requested, nil
+}
+
+// lookupToken returns what an access token was issued for
+func lookupToken(token string) (issuedToken, bool) {
+	oauthMutex.Lock()
+	defer oauthMutex.Unlock()
+	t, ok := tokens[token]
+	return t, ok
+}
+
+// clientCredentialsScopes are the scopes a two-legged token can carry; none
+// of them grant access to a researcher's limited data
+var clientCredentialsScopes = []string{
+	"/read-public",
+	"/webhook",
+	"/premium-notification",
+	"/group-id-record/read",
+	"/group-id-record/update",
+}
+
+// clientCredentialsScope checks the scopes requested with a client_credentials
+// grant, defaulting to /read-public
+func clientCredentialsScope(requested string) (string, error) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return "/read-public", nil
+	}
+	for _, s := range scopes {
+		if !slices.Contains(clientCredentialsScopes, s) {
+			return "", errors.New("Scope " + s + " is not available with client_credentials")
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// researcherName returns "Given Family" for orcid in s, or "" if unnamed
+func researcherName(s *Store, orcid string) string {
+	if person, ok := s.Person(orcid); ok && person.Name != nil {
+		return person.Name.GivenNames + " " + person.Name.FamilyName
+	}
+	return ""
+}
+
+// applyGrant points a token response at the researcher in s who approved
+// grant
+func (t *TokenResponse) applyGrant(s *Store, g authGrant) {
+	t.ORCID = g.ORCID
+	t.Name = researcherName(s, g.ORCID)
+	t.Scope = g.Scope
+	if t.Scope == "" {
+		t.Scope = defaultTokenScope
+	}
+}
+
+// authorizeRedirect builds the redirect back to the client, always echoing
+// state
+func authorizeRedirect(redirectURI string, params url.Values, state string) string {
+	if state != "" {
+		params.Set("state", state)
+	}
+	sep := "?"
+	if strings.Contains(redirectURI, "?") {
+		sep = "&"
+	}
+	return redirectURI + sep + params.Encode()
+}
+
+// requestClientID returns the client_id from the form or HTTP Basic auth
+func requestClientID(r *http.Request) string {
+	if id := r.FormValue("client_id"); id != "" {
+		return id
+	}
+	id, _, _ := r.BasicAuth()
+	return id
+}
+
+// writeOAuthError sends an RFC 6749 error body
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func handleToken(w http.ResponseWriter, r *http.Request) {
+	// Parse form data
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	client, err := authenticateClient(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="ORCID"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+	clientID := client.ClientID
+	grantType := r.FormValue("grant_type")
+
+	// Each grant needs its own parameter before anything else is checked
+	required := map[string]string{"authorization_code": "code", "refresh_token": "refresh_token"}
+	switch {
+	case grantType == "":
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Missing grant_type")
+		return
+	case grantType != "client_credentials" && required[grantType] == "":
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type: "+grantType)
+		return
+	case required[grantType] != "" && r.FormValue(required[grantType]) == "":
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Missing "+required[grantType])
+		return
+	}
+
+	resp := newTokenResponse(r.Context())
+	nonce := ""
+	switch grantType {
+	case "client_credentials":
+		scope, err := clientCredentialsScope(r.FormValue("scope"))
+		if err == nil {
+			err = client.checkScope(scope)
+		}
+		if err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+			return
+		}
+		resp.Scope = scope
+	case "authorization_code":
+		g, err := redeemCode(r.FormValue("code"), clientID, r.FormValue("redirect_uri"))
+		if err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+			return
+		}
+		if err := client.checkScope(g.Scope); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+			return
+		}
+		resp.applyGrant(storeFor(r), g)
+		nonce = g.Nonce
+	case "refresh_token":
+		t, err := refreshGrant(r.FormValue("refresh_token"), clientID)
+		if err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+			return
+		}
+		scope, err := refreshScope(t.Scope, r.FormValue("scope"))
+		if err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", err.Error())
+			return
+		}
+		resp.ORCID, resp.Name, resp.Scope = t.ORCID, researcherName(storeFor(r), t.ORCID), scope
+		if r.FormValue("revoke_old") == "true" {
+			revokeRefreshToken(r.FormValue("refresh_token"))
+		}
+	}
+
+	// Journeys script the 3-legged flow, so two-legged tokens skip them
+	if j := findJourney(clientID); j != nil && grantType != "client_credentials" {
+		if grantType == "refresh_token" && j.nextRefreshFails(storeFor(r)) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+			return
+		}
+		resp = j.tokenResponse(r.Context(), storeFor(r))
+	}
+
+	if grantType == "authorization_code" && hasScope(resp.Scope, "openid") {
+		token, err := idToken(r, clientID, nonce, resp)
+		if err != nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", err.Error())
+			return
+		}
+		resp.IDToken = token
+	}
+	recordToken(clientID, resp)
+
+	// Token endpoint always returns JSON
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// defaultTokenScope is granted when an authorization asked for no scope
+const defaultTokenScope = "/read-limited /activities/update"
+
+// newTokenResponse returns fresh tokens for no one in particular; each grant
+// fills in the researcher and scope
+func newTokenResponse(ctx context.Context) TokenResponse {
+	return TokenResponse{
+		AccessToken:  ids.Token(),
+		TokenType:    "bearer",
+		RefreshToken: ids.Token(),
+		ExpiresIn:    tokenLifetime(ctx),
+	}
+}
+
+// defaultTokenResponse is a token for the default researcher, as journeys
+// hand out before applying their own settings
+func defaultTokenResponse(ctx context.Context) TokenResponse {
+	resp := newTokenResponse(ctx)
+	resp.Scope = defaultTokenScope
+	resp.Name = "Sofia Garcia"
+	resp.ORCID = "0000-0001-2345-6789"
+	return resp
+}
+
+// checkAuthorizeRequest validates the client, redirect_uri and scope of an
+// authorize request, writing the error and returning false if they fail. As
+// in RFC 6749, a bad client or redirect_uri is reported here rather than
+// redirected; anything later is redirected back with state.
+func checkAuthorizeRequest(w http.ResponseWriter, r *http.Request, clientID, redirectURI, scope, state string) bool {
+	if redirectURI == "" {
+		http.Error(w, "Missing redirect_uri", http.StatusBadRequest)
+		return false
+	}
+	client, err := authorizeClient(clientID, redirectURI)
+	switch {
+	case errors.Is(err, errInvalidClient):
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client", "Unknown client_id: "+clientID)
+		return false
+	case errors.Is(err, errRedirectMismatch):
+		writeOAuthError(w, http.StatusBadRequest, "redirect_uri_mismatch", err.Error())
+		return false
+	}
+	if err := client.checkScope(scope); err != nil {
+		params := url.Values{"error": {"invalid_scope"}, "error_description": {err.Error()}}
+		http.Redirect(w, r, authorizeRedirect(redirectURI, params, state), http.StatusFound)
+		return false
+	}
+	return true
+}
+
+func handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	state := query.Get("state")
+
+	if !checkAuthorizeRequest(w, r, query.Get("client_id"), redirectURI, query.Get("scope"), state) {
+		return
+	}
+
+	if j := findJourney(query.Get("client_id")); j != nil && j.DenyConsent {
+		params := url.Values{"error": {"access_denied"}, "error_description": {"User denied access"}}
+		http.Redirect(w, r, authorizeRedirect(redirectURI, params, state), http.StatusFound)
+		return
+	}
+
+	// moat_user (or X-Moat-User) picks the researcher and skips the consent
+	// page, so automated tests can authorize as any persona
+	orcid := query.Get("moat_user")
+	if orcid == "" {
+		orcid = r.Header.Get("X-Moat-User")
+	}
+	if orcid != "" && !storeFor(r).HasUser(orcid) {
+		http.Error(w, fmt.Sprintf("Unknown researcher %q", orcid), http.StatusBadRequest)
+		return
+	}
+
+	if consentPage && orcid == "" {
+		serveConsentPage(w, r)
+		return
+	}
+
+	// Without the consent page or moat_user, Sofia authorizes immediately
+	if orcid == "" {
+		orcid = "0000-0001-2345-6789"
+	}
+	code := issueCode(authGrant{
+		ClientID:    query.Get("client_id"),
+		RedirectURI: redirectURI,
+		ORCID:       orcid,
+		Scope:       query.Get("scope"),
+		Nonce:       query.Get("nonce"),
+	})
+	http.Redirect(w, r, authorizeRedirect(redirectURI, url.Values{"code": {code}}, state), http.StatusFound)
+}
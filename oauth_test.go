@@ -0,0 +1,379 @@
+package moat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authorizeCode runs /oauth/authorize and returns the issued code
+func authorizeCode(t *testing.T, handler http.Handler, clientID, redirectURI string) string {
+	t.Helper()
+	q := url.Values{"client_id": {clientID}, "redirect_uri": {redirectURI}}
+	req := httptest.NewRequest("GET", "/oauth/authorize?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	loc, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || loc.Query().Get("code") == "" {
+		t.Fatalf("Expected a code from /oauth/authorize, got %q", w.Header().Get("Location"))
+	}
+	return loc.Query().Get("code")
+}
+
+func exchangeCode(handler http.Handler, clientID, redirectURI, code string) *httptest.ResponseRecorder {
+	data := url.Values{
+		"client_id":    {clientID},
+		"redirect_uri": {redirectURI},
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+	}
+	req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthorizationCodeIsSingleUse(t *testing.T) {
+	handler := setupRouter()
+	code := authorizeCode(t, handler, "APP-123", "http://example.com/cb")
+
+	if w := exchangeCode(handler, "APP-123", "http://example.com/cb", code); w.Code != http.StatusOK {
+		t.Fatalf("Expected first exchange to succeed, got %v", w.Code)
+	}
+
+	w := exchangeCode(handler, "APP-123", "http://example.com/cb", code)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected reused code to fail, got %v", w.Code)
+	}
+	var body map[string]string
+	json.NewDecoder(w.Body).Decode(&body)
+	if body["error"] != "invalid_grant" {
+		t.Errorf("Expected invalid_grant, got %v", body)
+	}
+}
+
+func TestAuthorizationCodeBinding(t *testing.T) {
+	handler := setupRouter()
+
+	code := authorizeCode(t, handler, "APP-123", "http://example.com/cb")
+	if w := exchangeCode(handler, "APP-123", "http://evil.example/cb", code); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected redirect_uri mismatch to fail, got %v", w.Code)
+	}
+
+	code = authorizeCode(t, handler, "APP-123", "http://example.com/cb")
+	if w := exchangeCode(handler, "APP-456", "http://example.com/cb", code); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected client_id mismatch to fail, got %v", w.Code)
+	}
+
+	if w := exchangeCode(handler, "APP-123", "http://example.com/cb", "NOPE42"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected unknown code to fail, got %v", w.Code)
+	}
+}
+
+func TestTokenScopesByGrant(t *testing.T) {
+	handler := setupRouter()
+	token := func(data url.Values) (*httptest.ResponseRecorder, TokenResponse) {
+		req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp TokenResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w, resp
+	}
+
+	_, resp := token(url.Values{"client_id": {"APP-123"}, "grant_type": {"client_credentials"}})
+	if resp.Scope != "/read-public" || resp.ORCID != "" {
+		t.Errorf("Expected a /read-public token with no iD, got %+v", resp)
+	}
+
+	_, resp = token(url.Values{"client_id": {"APP-123"}, "grant_type": {"client_credentials"}, "scope": {"/webhook"}})
+	if resp.Scope != "/webhook" {
+		t.Errorf("Expected the requested /webhook scope, got %q", resp.Scope)
+	}
+
+	if w, _ := token(url.Values{"client_id": {"APP-123"}, "grant_type": {"client_credentials"}, "scope": {"/read-limited"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected member scope to be refused for client_credentials, got %v", w.Code)
+	}
+
+	q := url.Values{"client_id": {"APP-123"}, "redirect_uri": {"http://example.com/cb"}, "scope": {"/authenticate"}}
+	req := httptest.NewRequest("GET", "/oauth/authorize?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	loc, _ := url.Parse(w.Header().Get("Location"))
+
+	w = exchangeCode(handler, "APP-123", "http://example.com/cb", loc.Query().Get("code"))
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Scope != "/authenticate" || resp.ORCID == "" {
+		t.Errorf("Expected an /authenticate token for a researcher, got %+v", resp)
+	}
+}
+
+func TestRegisteredClients(t *testing.T) {
+	handler := setupRouter()
+	t.Cleanup(func() {
+		clientsMutex.Lock()
+		clear(clients)
+		clientsMutex.Unlock()
+	})
+
+	body := `{"client_id": "APP-REG", "client_secret": "s3cret", "redirect_uris": ["http://example.com/cb"], "scopes": ["/read-public"]}`
+	req := httptest.NewRequest("POST", "/__admin/clients", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v: %s", w.Code, w.Body.String())
+	}
+
+	token := func(data url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := token(url.Values{"client_id": {"APP-REG"}, "client_secret": {"s3cret"}, "grant_type": {"client_credentials"}}); w.Code != http.StatusOK {
+		t.Errorf("Expected the registered client to get a token, got %v", w.Code)
+	}
+	if w := token(url.Values{"client_id": {"APP-REG"}, "client_secret": {"wrong"}, "grant_type": {"client_credentials"}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong secret to be refused, got %v", w.Code)
+	} else if !strings.Contains(w.Body.String(), "invalid_client") {
+		t.Errorf("Expected invalid_client, got %s", w.Body.String())
+	}
+	if w := token(url.Values{"client_id": {"APP-123"}, "grant_type": {"client_credentials"}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an unregistered client to be refused, got %v", w.Code)
+	}
+	if w := token(url.Values{"client_id": {"APP-REG"}, "client_secret": {"s3cret"}, "grant_type": {"client_credentials"}, "scope": {"/webhook"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a scope outside the client's to be refused, got %v", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/oauth/token", strings.NewReader("grant_type=client_credentials"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("APP-REG", "s3cret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected HTTP Basic client credentials to work, got %v", w.Code)
+	}
+}
+
+func TestTokenTTL(t *testing.T) {
+	t.Setenv("MOAT_TOKEN_TTL", "90")
+	if d, err := getTokenTTL(); err != nil || d != 90*time.Second {
+		t.Errorf("Expected 90s, got %v (%v)", d, err)
+	}
+	t.Setenv("MOAT_TOKEN_TTL", "5m")
+	if d, err := getTokenTTL(); err != nil || d != 5*time.Minute {
+		t.Errorf("Expected 5m, got %v (%v)", d, err)
+	}
+	t.Setenv("MOAT_TOKEN_TTL", "soon")
+	if _, err := getTokenTTL(); err == nil {
+		t.Error("Expected an error for an invalid TTL")
+	}
+
+	tokenTTL = time.Minute
+	t.Cleanup(func() { tokenTTL = 0 })
+	if resp := defaultTokenResponse(context.Background()); resp.ExpiresIn != 60 {
+		t.Errorf("Expected expires_in 60, got %d", resp.ExpiresIn)
+	}
+}
+
+func TestExpiredTokensSwept(t *testing.T) {
+	resetOAuth()
+	t.Cleanup(resetOAuth)
+	clock.Set(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true)
+	t.Cleanup(clock.Reset)
+
+	recordToken("client", TokenResponse{AccessToken: "short-lived", RefreshToken: "short-lived-refresh", ExpiresIn: 60})
+	clock.Advance(2 * time.Minute)
+	if tok, ok := lookupToken("short-lived"); !ok || !tok.expired() {
+		t.Errorf("Expected a just-expired token to be remembered as expired, got %+v, %v", tok, ok)
+	}
+
+	clock.Advance(expiredTokenGrace)
+	for i := range minTokenSweep {
+		recordToken("client", TokenResponse{AccessToken: fmt.Sprintf("fresh-%d", i), ExpiresIn: 60})
+	}
+	if _, ok := lookupToken("short-lived"); ok {
+		t.Error("Expected a long-expired token to be swept")
+	}
+	if _, ok := lookupToken("fresh-0"); !ok {
+		t.Error("Expected live tokens to be kept")
+	}
+	if _, err := refreshGrant("short-lived-refresh", "client"); err != nil {
+		t.Errorf("Expected the refresh token to outlive its access token, got %v", err)
+	}
+}
+
+func TestTokenErrors(t *testing.T) {
+	handler := setupRouter()
+	tests := []struct {
+		name   string
+		data   url.Values
+		status int
+		error  string
+	}{
+		{"no client", url.Values{"grant_type": {"client_credentials"}}, http.StatusUnauthorized, "invalid_client"},
+		{"no grant type", url.Values{"client_id": {"APP-123"}}, http.StatusBadRequest, "invalid_request"},
+		{"unknown grant type", url.Values{"client_id": {"APP-123"}, "grant_type": {"password"}}, http.StatusBadRequest, "unsupported_grant_type"},
+		{"no code", url.Values{"client_id": {"APP-123"}, "grant_type": {"authorization_code"}}, http.StatusBadRequest, "invalid_request"},
+		{"bad code", url.Values{"client_id": {"APP-123"}, "grant_type": {"authorization_code"}, "code": {"nope"}}, http.StatusBadRequest, "invalid_grant"},
+		{"bad refresh token", url.Values{"client_id": {"APP-123"}, "grant_type": {"refresh_token"}, "refresh_token": {"nope"}}, http.StatusBadRequest, "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(tt.data.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			var body map[string]string
+			json.NewDecoder(w.Body).Decode(&body)
+			if w.Code != tt.status || body["error"] != tt.error {
+				t.Errorf("Expected %v %s, got %v %+v", tt.status, tt.error, w.Code, body)
+			}
+		})
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	handler := setupRouter()
+	code := authorizeCode(t, handler, "APP-123", "http://example.com/cb")
+	var first TokenResponse
+	json.NewDecoder(exchangeCode(handler, "APP-123", "http://example.com/cb", code).Body).Decode(&first)
+
+	refresh := func(clientID string) *httptest.ResponseRecorder {
+		data := url.Values{"client_id": {clientID}, "grant_type": {"refresh_token"}, "refresh_token": {first.RefreshToken}}
+		req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := refresh("APP-123")
+	var resp TokenResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.ORCID != first.ORCID || resp.AccessToken == first.AccessToken {
+		t.Errorf("Expected a new token for %s, got %v %+v", first.ORCID, w.Code, resp)
+	}
+	if w := refresh("APP-OTHER"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected another client's refresh to fail, got %v", w.Code)
+	}
+}
+
+func TestRefreshTokenOptions(t *testing.T) {
+	handler := setupRouter()
+	code := authorizeCode(t, handler, "APP-123", "http://example.com/cb")
+	var first TokenResponse
+	json.NewDecoder(exchangeCode(handler, "APP-123", "http://example.com/cb", code).Body).Decode(&first)
+
+	refresh := func(extra url.Values) (*httptest.ResponseRecorder, TokenResponse) {
+		data := url.Values{"client_id": {"APP-123"}, "grant_type": {"refresh_token"}, "refresh_token": {first.RefreshToken}}
+		for k, v := range extra {
+			data[k] = v
+		}
+		req := httptest.NewRequest("POST", "/oauth/token", strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var resp TokenResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	if _, resp := refresh(url.Values{"scope": {"/read-limited"}}); resp.Scope != "/read-limited" || resp.ORCID != first.ORCID {
+		t.Errorf("Expected a narrowed /read-limited token, got %+v", resp)
+	}
+	if w, _ := refresh(url.Values{"scope": {"/person/update"}}); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_scope") {
+		t.Errorf("Expected a wider scope to be refused, got %v: %s", w.Code, w.Body)
+	}
+	if _, ok := lookupToken(first.AccessToken); !ok {
+		t.Fatal("Expected the original token to survive a plain refresh")
+	}
+
+	if w, _ := refresh(url.Values{"revoke_old": {"true"}}); w.Code != http.StatusOK {
+		t.Fatalf("Expected the revoking refresh to succeed, got %v", w.Code)
+	}
+	if _, ok := lookupToken(first.AccessToken); ok {
+		t.Error("Expected revoke_old to revoke the original access token")
+	}
+	if w, _ := refresh(nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the revoked refresh token to be refused, got %v", w.Code)
+	}
+}
+
+func TestAuthorizeAs(t *testing.T) {
+	handler := setupRouter()
+	consentPage = true
+	t.Cleanup(func() { consentPage = false })
+
+	q := url.Values{"client_id": {"APP-123"}, "redirect_uri": {"http://example.com/cb"}, "moat_user": {"0000-0002-1001-2002"}}
+	req := httptest.NewRequest("GET", "/oauth/authorize?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	loc, _ := url.Parse(w.Header().Get("Location"))
+	if w.Code != http.StatusFound || loc.Query().Get("code") == "" {
+		t.Fatalf("Expected moat_user to skip the consent page, got %v", w.Code)
+	}
+	var resp TokenResponse
+	json.NewDecoder(exchangeCode(handler, "APP-123", "http://example.com/cb", loc.Query().Get("code")).Body).Decode(&resp)
+	if resp.ORCID != "0000-0002-1001-2002" {
+		t.Errorf("Expected John Smith's token, got %s", resp.ORCID)
+	}
+
+	q.Del("moat_user")
+	req = httptest.NewRequest("GET", "/oauth/authorize?"+q.Encode(), nil)
+	req.Header.Set("X-Moat-User", "0000-0000-0000-0000")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown researcher to be refused, got %v", w.Code)
+	}
+}
+
+func TestAuthorizeValidatesRegisteredClient(t *testing.T) {
+	handler := setupRouter()
+	registerClient(OAuthClient{ClientID: "APP-REG", ClientSecret: "s3cret", RedirectURIs: []string{"http://example.com/cb"}, Scopes: []string{"/authenticate"}})
+	t.Cleanup(func() {
+		clientsMutex.Lock()
+		clear(clients)
+		clientsMutex.Unlock()
+	})
+
+	state := "xyz 123/&=?é"
+	authorize := func(clientID, redirectURI, scope string) *httptest.ResponseRecorder {
+		q := url.Values{"client_id": {clientID}, "redirect_uri": {redirectURI}, "scope": {scope}, "state": {state}}
+		req := httptest.NewRequest("GET", "/oauth/authorize?"+q.Encode(), nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := authorize("APP-REG", "http://example.com/cb", "/authenticate")
+	loc, _ := url.Parse(w.Header().Get("Location"))
+	if loc.Query().Get("code") == "" || loc.Query().Get("state") != state {
+		t.Errorf("Expected a code with state %q, got %s", state, loc)
+	}
+
+	w = authorize("APP-REG", "http://evil.example.com/cb", "/authenticate")
+	if w.Code != http.StatusBadRequest || w.Header().Get("Location") != "" {
+		t.Errorf("Expected an unregistered redirect_uri to be refused without redirecting, got %v", w.Code)
+	}
+	if w := authorize("APP-123", "http://example.com/cb", "/authenticate"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unregistered client to be refused, got %v", w.Code)
+	}
+
+	w = authorize("APP-REG", "http://example.com/cb", "/activities/update")
+	loc, _ = url.Parse(w.Header().Get("Location"))
+	if loc.Query().Get("error") != "invalid_scope" || loc.Query().Get("state") != state {
+		t.Errorf("Expected an invalid_scope redirect with state %q, got %s", state, loc)
+	}
+}
@@ -0,0 +1,166 @@
+package moat
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- OpenID Connect ---
+//
+// When a 3-legged flow asks for the openid scope, the token response carries
+// an RS256 id_token shaped like ORCID's. The signing key is generated on
+// first use and published at /oauth/jwks so client libraries can verify it;
+// /oauth/userinfo returns the same claims for an issued access token.
+
+const signingKeyID = "moat-1"
+
+var (
+	signingKey     *rsa.PrivateKey
+	signingKeyOnce sync.Once
+)
+
+func oidcKey() *rsa.PrivateKey {
+	signingKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic("generating OIDC signing key: " + err.Error())
+		}
+		signingKey = key
+	})
+	return signingKey
+}
+
+// issuer returns the base URL moat is being reached at, with any mount
+// prefix
+func issuer(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + mountPrefix(r.Context())
+}
+
+func hasScope(scope, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
+
+var b64 = base64.RawURLEncoding
+
+// signJWT returns claims as a compact RS256 JWS
+func signJWT(claims any) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": signingKeyID})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, oidcKey(), crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return input + "." + b64.EncodeToString(sig), nil
+}
+
+// userClaims are the profile claims shared by the id_token and /userinfo,
+// from orcid's record in s
+func userClaims(s *Store, orcid string) map[string]any {
+	claims := map[string]any{"sub": orcid}
+	if person, ok := s.Person(orcid); ok && person.Name != nil {
+		claims["given_name"] = person.Name.GivenNames
+		claims["family_name"] = person.Name.FamilyName
+		claims["name"] = strings.TrimSpace(person.Name.GivenNames + " " + person.Name.FamilyName)
+	}
+	return claims
+}
+
+// idToken builds the signed id_token for a token response
+func idToken(r *http.Request, clientID, nonce string, resp TokenResponse) (string, error) {
+	now := clock.Now()
+	atHash := sha256.Sum256([]byte(resp.AccessToken))
+
+	claims := userClaims(storeFor(r), resp.ORCID)
+	claims["iss"] = issuer(r)
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["auth_time"] = now.Unix()
+	claims["exp"] = now.Add(24 * time.Hour).Unix()
+	claims["jti"] = ids.Token()
+	claims["amr"] = "pwd"
+	claims["at_hash"] = b64.EncodeToString(atHash[:len(atHash)/2])
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return signJWT(claims)
+}
+
+// handleJWKS publishes the id_token signing key
+func handleJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := oidcKey().PublicKey
+	writeResponse(w, r, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": signingKeyID,
+			"n":   b64.EncodeToString(pub.N.Bytes()),
+			"e":   b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// handleUserInfo returns the profile of the researcher behind a bearer token
+func handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	t, ok := lookupToken(bearerToken(r))
+	if !ok || t.ORCID == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "Invalid access token")
+		return
+	}
+	if t.expired() {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="token expired"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "Access token expired")
+		return
+	}
+	if !hasScope(t.Scope, "openid") {
+		writeOAuthError(w, http.StatusForbidden, "insufficient_scope", "The openid scope is required")
+		return
+	}
+
+	claims := userClaims(storeFor(r), t.ORCID)
+	claims["id"] = t.ORCID
+	writeResponse(w, r, claims)
+}
+
+// handleDiscovery serves the OIDC discovery document, with every endpoint
+// pointing back at this moat instance
+func handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	base := issuer(r)
+	writeResponse(w, r, map[string]any{
+		"issuer":                                base,
+		"authorization_endpoint":                base + "/oauth/authorize",
+		"token_endpoint":                        base + "/oauth/token",
+		"userinfo_endpoint":                     base + "/oauth/userinfo",
+		"jwks_uri":                              base + "/oauth/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "/authenticate", "/read-limited", "/activities/update", "/person/update", "/read-public"},
+		"claims_supported":                      []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "given_name", "family_name", "name"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_post", "client_secret_basic"},
+	})
+}
@@ -0,0 +1,84 @@
+package moat
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOpenIDConnectFlow(t *testing.T) {
+	handler := setupRouter()
+	q := url.Values{
+		"client_id":    {"APP-OIDC"},
+		"redirect_uri": {"http://example.com/cb"},
+		"scope":        {"openid"},
+		"nonce":        {"n-0S6_WzA2Mj"},
+	}
+	req := httptest.NewRequest("GET", "/oauth/authorize?"+q.Encode(), nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	loc, _ := url.Parse(w.Header().Get("Location"))
+
+	w = exchangeCode(handler, "APP-OIDC", "http://example.com/cb", loc.Query().Get("code"))
+	var token TokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&token); err != nil || token.IDToken == "" {
+		t.Fatalf("Expected an id_token: %v %+v", err, token)
+	}
+
+	parts := strings.Split(token.IDToken, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a compact JWS, got %q", token.IDToken)
+	}
+	sig, _ := b64.DecodeString(parts[2])
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&oidcKey().PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+		t.Errorf("id_token signature doesn't verify: %v", err)
+	}
+	payload, _ := b64.DecodeString(parts[1])
+	var claims map[string]any
+	json.Unmarshal(payload, &claims)
+	if claims["sub"] != token.ORCID || claims["aud"] != "APP-OIDC" || claims["nonce"] != "n-0S6_WzA2Mj" {
+		t.Errorf("Unexpected id_token claims %v", claims)
+	}
+
+	req = httptest.NewRequest("GET", "/oauth/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var info map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode userinfo: %v", err)
+	}
+	if info["sub"] != token.ORCID || info["given_name"] != "Sofia" {
+		t.Errorf("Unexpected userinfo %v", info)
+	}
+
+	req = httptest.NewRequest("GET", "/oauth/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status Unauthorized for an unknown token, got %v", w.Code)
+	}
+}
+
+func TestDiscoveryDocument(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "http://moat.test:8080/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var doc map[string]any
+	if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+		t.Fatalf("Failed to decode discovery document: %v", err)
+	}
+	if doc["issuer"] != "http://moat.test:8080" || doc["jwks_uri"] != "http://moat.test:8080/oauth/jwks" {
+		t.Errorf("Expected endpoints on the request host, got %v", doc)
+	}
+}
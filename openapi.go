@@ -0,0 +1,326 @@
+package moat
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// --- OpenAPI ---
+//
+// GET /openapi.json describes every endpoint moat serves as an OpenAPI 3
+// document, built from apiRoutes, and GET /docs is a page (web/docs.html,
+// embedded so it works offline) for browsing and calling it.
+// Bodies are ORCID's v3.0 JSON or XML and are left as free-form objects
+// rather than restating ORCID's schema. A route added to routes belongs in
+// apiRoutes too; TestOpenAPIRoutes checks the two list the same operations.
+
+// routeMux is a ServeMux that remembers the patterns registered on it, so
+// the documented routes can be checked against the served ones
+type routeMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func newRouteMux() *routeMux {
+	return &routeMux{ServeMux: http.NewServeMux()}
+}
+
+func (m *routeMux) Handle(pattern string, handler http.Handler) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.Handle(pattern, handler)
+}
+
+func (m *routeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.HandleFunc(pattern, handler)
+}
+
+// mount serves sub's routes under pattern
+func (m *routeMux) mount(pattern string, sub *routeMux) {
+	m.ServeMux.Handle(pattern, sub.ServeMux)
+	for _, p := range sub.patterns {
+		if !slices.Contains(m.patterns, p) {
+			m.patterns = append(m.patterns, p)
+		}
+	}
+}
+
+// apiRoute is one documented operation
+type apiRoute struct {
+	Method  string
+	Path    string
+	Tag     string
+	Summary string
+}
+
+// apiActivitySections and apiPersonSections are documented as
+// registerActivity and registerPersonSection route them
+var (
+	apiActivitySections = []string{
+		sectionWork, sectionEmployment, sectionFunding, sectionEducation,
+		sectionInvitedPosition, sectionMembership, sectionQualification, sectionPeerReview,
+	}
+	apiPersonSections = [][2]string{
+		{"address", "address"},
+		{"external-identifiers", "external-identifier"},
+	}
+)
+
+// apiRoutes lists the operations in the order the document gives them
+func apiRoutes() []apiRoute {
+	routes := []apiRoute{
+		{"POST", "/oauth/token", "OAuth", "Exchange a code, refresh token or client credentials for an access token"},
+		{"GET", "/oauth/authorize", "OAuth", "Start the three-legged flow"},
+		{"POST", "/oauth/authorize", "OAuth", "Submit the consent page"},
+		{"GET", "/oauth/userinfo", "OAuth", "OpenID Connect user info"},
+		{"GET", "/oauth/jwks", "OAuth", "Keys that sign id_tokens"},
+		{"GET", "/.well-known/openid-configuration", "OAuth", "OpenID Connect discovery"},
+
+		{"GET", "/v3.0/{orcid}/record", "Records", "The whole record"},
+		{"GET", "/v3.0/{orcid}/person", "Records", "The biographical sections"},
+		{"GET", "/v3.0/{orcid}/activities", "Records", "Every activity summary"},
+		{"GET", "/v3.0/{orcid}/educations", "Records", "Education summaries"},
+		{"GET", "/v3.0/{orcid}/employments", "Records", "Employment summaries"},
+		{"GET", "/v3.0/{orcid}/fundings", "Records", "Funding summaries"},
+		{"GET", "/v3.0/{orcid}/peer-reviews", "Records", "Peer review summaries"},
+		{"GET", "/v3.0/{orcid}/personal-details", "Person", "Name and biography"},
+		{"GET", "/v3.0/{orcid}/biography", "Person", "Biography"},
+		{"GET", "/v3.0/{orcid}/email", "Person", "Email addresses"},
+
+		{"POST", "/v3.0/{orcid}/works", "Activities", "Add up to 100 works at once"},
+		{"GET", "/v3.0/{orcid}/works/{putCodes}", "Activities", "Up to 50 works by comma-separated put-codes"},
+	}
+	for _, section := range apiActivitySections {
+		item := "/v3.0/{orcid}/" + section + "/{putCode}"
+		routes = append(routes,
+			apiRoute{"GET", item, "Activities", "Read a " + section},
+			apiRoute{"POST", "/v3.0/{orcid}/" + section, "Activities", "Add a " + section},
+			apiRoute{"PUT", item, "Activities", "Replace a " + section},
+			apiRoute{"DELETE", item, "Activities", "Delete a " + section},
+		)
+	}
+	for _, s := range apiPersonSections {
+		collection, item := "/v3.0/{orcid}/"+s[0], "/v3.0/{orcid}/"+s[1]+"/{putCode}"
+		routes = append(routes,
+			apiRoute{"GET", collection, "Person", "List " + s[0]},
+			apiRoute{"POST", collection, "Person", "Add an " + s[1]},
+			apiRoute{"GET", item, "Person", "Read an " + s[1]},
+			apiRoute{"PUT", item, "Person", "Replace an " + s[1]},
+			apiRoute{"DELETE", item, "Person", "Delete an " + s[1]},
+		)
+	}
+	return append(routes,
+		apiRoute{"POST", "/v3.0/{orcid}/notification-permission", "Notifications", "Send a permission notification"},
+		apiRoute{"GET", "/v3.0/{orcid}/notification-permission/{putCode}", "Notifications", "Read a notification"},
+		apiRoute{"DELETE", "/v3.0/{orcid}/notification-permission/{putCode}", "Notifications", "Archive a notification"},
+
+		apiRoute{"GET", "/v3.0/search", "Search", "Search records with Solr syntax"},
+		apiRoute{"GET", "/v3.0/csv-search", "Search", "Search records, answering CSV"},
+
+		apiRoute{"GET", "/openapi.json", "Docs", "This document"},
+		apiRoute{"GET", "/docs", "Docs", "A browsable view of this document"},
+
+		apiRoute{"GET", "/v3.0/group-id-record", "Group IDs", "List group-id records"},
+		apiRoute{"POST", "/v3.0/group-id-record", "Group IDs", "Add a group-id record"},
+		apiRoute{"GET", "/v3.0/group-id-record/{putCode}", "Group IDs", "Read a group-id record"},
+		apiRoute{"PUT", "/v3.0/group-id-record/{putCode}", "Group IDs", "Replace a group-id record"},
+		apiRoute{"DELETE", "/v3.0/group-id-record/{putCode}", "Group IDs", "Delete a group-id record"},
+
+		apiRoute{"GET", "/__admin/", "Admin", "Web dashboard"},
+		apiRoute{"GET", "/__admin/users", "Admin", "List researchers"},
+		apiRoute{"POST", "/__admin/users", "Admin", "Create a researcher"},
+		apiRoute{"GET", "/__admin/users/{orcid}", "Admin", "A researcher's whole record"},
+		apiRoute{"PUT", "/__admin/users/{orcid}", "Admin", "Change a researcher's name, biography or emails"},
+		apiRoute{"DELETE", "/__admin/users/{orcid}", "Admin", "Delete a researcher"},
+		apiRoute{"GET", "/__admin/users/{orcid}/items", "Admin", "A researcher's stored put-codes"},
+		apiRoute{"GET", "/__admin/users/{orcid}/notifications", "Admin", "Notifications sent to a researcher"},
+		apiRoute{"GET", "/__admin/users/{orcid}/status", "Admin", "A record's status"},
+		apiRoute{"PUT", "/__admin/users/{orcid}/status", "Admin", "Deprecate, deactivate or lock a record"},
+		apiRoute{"DELETE", "/__admin/users/{orcid}/status", "Admin", "Make a record active again"},
+		apiRoute{"POST", "/__admin/import", "Admin", "Import a record in ORCID's v3.0 XML"},
+		apiRoute{"POST", "/__admin/reset", "Admin", "Go back to the startup state"},
+		apiRoute{"GET", "/__admin/state", "Admin", "Export the store"},
+		apiRoute{"PUT", "/__admin/state", "Admin", "Replace the store"},
+		apiRoute{"GET", "/__admin/clients", "Admin", "List OAuth clients"},
+		apiRoute{"POST", "/__admin/clients", "Admin", "Register an OAuth client"},
+		apiRoute{"GET", "/__admin/faults", "Admin", "List fault rules"},
+		apiRoute{"POST", "/__admin/faults", "Admin", "Add a fault rule"},
+		apiRoute{"DELETE", "/__admin/faults", "Admin", "Remove every fault rule"},
+		apiRoute{"DELETE", "/__admin/faults/{id}", "Admin", "Remove a fault rule"},
+		apiRoute{"GET", "/__admin/scenarios", "Admin", "List scenarios and their states"},
+		apiRoute{"PUT", "/__admin/scenarios/{name}/state", "Admin", "Move a scenario to another state"},
+		apiRoute{"GET", "/__admin/stubs", "Admin", "List stubs"},
+		apiRoute{"POST", "/__admin/stubs", "Admin", "Add a stub"},
+		apiRoute{"DELETE", "/__admin/stubs", "Admin", "Remove every stub"},
+		apiRoute{"DELETE", "/__admin/stubs/{id}", "Admin", "Remove a stub"},
+		apiRoute{"GET", "/__admin/requests", "Admin", "The request journal"},
+		apiRoute{"DELETE", "/__admin/requests", "Admin", "Empty the request journal"},
+		apiRoute{"POST", "/__admin/verify", "Admin", "Check the request journal"},
+		apiRoute{"GET", "/__admin/clock", "Admin", "moat's time"},
+		apiRoute{"PUT", "/__admin/clock", "Admin", "Set or freeze moat's time"},
+		apiRoute{"DELETE", "/__admin/clock", "Admin", "Go back to the wall clock"},
+		apiRoute{"POST", "/__admin/clock/advance", "Admin", "Move moat's time forward"},
+		apiRoute{"GET", "/__admin/maintenance", "Admin", "The maintenance window"},
+		apiRoute{"PUT", "/__admin/maintenance", "Admin", "Start a maintenance window"},
+		apiRoute{"DELETE", "/__admin/maintenance", "Admin", "End the maintenance window"},
+		apiRoute{"GET", "/__admin/tenants", "Admin", "List tenants"},
+		apiRoute{"DELETE", "/__admin/tenants/{name}", "Admin", "Delete a tenant"},
+	)
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// content describes a free-form body in each of mediaTypes
+func content(mediaTypes ...string) map[string]any {
+	c := map[string]any{}
+	for _, t := range mediaTypes {
+		c[t] = map[string]any{"schema": map[string]any{"type": "object"}}
+	}
+	return c
+}
+
+// operation describes rt
+func (rt apiRoute) operation() map[string]any {
+	orcidAPI := strings.HasPrefix(rt.Path, "/v3.0/")
+	op := map[string]any{
+		"tags":        []string{rt.Tag},
+		"summary":     rt.Summary,
+		"operationId": strings.ToLower(rt.Method) + pathParam.ReplaceAllString(strings.NewReplacer("/", "_", ".", "_", "-", "_").Replace(rt.Path), "by_$1"),
+	}
+
+	var params []map[string]any
+	for _, m := range pathParam.FindAllStringSubmatch(rt.Path, -1) {
+		params = append(params, map[string]any{
+			"name": m[1], "in": "path", "required": true,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	if params != nil {
+		op["parameters"] = params
+	}
+
+	body, success := content("application/json"), "200"
+	switch {
+	case orcidAPI:
+		body = content(orcidMediaTypes...)
+	case strings.HasPrefix(rt.Path, "/oauth/") && rt.Method == "POST":
+		body = content("application/x-www-form-urlencoded")
+	case rt.Path == "/__admin/import":
+		body = content("application/vnd.orcid+xml")
+	}
+	if (rt.Method == "POST" || rt.Method == "PUT") && rt.Path != "/__admin/reset" {
+		op["requestBody"] = map[string]any{"content": body}
+	}
+	switch {
+	case rt.Method == "POST" && orcidAPI && !strings.HasSuffix(rt.Path, "/works"):
+		success = "201"
+	case rt.Method == "DELETE":
+		success = "204"
+	}
+
+	responses := map[string]any{success: map[string]any{"description": "Success"}}
+	switch {
+	case success == "204":
+	case rt.Path == "/__admin/" || rt.Path == "/docs":
+		responses[success] = map[string]any{"description": "Success", "content": content("text/html")}
+	case rt.Path == "/v3.0/csv-search":
+		responses[success] = map[string]any{"description": "Success", "content": content("text/csv")}
+	case orcidAPI:
+		responses[success] = map[string]any{"description": "Success", "content": content(orcidMediaTypes...)}
+	default:
+		responses[success] = map[string]any{"description": "Success", "content": content("application/json")}
+	}
+	if orcidAPI {
+		errorBody := map[string]any{}
+		for _, t := range orcidMediaTypes {
+			errorBody[t] = map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}}
+		}
+		responses["default"] = map[string]any{"description": "ORCID error", "content": errorBody}
+		op["security"] = []map[string][]string{{}, {"orcid": {}}}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// openAPIDocument builds the OpenAPI document
+func openAPIDocument() map[string]any {
+	paths := map[string]map[string]any{}
+	for _, rt := range apiRoutes() {
+		if paths[rt.Path] == nil {
+			paths[rt.Path] = map[string]any{}
+		}
+		paths[rt.Path][strings.ToLower(rt.Method)] = rt.operation()
+	}
+
+	scopes := map[string]string{
+		"/authenticate":      "Get the researcher's ORCID iD",
+		"/read-limited":      "Read limited-visibility data",
+		"/activities/update": "Add and change activities",
+		"/person/update":     "Add and change biographical data",
+		"openid":             "Get an id_token",
+	}
+	twoLegged := map[string]string{}
+	for _, s := range clientCredentialsScopes {
+		twoLegged[s] = s
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "MOAT",
+			"description": "A mock of the ORCID v3.0 Member API, with an admin API under /__admin/ for tests.",
+			"version":     "3.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"Error": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"response-code":     map[string]string{"type": "integer"},
+						"developer-message": map[string]string{"type": "string"},
+						"user-message":      map[string]string{"type": "string"},
+						"error-code":        map[string]string{"type": "integer"},
+						"more-info":         map[string]string{"type": "string"},
+					},
+				},
+			},
+			"securitySchemes": map[string]any{
+				"orcid": map[string]any{
+					"type": "oauth2",
+					"flows": map[string]any{
+						"authorizationCode": map[string]any{
+							"authorizationUrl": "/oauth/authorize",
+							"tokenUrl":         "/oauth/token",
+							"scopes":           scopes,
+						},
+						"clientCredentials": map[string]any{
+							"tokenUrl": "/oauth/token",
+							"scopes":   twoLegged,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+//go:embed web/docs.html
+var docsPage []byte
+
+// handleOpenAPI serves the OpenAPI document
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(openAPIDocument())
+}
+
+// handleDocs serves the API browser over /openapi.json
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
@@ -0,0 +1,95 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIRoutes checks the documented operations are the routed ones
+func TestOpenAPIRoutes(t *testing.T) {
+	documented := make(map[string]bool)
+	for _, rt := range apiRoutes() {
+		documented[rt.Method+" "+strings.TrimSuffix(rt.Path, "/")] = true
+	}
+	routed := make(map[string]bool)
+	for _, pattern := range routes().patterns {
+		routed[strings.TrimSuffix(pattern, "/{$}")] = true
+	}
+	for op := range routed {
+		if !documented[op] {
+			t.Errorf("%s is routed but not in apiRoutes", op)
+		}
+	}
+	for op := range documented {
+		if !routed[op] {
+			t.Errorf("%s is in apiRoutes but not routed", op)
+		}
+	}
+}
+
+// TestOpenAPIRoutesServed checks every documented operation reaches a handler
+func TestOpenAPIRoutesServed(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() {
+		store.Restore(saved)
+		clock.Reset()
+	})
+	handler := setupRouter()
+	values := strings.NewReplacer("{orcid}", "0000-0001-2345-6789", "{putCode}", "1", "{putCodes}", "1,2", "{id}", "1", "{name}", "none")
+
+	for _, rt := range apiRoutes() {
+		path := values.Replace(rt.Path)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(rt.Method, path, nil))
+		if w.Code == http.StatusMethodNotAllowed || w.Body.String() == "404 page not found\n" {
+			t.Errorf("%s %s is documented but not routed (%v)", rt.Method, rt.Path, w.Code)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	handler := setupRouter()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	var doc struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil || doc.OpenAPI != "3.0.3" {
+		t.Fatalf("Expected an OpenAPI 3 document, got %v: %v", w.Code, err)
+	}
+	ops := 0
+	for _, methods := range doc.Paths {
+		ops += len(methods)
+	}
+	if ops != len(apiRoutes()) {
+		t.Errorf("Expected %d operations, got %d; is one listed twice?", len(apiRoutes()), ops)
+	}
+
+	var work struct {
+		Parameters []struct {
+			Name string `json:"name"`
+			In   string `json:"in"`
+		} `json:"parameters"`
+		Responses map[string]json.RawMessage `json:"responses"`
+	}
+	json.Unmarshal(doc.Paths["/v3.0/{orcid}/work/{putCode}"]["put"], &work)
+	if len(work.Parameters) != 2 || work.Parameters[1].Name != "putCode" || work.Parameters[1].In != "path" {
+		t.Errorf("Expected orcid and putCode path parameters, got %+v", work.Parameters)
+	}
+	if _, ok := work.Responses["default"]; !ok {
+		t.Error("Expected ORCID's error as the default response")
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"openapi.json"`) {
+		t.Errorf("Expected a page over openapi.json, got %v", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "://") {
+		t.Error("Expected the docs page to load nothing from elsewhere")
+	}
+}
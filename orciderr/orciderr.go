@@ -0,0 +1,180 @@
+// Package orciderr catalogs the error codes the ORCID API v3.0 returns,
+// together with the HTTP status and messages each code comes with. moat uses
+// it to build its error bodies; clients can use it to classify the errors
+// they get back from ORCID (or moat).
+package orciderr
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// MoreInfo is the troubleshooting link ORCID includes in every error body
+const MoreInfo = "https://info.orcid.org/documentation/integration-guide/troubleshooting/"
+
+// Code is an ORCID API error code
+type Code int
+
+const (
+	InvalidMessage         Code = 9001 // payload failed schema validation
+	InvalidScope           Code = 9002 // the requested scope is not valid
+	ExternalIDRequired     Code = 9003 // an activity is missing its external identifiers
+	PutCodeOnCreate        Code = 9004 // a put-code was supplied when creating an item
+	InsufficientScope      Code = 9006 // the token lacks the required scope
+	RecordDeprecated       Code = 9007 // the record was merged into another
+	InvalidRedirectURI     Code = 9008 // redirect_uri is not registered for the client
+	NotSource              Code = 9010 // the client is not the source of the item
+	InvalidAuthCode        Code = 9011 // the authorization code is invalid or used
+	ClientNotFound         Code = 9012 // the client credentials are unknown
+	UnsupportedMediaType   Code = 9013 // Content-Type is not an accepted ORCID type
+	NotAcceptable          Code = 9014 // no acceptable response format
+	ItemNotFound           Code = 9016 // no item with that put-code
+	InvalidToken           Code = 9017 // the access token is invalid
+	RecordLocked           Code = 9018 // the record has been locked
+	DuplicateExternalID    Code = 9021 // an item with the same external id exists
+	PutCodeMismatch        Code = 9034 // the body put-code doesn't match the URL
+	PutCodeConflict        Code = 9035 // an item with that put-code already exists
+	InvalidORCID           Code = 9036 // the ORCID iD is malformed
+	TooManyBulkItems       Code = 9037 // a bulk request exceeded the item limit
+	RecordNotFound         Code = 9038 // no record exists for the iD
+	TokenExpired           Code = 9039 // the access token has expired
+	TooManyRequests        Code = 9040 // the client exceeded the rate limit
+	ServiceUnavailable     Code = 9041 // the API is down for maintenance
+	InvalidParameter       Code = 9042 // a query parameter is invalid
+	InternalError          Code = 9043 // an unexpected server error
+	RecordDeactivated      Code = 9044 // the record has been deactivated
+	UnauthorizedNoToken    Code = 9045 // the request had no bearer token
+	MissingRequiredElement Code = 9046 // a required element such as title is absent
+)
+
+// Entry describes one error code
+type Entry struct {
+	Code             Code
+	Status           int
+	DeveloperMessage string
+	UserMessage      string
+}
+
+var catalog = map[Code]Entry{
+	InvalidMessage:         {InvalidMessage, http.StatusBadRequest, "Bad Request: Invalid incoming message", "There was an error when updating the record. Please try again."},
+	InvalidScope:           {InvalidScope, http.StatusBadRequest, "Bad Request: Invalid scope", "The requested scope is not valid."},
+	ExternalIDRequired:     {ExternalIDRequired, http.StatusBadRequest, "Bad Request: External identifiers are required", "The item must have at least one external identifier."},
+	PutCodeOnCreate:        {PutCodeOnCreate, http.StatusBadRequest, "Bad Request: Put-code must not be set when creating an item", "There was an error when updating the record. Please try again."},
+	InsufficientScope:      {InsufficientScope, http.StatusForbidden, "Forbidden: Insufficient or wrong scope", "The client application is not allowed to perform this action."},
+	RecordDeprecated:       {RecordDeprecated, http.StatusConflict, "Conflict: This account is deprecated", "This account has been merged into a primary ORCID iD."},
+	InvalidRedirectURI:     {InvalidRedirectURI, http.StatusBadRequest, "Bad Request: Redirect URI doesn't match your registered redirect URIs", "The redirect URI is not registered for this application."},
+	NotSource:              {NotSource, http.StatusForbidden, "Forbidden: The client application is not the source of the resource", "You are not allowed to modify this item."},
+	InvalidAuthCode:        {InvalidAuthCode, http.StatusBadRequest, "Bad Request: Invalid authorization code", "The authorization code is invalid or has already been used."},
+	ClientNotFound:         {ClientNotFound, http.StatusUnauthorized, "Unauthorized: Client not found", "The client application could not be identified."},
+	UnsupportedMediaType:   {UnsupportedMediaType, http.StatusUnsupportedMediaType, "Unsupported Media Type", "The request body must be ORCID XML or JSON."},
+	NotAcceptable:          {NotAcceptable, http.StatusNotAcceptable, "Not Acceptable", "The requested response format is not supported."},
+	ItemNotFound:           {ItemNotFound, http.StatusNotFound, "Not Found: No entity found with the given put-code", "The item could not be found."},
+	InvalidToken:           {InvalidToken, http.StatusUnauthorized, "Unauthorized: Invalid access token", "The access token is not valid."},
+	RecordLocked:           {RecordLocked, http.StatusConflict, "Conflict: The ORCID record is locked", "This ORCID record has been locked."},
+	DuplicateExternalID:    {DuplicateExternalID, http.StatusConflict, "Conflict: You have already added this activity (matched by external identifiers)", "You have already added this activity."},
+	PutCodeMismatch:        {PutCodeMismatch, http.StatusBadRequest, "Bad Request: The put-code in the body doesn't match the put-code in the URL", "There was an error when updating the record. Please try again."},
+	PutCodeConflict:        {PutCodeConflict, http.StatusConflict, "Conflict: An item with this put-code already exists", "There was an error when updating the record. Please try again."},
+	InvalidORCID:           {InvalidORCID, http.StatusNotFound, "Not Found: The ORCID iD is not valid", "The ORCID iD is not valid."},
+	TooManyBulkItems:       {TooManyBulkItems, http.StatusBadRequest, "Bad Request: Too many items in the bulk request", "Too many items were sent at once."},
+	RecordNotFound:         {RecordNotFound, http.StatusNotFound, "Not Found: The ORCID record does not exist", "The ORCID record could not be found."},
+	TokenExpired:           {TokenExpired, http.StatusUnauthorized, "Unauthorized: Access token expired", "Your session has expired."},
+	TooManyRequests:        {TooManyRequests, http.StatusTooManyRequests, "Too Many Requests: Rate limit exceeded", "Too many requests. Please try again later."},
+	ServiceUnavailable:     {ServiceUnavailable, http.StatusServiceUnavailable, "Service Unavailable: The ORCID API is down for maintenance", "ORCID is down for maintenance. Please try again later."},
+	InvalidParameter:       {InvalidParameter, http.StatusBadRequest, "Bad Request: Invalid parameter", "There was an error with the request."},
+	InternalError:          {InternalError, http.StatusInternalServerError, "Internal Server Error", "Something went wrong in ORCID."},
+	RecordDeactivated:      {RecordDeactivated, http.StatusConflict, "Conflict: The ORCID record has been deactivated", "This ORCID record has been deactivated."},
+	UnauthorizedNoToken:    {UnauthorizedNoToken, http.StatusUnauthorized, "Unauthorized: An access token is required", "You must sign in to perform this action."},
+	MissingRequiredElement: {MissingRequiredElement, http.StatusBadRequest, "Bad Request: A required element is missing", "There was an error when updating the record. Please try again."},
+}
+
+// Lookup returns the catalog entry for c
+func Lookup(c Code) (Entry, bool) {
+	e, ok := catalog[c]
+	return e, ok
+}
+
+// Codes returns every cataloged code in ascending order
+func Codes() []Code {
+	codes := make([]Code, 0, len(catalog))
+	for c := range catalog {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+// Status returns the HTTP status ORCID sends with c, or 500 for unknown codes
+func (c Code) Status() int {
+	if e, ok := catalog[c]; ok {
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+func (c Code) String() string {
+	if e, ok := catalog[c]; ok {
+		return fmt.Sprintf("%d (%s)", int(c), e.DeveloperMessage)
+	}
+	return fmt.Sprintf("%d", int(c))
+}
+
+// Namespace is the XML namespace of ORCID error bodies
+const Namespace = "http://www.orcid.org/ns/error"
+
+// Error is the ORCID error body, sent in XML or JSON alongside 4xx/5xx codes.
+// In XML it is an error element in Namespace, which its children inherit.
+type Error struct {
+	XMLName          xml.Name `json:"-" xml:"http://www.orcid.org/ns/error error"`
+	ResponseCode     int      `json:"response-code" xml:"response-code"`
+	DeveloperMessage string   `json:"developer-message" xml:"developer-message"`
+	UserMessage      string   `json:"user-message" xml:"user-message"`
+	ErrorCode        Code     `json:"error-code" xml:"error-code"`
+	MoreInfo         string   `json:"more-info" xml:"more-info"`
+}
+
+// New returns the error body for c with the cataloged messages
+func New(c Code) *Error {
+	e, ok := catalog[c]
+	if !ok {
+		e = catalog[InternalError]
+	}
+	return &Error{
+		ResponseCode:     e.Status,
+		DeveloperMessage: fmt.Sprintf("%d %s", e.Status, e.DeveloperMessage),
+		UserMessage:      e.UserMessage,
+		ErrorCode:        c,
+		MoreInfo:         MoreInfo,
+	}
+}
+
+// Newf returns the error body for c with a more specific developer message
+func Newf(c Code, format string, args ...any) *Error {
+	e := New(c)
+	e.DeveloperMessage = fmt.Sprintf("%d %s", e.ResponseCode, fmt.Sprintf(format, args...))
+	return e
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("orcid error %d: %s", int(e.ErrorCode), e.DeveloperMessage)
+}
+
+// Decode reads a JSON error body, as returned by ORCID with an
+// application/json (or vnd.orcid+json) Accept header
+func Decode(r io.Reader) (*Error, error) {
+	var e Error
+	if err := json.NewDecoder(r).Decode(&e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Is reports whether err is (or wraps) an ORCID error with code c
+func Is(err error, c Code) bool {
+	var e *Error
+	return errors.As(err, &e) && e.ErrorCode == c
+}
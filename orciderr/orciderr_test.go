@@ -0,0 +1,81 @@
+package orciderr
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCatalogEntriesMatchCodes(t *testing.T) {
+	for _, c := range Codes() {
+		e, ok := Lookup(c)
+		if !ok {
+			t.Fatalf("Expected entry for %d", c)
+		}
+		if e.Code != c {
+			t.Errorf("Entry for %d has code %d", c, e.Code)
+		}
+		if e.Status < 400 || e.DeveloperMessage == "" || e.UserMessage == "" {
+			t.Errorf("Incomplete entry for %d: %+v", c, e)
+		}
+	}
+}
+
+func TestNewfAndClassify(t *testing.T) {
+	e := Newf(DuplicateExternalID, "duplicate doi:%s", "10.1/x")
+	if e.ResponseCode != http.StatusConflict || e.ErrorCode != DuplicateExternalID {
+		t.Errorf("Unexpected error body %+v", e)
+	}
+	if e.DeveloperMessage != "409 duplicate doi:10.1/x" {
+		t.Errorf("Unexpected developer message %q", e.DeveloperMessage)
+	}
+
+	wrapped := fmt.Errorf("posting work: %w", e)
+	if !Is(wrapped, DuplicateExternalID) || Is(wrapped, ItemNotFound) {
+		t.Error("Expected Is to match only the wrapped code")
+	}
+}
+
+func TestErrorXML(t *testing.T) {
+	data, err := xml.Marshal(New(ItemNotFound))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `<error xmlns="http://www.orcid.org/ns/error">`) {
+		t.Errorf("Expected the error namespace declared, got %s", data)
+	}
+
+	// Every element, the children included, is in the error namespace
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Expected well-formed XML: %v", err)
+		}
+		if el, ok := tok.(xml.StartElement); ok && el.Name.Space != Namespace {
+			t.Errorf("Expected %s in %s, got %q", el.Name.Local, Namespace, el.Name.Space)
+		}
+	}
+
+	var e Error
+	if err := xml.Unmarshal(data, &e); err != nil || e.ErrorCode != ItemNotFound || e.ResponseCode != http.StatusNotFound {
+		t.Errorf("Expected the error back, got %+v %v", e, err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	body := `{"response-code":404,"developer-message":"404 Not Found","user-message":"Gone","error-code":9016,"more-info":"x"}`
+	e, err := Decode(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if e.ErrorCode != ItemNotFound || e.ErrorCode.Status() != http.StatusNotFound {
+		t.Errorf("Unexpected decoded error %+v", e)
+	}
+}
@@ -0,0 +1,60 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"moat/orciderr"
+)
+
+func TestValidORCID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"0000-0002-1825-0097": true,
+		"0000-0001-5109-3700": true,
+		"0000-0002-1694-233X": true,
+		"0000-0002-1825-0098": false,
+		"0000-0002-1694-2330": false,
+		"0000000218250097":    false,
+		"0000-0002-1825-009":  false,
+		"0000-0002-1825-009x": false,
+		"abcd-0002-1825-0097": false,
+	} {
+		if got := validORCID(id); got != want {
+			t.Errorf("validORCID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestInvalidORCIDPath(t *testing.T) {
+	handler := setupRouter()
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		code   orciderr.Code
+	}{
+		{"malformed", "/v3.0/not-an-orcid/record", http.StatusNotFound, orciderr.InvalidORCID},
+		{"bad checksum", "/v3.0/0000-0002-1825-0098/works", http.StatusNotFound, orciderr.InvalidORCID},
+		{"valid but unknown", "/v3.0/0000-0002-1825-0097/record", http.StatusNotFound, orciderr.RecordNotFound},
+		{"demo user with made-up check digit", "/v3.0/0000-0002-1001-2002/record", http.StatusOK, 0},
+		{"search", "/v3.0/search?q=family-name:Doe", http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if tt.code == 0 {
+				return
+			}
+			if e, err := orciderr.Decode(w.Body); err != nil || e.ErrorCode != tt.code {
+				t.Errorf("Expected error code %d, got %v, %v", tt.code, e, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package moat
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"moat/models"
+)
+
+// --- ORCID XML Import ---
+//
+// MOAT_IMPORT loads records in ORCID's own v3.0 XML, as downloaded from
+// GET https://pub.orcid.org/v3.0/{orcid}/record or found in the annual public
+// data file, so a specific real researcher can be mocked exactly. It is
+// different enough from moat's summaries (put-codes are attributes, created
+// and last-modified dates are timestamps) to need its own types. The value may be one .xml
+// file, a directory searched recursively, or a .tar.gz of the data file.
+// Imported users are added alongside the existing ones, replacing any with the
+// same iD.
+
+// orcidXMLRecord is the part of a v3.0 record moat keeps
+type orcidXMLRecord struct {
+	XMLName    xml.Name `xml:"record"`
+	Identifier struct {
+		Path string `xml:"path"`
+	} `xml:"orcid-identifier"`
+	Person     models.Person      `xml:"person"`
+	Activities orcidXMLActivities `xml:"activities-summary"`
+}
+
+type orcidXMLActivities struct {
+	Works            []orcidXMLWork        `xml:"works>group>work-summary"`
+	Employments      []orcidXMLAffiliation `xml:"employments>affiliation-group>employment-summary"`
+	Educations       []orcidXMLAffiliation `xml:"educations>affiliation-group>education-summary"`
+	Qualifications   []orcidXMLAffiliation `xml:"qualifications>affiliation-group>qualification-summary"`
+	Memberships      []orcidXMLAffiliation `xml:"memberships>affiliation-group>membership-summary"`
+	InvitedPositions []orcidXMLAffiliation `xml:"invited-positions>affiliation-group>invited-position-summary"`
+	Fundings         []orcidXMLFunding     `xml:"fundings>group>funding-summary"`
+	PeerReviews      []orcidXMLPeerReview  `xml:"peer-reviews>group>peer-review-group>peer-review-summary"`
+}
+
+// orcidXMLMeta is the attribution every ORCID activity summary carries
+type orcidXMLMeta struct {
+	CreatedDate      string `xml:"created-date"`
+	LastModifiedDate string `xml:"last-modified-date"`
+	Source           struct {
+		SourceOrcid *OrcidIdentifier `xml:"source-orcid"`
+		SourceName  string           `xml:"source-name"`
+	} `xml:"source"`
+}
+
+type orcidXMLDate struct {
+	Year  string `xml:"year"`
+	Month string `xml:"month"`
+	Day   string `xml:"day"`
+}
+
+type orcidXMLOrg struct {
+	Name    string `xml:"name"`
+	Address struct {
+		City    string `xml:"city"`
+		Region  string `xml:"region"`
+		Country string `xml:"country"`
+	} `xml:"address"`
+}
+
+type orcidXMLExternalID struct {
+	Type         string `xml:"external-id-type"`
+	Value        string `xml:"external-id-value"`
+	URL          string `xml:"external-id-url"`
+	Relationship string `xml:"external-id-relationship"`
+}
+
+type orcidXMLWork struct {
+	PutCode         int                  `xml:"put-code,attr"`
+	Title           string               `xml:"title>title"`
+	Type            string               `xml:"type"`
+	JournalTitle    string               `xml:"journal-title"`
+	URL             string               `xml:"url"`
+	PublicationDate *orcidXMLDate        `xml:"publication-date"`
+	ExternalIDs     []orcidXMLExternalID `xml:"external-ids>external-id"`
+	orcidXMLMeta
+}
+
+type orcidXMLAffiliation struct {
+	PutCode        int           `xml:"put-code,attr"`
+	DepartmentName string        `xml:"department-name"`
+	RoleTitle      string        `xml:"role-title"`
+	StartDate      *orcidXMLDate `xml:"start-date"`
+	EndDate        *orcidXMLDate `xml:"end-date"`
+	Organization   orcidXMLOrg   `xml:"organization"`
+	orcidXMLMeta
+}
+
+type orcidXMLFunding struct {
+	PutCode      int                  `xml:"put-code,attr"`
+	Title        string               `xml:"title>title"`
+	Type         string               `xml:"type"`
+	StartDate    *orcidXMLDate        `xml:"start-date"`
+	EndDate      *orcidXMLDate        `xml:"end-date"`
+	Organization orcidXMLOrg          `xml:"organization"`
+	ExternalIDs  []orcidXMLExternalID `xml:"external-ids>external-id"`
+}
+
+type orcidXMLPeerReview struct {
+	PutCode               int                  `xml:"put-code,attr"`
+	ReviewerRole          string               `xml:"reviewer-role"`
+	ReviewType            string               `xml:"review-type"`
+	ReviewURL             string               `xml:"review-url"`
+	CompletionDate        *orcidXMLDate        `xml:"completion-date"`
+	ReviewGroupID         string               `xml:"review-group-id"`
+	ConveningOrganization orcidXMLOrg          `xml:"convening-organization"`
+	ExternalIDs           []orcidXMLExternalID `xml:"external-ids>external-id"`
+}
+
+// parseORCIDXML decodes one record in ORCID's v3.0 XML
+func parseORCIDXML(data []byte) (orcidXMLRecord, error) {
+	var rec orcidXMLRecord
+	if err := xml.Unmarshal(data, &rec); err != nil {
+		return rec, err
+	}
+	if rec.Identifier.Path == "" {
+		return rec, errors.New("record has no orcid-identifier path")
+	}
+	return rec, nil
+}
+
+// loadORCIDXML imports every record at path, a file, directory or .tar.gz.
+// Every record is parsed before the store is touched, so a bad one changes
+// nothing.
+func loadORCIDXML(path string) (int, error) {
+	var records []orcidXMLRecord
+	add := func(name string, data []byte) error {
+		rec, err := parseORCIDXML(data)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", name, err)
+		}
+		records = append(records, rec)
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		return 0, err
+	case info.IsDir():
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".xml") {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			return add(p, data)
+		})
+	case strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz"):
+		err = readTarGz(path, add)
+	default:
+		var data []byte
+		if data, err = os.ReadFile(path); err == nil {
+			err = add(path, data)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rec := range records {
+		importORCIDRecord(rec)
+	}
+	return len(records), nil
+}
+
+// readTarGz calls fn with each .xml file in a gzipped tar archive
+func readTarGz(path string, fn func(name string, data []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg || !strings.EqualFold(filepath.Ext(h.Name), ".xml") {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := fn(h.Name, data); err != nil {
+			return err
+		}
+	}
+}
+
+// importORCIDRecord adds rec's person and activities to the store, replacing
+// any user with the same iD. Put-codes are kept, so URLs copied from the real
+// record work against moat.
+func importORCIDRecord(rec orcidXMLRecord) string {
+	orcid := rec.Identifier.Path
+	rec.Person.Path = orcid
+	store.AddUser(orcid, rec.Person)
+
+	a := rec.Activities
+	for _, w := range a.Works {
+		work := GenericWorkResponse{
+			Type:         w.Type,
+			PutCode:      fixturePutCode(orcid, w.PutCode),
+			Title:        Title{Title: Value{Value: w.Title}},
+			JournalTitle: optionalValue(w.JournalTitle),
+			ExternalIDs:  externalIDs(w.ExternalIDs),
+			URL:          optionalValue(w.URL),
+			ActivityMeta: w.meta(),
+		}
+		if d := w.PublicationDate.dateYear(); d != nil {
+			work.PublicationDate = *d
+		}
+		putImported(orcid, sectionWork, work.PutCode, work)
+	}
+
+	affiliations := []struct {
+		section string
+		list    []orcidXMLAffiliation
+		wrap    func(Affiliation) any
+	}{
+		{sectionEmployment, a.Employments, func(af Affiliation) any { return GenericEmploymentResponse{Affiliation: af} }},
+		{sectionEducation, a.Educations, func(af Affiliation) any { return GenericEducationResponse{Affiliation: af} }},
+		{sectionQualification, a.Qualifications, func(af Affiliation) any { return GenericQualificationResponse{Affiliation: af} }},
+		{sectionMembership, a.Memberships, func(af Affiliation) any { return GenericMembershipResponse{Affiliation: af} }},
+		{sectionInvitedPosition, a.InvitedPositions, func(af Affiliation) any { return GenericInvitedPositionResponse{Affiliation: af} }},
+	}
+	for _, group := range affiliations {
+		for _, x := range group.list {
+			af := Affiliation{
+				PutCode:        fixturePutCode(orcid, x.PutCode),
+				DepartmentName: x.DepartmentName,
+				RoleTitle:      x.RoleTitle,
+				Organization:   x.Organization.org(),
+				StartDate:      x.StartDate.dateYear(),
+				EndDate:        x.EndDate.dateYear(),
+				ActivityMeta:   x.meta(),
+			}
+			putImported(orcid, group.section, af.PutCode, group.wrap(af))
+		}
+	}
+
+	for _, x := range a.Fundings {
+		funding := GenericFundingResponse{
+			PutCode:      fixturePutCode(orcid, x.PutCode),
+			Type:         x.Type,
+			Title:        Title{Title: Value{Value: x.Title}},
+			Organization: x.Organization.org(),
+			EndDate:      x.EndDate.dateYear(),
+			ExternalIDs:  externalIDs(x.ExternalIDs),
+		}
+		if d := x.StartDate.dateYear(); d != nil {
+			funding.StartDate = *d
+		}
+		putImported(orcid, sectionFunding, funding.PutCode, funding)
+	}
+
+	for _, x := range a.PeerReviews {
+		review := GenericPeerReviewResponse{
+			PutCode:               fixturePutCode(orcid, x.PutCode),
+			ReviewerRole:          x.ReviewerRole,
+			ReviewType:            x.ReviewType,
+			ReviewCompletionDate:  x.CompletionDate.dateYear(),
+			ReviewGroupID:         x.ReviewGroupID,
+			ConveningOrganization: x.ConveningOrganization.org(),
+			ExternalIDs:           externalIDs(x.ExternalIDs),
+		}
+		if x.ReviewURL != "" {
+			review.ReviewURL = &Value{Value: x.ReviewURL}
+		}
+		putImported(orcid, sectionPeerReview, review.PutCode, review)
+	}
+	return orcid
+}
+
+func putImported(orcid, section string, putCode int, v any) {
+	data, _ := json.Marshal(v)
+	store.PutItem(orcid, section, putCode, data)
+}
+
+// dateYear converts d, returning nil for a missing or yearless date
+func (d *orcidXMLDate) dateYear() *DateYear {
+	if d == nil || d.Year == "" {
+		return nil
+	}
+	out := &DateYear{Year: Value{Value: d.Year}}
+	if d.Month != "" {
+		out.Month = &Value{Value: d.Month}
+	}
+	if d.Day != "" {
+		out.Day = &Value{Value: d.Day}
+	}
+	return out
+}
+
+func (o orcidXMLOrg) org() Org {
+	out := Org{Name: o.Name}
+	if a := o.Address; a.City != "" || a.Region != "" || a.Country != "" {
+		out.Address = &OrgAddress{City: a.City, Region: a.Region, Country: a.Country}
+	}
+	return out
+}
+
+func externalIDs(list []orcidXMLExternalID) *ExternalIDs {
+	if len(list) == 0 {
+		return nil
+	}
+	out := &ExternalIDs{}
+	for _, x := range list {
+		out.ExternalID = append(out.ExternalID, ExternalID{
+			Type:         x.Type,
+			Value:        x.Value,
+			URL:          optionalValue(x.URL),
+			Relationship: x.Relationship,
+		})
+	}
+	return out
+}
+
+// optionalValue wraps s as a Value, or returns nil if it is empty
+func optionalValue(s string) *Value {
+	if s == "" {
+		return nil
+	}
+	return &Value{Value: s}
+}
+
+// meta converts the summary's attribution. Sources identified by a client
+// rather than an iD keep only their name.
+func (m orcidXMLMeta) meta() ActivityMeta {
+	var out ActivityMeta
+	out.CreatedDate = orcidXMLTime(m.CreatedDate)
+	out.LastModifiedDate = orcidXMLTime(m.LastModifiedDate)
+	if m.Source.SourceOrcid != nil || m.Source.SourceName != "" {
+		out.Source = &ActivitySource{SourceOrcid: m.Source.SourceOrcid}
+		if m.Source.SourceName != "" {
+			out.Source.SourceName = &Value{Value: m.Source.SourceName}
+		}
+	}
+	return out
+}
+
+// orcidXMLTime converts an ORCID timestamp such as 2019-06-05T13:11:59.870Z
+// to moat's millisecond value
+func orcidXMLTime(s string) *LastModified {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(s))
+	if err != nil {
+		return nil
+	}
+	return &LastModified{Value: t.UnixMilli()}
+}
+
+// handleAdminImport imports one ORCID v3.0 XML record from the request body
+func handleAdminImport(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rec, err := parseORCIDXML(data)
+	if err != nil {
+		http.Error(w, "Invalid ORCID record: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	orcid := importORCIDRecord(rec)
+	w.Header().Set("Location", "/v3.0/"+orcid+"/record")
+	writeResponseStatus(w, r, http.StatusCreated, map[string]string{"orcid": orcid})
+}
@@ -0,0 +1,103 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const carberry = "0000-0002-1825-0097"
+
+func TestLoadORCIDXML(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+
+	n, err := loadORCIDXML("testdata/orcid")
+	if err != nil || n != 1 {
+		t.Fatalf("Expected one record, got %d, %v", n, err)
+	}
+	if !store.HasUser("0000-0001-2345-6789") {
+		t.Error("Expected the demo users to be kept")
+	}
+
+	person, ok := store.Person(carberry)
+	if !ok || person.Name == nil || person.Name.GivenNames != "Josiah" {
+		t.Fatalf("Expected Josiah's person, got %+v", person.Name)
+	}
+	if person.Keywords == nil || len(person.Keywords.Keywords) != 1 || person.Keywords.Keywords[0].Content != "psychoceramics" {
+		t.Errorf("Expected the keyword, got %+v", person.Keywords)
+	}
+
+	work, ok := loadActivity[GenericWorkResponse](store, carberry, sectionWork, 733535)
+	if !ok {
+		t.Fatal("Expected the work under its real put-code")
+	}
+	if !strings.HasPrefix(work.Title.Title.Value, "Toward a Unified Theory") || work.Type != "journal-article" {
+		t.Errorf("Unexpected work %+v", work)
+	}
+	if work.PublicationDate.Year.Value != "2008" || work.PublicationDate.Day == nil || work.PublicationDate.Day.Value != "14" {
+		t.Errorf("Expected the full publication date, got %+v", work.PublicationDate)
+	}
+	if work.ExternalIDs == nil || work.ExternalIDs.ExternalID[0].Value != "10.5555/12345678" ||
+		work.ExternalIDs.ExternalID[0].URL == nil || work.ExternalIDs.ExternalID[0].URL.Value != "https://doi.org/10.5555/12345678" {
+		t.Errorf("Expected the DOI and its URL, got %+v", work.ExternalIDs)
+	}
+	if work.JournalTitle == nil || work.JournalTitle.Value != "Journal of Psychoceramics" {
+		t.Errorf("Expected the journal title, got %+v", work.JournalTitle)
+	}
+	if work.CreatedDate == nil || work.CreatedDate.Value != 1372093237364 {
+		t.Errorf("Expected the created date to be kept, got %+v", work.CreatedDate)
+	}
+
+	emp, ok := loadActivity[GenericEmploymentResponse](store, carberry, sectionEmployment, 4490)
+	if !ok || emp.Organization.Name != "Brown University" || emp.Organization.Address == nil || emp.Organization.Address.Region != "RI" {
+		t.Fatalf("Expected the employment, got %+v", emp)
+	}
+	if emp.Source == nil || emp.Source.SourceName == nil || emp.Source.SourceName.Value != "Josiah Carberry" {
+		t.Errorf("Expected the source to be kept, got %+v", emp.Source)
+	}
+
+	edu, ok := loadActivity[GenericEducationResponse](store, carberry, sectionEducation, 4491)
+	if !ok || edu.StartDate != nil || edu.EndDate == nil || edu.EndDate.Year.Value != "1952" {
+		t.Errorf("Expected the education with only an end date, got %+v", edu)
+	}
+
+	funding, ok := loadActivity[GenericFundingResponse](store, carberry, sectionFunding, 2231)
+	if !ok || funding.Title.Title.Value != "Ceramic fracture mechanics" || funding.StartDate.Year.Value != "1990" {
+		t.Errorf("Expected the funding, got %+v", funding)
+	}
+}
+
+func TestHandleAdminImport(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+
+	data, err := os.ReadFile("testdata/orcid/" + carberry + ".xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/__admin/import", strings.NewReader(string(data)))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v: %s", w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest("GET", "/v3.0/"+carberry+"/work/733535", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Silly String Theory") {
+		t.Errorf("Expected the imported work, got %v: %s", w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest("POST", "/__admin/import", strings.NewReader("<record/>"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a record without an iD to be rejected, got %v", w.Code)
+	}
+}
@@ -0,0 +1,256 @@
+package moat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- File Persistence ---
+//
+// With MOAT_DATA_DIR set, the store is saved as JSON under that directory and
+// reloaded at startup, so a long-running demo instance keeps its data across
+// restarts. Each user is one file under users/, and group-id records are in
+// groups.json. --store=bolt:<file> keeps the whole store in one file instead,
+// for setups that want a single database file like bbolt's; it is JSON too,
+// not a bbolt database, since moat sticks to the standard library. Writes
+// mark the store dirty and a background goroutine saves it shortly
+// afterwards, so a burst of writes costs one save.
+
+// snapshotFiles is where a store is saved: a dataDir or a dataFile
+type snapshotFiles interface {
+	// load reads the saved state, reporting whether there was any
+	load() (Snapshot, bool, error)
+	save(snap Snapshot) error
+	String() string
+}
+
+// parseStoreSpec resolves a --store value to where the store is saved, or
+// nil for memory
+func parseStoreSpec(spec string) (snapshotFiles, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	switch {
+	case kind == "memory" && path == "":
+		return nil, nil
+	case kind == "file" && path != "":
+		return &dataDir{path: path}, nil
+	case kind == "bolt" && path != "":
+		return &dataFile{path: path}, nil
+	}
+	return nil, fmt.Errorf("invalid store %q: want memory, file:<dir> or bolt:<file>", spec)
+}
+
+// flushDelay is how long the saver waits after a write before saving, so
+// writes that arrive together are saved together
+const flushDelay = 200 * time.Millisecond
+
+// saver saves the store's changes to files
+type saver struct {
+	files snapshotFiles
+	dirty chan struct{}
+	mu    sync.Mutex // held while saving
+}
+
+// openSaver loads any saved state from files into store and starts saving
+// store's changes there
+func openSaver(files snapshotFiles) (*saver, error) {
+	d := &saver{files: files, dirty: make(chan struct{}, 1)}
+	snap, found, err := files.load()
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		store.Restore(snap)
+		reserveSnapshotPutCodes(snap)
+		slog.Info("Loaded saved data", "store", files, "users", len(snap.Users))
+	}
+
+	store.SetOnWrite(d.markDirty)
+	go d.run()
+	if !found {
+		// Save the seeded state so the saved data is complete from the start
+		d.markDirty()
+	}
+	return d, nil
+}
+
+func (d *saver) markDirty() {
+	select {
+	case d.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (d *saver) run() {
+	for range d.dirty {
+		time.Sleep(flushDelay)
+		if err := d.flush(); err != nil {
+			slog.Error("Unable to save data", "store", d.files, "error", err)
+		}
+	}
+}
+
+// flush saves the store now
+func (d *saver) flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.files.save(store.Snapshot())
+}
+
+// dataDir saves a store to, and loads it from, a directory
+type dataDir struct {
+	path string
+}
+
+func (d *dataDir) String() string {
+	return d.path
+}
+
+// userFile returns the file holding orcid's data
+func (d *dataDir) userFile(orcid string) string {
+	return filepath.Join(d.path, "users", orcid+".json")
+}
+
+// save writes snap, removing the files of users no longer in it
+func (d *dataDir) save(snap Snapshot) error {
+	keep := make(map[string]bool, len(snap.Users))
+	for _, u := range snap.Users {
+		if err := writeJSONFile(d.userFile(u.ORCID), u); err != nil {
+			return err
+		}
+		keep[filepath.Base(d.userFile(u.ORCID))] = true
+	}
+	if err := writeJSONFile(filepath.Join(d.path, "groups.json"), snap.Groups); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(d.path, "users"))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".json") && !keep[e.Name()] {
+			os.Remove(filepath.Join(d.path, "users", e.Name()))
+		}
+	}
+	return nil
+}
+
+// load reads the saved state, reporting whether there was any
+func (d *dataDir) load() (Snapshot, bool, error) {
+	snap := Snapshot{}
+	if err := os.MkdirAll(filepath.Join(d.path, "users"), 0o755); err != nil {
+		return snap, false, err
+	}
+	entries, err := os.ReadDir(filepath.Join(d.path, "users"))
+	if err != nil {
+		return snap, false, err
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		var u StoredUser
+		if err := readJSONFile(filepath.Join(d.path, "users", e.Name()), &u); err != nil {
+			return snap, false, err
+		}
+		snap.Users = append(snap.Users, u)
+	}
+
+	err = readJSONFile(filepath.Join(d.path, "groups.json"), &snap.Groups)
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+	return snap, len(snap.Users) > 0, err
+}
+
+// dataFile saves a store to, and loads it from, a single file
+type dataFile struct {
+	path string
+}
+
+func (f *dataFile) String() string {
+	return f.path
+}
+
+// save writes snap over the file, through a temporary file so a crash
+// mid-save leaves the previous one intact
+func (f *dataFile) save(snap Snapshot) error {
+	return writeJSONFile(f.path, snap)
+}
+
+func (f *dataFile) load() (Snapshot, bool, error) {
+	snap := Snapshot{}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return snap, false, err
+	}
+	err := readJSONFile(f.path, &snap)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Snapshot{}, false, nil
+	}
+	return snap, err == nil && len(snap.Users) > 0, err
+}
+
+// writeJSONFile writes v to path atomically, so a crash mid-save leaves the
+// previous file intact
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// reserveSnapshotPutCodes stops the IDService reissuing put-codes that
+// restored items already use
+func reserveSnapshotPutCodes(snap Snapshot) {
+	for _, it := range snap.Groups {
+		ids.ReservePutCode("", it.PutCode)
+	}
+	for _, u := range snap.Users {
+		for _, items := range u.Activities {
+			for _, it := range items {
+				ids.ReservePutCode(u.ORCID, it.PutCode)
+			}
+		}
+		var putCodes []string
+		if u.Person.Addresses != nil {
+			for _, a := range u.Person.Addresses.Addresses {
+				putCodes = append(putCodes, a.PutCode)
+			}
+		}
+		if u.Person.ExternalIdentifiers != nil {
+			for _, e := range u.Person.ExternalIdentifiers.ExternalIdentifiers {
+				putCodes = append(putCodes, e.PutCode)
+			}
+		}
+		for _, pc := range putCodes {
+			if n, err := strconv.Atoi(pc); err == nil {
+				ids.ReservePutCode(u.ORCID, n)
+			}
+		}
+	}
+}
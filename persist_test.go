@@ -0,0 +1,100 @@
+package moat
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataDirRoundTrip(t *testing.T) {
+	d := &dataDir{path: t.TempDir()}
+	if err := os.MkdirAll(filepath.Join(d.path, "users"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.save(store.Snapshot()); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if _, err := os.Stat(d.userFile("0000-0001-2345-6789")); err != nil {
+		t.Errorf("Expected a file for Sofia: %v", err)
+	}
+
+	snap, found, err := d.load()
+	if err != nil || !found {
+		t.Fatalf("Failed to load: %v (found %v)", err, found)
+	}
+
+	restored := NewStore()
+	restored.Restore(snap)
+	if got, want := restored.ORCIDs(), store.ORCIDs(); len(got) != len(want) {
+		t.Errorf("Expected %d users back, got %d", len(want), len(got))
+	}
+	person, ok := restored.Person("0000-0001-2345-6789")
+	if !ok || person.Name == nil || person.Name.GivenNames != "Sofia" {
+		t.Errorf("Expected Sofia's person back, got %+v", person.Name)
+	}
+	items, _ := restored.Items("0000-0001-2345-6789", sectionEmployment)
+	var emp GenericEmploymentResponse
+	if len(items) == 0 || json.Unmarshal(items[0].Data, &emp) != nil || emp.Organization.Name == "" {
+		t.Errorf("Expected the stored employment back, got %v", items)
+	}
+
+	// Users missing from a later save lose their file
+	snap.Users = snap.Users[:1]
+	if err := d.save(snap); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(d.path, "users"))
+	if len(entries) != 1 {
+		t.Errorf("Expected one user file left, got %d", len(entries))
+	}
+}
+
+func TestDataFileRoundTrip(t *testing.T) {
+	f := &dataFile{path: filepath.Join(t.TempDir(), "db", "moat.db")}
+	if _, found, err := f.load(); err != nil || found {
+		t.Fatalf("Expected nothing saved yet, got %v (found %v)", err, found)
+	}
+
+	if err := f.save(store.Snapshot()); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(f.path))
+	if len(entries) != 1 || entries[0].Name() != "moat.db" {
+		t.Errorf("Expected just the one file, got %v", entries)
+	}
+
+	snap, found, err := f.load()
+	if err != nil || !found {
+		t.Fatalf("Failed to load: %v (found %v)", err, found)
+	}
+	restored := NewStore()
+	restored.Restore(snap)
+	if got, want := restored.ORCIDs(), store.ORCIDs(); len(got) != len(want) {
+		t.Errorf("Expected %d users back, got %d", len(want), len(got))
+	}
+	person, ok := restored.Person("0000-0001-2345-6789")
+	if !ok || person.Name == nil || person.Name.GivenNames != "Sofia" {
+		t.Errorf("Expected Sofia's person back, got %+v", person.Name)
+	}
+}
+
+func TestParseStoreSpec(t *testing.T) {
+	if files, err := parseStoreSpec("file:/tmp/moat"); err != nil || files.String() != "/tmp/moat" {
+		t.Errorf("Expected the /tmp/moat directory, got %v (%v)", files, err)
+	} else if _, ok := files.(*dataDir); !ok {
+		t.Errorf("Expected a directory, got %T", files)
+	}
+	if files, err := parseStoreSpec("memory"); err != nil || files != nil {
+		t.Errorf("Expected nothing saved, got %v (%v)", files, err)
+	}
+	if files, err := parseStoreSpec("bolt:/tmp/moat.db"); err != nil {
+		t.Errorf("Expected the bolt store, got %v", err)
+	} else if f, ok := files.(*dataFile); !ok || f.path != "/tmp/moat.db" {
+		t.Errorf("Expected the /tmp/moat.db file, got %v", files)
+	}
+	if _, err := parseStoreSpec("bolt:"); err == nil {
+		t.Error("Expected a bolt store without a file refused")
+	}
+}
@@ -0,0 +1,375 @@
+package moat
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"moat/models"
+	"moat/orciderr"
+)
+
+// --- Biographical Section Handlers ---
+//
+// These operate on the sections of models.Person kept in the store. The
+// models types carry ORCID's namespaced XML tags, so XML bodies decode
+// straight into them. List sections (addresses, external identifiers) share
+// one set of handlers, parameterised by a personSection describing where the
+// items live on the person.
+
+// errItemNotFound is returned from UpdatePerson callbacks when a put-code
+// doesn't exist
+var errItemNotFound = errors.New("item not found")
+
+// itemMeta points at the fields every person list item carries
+type itemMeta struct {
+	Visibility       *string
+	PutCode          *string
+	CreatedDate      **string
+	LastModifiedDate **string
+	Source           **models.Source
+}
+
+// personSection describes one list section of models.Person
+type personSection[T any] struct {
+	// item is the path segment for a single item, used in Location headers
+	item string
+	// list and setList read and replace the section's items
+	list    func(p *models.Person) []*T
+	setList func(p *models.Person, items []*T)
+	meta    func(v *T) itemMeta
+	// listResponse and itemResponse wrap values in their XML documents
+	listResponse func(items []*T) any
+	itemResponse func(v *T) any
+}
+
+// registerPersonSection adds GET/POST on collection and GET/PUT/DELETE on
+// item/{putCode}
+func registerPersonSection[T any](mux *routeMux, collection string, s personSection[T]) {
+	itemPath := "/v3.0/{orcid}/" + s.item + "/{putCode}"
+	mux.HandleFunc("GET /v3.0/{orcid}/"+collection, s.handleList)
+	mux.HandleFunc("POST /v3.0/{orcid}/"+collection, s.handlePost)
+	mux.HandleFunc("GET "+itemPath, s.handleGet)
+	mux.HandleFunc("PUT "+itemPath, s.handlePut)
+	mux.HandleFunc("DELETE "+itemPath, s.handleDelete)
+}
+
+func personItemLocation(orcid, section, putCode string) string {
+	return fmt.Sprintf("https://api.orcid.org/v3.0/%s/%s/%s", orcid, section, putCode)
+}
+
+// mockSource is the source recorded on items created through the API: the
+// client whose token wrote them, or the researcher without one
+func mockSource(orcid, clientID string) *models.Source {
+	if clientID != "" {
+		return &models.Source{
+			SourceClientID: &models.SourceClientID{
+				Uri:  "https://orcid.org/client/" + clientID,
+				Path: clientID,
+				Host: "orcid.org",
+			},
+			SourceName: &models.SourceName{Value: clientName(clientID)},
+		}
+	}
+	return &models.Source{
+		SourceOrcid: &models.SourceOrcid{
+			Uri:  fmt.Sprintf("https://orcid.org/%s", orcid),
+			Path: orcid,
+			Host: "orcid.org",
+		},
+		SourceName: &models.SourceName{Value: "MOAT Service"},
+	}
+}
+
+// timestamp returns the current time as ORCID writes it, to the millisecond
+func timestamp() *string {
+	now := clock.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	return &now
+}
+
+func (s personSection[T]) find(p models.Person, putCode string) (*T, bool) {
+	for _, v := range s.list(&p) {
+		if *s.meta(v).PutCode == putCode {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (s personSection[T]) handleList(w http.ResponseWriter, r *http.Request) {
+	if notModified(w, r, r.PathValue("orcid"), "") {
+		return
+	}
+	person, ok := personFor(r, r.PathValue("orcid"))
+	if !ok {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
+	}
+	writeResponse(w, r, s.listResponse(s.list(&person)))
+}
+
+func (s personSection[T]) handleGet(w http.ResponseWriter, r *http.Request) {
+	person, ok := personFor(r, r.PathValue("orcid"))
+	if !ok {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
+	}
+	v, ok := s.find(person, r.PathValue("putCode"))
+	if !ok {
+		writeError(w, r, itemNotFound(s.item, r.PathValue("putCode")))
+		return
+	}
+	writeResponse(w, r, s.itemResponse(v))
+}
+
+func (s personSection[T]) handlePost(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+
+	v := new(T)
+	if err := decodeBody(r, v); err != nil {
+		writeError(w, r, invalidPayload(s.item, err))
+		return
+	}
+
+	m := s.meta(v)
+	*m.PutCode = strconv.Itoa(ids.PutCode(orcid))
+	*m.CreatedDate = timestamp()
+	*m.LastModifiedDate = *m.CreatedDate
+	*m.Source = mockSource(orcid, tokenClientID(r))
+	if *m.Visibility == "" {
+		*m.Visibility = "PUBLIC"
+	}
+
+	err := storeFor(r).UpdatePerson(orcid, func(p *models.Person) error {
+		s.setList(p, append(slices.Clone(s.list(p)), v))
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
+	}
+
+	type PutCodeResponse struct {
+		XMLName xml.Name `json:"-" xml:"response"`
+		PutCode string   `json:"put-code" xml:"put-code"`
+	}
+
+	w.Header().Set("Location", personItemLocation(orcid, s.item, *m.PutCode))
+	writeResponseStatus(w, r, http.StatusCreated, PutCodeResponse{PutCode: *m.PutCode})
+}
+
+func (s personSection[T]) handlePut(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+	putCode := r.PathValue("putCode")
+
+	v := new(T)
+	if err := decodeBody(r, v); err != nil {
+		writeError(w, r, invalidPayload(s.item, err))
+		return
+	}
+	m := s.meta(v)
+	if *m.PutCode != "" && *m.PutCode != putCode {
+		writeError(w, r, orciderr.New(orciderr.PutCodeMismatch))
+		return
+	}
+
+	err := storeFor(r).UpdatePerson(orcid, func(p *models.Person) error {
+		list := slices.Clone(s.list(p))
+		for i, existing := range list {
+			old := s.meta(existing)
+			if *old.PutCode != putCode {
+				continue
+			}
+			*m.PutCode = putCode
+			*m.CreatedDate = *old.CreatedDate
+			*m.LastModifiedDate = timestamp()
+			*m.Source = *old.Source
+			if *m.Visibility == "" {
+				*m.Visibility = *old.Visibility
+			}
+			list[i] = v
+			s.setList(p, list)
+			return nil
+		}
+		return errItemNotFound
+	})
+	if err != nil {
+		writeError(w, r, itemNotFound(s.item, r.PathValue("putCode")))
+		return
+	}
+
+	w.Header().Set("Location", personItemLocation(orcid, s.item, putCode))
+	writeResponse(w, r, s.itemResponse(v))
+}
+
+func (s personSection[T]) handleDelete(w http.ResponseWriter, r *http.Request) {
+	putCode := r.PathValue("putCode")
+
+	err := storeFor(r).UpdatePerson(r.PathValue("orcid"), func(p *models.Person) error {
+		current := s.list(p)
+		list := slices.DeleteFunc(slices.Clone(current), func(v *T) bool {
+			return *s.meta(v).PutCode == putCode
+		})
+		if len(list) == len(current) {
+			return errItemNotFound
+		}
+		s.setList(p, list)
+		return nil
+	})
+	if err != nil {
+		writeError(w, r, itemNotFound(s.item, r.PathValue("putCode")))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Addresses ---
+
+// AddressesResponse is the /address list document
+type AddressesResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/address addresses"`
+	models.Addresses
+}
+
+// AddressResponse is a single /address/{putCode} document
+type AddressResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/address address"`
+	models.Address
+}
+
+var addressSection = personSection[models.Address]{
+	item: "address",
+	list: func(p *models.Person) []*models.Address {
+		if p.Addresses == nil {
+			return nil
+		}
+		return p.Addresses.Addresses
+	},
+	setList: func(p *models.Person, items []*models.Address) {
+		p.Addresses = &models.Addresses{Addresses: items}
+	},
+	meta: func(a *models.Address) itemMeta {
+		return itemMeta{&a.Visibility, &a.PutCode, &a.CreatedDate, &a.LastModifiedDate, &a.Source}
+	},
+	listResponse: func(items []*models.Address) any {
+		return AddressesResponse{Addresses: models.Addresses{Addresses: items}}
+	},
+	itemResponse: func(a *models.Address) any { return AddressResponse{Address: *a} },
+}
+
+// --- External Identifiers ---
+
+// ExternalIdentifiersResponse is the /external-identifiers list document
+type ExternalIdentifiersResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/external-identifier external-identifiers"`
+	models.ExternalIdentifiers
+}
+
+// ExternalIdentifierResponse is a single /external-identifier/{putCode}
+// document
+type ExternalIdentifierResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/external-identifier external-identifier"`
+	models.ExternalIdentifier
+}
+
+var externalIdentifierSection = personSection[models.ExternalIdentifier]{
+	item: "external-identifier",
+	list: func(p *models.Person) []*models.ExternalIdentifier {
+		if p.ExternalIdentifiers == nil {
+			return nil
+		}
+		return p.ExternalIdentifiers.ExternalIdentifiers
+	},
+	setList: func(p *models.Person, items []*models.ExternalIdentifier) {
+		p.ExternalIdentifiers = &models.ExternalIdentifiers{ExternalIdentifiers: items}
+	},
+	meta: func(e *models.ExternalIdentifier) itemMeta {
+		return itemMeta{&e.Visibility, &e.PutCode, &e.CreatedDate, &e.LastModifiedDate, &e.Source}
+	},
+	listResponse: func(items []*models.ExternalIdentifier) any {
+		return ExternalIdentifiersResponse{ExternalIdentifiers: models.ExternalIdentifiers{ExternalIdentifiers: items}}
+	},
+	itemResponse: func(e *models.ExternalIdentifier) any {
+		return ExternalIdentifierResponse{ExternalIdentifier: *e}
+	},
+}
+
+// --- Personal Details ---
+
+// PersonalDetailsResponse is the /personal-details document: the name parts
+// of the person without contact or identifier sections
+type PersonalDetailsResponse struct {
+	XMLName    xml.Name           `json:"-" xml:"http://www.orcid.org/ns/personal-details personal-details"`
+	Name       *models.PersonName `json:"name,omitempty" xml:"http://www.orcid.org/ns/person name,omitempty"`
+	OtherNames *models.OtherNames `json:"other-names,omitempty" xml:"http://www.orcid.org/ns/other-name other-names,omitempty"`
+	Biography  *models.Biography  `json:"biography,omitempty" xml:"http://www.orcid.org/ns/person biography,omitempty"`
+}
+
+func handleGetPersonalDetails(w http.ResponseWriter, r *http.Request) {
+	if notModified(w, r, r.PathValue("orcid"), "") {
+		return
+	}
+	person, ok := personFor(r, r.PathValue("orcid"))
+	if !ok {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
+	}
+
+	writeResponse(w, r, PersonalDetailsResponse{
+		Name:       person.Name,
+		OtherNames: person.OtherNames,
+		Biography:  person.Biography,
+	})
+}
+
+// BiographyResponse is the /biography document
+type BiographyResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/person biography"`
+	models.Biography
+}
+
+func handleGetBiography(w http.ResponseWriter, r *http.Request) {
+	if notModified(w, r, r.PathValue("orcid"), "") {
+		return
+	}
+	person, ok := personFor(r, r.PathValue("orcid"))
+	if !ok {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
+	}
+
+	resp := BiographyResponse{}
+	if person.Biography != nil {
+		resp.Biography = *person.Biography
+	}
+	writeResponse(w, r, resp)
+}
+
+// --- Emails ---
+
+// EmailsResponse is the /email document
+type EmailsResponse struct {
+	XMLName xml.Name `json:"-" xml:"http://www.orcid.org/ns/email emails"`
+	models.Emails
+}
+
+func handleGetEmails(w http.ResponseWriter, r *http.Request) {
+	if notModified(w, r, r.PathValue("orcid"), "") {
+		return
+	}
+	person, ok := personFor(r, r.PathValue("orcid"))
+	if !ok {
+		writeError(w, r, recordNotFound(r.PathValue("orcid")))
+		return
+	}
+
+	resp := EmailsResponse{}
+	if person.Emails != nil {
+		resp.Emails = *person.Emails
+	}
+	writeResponse(w, r, resp)
+}
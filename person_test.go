@@ -0,0 +1,155 @@
+package moat
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAddressCRUDWithXML(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0002-1001-2002"
+	base := "/v3.0/" + orcid + "/address"
+	token := testToken("APP-123", orcid, "/read-limited /person/update")
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", base, `<address:address xmlns:address="http://www.orcid.org/ns/address" visibility="limited">
+		<address:country>NZ</address:country>
+	</address:address>`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v", w.Code)
+	}
+	loc := w.Header().Get("Location")
+	item := loc[strings.Index(loc, "/v3.0/"):]
+
+	w = do("GET", item, "")
+	var got AddressResponse
+	if err := xml.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode address: %v", err)
+	}
+	if got.Country != "NZ" || got.Visibility != "limited" || got.Source == nil {
+		t.Errorf("Unexpected address %+v", got.Address)
+	}
+
+	w = do("PUT", item, `<address:address xmlns:address="http://www.orcid.org/ns/address">
+		<address:country>AU</address:country>
+	</address:address>`)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status OK on PUT, got %v", w.Code)
+	}
+	if !strings.Contains(do("GET", base, "").Body.String(), ">AU<") {
+		t.Error("Expected updated country in address list")
+	}
+
+	if w := do("DELETE", item, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status No Content, got %v", w.Code)
+	}
+	if w := do("GET", item, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status Not Found after DELETE, got %v", w.Code)
+	}
+}
+
+func TestExternalIdentifierCRUD(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0004-5005-6006"
+
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/external-identifiers", strings.NewReader(
+		`{"ExternalIdType": "Scopus Author ID", "ExternalIdValue": "1234567", "ExternalIdUrl": "https://www.scopus.com/authid/detail.uri?authorId=1234567"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v", w.Code)
+	}
+	loc := w.Header().Get("Location")
+	if !strings.Contains(loc, "/external-identifier/") {
+		t.Fatalf("Unexpected Location %q", loc)
+	}
+	item := loc[strings.Index(loc, "/v3.0/"):]
+
+	req = httptest.NewRequest("GET", "/v3.0/"+orcid+"/external-identifiers", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var list ExternalIdentifiersResponse
+	if err := xml.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	if len(list.ExternalIdentifiers.ExternalIdentifiers) != 1 || list.ExternalIdentifiers.ExternalIdentifiers[0].ExternalIdValue != "1234567" {
+		t.Errorf("Unexpected external identifiers %+v", list.ExternalIdentifiers)
+	}
+
+	req = httptest.NewRequest("DELETE", item, nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status No Content, got %v", w.Code)
+	}
+}
+
+func TestHandleGetEmails(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/email", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{`visibility="PUBLIC"`, `verified="true"`, `primary="true"`, "sofia.garcia@mock.edu"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %s in emails XML: %s", want, body)
+		}
+	}
+}
+
+func TestHandleGetPersonalDetails(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/0000-0002-1001-2002/personal-details", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+	var resp PersonalDetailsResponse
+	if err := xml.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode personal details: %v", err)
+	}
+	if resp.Name == nil || resp.Name.GivenNames != "John" || resp.Biography == nil {
+		t.Errorf("Unexpected personal details %+v", resp)
+	}
+	if strings.Contains(w.Body.String(), "email") {
+		t.Error("Expected no emails in personal details")
+	}
+}
+
+func TestHandleGetBiography(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/0000-0002-1001-2002/biography", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+	var resp BiographyResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode biography: %v", err)
+	}
+	if resp.Content == "" || resp.Visibility != "PUBLIC" {
+		t.Errorf("Unexpected biography %+v", resp.Biography)
+	}
+}
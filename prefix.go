@@ -0,0 +1,66 @@
+package moat
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// --- Path Prefix ---
+//
+// A Server made WithPrefix("/orcid-mock") can be mounted at /orcid-mock/ in
+// a larger test services mux: it strips the prefix before routing and puts
+// it back on the URLs it makes for itself, which are root-relative Location
+// headers (and redirects) and the OpenID Connect issuer. The Locations that
+// point at api.orcid.org, as ORCID's do, are left alone.
+
+type prefixKey struct{}
+
+// mountPrefix returns the prefix the request came in under, or ""
+func mountPrefix(ctx context.Context) string {
+	p, _ := ctx.Value(prefixKey{}).(string)
+	return p
+}
+
+// prefixWriter puts the prefix back on root-relative Location headers
+type prefixWriter struct {
+	http.ResponseWriter
+	prefix      string
+	wroteHeader bool
+}
+
+func (w *prefixWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		h := w.Header()
+		if loc := h.Get("Location"); strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+			h.Set("Location", w.prefix+loc)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *prefixWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *prefixWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withPrefix serves next under prefix, answering 404 for paths outside it
+func withPrefix(prefix string, next http.Handler) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return next
+	}
+	return http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), prefixKey{}, prefix))
+		next.ServeHTTP(&prefixWriter{ResponseWriter: w, prefix: prefix}, r)
+	}))
+}
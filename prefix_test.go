@@ -0,0 +1,44 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithPrefix(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	mux := http.NewServeMux()
+	mux.Handle("/orcid-mock/", New(WithPrefix("/orcid-mock/")))
+	mux.HandleFunc("/other", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "http://moat.test"+path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("GET", "/orcid-mock/v3.0/0000-0001-2345-6789/record", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the record under the prefix, got %v", w.Code)
+	}
+	if w := do("GET", "/other", ""); w.Code != http.StatusTeapot {
+		t.Errorf("Expected the rest of the mux untouched, got %v", w.Code)
+	}
+
+	w := do("POST", "/orcid-mock/__admin/users", `{"given-names": "Ada"}`)
+	if w.Code != http.StatusCreated || !strings.HasPrefix(w.Header().Get("Location"), "/orcid-mock/__admin/users/") {
+		t.Errorf("Expected the Location under the prefix, got %v %q", w.Code, w.Header().Get("Location"))
+	}
+	if w := do("GET", w.Header().Get("Location"), ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the Location to resolve, got %v", w.Code)
+	}
+
+	var doc map[string]any
+	json.NewDecoder(do("GET", "/orcid-mock/.well-known/openid-configuration", "").Body).Decode(&doc)
+	if doc["issuer"] != "http://moat.test/orcid-mock" || doc["jwks_uri"] != "http://moat.test/orcid-mock/oauth/jwks" {
+		t.Errorf("Expected the issuer under the prefix, got %v", doc["issuer"])
+	}
+}
@@ -0,0 +1,157 @@
+package moat
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"moat/orciderr"
+)
+
+// --- Record and Replay ---
+//
+// To bootstrap realistic data, moat can stand in front of the ORCID sandbox:
+// a GET naming a record moat doesn't hold is answered from a recording in
+// MOAT_RECORDINGS if there is one, or else, with MOAT_PROXY set, forwarded
+// to the sandbox and its response saved there as a new recording. Later runs
+// replay the recordings without MOAT_PROXY, so need no network.
+
+// Recording is one saved upstream response, keyed by the request it answered
+type Recording struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Accept string `json:"accept"`
+	CannedResponse
+}
+
+var (
+	// proxyUpstream is the ORCID API requests are forwarded to, if any
+	proxyUpstream *url.URL
+	// recordingsDir holds the recordings; empty turns record and replay off
+	recordingsDir string
+	proxyClient   = &http.Client{Timeout: 30 * time.Second}
+)
+
+// setupProxy replays recordings from dir and, with upstream set, records
+// new ones from it
+func setupProxy(upstream, dir string) error {
+	if dir == "" {
+		return errors.New("MOAT_RECORDINGS must name a directory for the recordings")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	recordingsDir = dir
+	proxyUpstream = nil
+	if upstream != "" {
+		u, err := url.Parse(upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("MOAT_PROXY must be an http(s) URL such as https://pub.sandbox.orcid.org, got %q", upstream)
+		}
+		proxyUpstream = u
+	}
+	return nil
+}
+
+// recordingFile names the recording for r: readable from the path, with a
+// hash of the query and response type to tell variants apart
+func recordingFile(r *http.Request) string {
+	name := r.Method + strings.ReplaceAll(r.URL.Path, "/", "_")
+	sum := sha256.Sum256([]byte(r.URL.RawQuery + "\n" + responseType(r)))
+	return filepath.Join(recordingsDir, fmt.Sprintf("%s-%x.json", name, sum[:4]))
+}
+
+// proxies reports whether r is one moat would forward: a GET naming a valid
+// iD moat doesn't hold
+func proxies(r *http.Request) bool {
+	if recordingsDir == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	orcid, ok := pathORCID(r)
+	return ok && validORCID(orcid) && !storeFor(r).HasUser(orcid)
+}
+
+// playRecording answers r from its recording, fetching and recording it
+// first if need be, reporting whether it did
+func playRecording(w http.ResponseWriter, r *http.Request) bool {
+	if !proxies(r) {
+		return false
+	}
+	file := recordingFile(r)
+	var rec Recording
+	data, err := os.ReadFile(file)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &rec); err != nil {
+			slog.ErrorContext(r.Context(), "Unreadable recording", "file", file, "error", err)
+			return false
+		}
+	case errors.Is(err, os.ErrNotExist) && proxyUpstream != nil:
+		if rec, err = fetchRecording(r); err != nil {
+			slog.ErrorContext(r.Context(), "Unable to reach ORCID", "upstream", proxyUpstream, "error", err)
+			writeError(w, r, orciderr.Newf(orciderr.ServiceUnavailable, "Service Unavailable: moat could not reach %s", proxyUpstream))
+			return true
+		}
+		if data, err := json.MarshalIndent(rec, "", "  "); err == nil {
+			if err := os.WriteFile(file, data, 0o644); err != nil {
+				slog.ErrorContext(r.Context(), "Unable to save recording", "file", file, "error", err)
+			} else {
+				slog.InfoContext(r.Context(), "Recorded ORCID response", "file", file, "status", rec.Status)
+			}
+		}
+	default:
+		return false
+	}
+	rec.write(w, r)
+	return true
+}
+
+// fetchRecording forwards r to the upstream API
+func fetchRecording(r *http.Request) (Recording, error) {
+	u := *proxyUpstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawQuery = r.URL.RawQuery
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, u.String(), nil)
+	if err != nil {
+		return Recording{}, err
+	}
+	accept := responseType(r)
+	req.Header.Set("Accept", accept)
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := proxyClient.Do(req)
+	if err != nil {
+		return Recording{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Recording{}, err
+	}
+	rec := Recording{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Accept: accept,
+		CannedResponse: CannedResponse{
+			Status: resp.StatusCode,
+			Body:   string(body),
+		},
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		rec.Headers = map[string]string{"Content-Type": ct}
+	}
+	return rec, nil
+}
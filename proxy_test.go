@@ -0,0 +1,75 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	calls := 0
+	sandbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer sandbox-token" {
+			t.Errorf("Expected the token to be forwarded, got %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", r.Header.Get("Accept"))
+		w.Write([]byte(`{"path": "` + r.URL.Path + `", "query": "` + r.URL.RawQuery + `"}`))
+	}))
+	t.Cleanup(sandbox.Close)
+	dir := t.TempDir()
+	if err := setupProxy(sandbox.URL, dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { recordingsDir, proxyUpstream = "", nil })
+	handler := setupRouter()
+
+	unknown := "/v3.0/0000-0002-1694-233X/record"
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/vnd.orcid+json")
+		req.Header.Set("Authorization", "Bearer sandbox-token")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	want := `{"path": "` + unknown + `", "query": "x=1"}`
+	w := get(unknown + "?x=1")
+	if w.Code != http.StatusOK || w.Body.String() != want || w.Header().Get("Content-Type") != "application/vnd.orcid+json" {
+		t.Errorf("Expected the sandbox's answer, got %v %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one recording, got %v", files)
+	}
+
+	// Later runs replay the recording without the sandbox
+	setupProxy("", dir)
+	if w := get(unknown + "?x=1"); w.Body.String() != want || calls != 1 {
+		t.Errorf("Expected the recording replayed without a call, got %d calls: %s", calls, w.Body)
+	}
+	if w := get(unknown + "?x=2"); w.Code != http.StatusNotFound || calls != 1 {
+		t.Errorf("Expected an unrecorded request to fall through to moat, got %v", w.Code)
+	}
+	if w := get("/v3.0/0000-0001-2345-6789/record"); w.Code != http.StatusOK || calls != 1 {
+		t.Errorf("Expected records moat holds never to be proxied, got %v", w.Code)
+	}
+
+	os.WriteFile(files[0], []byte("not json"), 0o644)
+	if w := get(unknown + "?x=1"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a broken recording to be ignored, got %v", w.Code)
+	}
+}
+
+func TestSetupProxyRejects(t *testing.T) {
+	t.Cleanup(func() { recordingsDir, proxyUpstream = "", nil })
+	if err := setupProxy("https://pub.sandbox.orcid.org", ""); err == nil {
+		t.Error("Expected an error without a recordings directory")
+	}
+	if err := setupProxy("ftp://example.org", t.TempDir()); err == nil {
+		t.Error("Expected an error for a non-HTTP upstream")
+	}
+}
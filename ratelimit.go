@@ -0,0 +1,156 @@
+package moat
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"moat/orciderr"
+)
+
+// --- Rate Limiting ---
+//
+// ORCID limits each client to 24 requests a second with bursts of up to 40,
+// and answers 429 beyond that. With MOAT_RATE_LIMIT set, moat does the same
+// with a token bucket per caller: the token's client, or the remote address
+// for requests without one. Every limited response carries
+// X-Rate-Limit-Limit (the burst), X-Rate-Limit-Remaining and
+// X-Rate-Limit-Reset (when the bucket is full again, in Unix seconds).
+// /__admin/ is never limited.
+
+// orcidRateBurst is the burst ORCID allows
+const orcidRateBurst = 40
+
+// rateLimit is a sustained rate in requests a second and a burst size
+type rateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type rateBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+var (
+	// limit is off while Rate is zero
+	limit       rateLimit
+	rateBuckets = map[string]*rateBucket{}
+	rateMutex   sync.Mutex
+)
+
+// getRateLimit reads MOAT_RATE_LIMIT and MOAT_RATE_BURST. The burst defaults
+// to ORCID's, or to the rate if that's higher.
+func getRateLimit() (rateLimit, error) {
+	v := os.Getenv("MOAT_RATE_LIMIT")
+	if v == "" {
+		return rateLimit{}, nil
+	}
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return rateLimit{}, fmt.Errorf("MOAT_RATE_LIMIT must be a positive number of requests a second, got %q", v)
+	}
+	l := rateLimit{Rate: rate, Burst: max(orcidRateBurst, int(math.Ceil(rate)))}
+	if v := os.Getenv("MOAT_RATE_BURST"); v != "" {
+		burst, err := strconv.Atoi(v)
+		if err != nil || burst <= 0 {
+			return rateLimit{}, fmt.Errorf("MOAT_RATE_BURST must be a positive number, got %q", v)
+		}
+		l.Burst = burst
+	}
+	return l, nil
+}
+
+// setRateLimit replaces the limit and empties every bucket's history
+func setRateLimit(l rateLimit) {
+	rateMutex.Lock()
+	defer rateMutex.Unlock()
+	limit = l
+	rateBuckets = map[string]*rateBucket{}
+}
+
+// resetRateLimits refills every caller's bucket
+func resetRateLimits() {
+	rateMutex.Lock()
+	defer rateMutex.Unlock()
+	rateBuckets = map[string]*rateBucket{}
+}
+
+// take spends one of key's tokens if it has one, returning what's left and
+// how long until the bucket is full, or until the next token if it was empty
+func take(key string, now time.Time) (remaining int, wait time.Duration, ok bool) {
+	rateMutex.Lock()
+	defer rateMutex.Unlock()
+	burst := float64(limit.Burst)
+	b := rateBuckets[key]
+	if b == nil {
+		b = &rateBucket{tokens: burst}
+		rateBuckets[key] = b
+	} else {
+		b.tokens = min(burst, b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	}
+	b.updated = now
+
+	seconds := func(tokens float64) time.Duration {
+		return time.Duration(tokens / limit.Rate * float64(time.Second))
+	}
+	if b.tokens < 1 {
+		return 0, seconds(1 - b.tokens), false
+	}
+	b.tokens--
+	return int(b.tokens), seconds(burst - b.tokens), true
+}
+
+// rateKey names the bucket r draws from
+func rateKey(r *http.Request) string {
+	if client := tokenClientID(r); client != "" {
+		return "client:" + client
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// limitRate sets the rate limit headers and answers r with 429 if its caller
+// is over the limit, reporting whether it did. /v3.0/ gets ORCID's error
+// body, /oauth/ an RFC 6749 error, and anything else plain text.
+func limitRate(w http.ResponseWriter, r *http.Request) bool {
+	rateMutex.Lock()
+	l := limit
+	rateMutex.Unlock()
+	if l.Rate == 0 || strings.HasPrefix(r.URL.Path, "/__admin/") {
+		return false
+	}
+
+	now := time.Now()
+	remaining, wait, ok := take(rateKey(r), now)
+	h := w.Header()
+	h.Set("X-Rate-Limit-Limit", strconv.Itoa(l.Burst))
+	h.Set("X-Rate-Limit-Remaining", strconv.Itoa(remaining))
+	if ok {
+		h.Set("X-Rate-Limit-Reset", strconv.FormatInt(now.Add(wait).Unix(), 10))
+		return false
+	}
+
+	retry := int(math.Ceil(wait.Seconds()))
+	h.Set("X-Rate-Limit-Reset", strconv.FormatInt(now.Unix()+int64(retry), 10))
+	h.Set("Retry-After", strconv.Itoa(retry))
+	message := fmt.Sprintf("Too Many Requests: limit is %g requests a second with bursts of %d", l.Rate, l.Burst)
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v3.0/"):
+		writeError(w, r, orciderr.New(orciderr.TooManyRequests))
+	case strings.HasPrefix(r.URL.Path, "/oauth/"):
+		writeOAuthError(w, http.StatusTooManyRequests, "slow_down", message)
+	default:
+		http.Error(w, message, http.StatusTooManyRequests)
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"moat/orciderr"
+)
+
+func TestRateLimit(t *testing.T) {
+	setRateLimit(rateLimit{Rate: 1, Burst: 2})
+	t.Cleanup(func() { setRateLimit(rateLimit{}) })
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	do := func(path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/json")
+		req.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		w := do("/v3.0/"+orcid+"/record", "192.0.2.1:1234")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %v", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-Rate-Limit-Limit"); got != "2" {
+			t.Errorf("Expected X-Rate-Limit-Limit 2, got %q", got)
+		}
+		if got := w.Header().Get("X-Rate-Limit-Remaining"); got != remaining {
+			t.Errorf("Request %d: expected X-Rate-Limit-Remaining %s, got %q", i+1, remaining, got)
+		}
+		reset, err := strconv.ParseInt(w.Header().Get("X-Rate-Limit-Reset"), 10, 64)
+		if err != nil || reset < time.Now().Unix() {
+			t.Errorf("Expected X-Rate-Limit-Reset in the future, got %q", w.Header().Get("X-Rate-Limit-Reset"))
+		}
+	}
+
+	w := do("/v3.0/"+orcid+"/record", "192.0.2.1:5678")
+	e, err := orciderr.Decode(w.Body)
+	if w.Code != http.StatusTooManyRequests || err != nil || e.ErrorCode != orciderr.TooManyRequests {
+		t.Errorf("Expected 429 with 9040, got %v: %v, %v", w.Code, e, err)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", got)
+	}
+
+	// Other callers and the admin API are unaffected
+	if w := do("/v3.0/"+orcid+"/record", "192.0.2.2:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected another address to have its own bucket, got %v", w.Code)
+	}
+	if w := do("/__admin/faults", "192.0.2.1:1234"); w.Code != http.StatusOK || w.Header().Get("X-Rate-Limit-Limit") != "" {
+		t.Errorf("Expected the admin API never to be limited, got %v", w.Code)
+	}
+
+	w = do("/oauth/token", "192.0.2.1:1234")
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), `"slow_down"`) {
+		t.Errorf("Expected an OAuth slow_down, got %v: %s", w.Code, w.Body)
+	}
+
+	req := httptest.NewRequest("POST", "/__admin/reset", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if w := do("/v3.0/"+orcid+"/record", "192.0.2.1:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected reset to refill the bucket, got %v", w.Code)
+	}
+}
+
+func TestRateLimitRefills(t *testing.T) {
+	setRateLimit(rateLimit{Rate: 10, Burst: 1})
+	t.Cleanup(func() { setRateLimit(rateLimit{}) })
+	now := time.Now()
+
+	if _, _, ok := take("caller", now); !ok {
+		t.Fatal("Expected a full bucket to allow a request")
+	}
+	_, wait, ok := take("caller", now)
+	if ok || wait != 100*time.Millisecond {
+		t.Errorf("Expected an empty bucket to wait 100ms, got %v, %v", ok, wait)
+	}
+	if _, _, ok := take("caller", now.Add(100*time.Millisecond)); !ok {
+		t.Error("Expected the bucket to have refilled a token")
+	}
+}
+
+func TestGetRateLimit(t *testing.T) {
+	tests := []struct {
+		rate, burst string
+		want        rateLimit
+		wantErr     bool
+	}{
+		{"", "", rateLimit{}, false},
+		{"24", "", rateLimit{Rate: 24, Burst: 40}, false},
+		{"100", "", rateLimit{Rate: 100, Burst: 100}, false},
+		{"0.5", "1", rateLimit{Rate: 0.5, Burst: 1}, false},
+		{"0", "", rateLimit{}, true},
+		{"fast", "", rateLimit{}, true},
+		{"24", "-1", rateLimit{}, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("MOAT_RATE_LIMIT", tt.rate)
+		t.Setenv("MOAT_RATE_BURST", tt.burst)
+		got, err := getRateLimit()
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("getRateLimit(%q, %q) = %+v, %v", tt.rate, tt.burst, got, err)
+		}
+	}
+}
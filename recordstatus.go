@@ -0,0 +1,98 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"moat/orciderr"
+)
+
+// --- Record Status ---
+//
+// ORCID stops serving a record that has been merged into another
+// (deprecated), closed by its owner (deactivated) or locked by ORCID, and
+// answers every API call on it with 409. Records are marked through
+// /__admin/users/{orcid}/status so clients can test those states.
+
+// RecordStatus marks a record ORCID no longer serves normally
+type RecordStatus struct {
+	// State is "deprecated", "deactivated" or "locked"
+	State string `json:"state"`
+	// Primary is the record a deprecated one was merged into
+	Primary string `json:"primary,omitempty"`
+}
+
+// recordStates maps each state to the error ORCID answers with
+var recordStates = map[string]orciderr.Code{
+	"deprecated":  orciderr.RecordDeprecated,
+	"deactivated": orciderr.RecordDeactivated,
+	"locked":      orciderr.RecordLocked,
+}
+
+// checkRecordStatus returns the 409 ORCID gives for r if it names a
+// deprecated, deactivated or locked record
+func checkRecordStatus(r *http.Request) *orciderr.Error {
+	orcid, ok := pathORCID(r)
+	if !ok {
+		return nil
+	}
+	status := storeFor(r).Status(orcid)
+	if status == nil {
+		return nil
+	}
+	if status.State == "deprecated" && status.Primary != "" {
+		return orciderr.Newf(orciderr.RecordDeprecated, "Conflict: The ORCID record is deprecated and the primary record is %s", status.Primary)
+	}
+	return orciderr.New(recordStates[status.State])
+}
+
+// handleAdminGetStatus returns a record's status, "active" if it has none
+func handleAdminGetStatus(w http.ResponseWriter, r *http.Request) {
+	orcid := r.PathValue("orcid")
+	if !storeFor(r).HasUser(orcid) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	status := storeFor(r).Status(orcid)
+	if status == nil {
+		status = &RecordStatus{State: "active"}
+	}
+	writeResponse(w, r, status)
+}
+
+// handleAdminPutStatus marks a record deprecated, deactivated or locked, or
+// active again
+func handleAdminPutStatus(w http.ResponseWriter, r *http.Request) {
+	var status RecordStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		http.Error(w, "Invalid status: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := recordStates[status.State]; !ok && status.State != "active" {
+		http.Error(w, "Invalid status: state must be active, deprecated, deactivated or locked", http.StatusBadRequest)
+		return
+	}
+	if status.Primary != "" && status.State != "deprecated" {
+		http.Error(w, "Invalid status: only a deprecated record has a primary", http.StatusBadRequest)
+		return
+	}
+
+	var set *RecordStatus
+	if status.State != "active" {
+		set = &status
+	}
+	if !storeFor(r).SetStatus(r.PathValue("orcid"), set) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	writeResponse(w, r, status)
+}
+
+// handleAdminDeleteStatus makes a record active again
+func handleAdminDeleteStatus(w http.ResponseWriter, r *http.Request) {
+	if !storeFor(r).SetStatus(r.PathValue("orcid"), nil) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,89 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"moat/orciderr"
+)
+
+func TestRecordStatus(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	orcid := "0000-0002-1001-2002"
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		status string
+		code   orciderr.Code
+	}{
+		{`{"state": "deprecated", "primary": "0000-0001-2345-6789"}`, orciderr.RecordDeprecated},
+		{`{"state": "deactivated"}`, orciderr.RecordDeactivated},
+		{`{"state": "locked"}`, orciderr.RecordLocked},
+	}
+	for _, tt := range tests {
+		if w := do("PUT", "/__admin/users/"+orcid+"/status", tt.status); w.Code != http.StatusOK {
+			t.Fatalf("Expected the status to be set, got %v: %s", w.Code, w.Body)
+		}
+		for _, req := range [][2]string{{"GET", "/record"}, {"GET", "/works"}, {"POST", "/work"}} {
+			w := do(req[0], "/v3.0/"+orcid+req[1], `{"title": {"title": {"value": "T"}}, "type": "book"}`)
+			e, err := orciderr.Decode(w.Body)
+			if w.Code != http.StatusConflict || err != nil || e.ErrorCode != tt.code {
+				t.Errorf("%s %s on a %s record: expected 409 with %d, got %v: %v, %v", req[0], req[1], tt.status, tt.code, w.Code, e, err)
+			}
+		}
+	}
+
+	do("PUT", "/__admin/users/"+orcid+"/status", `{"state": "deprecated", "primary": "0000-0001-2345-6789"}`)
+	w := do("GET", "/v3.0/"+orcid+"/person", "")
+	if !strings.Contains(w.Body.String(), "primary record is 0000-0001-2345-6789") {
+		t.Errorf("Expected the primary record in the error, got %s", w.Body)
+	}
+	for _, u := range store.Snapshot().Users {
+		if deprecated := u.Status != nil && u.Status.State == "deprecated"; deprecated != (u.ORCID == orcid) {
+			t.Errorf("Unexpected status for %s in the snapshot: %+v", u.ORCID, u.Status)
+		}
+	}
+
+	if w := do("DELETE", "/__admin/users/"+orcid+"/status", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the status to be cleared, got %v", w.Code)
+	}
+	if w := do("GET", "/v3.0/"+orcid+"/record", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected an active record again, got %v", w.Code)
+	}
+	if w := do("GET", "/__admin/users/"+orcid+"/status", ""); !strings.Contains(w.Body.String(), `"state":"active"`) {
+		t.Errorf("Expected the record to be active, got %s", w.Body)
+	}
+}
+
+func TestAdminPutStatusRejects(t *testing.T) {
+	handler := setupRouter()
+	tests := []struct {
+		name, orcid, body string
+		status            int
+	}{
+		{"unknown state", "0000-0002-1001-2002", `{"state": "frozen"}`, http.StatusBadRequest},
+		{"primary without deprecation", "0000-0002-1001-2002", `{"state": "locked", "primary": "0000-0001-2345-6789"}`, http.StatusBadRequest},
+		{"unknown user", "0000-0009-9999-9999", `{"state": "locked"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/__admin/users/"+tt.orcid+"/status", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package moat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// --- Scenarios ---
+//
+// A scenario is a small state machine over requests, for end-to-end
+// narratives like "the first GET of the record fails, then it returns
+// fixture A; after a work is POSTed it returns fixture B". Each step applies
+// to matching requests while its scenario is in the step's state, answers
+// with a canned response or lets the request through to moat's handlers,
+// and may move the scenario to another state. Like journeys, scenario files
+// are JSON, which is also valid YAML.
+
+// scenarioStart is the state every scenario begins in
+const scenarioStart = "start"
+
+// ScenarioStep is one transition of a scenario
+type ScenarioStep struct {
+	// When is the state the step applies in; empty applies in any state
+	When string `json:"when,omitempty"`
+	// Method and Path match requests as a fault rule's do
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	// The response, with its body possibly read from BodyFile, relative to
+	// the scenario file; a step with none lets the request through
+	CannedResponse
+	BodyFile string `json:"body_file,omitempty"`
+	// Then is the state to move to afterwards; empty stays put
+	Then string `json:"then,omitempty"`
+}
+
+// Scenario is a named sequence of steps and the state it has reached
+type Scenario struct {
+	Name  string          `json:"name"`
+	Steps []*ScenarioStep `json:"steps"`
+	State string          `json:"-"`
+}
+
+type scenarioFile struct {
+	Scenarios []*Scenario `json:"scenarios"`
+}
+
+var (
+	scenarios     []*Scenario
+	scenarioMutex sync.Mutex
+)
+
+// validate checks s, reading its body file from dir. A body file ending in
+// .tmpl is a template, as fixture files are.
+func (s *ScenarioStep) validate(dir string) error {
+	if _, err := path.Match(s.Path, ""); err != nil {
+		return fmt.Errorf("invalid path pattern %q", s.Path)
+	}
+	if s.BodyFile != "" {
+		if s.Body != "" {
+			return errors.New("body and body_file are exclusive")
+		}
+		data, err := os.ReadFile(filepath.Join(dir, s.BodyFile))
+		if err != nil {
+			return err
+		}
+		s.Body = string(data)
+		s.Template = s.Template || strings.HasSuffix(s.BodyFile, ".tmpl")
+	}
+	return s.CannedResponse.validate()
+}
+
+// loadScenarios reads a scenario file and adds its scenarios, each in its
+// start state
+func loadScenarios(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var f scenarioFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("parsing %s: %w", filename, err)
+	}
+
+	scenarioMutex.Lock()
+	defer scenarioMutex.Unlock()
+	for i, sc := range f.Scenarios {
+		if sc.Name == "" {
+			return fmt.Errorf("scenario %d has no name", i)
+		}
+		sameName := func(o *Scenario) bool { return o.Name == sc.Name }
+		if slices.ContainsFunc(scenarios, sameName) || slices.ContainsFunc(f.Scenarios[:i], sameName) {
+			return fmt.Errorf("scenario %q is defined twice", sc.Name)
+		}
+		for j, step := range sc.Steps {
+			if err := step.validate(filepath.Dir(filename)); err != nil {
+				return fmt.Errorf("scenario %q step %d: %w", sc.Name, j, err)
+			}
+		}
+		sc.State = scenarioStart
+	}
+	scenarios = append(scenarios, f.Scenarios...)
+	return nil
+}
+
+// resetScenarios puts every scenario back in its start state
+func resetScenarios() {
+	scenarioMutex.Lock()
+	defer scenarioMutex.Unlock()
+	for _, sc := range scenarios {
+		sc.State = scenarioStart
+	}
+}
+
+// scenarioStep returns the first step that applies to r, moving its scenario
+// on. /__admin/ is never scripted.
+func scenarioStep(r *http.Request) (ScenarioStep, bool) {
+	if strings.HasPrefix(r.URL.Path, "/__admin/") {
+		return ScenarioStep{}, false
+	}
+	scenarioMutex.Lock()
+	defer scenarioMutex.Unlock()
+	for _, sc := range scenarios {
+		for _, step := range sc.Steps {
+			if step.When != "" && step.When != sc.State {
+				continue
+			}
+			if !matchRequest(r, step.Method, step.Path) {
+				continue
+			}
+			if step.Then != "" {
+				sc.State = step.Then
+			}
+			return *step, true
+		}
+	}
+	return ScenarioStep{}, false
+}
+
+// playScenario answers r from a scenario step if one applies and has a
+// response, reporting whether it did
+func playScenario(w http.ResponseWriter, r *http.Request) bool {
+	step, ok := scenarioStep(r)
+	if !ok || step.empty() {
+		return false
+	}
+	step.write(w, r)
+	return true
+}
+
+// scenarioState is a scenario as the admin API reports it
+type scenarioState struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// handleAdminListScenarios lists the scenarios and the state each is in
+func handleAdminListScenarios(w http.ResponseWriter, r *http.Request) {
+	scenarioMutex.Lock()
+	list := make([]scenarioState, len(scenarios))
+	for i, sc := range scenarios {
+		list[i] = scenarioState{sc.Name, sc.State}
+	}
+	scenarioMutex.Unlock()
+	writeResponse(w, r, list)
+}
+
+// handleAdminPutScenarioState moves a scenario to another state
+func handleAdminPutScenarioState(w http.ResponseWriter, r *http.Request) {
+	var body scenarioState
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.State == "" {
+		http.Error(w, "Invalid state: expected {\"state\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+
+	scenarioMutex.Lock()
+	defer scenarioMutex.Unlock()
+	for _, sc := range scenarios {
+		if sc.Name == name {
+			sc.State = body.State
+			writeResponse(w, r, scenarioState{sc.Name, sc.State})
+			return
+		}
+	}
+	http.Error(w, "Scenario not found", http.StatusNotFound)
+}
@@ -0,0 +1,98 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScenario(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	t.Cleanup(func() { scenarios = nil })
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"fixture": "A"}`), 0o644)
+	os.WriteFile(filepath.Join(dir, "b.xml"), []byte(`<fixture>B</fixture>`), 0o644)
+	file := filepath.Join(dir, "scenarios.json")
+	os.WriteFile(file, []byte(`{"scenarios": [{"name": "new-work", "steps": [
+		{"when": "start", "method": "GET", "path": "/v3.0/*/record", "status": 500, "then": "up"},
+		{"when": "up", "method": "GET", "path": "/v3.0/*/record", "body_file": "a.json"},
+		{"when": "up", "method": "POST", "path": "/v3.0/*/work", "then": "posted"},
+		{"when": "posted", "method": "GET", "path": "/v3.0/*/record", "body_file": "b.xml"}
+	]}]}`), 0o644)
+	if err := loadScenarios(file); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	getRecord := func() *httptest.ResponseRecorder { return do("GET", "/v3.0/"+orcid+"/record", "") }
+
+	if w := getRecord(); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected the first GET to fail, got %v", w.Code)
+	}
+	for range 2 {
+		w := getRecord()
+		if w.Code != http.StatusOK || w.Body.String() != `{"fixture": "A"}` || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+			t.Errorf("Expected fixture A, got %v %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+		}
+	}
+	if w := do("POST", "/v3.0/"+orcid+"/work", `{"type": "book", "title": {"title": {"value": "Scripted"}}}`); w.Code != http.StatusCreated {
+		t.Errorf("Expected the POST to reach moat, got %v: %s", w.Code, w.Body)
+	}
+	if w := getRecord(); w.Body.String() != `<fixture>B</fixture>` || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/xml") {
+		t.Errorf("Expected fixture B, got %q: %s", w.Header().Get("Content-Type"), w.Body)
+	}
+	if w := do("GET", "/v3.0/"+orcid+"/person", ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "fixture") {
+		t.Errorf("Expected unscripted requests to reach moat, got %v: %s", w.Code, w.Body)
+	}
+
+	if w := do("GET", "/__admin/scenarios", ""); !strings.Contains(w.Body.String(), `"state":"posted"`) {
+		t.Errorf("Expected the scenario to be listed as posted, got %s", w.Body)
+	}
+	if w := do("PUT", "/__admin/scenarios/new-work/state", `{"state": "up"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected the state to be set, got %v: %s", w.Code, w.Body)
+	}
+	if w := getRecord(); w.Body.String() != `{"fixture": "A"}` {
+		t.Errorf("Expected fixture A after setting the state, got %s", w.Body)
+	}
+	if w := do("PUT", "/__admin/scenarios/missing/state", `{"state": "up"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown scenario, got %v", w.Code)
+	}
+
+	do("POST", "/__admin/reset", "")
+	if w := getRecord(); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected reset to restart the scenario, got %v", w.Code)
+	}
+}
+
+func TestLoadScenariosRejects(t *testing.T) {
+	t.Cleanup(func() { scenarios = nil })
+	dir := t.TempDir()
+	tests := map[string]string{
+		"no name":      `{"scenarios": [{"steps": []}]}`,
+		"bad status":   `{"scenarios": [{"name": "s", "steps": [{"status": 1000}]}]}`,
+		"bad pattern":  `{"scenarios": [{"name": "s", "steps": [{"path": "["}]}]}`,
+		"missing file": `{"scenarios": [{"name": "s", "steps": [{"body_file": "nope.json"}]}]}`,
+		"both bodies":  `{"scenarios": [{"name": "s", "steps": [{"body": "x", "body_file": "nope.json"}]}]}`,
+		"duplicate":    `{"scenarios": [{"name": "s", "steps": []}, {"name": "s", "steps": []}]}`,
+	}
+	for name, content := range tests {
+		file := filepath.Join(dir, "scenarios.json")
+		os.WriteFile(file, []byte(content), 0o644)
+		if err := loadScenarios(file); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		scenarios = nil
+	}
+}
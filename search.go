@@ -0,0 +1,224 @@
+package moat
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"moat/orciderr"
+)
+
+// --- Search ---
+//
+// Searches run against the users in the store. Queries are a loose subset of
+// ORCID's Solr syntax: whitespace-separated terms, all of which must match.
+// A term is either field:value (e.g. family-name:Garcia) or free text matched
+// against every field; "*" and "*:*" match everyone. Matching is a
+// case-insensitive substring test, and a trailing "*" on a value is ignored.
+
+// searchFields are the fields csv-search can return, in ORCID's order
+var searchFields = []string{
+	"orcid",
+	"email",
+	"given-names",
+	"family-name",
+	"given-and-family-names",
+	"credit-name",
+	"other-name",
+	"current-institution-affiliation-name",
+	"past-institution-affiliation-name",
+}
+
+// defaultCSVFields is used when csv-search has no fl parameter
+const defaultCSVFields = "orcid,given-names,family-name,current-institution-affiliation-name"
+
+// Search paging defaults and limits, as on the real API
+const (
+	defaultSearchRows = 100
+	maxSearchRows     = 1000
+)
+
+// searchDoc holds a user's searchable values by field
+type searchDoc map[string][]string
+
+func buildSearchDoc(s *Store, orcid string) searchDoc {
+	doc := searchDoc{"orcid": {orcid}}
+	person, _ := s.Person(orcid)
+	person = viewer{}.person(person)
+	if n := person.Name; n != nil {
+		doc["given-names"] = []string{n.GivenNames}
+		doc["family-name"] = []string{n.FamilyName}
+		doc["given-and-family-names"] = []string{strings.TrimSpace(n.GivenNames + " " + n.FamilyName)}
+		if n.CreditName != "" {
+			doc["credit-name"] = []string{n.CreditName}
+		}
+	}
+	if person.Emails != nil {
+		for _, e := range person.Emails.Emails {
+			doc["email"] = append(doc["email"], e.Email)
+		}
+	}
+	if person.OtherNames != nil {
+		for _, o := range person.OtherNames.OtherNames {
+			doc["other-name"] = append(doc["other-name"], o.Content)
+		}
+	}
+
+	// Employment summaries carry no end date, so every employment counts as
+	// current; educations are past once they have ended
+	activities, _ := s.VisibleActivities(orcid, viewer{}.item)
+	for _, g := range activities.Employment.AffiliationGroup {
+		for _, s := range g.Summaries {
+			doc.addOrg("current-institution-affiliation-name", s.Organization.Name)
+		}
+	}
+	for _, g := range activities.Educations.AffiliationGroup {
+		for _, s := range g.Summaries {
+			field := "current-institution-affiliation-name"
+			if s.EndDate != nil {
+				field = "past-institution-affiliation-name"
+			}
+			doc.addOrg(field, s.Organization.Name)
+		}
+	}
+	return doc
+}
+
+func (d searchDoc) addOrg(field, name string) {
+	if name != "" && !slices.Contains(d[field], name) {
+		d[field] = append(d[field], name)
+	}
+}
+
+func (d searchDoc) matches(query string) bool {
+	for _, term := range strings.Fields(query) {
+		if term == "*" || term == "*:*" || term == "AND" {
+			continue
+		}
+		field, value, scoped := strings.Cut(term, ":")
+		if !scoped {
+			field, value = "", term
+		}
+		value = strings.ToLower(strings.Trim(strings.TrimSuffix(value, "*"), `"`))
+
+		found := false
+		for f, values := range d {
+			if field != "" && f != field {
+				continue
+			}
+			for _, v := range values {
+				found = found || strings.Contains(strings.ToLower(v), value)
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// searchStore returns the iDs of users in s matching query, sorted
+func searchStore(s *Store, query string) []string {
+	var hits []string
+	for _, orcid := range s.ORCIDs() {
+		if buildSearchDoc(s, orcid).matches(query) {
+			hits = append(hits, orcid)
+		}
+	}
+	return hits
+}
+
+// searchPage reads start and rows from the query string
+func searchPage(r *http.Request) (start, rows int, err error) {
+	q := r.URL.Query()
+	start, rows = 0, defaultSearchRows
+	if v := q.Get("start"); v != "" {
+		if start, err = strconv.Atoi(v); err != nil || start < 0 {
+			return 0, 0, fmt.Errorf("start must be a non-negative integer")
+		}
+	}
+	if v := q.Get("rows"); v != "" {
+		if rows, err = strconv.Atoi(v); err != nil || rows < 0 || rows > maxSearchRows {
+			return 0, 0, fmt.Errorf("rows must be between 0 and %d", maxSearchRows)
+		}
+	}
+	return start, rows, nil
+}
+
+// searchSlice returns the page of hits from start, at most rows long
+func searchSlice(hits []string, start, rows int) []string {
+	start = min(start, len(hits))
+	return hits[start : start+min(rows, len(hits)-start)]
+}
+
+// handleSearch returns one page of matching iDs. num-found counts every
+// match, not just the page.
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	// Simple mock: if query contains "error", return error
+	if strings.Contains(query, "error") {
+		writeError(w, r, orciderr.Newf(orciderr.InternalError, "Internal Server Error: Search failed"))
+		return
+	}
+
+	start, rows, err := searchPage(r)
+	if err != nil {
+		writeError(w, r, orciderr.Newf(orciderr.InvalidParameter, "Bad Request: %v", err))
+		return
+	}
+
+	hits := searchStore(storeFor(r), query)
+	resp := SearchResponse{NumFound: len(hits), Result: []SearchResult{}}
+	for _, orcid := range searchSlice(hits, start, rows) {
+		resp.Result = append(resp.Result, SearchResult{OrcidIdentifier: newOrcidIdentifier(orcid)})
+	}
+
+	writeResponse(w, r, resp)
+}
+
+// handleCSVSearch returns a page of search hits as CSV, one column per field
+// in fl
+func handleCSVSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if strings.Contains(q.Get("q"), "error") {
+		writeError(w, r, orciderr.Newf(orciderr.InternalError, "Internal Server Error: Search failed"))
+		return
+	}
+
+	fl := q.Get("fl")
+	if fl == "" {
+		fl = defaultCSVFields
+	}
+	fields := strings.Split(fl, ",")
+	for i, f := range fields {
+		fields[i] = strings.TrimSpace(f)
+		if !slices.Contains(searchFields, fields[i]) {
+			writeError(w, r, orciderr.Newf(orciderr.InvalidParameter, "Bad Request: Unknown field in fl: %s", fields[i]))
+			return
+		}
+	}
+
+	start, rows, err := searchPage(r)
+	if err != nil {
+		writeError(w, r, orciderr.Newf(orciderr.InvalidParameter, "Bad Request: %v", err))
+		return
+	}
+
+	hits := searchStore(storeFor(r), q.Get("q"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Write(fields)
+	for _, orcid := range searchSlice(hits, start, rows) {
+		doc := buildSearchDoc(storeFor(r), orcid)
+		row := make([]string, len(fields))
+		for i, f := range fields {
+			row[i] = strings.Join(doc[f], ";")
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+}
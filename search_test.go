@@ -0,0 +1,85 @@
+package moat
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandleCSVSearch(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/csv-search?q=family-name:garcia&fl=orcid,given-names,email", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Expected CSV content type, got %s", ct)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Expected header and one row, got %v", rows)
+	}
+	if rows[0][2] != "email" || rows[1][0] != "0000-0001-2345-6789" || rows[1][1] != "Sofia" {
+		t.Errorf("Unexpected CSV rows %v", rows)
+	}
+}
+
+func TestHandleCSVSearchUnknownField(t *testing.T) {
+	handler := setupRouter()
+	req := httptest.NewRequest("GET", "/v3.0/csv-search?q=*&fl=orcid,shoe-size", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status Bad Request, got %v", w.Code)
+	}
+}
+
+func TestHandleSearchPagination(t *testing.T) {
+	handler := setupRouter()
+	total := len(searchStore(store, "*"))
+	if total < 3 {
+		t.Fatalf("Expected at least 3 users in the store, got %d", total)
+	}
+
+	req := httptest.NewRequest("GET", "/v3.0/search?q=*&start=1&rows=2", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var resp SearchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.NumFound != total {
+		t.Errorf("Expected num-found %d, got %d", total, resp.NumFound)
+	}
+	if len(resp.Result) != 2 || resp.Result[0].OrcidIdentifier.Path != store.ORCIDs()[1] {
+		t.Errorf("Expected the second and third users, got %+v", resp.Result)
+	}
+
+	req = httptest.NewRequest("GET", "/v3.0/search?q=*&rows=5000", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status Bad Request for rows over the limit, got %v", w.Code)
+	}
+
+	for _, path := range []string{"/v3.0/search?q=*&start=9223372036854775807", "/v3.0/csv-search?q=*&start=9223372036854775807"} {
+		req = httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/json")
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected an empty page for a huge start on %s, got %v", path, w.Code)
+		}
+	}
+}
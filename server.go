@@ -0,0 +1,119 @@
+package moat
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// --- Library ---
+//
+// Besides running as the moat command (cmd/moat), moat can be embedded in Go
+// tests: New returns a Server, an http.Handler to pass to
+// httptest.NewServer. A Server keeps its store, latency and token lifetime to
+// itself and hands them to its requests through the context, so servers made
+// with different options don't change each other. Without WithStore it
+// serves the package's default store, as the binary does. OAuth clients and
+// tokens, the journal, faults, stubs and the clock are shared by every Server
+// in a process; call Reset between tests.
+//
+// Options stand in for the environment variables the command reads:
+// WithStore for MOAT_DATA_DIR, WithSeedUsers for MOAT_FIXTURES, WithLatency
+// for MOAT_LATENCY and WithTokenTTL for MOAT_TOKEN_TTL. WithPrefix mounts
+// moat under a path prefix.
+
+// Server is the full moat route tree, as the main port serves it
+type Server struct {
+	handler  http.Handler
+	store    *Store
+	users    []FixtureUser
+	latency  *time.Duration // nil leaves MOAT_LATENCY's
+	tokenTTL *time.Duration // nil leaves MOAT_TOKEN_TTL's
+	prefix   string
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithStore serves s in place of the demo users
+func WithStore(s *Store) Option {
+	return func(srv *Server) { srv.store = s }
+}
+
+// WithSeedUsers adds users to the store, replacing any with the same iD, as
+// a MOAT_FIXTURES file does. Reset keeps them.
+func WithSeedUsers(users ...FixtureUser) Option {
+	return func(srv *Server) { srv.users = append(srv.users, users...) }
+}
+
+// WithLatency delays every response but /__admin/ ones by d
+func WithLatency(d time.Duration) Option {
+	return func(srv *Server) { srv.latency = &d }
+}
+
+// WithTokenTTL sets the lifetime of the access tokens moat issues
+func WithTokenTTL(d time.Duration) Option {
+	return func(srv *Server) { srv.tokenTTL = &d }
+}
+
+// WithPrefix serves moat under prefix, such as /orcid-mock, for mounting in
+// a larger mux; see prefix.go
+func WithPrefix(prefix string) Option {
+	return func(srv *Server) { srv.prefix = prefix }
+}
+
+// New returns a Server with moat's default settings, adjusted by opts
+func New(opts ...Option) *Server {
+	s := &Server{}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	own := s.store != nil
+	if !own {
+		s.store = store
+	}
+	for _, u := range s.users {
+		seedFixtureUser(s.store, u)
+	}
+	if own {
+		// Put-codes are issued process-wide, so new items mustn't take the
+		// ones the supplied store already uses
+		reserveSnapshotPutCodes(s.store.Snapshot())
+	}
+	if own || len(s.users) > 0 {
+		captureSeedState(s.store)
+	}
+
+	s.handler = withPrefix(s.prefix, s.withSettings(withTenant(setupRouter())))
+	return s
+}
+
+type serverKey struct{}
+
+// serverFor returns the Server a request came through, or nil for the
+// binary's listeners
+func serverFor(ctx context.Context) *Server {
+	s, _ := ctx.Value(serverKey{}).(*Server)
+	return s
+}
+
+// withSettings serves next with s and its store in the request context;
+// withTenant still swaps in a tenant's store when one is named
+func (s *Server) withSettings(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), serverKey{}, s)
+		ctx = context.WithValue(ctx, tenantKey{}, s.store)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ServeHTTP serves the ORCID API, OAuth and the admin endpoints
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Reset puts moat back to its startup state, as POST /__admin/reset does
+func (s *Server) Reset() {
+	resetState(s.store)
+}
@@ -0,0 +1,123 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	srv := New()
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	t.Cleanup(srv.Reset)
+
+	resp, err := http.Get(ts.URL + "/v3.0/0000-0001-2345-6789/record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a seeded record, got %v", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest("DELETE", ts.URL+"/v3.0/0000-0003-3003-4004/employment/789012", nil)
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected the employment deleted, got %v", resp.StatusCode)
+	}
+
+	srv.Reset()
+	if resp, err = http.Get(ts.URL + "/v3.0/0000-0003-3003-4004/employment/789012"); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected Reset to bring the employment back, got %v", resp.StatusCode)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	t.Cleanup(func() { resetState(store) })
+
+	srv := New(
+		WithStore(NewStore()),
+		WithSeedUsers(FixtureUser{ORCID: "0000-0009-0000-0001", GivenNames: "Ada", FamilyName: "Lovelace"}),
+		WithLatency(50*time.Millisecond),
+		WithTokenTTL(time.Minute),
+	)
+	do := func(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(srv, "GET", "/v3.0/0000-0001-2345-6789/record", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the demo users gone with WithStore, got %v", w.Code)
+	}
+	start := time.Now()
+	if w := do(srv, "GET", "/v3.0/0000-0009-0000-0001/record", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Lovelace") {
+		t.Errorf("Expected the seeded user, got %v", w.Code)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Expected the response delayed by WithLatency")
+	}
+	if w := do(srv, "POST", "/oauth/token", "client_id=APP-123&grant_type=client_credentials"); !strings.Contains(w.Body.String(), `"expires_in":60`) {
+		t.Errorf("Expected a one-minute token, got %s", w.Body)
+	}
+
+	// The options belong to srv: the default store and settings are as they were
+	if _, ok := store.Person("0000-0009-0000-0001"); ok {
+		t.Error("Expected the default store left alone")
+	}
+	if w := do(setupRouter(), "POST", "/oauth/token", "client_id=APP-123&grant_type=client_credentials"); strings.Contains(w.Body.String(), `"expires_in":60`) {
+		t.Errorf("Expected the default token lifetime elsewhere, got %s", w.Body)
+	}
+
+	do(srv, "DELETE", "/__admin/users/0000-0009-0000-0001", "")
+	srv.Reset()
+	if w := do(srv, "GET", "/v3.0/0000-0009-0000-0001/record", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected Reset to keep the seeded user, got %v", w.Code)
+	}
+}
+
+func TestNewKeepsServersApart(t *testing.T) {
+	slow := New(WithStore(NewStore()), WithLatency(50*time.Millisecond))
+	New(WithStore(NewStore()))
+
+	// Making the second server leaves the first one's latency alone
+	start := time.Now()
+	slow.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil))
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Expected the first server still delayed")
+	}
+}
+
+func TestNewReservesStorePutCodes(t *testing.T) {
+	orcid := "0000-0009-0000-0002"
+	s := NewStore()
+	s.AddUser(orcid, createMockPerson(orcid, "Grace", "Hopper", ""))
+	s.PutItem(orcid, sectionWork, minPutCode, []byte(`{"title": {"title": {"value": "Compilers"}}}`))
+	srv := New(WithStore(s))
+
+	req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/work", strings.NewReader(`{"type": "book", "title": {"title": {"value": "COBOL"}}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated || strings.HasSuffix(w.Header().Get("Location"), "/"+strconv.Itoa(minPutCode)) {
+		t.Errorf("Expected a new put-code, got %v %s", w.Code, w.Header().Get("Location"))
+	}
+	if items, _ := s.Items(orcid, sectionWork); len(items) != 2 {
+		t.Errorf("Expected both works in the supplied store, got %d", len(items))
+	}
+}
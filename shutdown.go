@@ -0,0 +1,74 @@
+package moat
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// --- Graceful Shutdown ---
+//
+// On SIGINT or SIGTERM moat stops accepting connections and lets requests
+// in flight finish, for up to MOAT_SHUTDOWN_TIMEOUT (10 seconds by default),
+// before closing what's left. With MOAT_DATA_DIR set, the store is then
+// saved one last time, so nothing written just before the signal is lost.
+
+// defaultShutdownTimeout is how long requests in flight get to finish
+const defaultShutdownTimeout = 10 * time.Second
+
+// getShutdownTimeout reads MOAT_SHUTDOWN_TIMEOUT, a number of seconds or a
+// Go duration
+func getShutdownTimeout() (time.Duration, error) {
+	d, err := envDuration("MOAT_SHUTDOWN_TIMEOUT")
+	if d == 0 && err == nil {
+		d = defaultShutdownTimeout
+	}
+	return d, err
+}
+
+// serve runs servers, over TLS if they have a TLSConfig, until ctx is done
+// or one of them fails, then shuts them all down, giving requests in flight
+// up to timeout to finish. A server with a listener in listeners serves that
+// instead of binding its Addr.
+func serve(ctx context.Context, servers []*http.Server, listeners map[*http.Server]net.Listener, timeout time.Duration) error {
+	failed := make(chan error, len(servers))
+	for _, srv := range servers {
+		l := listeners[srv]
+		go func() {
+			var err error
+			switch {
+			case l != nil && srv.TLSConfig != nil:
+				err = srv.ServeTLS(l, "", "")
+			case l != nil:
+				err = srv.Serve(l)
+			case srv.TLSConfig != nil:
+				err = srv.ListenAndServeTLS("", "")
+			default:
+				err = srv.ListenAndServe()
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				failed <- err
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down", "timeout", timeout)
+	case err = <-failed:
+	}
+
+	stop, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, srv := range servers {
+		if serr := srv.Shutdown(stop); serr != nil {
+			slog.Warn("Requests cut off at shutdown", "addr", srv.Addr, "error", serr)
+			srv.Close()
+		}
+	}
+	return err
+}
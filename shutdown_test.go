@@ -0,0 +1,125 @@
+package moat
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a loopback address nothing is listening on
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestServeDrainsRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("finished"))
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- serve(ctx, []*http.Server{srv}, nil, 5*time.Second) }()
+
+	got := make(chan string)
+	go func() {
+		for {
+			resp, err := http.Get("http://" + addr)
+			if err != nil {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			got <- string(body)
+			return
+		}
+	}()
+
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected new connections to be refused while draining")
+	}
+	close(release)
+	if body := <-got; body != "finished" {
+		t.Errorf("Expected the request in flight to finish, got %q", body)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- serve(ctx, []*http.Server{srv}, nil, 100*time.Millisecond) }()
+	go func() {
+		for {
+			select {
+			case <-started:
+				return
+			default:
+			}
+			if resp, err := http.Get("http://" + addr); err == nil {
+				resp.Body.Close()
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	<-started
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected shutdown to give up after its timeout")
+	}
+}
+
+func TestServeListenError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	srv := &http.Server{Addr: l.Addr().String()}
+	if err := serve(context.Background(), []*http.Server{srv}, nil, time.Second); err == nil {
+		t.Error("Expected an error for an address in use")
+	}
+}
+
+func TestGetShutdownTimeout(t *testing.T) {
+	t.Setenv("MOAT_SHUTDOWN_TIMEOUT", "")
+	if d, err := getShutdownTimeout(); err != nil || d != defaultShutdownTimeout {
+		t.Errorf("Expected the default, got %v, %v", d, err)
+	}
+	t.Setenv("MOAT_SHUTDOWN_TIMEOUT", "30")
+	if d, err := getShutdownTimeout(); err != nil || d != 30*time.Second {
+		t.Errorf("Expected 30s, got %v, %v", d, err)
+	}
+	t.Setenv("MOAT_SHUTDOWN_TIMEOUT", "soon")
+	if _, err := getShutdownTimeout(); err == nil {
+		t.Error("Expected an error for an invalid timeout")
+	}
+}
@@ -0,0 +1,79 @@
+package moat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --- Socket Activation ---
+//
+// Under systemd socket activation (LISTEN_PID and LISTEN_FDS) moat serves
+// the sockets it is handed instead of binding its ports, so it can start on
+// demand on a shared dev server. The socket named "public" (systemd's
+// FileDescriptorName=) is the public API; the first other one is the main
+// port.
+
+// listenFDsStart is the first descriptor systemd passes
+const listenFDsStart = 3
+
+// activatedListeners returns the sockets systemd passed moat, by name, or
+// nil if it passed none
+func activatedListeners() (map[string]net.Listener, error) {
+	listeners, err := socketListeners(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"), os.Getpid(), listenFDsStart)
+	// The sockets are moat's alone, not for any child process
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	return listeners, err
+}
+
+// socketListeners turns the LISTEN_* variables into listeners on the
+// descriptors from start, provided they were meant for process pid
+func socketListeners(listenPID, listenFDs, fdNames string, pid, start int) (map[string]net.Listener, error) {
+	if listenPID == "" || listenFDs == "" {
+		return nil, nil
+	}
+	if p, err := strconv.Atoi(listenPID); err != nil || p != pid {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(listenFDs)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("LISTEN_FDS must be a number of sockets, got %q", listenFDs)
+	}
+	names := strings.Split(fdNames, ":")
+
+	listeners := map[string]net.Listener{}
+	for i := range n {
+		name := "main"
+		if i < len(names) && names[i] == "public" {
+			name = "public"
+		}
+		if _, dup := listeners[name]; dup {
+			continue
+		}
+		f := os.NewFile(uintptr(start+i), fmt.Sprintf("LISTEN_FD_%d", start+i))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %d: %w", start+i, err)
+		}
+		listeners[name] = l
+	}
+	if listeners["main"] == nil {
+		return nil, errors.New(`systemd passed only a "public" socket`)
+	}
+	return listeners, nil
+}
+
+// listenerPort returns l's port in the ":8080" form moat's settings use
+func listenerPort(l net.Listener) string {
+	_, port, err := net.SplitHostPort(l.Addr().String())
+	if err != nil {
+		return l.Addr().String()
+	}
+	return ":" + port
+}
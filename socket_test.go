@@ -0,0 +1,72 @@
+package moat
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// passedSocket returns the descriptor of a fresh loopback socket, as
+// systemd would pass one
+func passedSocket(t *testing.T) (fd int, addr string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return int(f.Fd()), l.Addr().String()
+}
+
+func TestSocketListeners(t *testing.T) {
+	pid := 4242
+	if l, err := socketListeners("", "", "", pid, listenFDsStart); l != nil || err != nil {
+		t.Errorf("Expected nothing without LISTEN_FDS, got %v %v", l, err)
+	}
+	if l, err := socketListeners("1", "1", "", pid, listenFDsStart); l != nil || err != nil {
+		t.Errorf("Expected sockets for another process ignored, got %v %v", l, err)
+	}
+	if _, err := socketListeners(strconv.Itoa(pid), "x", "", pid, listenFDsStart); err == nil {
+		t.Error("Expected an error for a bad LISTEN_FDS")
+	}
+
+	fd, addr := passedSocket(t)
+	if _, err := socketListeners(strconv.Itoa(pid), "1", "public", pid, fd); err == nil {
+		t.Error("Expected an error for only a public socket")
+	}
+	fd, addr = passedSocket(t)
+	listeners, err := socketListeners(strconv.Itoa(pid), "1", "", pid, fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := listeners["main"]
+	if l == nil || l.Addr().String() != addr || listenerPort(l) == "" {
+		t.Fatalf("Expected the main socket on %s, got %v", addr, listeners)
+	}
+
+	srv := &http.Server{Handler: setupRouter()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- serve(ctx, []*http.Server{srv}, map[*http.Server]net.Listener{srv: l}, time.Second) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	resp, err := http.Get("http://" + addr + "/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the passed socket served, got %v", resp.StatusCode)
+	}
+}
@@ -0,0 +1,733 @@
+package moat
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"moat/models"
+)
+
+// --- Store ---
+//
+// The store keeps each user's data as normalized sections: the biographical
+// person, plus activities keyed by section and put-code. Record, person and
+// activities documents are assembled from those sections on demand, and each
+// assembled activity section is cached until a write touches it.
+
+// Activity section names, used as store keys and in admin listings
+const (
+	sectionWork             = "work"
+	sectionEmployment       = "employment"
+	sectionEducation        = "education"
+	sectionQualification    = "qualification"
+	sectionMembership       = "membership"
+	sectionInvitedPosition  = "invited-position"
+	sectionFunding          = "funding"
+	sectionPeerReview       = "peer-review"
+	sectionResearchResource = "research-resource"
+)
+
+// activitySections lists every section a user is created with
+var activitySections = []string{
+	sectionWork,
+	sectionEmployment,
+	sectionEducation,
+	sectionQualification,
+	sectionMembership,
+	sectionInvitedPosition,
+	sectionFunding,
+	sectionPeerReview,
+	sectionResearchResource,
+}
+
+// Item is a single stored activity: the raw JSON payload as submitted (with
+// its put-code filled in) and when it was last written
+type Item struct {
+	PutCode  int
+	Data     []byte
+	Modified time.Time
+	// Expires, if set, is when the item is garbage-collected (see expiry.go)
+	Expires time.Time
+}
+
+type userData struct {
+	person     models.Person
+	activities map[string]map[int]*Item
+	// modified is when each activity section last changed, with the person
+	// under ""
+	modified map[string]time.Time
+	// versions is the store's write count when each section last changed,
+	// which moves on even when a frozen clock leaves modified where it is
+	versions map[string]uint64
+	// status, if set, marks the record deprecated, deactivated or locked
+	status *RecordStatus
+}
+
+// newUserData returns a user with no activities, every section last changed
+// at modified
+func newUserData(person models.Person, modified time.Time) *userData {
+	u := &userData{person: person, activities: make(map[string]map[int]*Item), modified: map[string]time.Time{"": modified}, versions: make(map[string]uint64)}
+	for _, section := range activitySections {
+		u.activities[section] = make(map[int]*Item)
+		u.modified[section] = modified
+	}
+	return u
+}
+
+// Store is an in-memory, concurrency-safe set of ORCID users
+type Store struct {
+	mu    sync.RWMutex
+	users map[string]*userData
+	// groups holds group-id records, which belong to no user
+	groups map[int]*Item
+
+	cacheMu sync.Mutex
+	cache   map[string]any
+
+	// version counts writes to user sections (see touch)
+	version uint64
+
+	// onWrite, if set, is called after every write, with the write lock held
+	onWrite func()
+}
+
+// NewStore returns an empty store
+func NewStore() *Store {
+	return &Store{
+		users:  make(map[string]*userData),
+		groups: make(map[int]*Item),
+		cache:  make(map[string]any),
+	}
+}
+
+// SetOnWrite registers fn to be called after every write. fn runs with the
+// write lock held, so it must not call back into the store.
+func (s *Store) SetOnWrite(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onWrite = fn
+}
+
+// written notifies onWrite; callers must hold the write lock
+func (s *Store) written() {
+	if s.onWrite != nil {
+		s.onWrite()
+	}
+}
+
+// touch records that section of u changed at t; callers must hold the write
+// lock
+func (s *Store) touch(u *userData, section string, t time.Time) {
+	s.version++
+	u.modified[section] = t
+	u.versions[section] = s.version
+}
+
+// touchAll touches every section of u at the date it already has
+func (s *Store) touchAll(u *userData) {
+	for section, t := range u.modified {
+		s.touch(u, section, t)
+	}
+}
+
+func cacheKey(orcid, section string) string {
+	return orcid + "/" + section
+}
+
+// invalidate drops a cached section; callers must hold the write lock
+func (s *Store) invalidate(orcid, section string) {
+	s.cacheMu.Lock()
+	delete(s.cache, cacheKey(orcid, section))
+	s.cacheMu.Unlock()
+}
+
+// AddUser creates (or replaces) a user with the given person and no activities
+func (s *Store) AddUser(orcid string, person models.Person) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, section := range activitySections {
+		s.invalidate(orcid, section)
+	}
+	u := newUserData(person, clock.Now())
+	s.touchAll(u)
+	s.users[orcid] = u
+	s.written()
+}
+
+// DeleteUser removes orcid and everything it holds, reporting whether it
+// existed
+func (s *Store) DeleteUser(orcid string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[orcid]; !ok {
+		return false
+	}
+	for _, section := range activitySections {
+		s.invalidate(orcid, section)
+	}
+	delete(s.users, orcid)
+	s.written()
+	return true
+}
+
+// HasUser reports whether orcid exists in the store
+func (s *Store) HasUser(orcid string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.users[orcid]
+	return ok
+}
+
+// Status returns orcid's record status, or nil for an active record
+func (s *Store) Status(orcid string) *RecordStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if u, ok := s.users[orcid]; ok && u.status != nil {
+		status := *u.status
+		return &status
+	}
+	return nil
+}
+
+// SetStatus marks orcid's record with status, or makes it active again if
+// status is nil. It reports false if orcid doesn't exist.
+func (s *Store) SetStatus(orcid string, status *RecordStatus) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[orcid]
+	if !ok {
+		return false
+	}
+	u.status = status
+	s.written()
+	return true
+}
+
+// ORCIDs returns every user's iD, sorted
+func (s *Store) ORCIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]string, 0, len(s.users))
+	for orcid := range s.users {
+		list = append(list, orcid)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Person returns the biographical section for orcid
+func (s *Store) Person(orcid string) (models.Person, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[orcid]
+	if !ok {
+		return models.Person{}, false
+	}
+	return u.person, true
+}
+
+// UpdatePerson runs fn against orcid's person under the write lock. Readers
+// may still hold the previous person's sections, so fn must replace any
+// section it changes (e.g. assign a new *models.Addresses) rather than
+// modifying it in place.
+func (s *Store) UpdatePerson(orcid string, fn func(p *models.Person) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[orcid]
+	if !ok {
+		return fmt.Errorf("user %s not found", orcid)
+	}
+	person := u.person
+	if err := fn(&person); err != nil {
+		return err
+	}
+	person.LastModifiedDate = timestamp()
+	u.person = person
+	s.touch(u, "", clock.Now())
+	s.written()
+	return nil
+}
+
+// PutItem stores data under section and putCode, replacing any existing item
+// but keeping its expiry
+func (s *Store) PutItem(orcid, section string, putCode int, data []byte) error {
+	return s.UpdateItems(orcid, section, func(items map[int]*Item) error {
+		it := &Item{PutCode: putCode, Data: data, Modified: clock.Now()}
+		if old, ok := items[putCode]; ok {
+			it.Expires = old.Expires
+		}
+		items[putCode] = it
+		return nil
+	})
+}
+
+// ExpireItems removes every item whose expiry is at or before now, returning
+// how many it removed
+func (s *Store) ExpireItems(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expire := func(items map[int]*Item) int {
+		n := 0
+		for putCode, it := range items {
+			if !it.Expires.IsZero() && !now.Before(it.Expires) {
+				delete(items, putCode)
+				n++
+			}
+		}
+		return n
+	}
+
+	total := expire(s.groups)
+	for orcid, u := range s.users {
+		for section, items := range u.activities {
+			if n := expire(items); n > 0 {
+				s.invalidate(orcid, section)
+				s.touch(u, section, now)
+				total += n
+			}
+		}
+	}
+	if total > 0 {
+		s.written()
+	}
+	return total
+}
+
+// DeleteItem removes one item, reporting whether it existed
+func (s *Store) DeleteItem(orcid, section string, putCode int) bool {
+	err := s.UpdateItems(orcid, section, func(items map[int]*Item) error {
+		if _, ok := items[putCode]; !ok {
+			return errItemNotFound
+		}
+		delete(items, putCode)
+		return nil
+	})
+	return err == nil
+}
+
+// UpdateItems runs fn against a section's items under the write lock, so
+// callers can check and modify them atomically. Unless fn returns an error,
+// which leaves the section as it was, the section's cached summary is dropped
+// afterwards; fn must not change items before it fails.
+func (s *Store) UpdateItems(orcid, section string, fn func(items map[int]*Item) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[orcid]
+	if !ok {
+		return fmt.Errorf("user %s not found", orcid)
+	}
+	items, ok := u.activities[section]
+	if !ok {
+		items = make(map[int]*Item)
+		u.activities[section] = items
+	}
+	if err := fn(items); err != nil {
+		return err
+	}
+	s.invalidate(orcid, section)
+	s.touch(u, section, clock.Now())
+	s.written()
+	return nil
+}
+
+// UpdateGroups runs fn against the group-id records under the write lock
+func (s *Store) UpdateGroups(fn func(items map[int]*Item) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.written()
+	return fn(s.groups)
+}
+
+// Groups returns every group-id record ordered by put-code
+func (s *Store) Groups() []*Item {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return sortedItems(s.groups)
+}
+
+// Items returns a section's items ordered by put-code
+func (s *Store) Items(orcid, section string) ([]*Item, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[orcid]
+	if !ok {
+		return nil, false
+	}
+	return sortedItems(u.activities[section]), true
+}
+
+// Sections returns the names of every section stored for orcid
+func (s *Store) Sections(orcid string) ([]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[orcid]
+	if !ok {
+		return nil, false
+	}
+	var names []string
+	for name := range u.activities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, true
+}
+
+func sortedItems(items map[int]*Item) []*Item {
+	list := make([]*Item, 0, len(items))
+	for _, it := range items {
+		list = append(list, it)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].PutCode < list[j].PutCode })
+	return list
+}
+
+// StoredItem is an Item as saved outside the store
+type StoredItem struct {
+	PutCode  int             `json:"put-code"`
+	Data     json.RawMessage `json:"data"`
+	Modified time.Time       `json:"modified"`
+	Expires  time.Time       `json:"expires,omitzero"`
+}
+
+// StoredUser is everything the store holds for one user
+type StoredUser struct {
+	ORCID      string                  `json:"orcid"`
+	Person     models.Person           `json:"person"`
+	Activities map[string][]StoredItem `json:"activities"`
+	Status     *RecordStatus           `json:"status,omitempty"`
+}
+
+// Snapshot is the whole store's contents, as saved outside it
+type Snapshot struct {
+	Users  []StoredUser `json:"users"`
+	Groups []StoredItem `json:"groups"`
+}
+
+func storedItems(items []*Item) []StoredItem {
+	list := make([]StoredItem, len(items))
+	for i, it := range items {
+		list[i] = StoredItem{PutCode: it.PutCode, Data: it.Data, Modified: it.Modified, Expires: it.Expires}
+	}
+	return list
+}
+
+func restoredItems(list []StoredItem) map[int]*Item {
+	items := make(map[int]*Item, len(list))
+	for _, it := range list {
+		items[it.PutCode] = &Item{PutCode: it.PutCode, Data: it.Data, Modified: it.Modified, Expires: it.Expires}
+	}
+	return items
+}
+
+// Snapshot copies out the store's contents, users ordered by iD
+func (s *Store) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snap := Snapshot{Users: []StoredUser{}, Groups: storedItems(sortedItems(s.groups))}
+	orcids := make([]string, 0, len(s.users))
+	for orcid := range s.users {
+		orcids = append(orcids, orcid)
+	}
+	sort.Strings(orcids)
+	for _, orcid := range orcids {
+		u := s.users[orcid]
+		su := StoredUser{ORCID: orcid, Person: u.person, Activities: make(map[string][]StoredItem), Status: u.status}
+		for section, items := range u.activities {
+			su.Activities[section] = storedItems(sortedItems(items))
+		}
+		snap.Users = append(snap.Users, su)
+	}
+	return snap
+}
+
+// Restore replaces the store's contents with snap
+func (s *Store) Restore(snap Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = make(map[string]*userData, len(snap.Users))
+	for _, su := range snap.Users {
+		// Snapshots don't record section dates, so a section counts as last
+		// changed when its newest item was written
+		u := newUserData(su.Person, clock.Now())
+		for section, list := range su.Activities {
+			u.activities[section] = restoredItems(list)
+			var newest time.Time
+			for _, it := range list {
+				if it.Modified.After(newest) {
+					newest = it.Modified
+				}
+			}
+			if !newest.IsZero() {
+				u.modified[section] = newest
+			}
+		}
+		u.status = su.Status
+		s.touchAll(u)
+		s.users[su.ORCID] = u
+	}
+	s.groups = restoredItems(snap.Groups)
+
+	s.cacheMu.Lock()
+	s.cache = make(map[string]any)
+	s.cacheMu.Unlock()
+	s.written()
+}
+
+// summary returns the cached summary for a section, building it from the
+// stored items on a miss. If visible hides any of the items, the summary is
+// built from the rest and not cached.
+func (s *Store) summary(orcid, section string, visible func(*Item) bool, build func(items []*Item) any) any {
+	if visible != nil {
+		items := sortedItems(s.users[orcid].activities[section])
+		kept := slices.DeleteFunc(slices.Clone(items), func(it *Item) bool { return !visible(it) })
+		if len(kept) < len(items) {
+			return build(kept)
+		}
+	}
+
+	key := cacheKey(orcid, section)
+	s.cacheMu.Lock()
+	v, ok := s.cache[key]
+	s.cacheMu.Unlock()
+	if ok {
+		return v
+	}
+
+	// Callers hold the read lock, so no write can land between building
+	// the summary and caching it
+	v = build(sortedItems(s.users[orcid].activities[section]))
+	s.cacheMu.Lock()
+	s.cache[key] = v
+	s.cacheMu.Unlock()
+	return v
+}
+
+// Activities assembles the activities summary for orcid
+func (s *Store) Activities(orcid string) (Activities, bool) {
+	return s.VisibleActivities(orcid, nil)
+}
+
+// VisibleActivities assembles the activities summary for orcid from the items
+// visible reports true for; nil includes them all
+func (s *Store) VisibleActivities(orcid string, visible func(*Item) bool) (Activities, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[orcid]
+	if !ok {
+		return Activities{}, false
+	}
+	works := s.summary(orcid, sectionWork, visible, buildWorkSummaries).(WorkSummaryGroup)
+	works.LastModifiedDate = lastModified(u.modified[sectionWork])
+	employments := s.summary(orcid, sectionEmployment, visible, buildEmploymentSummaries).(EmploymentSummaryGroup)
+	employments.LastModifiedDate = lastModified(u.modified[sectionEmployment])
+
+	var newest time.Time
+	for _, section := range activitySections {
+		if u.modified[section].After(newest) {
+			newest = u.modified[section]
+		}
+	}
+	return Activities{
+		LastModifiedDate:  lastModified(newest),
+		Works:             works,
+		Educations:        s.summary(orcid, sectionEducation, visible, buildEducationSummaries).(EducationSummaryGroup),
+		Employment:        employments,
+		Fundings:          s.summary(orcid, sectionFunding, visible, buildFundingSummaries).(FundingSummaryGroup),
+		InvitedPositions:  s.summary(orcid, sectionInvitedPosition, visible, buildInvitedPositionSummaries).(InvitedPositionSummaryGroup),
+		Memberships:       s.summary(orcid, sectionMembership, visible, buildMembershipSummaries).(MembershipSummaryGroup),
+		Qualifications:    s.summary(orcid, sectionQualification, visible, buildQualificationSummaries).(QualificationSummaryGroup),
+		PeerReviews:       s.summary(orcid, sectionPeerReview, visible, buildPeerReviewSummaries).(PeerReviewSummaryGroup),
+		ResearchResources: s.summary(orcid, sectionResearchResource, visible, buildResearchResourceSummaries).(ResearchResourceSummaryGroup),
+	}, true
+}
+
+// Modified returns when the newest of sections of orcid's record changed,
+// with "" standing for the person
+func (s *Store) Modified(orcid string, sections ...string) (time.Time, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[orcid]
+	if !ok {
+		return time.Time{}, false
+	}
+	var newest time.Time
+	for _, section := range sections {
+		if u.modified[section].After(newest) {
+			newest = u.modified[section]
+		}
+	}
+	return newest, true
+}
+
+// Version returns a number that changes whenever any of sections of orcid's
+// record is written, even if Modified does not because the clock is frozen
+func (s *Store) Version(orcid string, sections ...string) (uint64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[orcid]
+	if !ok {
+		return 0, false
+	}
+	var newest uint64
+	for _, section := range sections {
+		newest = max(newest, u.versions[section])
+	}
+	return newest, true
+}
+
+// lastModified converts t to ORCID's millisecond timestamp
+func lastModified(t time.Time) *LastModified {
+	return &LastModified{Value: t.UnixMilli()}
+}
+
+// Record assembles the full record for orcid
+func (s *Store) Record(orcid string) (OrcidRecord, bool) {
+	return s.VisibleRecord(orcid, nil)
+}
+
+// VisibleRecord assembles the full record for orcid with only the activities
+// visible reports true for
+func (s *Store) VisibleRecord(orcid string, visible func(*Item) bool) (OrcidRecord, bool) {
+	person, ok := s.Person(orcid)
+	if !ok {
+		return OrcidRecord{}, false
+	}
+	activities, ok := s.VisibleActivities(orcid, visible)
+	if !ok {
+		return OrcidRecord{}, false
+	}
+	return OrcidRecord{
+		OrcidIdentifier: newOrcidIdentifier(orcid),
+		Person:          person,
+		Activities:      activities,
+	}, true
+}
+
+// decodeItems unmarshals each item's JSON into a summary type, skipping
+// anything that doesn't decode
+func decodeItems[T any](items []*Item, fn func(it *Item, v *T)) []T {
+	list := make([]T, 0, len(items))
+	for _, it := range items {
+		var v T
+		if err := json.Unmarshal(it.Data, &v); err != nil {
+			continue
+		}
+		if fn != nil {
+			fn(it, &v)
+		}
+		list = append(list, v)
+	}
+	return list
+}
+
+func buildWorkSummaries(items []*Item) any {
+	group := WorkSummaryGroup{Group: []WorkGroup{}}
+	summaries := decodeItems(items, func(it *Item, v *WorkSummary) {
+		v.LastModified = *lastModified(it.Modified)
+	})
+	for _, ws := range summaries {
+		group.Group = append(group.Group, WorkGroup{WorkSummary: []WorkSummary{ws}})
+	}
+	return group
+}
+
+func buildEmploymentSummaries(items []*Item) any {
+	group := EmploymentSummaryGroup{AffiliationGroup: []AffiliationGroup{}}
+	summaries := decodeItems(items, func(it *Item, v *EmploymentSummary) {
+		v.LastModifiedDate = lastModified(it.Modified)
+	})
+	for _, es := range summaries {
+		group.AffiliationGroup = append(group.AffiliationGroup, AffiliationGroup{Summaries: []EmploymentSummary{es}})
+	}
+	return group
+}
+
+func buildEducationSummaries(items []*Item) any {
+	group := EducationSummaryGroup{AffiliationGroup: []EducationGroup{}}
+	for _, as := range decodeItems[AffiliationSummary](items, nil) {
+		group.AffiliationGroup = append(group.AffiliationGroup, EducationGroup{Summaries: []AffiliationSummary{as}})
+	}
+	return group
+}
+
+func buildInvitedPositionSummaries(items []*Item) any {
+	group := InvitedPositionSummaryGroup{AffiliationGroup: []InvitedPositionGroup{}}
+	for _, as := range decodeItems[AffiliationSummary](items, nil) {
+		group.AffiliationGroup = append(group.AffiliationGroup, InvitedPositionGroup{Summaries: []AffiliationSummary{as}})
+	}
+	return group
+}
+
+func buildMembershipSummaries(items []*Item) any {
+	group := MembershipSummaryGroup{AffiliationGroup: []MembershipGroup{}}
+	for _, as := range decodeItems[AffiliationSummary](items, nil) {
+		group.AffiliationGroup = append(group.AffiliationGroup, MembershipGroup{Summaries: []AffiliationSummary{as}})
+	}
+	return group
+}
+
+func buildQualificationSummaries(items []*Item) any {
+	group := QualificationSummaryGroup{AffiliationGroup: []QualificationGroup{}}
+	for _, as := range decodeItems[AffiliationSummary](items, nil) {
+		group.AffiliationGroup = append(group.AffiliationGroup, QualificationGroup{Summaries: []AffiliationSummary{as}})
+	}
+	return group
+}
+
+func buildFundingSummaries(items []*Item) any {
+	group := FundingSummaryGroup{Group: []FundingGroup{}}
+	for _, fs := range decodeItems[FundingSummary](items, nil) {
+		group.Group = append(group.Group, FundingGroup{FundingSummary: []FundingSummary{fs}})
+	}
+	return group
+}
+
+// buildPeerReviewSummaries groups reviews by review-group-id, ordered by
+// group-id, as harvesting clients page through them group by group
+func buildPeerReviewSummaries(items []*Item) any {
+	group := PeerReviewSummaryGroup{Group: []PeerReviewGroup{}}
+	byGroupID := make(map[string][]PeerReviewSummary)
+	for _, ps := range decodeItems[PeerReviewSummary](items, nil) {
+		byGroupID[ps.ReviewGroupID] = append(byGroupID[ps.ReviewGroupID], ps)
+	}
+
+	groupIDs := make([]string, 0, len(byGroupID))
+	for id := range byGroupID {
+		groupIDs = append(groupIDs, id)
+	}
+	sort.Strings(groupIDs)
+
+	for _, id := range groupIDs {
+		g := PeerReviewGroup{
+			ExternalIDs: ExternalIDs{ExternalID: []ExternalID{{Type: "peer-review", Value: id}}},
+		}
+		for _, ps := range byGroupID[id] {
+			g.PeerReviewGroup = append(g.PeerReviewGroup, PeerReviewDuplicates{PeerReviewSummary: []PeerReviewSummary{ps}})
+		}
+		group.Group = append(group.Group, g)
+	}
+	return group
+}
+
+func buildResearchResourceSummaries(items []*Item) any {
+	group := ResearchResourceSummaryGroup{Group: []ResearchResourceGroup{}}
+	for _, rs := range decodeItems[ResearchResourceSummary](items, nil) {
+		group.Group = append(group.Group, ResearchResourceGroup{ResearchResourceSummary: []ResearchResourceSummary{rs}})
+	}
+	return group
+}
@@ -0,0 +1,106 @@
+package moat
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"moat/models"
+)
+
+func TestStoreAssemblesRecordFromSections(t *testing.T) {
+	s := NewStore()
+	orcid := "0000-0001-0000-0001"
+	s.AddUser(orcid, models.Person{Path: orcid})
+
+	rec, ok := s.Record(orcid)
+	if !ok {
+		t.Fatal("Expected record for new user")
+	}
+	if rec.OrcidIdentifier.Path != orcid || len(rec.Activities.Works.Group) != 0 {
+		t.Errorf("Expected empty record for %s, got %+v", orcid, rec)
+	}
+
+	work, _ := json.Marshal(GenericWorkResponse{Type: "book", PutCode: 7, Title: Title{Title: Value{Value: "Cached?"}}})
+	if err := s.PutItem(orcid, sectionWork, 7, work); err != nil {
+		t.Fatalf("Failed to store work: %v", err)
+	}
+
+	// The earlier Record call cached an empty works section; the write must
+	// have invalidated it
+	rec, _ = s.Record(orcid)
+	if len(rec.Activities.Works.Group) != 1 {
+		t.Fatalf("Expected 1 work group after write, got %d", len(rec.Activities.Works.Group))
+	}
+	summary := rec.Activities.Works.Group[0].WorkSummary[0]
+	if summary.PutCode != 7 || summary.Title.Title.Value != "Cached?" || summary.LastModified.Value == 0 {
+		t.Errorf("Unexpected work summary %+v", summary)
+	}
+}
+
+func TestStoreUnknownUser(t *testing.T) {
+	s := NewStore()
+
+	if _, ok := s.Record("0000-0000-0000-0000"); ok {
+		t.Error("Expected no record for unknown user")
+	}
+	if err := s.PutItem("0000-0000-0000-0000", sectionWork, 1, nil); err == nil {
+		t.Error("Expected error storing an item for unknown user")
+	}
+}
+
+func TestStoreTracksLastModified(t *testing.T) {
+	s := NewStore()
+	orcid := "0000-0001-0000-0001"
+	s.AddUser(orcid, models.Person{Path: orcid})
+	before, _ := s.Activities(orcid)
+
+	time.Sleep(2 * time.Millisecond)
+	s.PutItem(orcid, sectionEmployment, 1, []byte(`{"put-code": 1}`))
+	after, _ := s.Activities(orcid)
+
+	if after.Employment.LastModifiedDate.Value <= before.Employment.LastModifiedDate.Value {
+		t.Errorf("Expected the employments date to advance, got %v then %v", before.Employment.LastModifiedDate, after.Employment.LastModifiedDate)
+	}
+	if after.LastModifiedDate.Value != after.Employment.LastModifiedDate.Value {
+		t.Errorf("Expected the activities date to follow the newest section, got %v", after.LastModifiedDate)
+	}
+	if after.Works.LastModifiedDate.Value != before.Works.LastModifiedDate.Value {
+		t.Error("Expected the works date to be unchanged")
+	}
+	if summary := after.Employment.AffiliationGroup[0].Summaries[0]; summary.LastModifiedDate == nil {
+		t.Error("Expected the employment summary to have a last-modified-date")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	s.DeleteItem(orcid, sectionEmployment, 1)
+	deleted, _ := s.Activities(orcid)
+	if deleted.Employment.LastModifiedDate.Value <= after.Employment.LastModifiedDate.Value {
+		t.Error("Expected a delete to advance the employments date")
+	}
+
+	s.UpdatePerson(orcid, func(p *models.Person) error { return nil })
+	if p, _ := s.Person(orcid); p.LastModifiedDate == nil {
+		t.Error("Expected a person update to set its last-modified-date")
+	}
+}
+
+func TestStoreRejectedUpdateLeavesSection(t *testing.T) {
+	s := NewStore()
+	orcid := "0000-0001-0000-0001"
+	s.AddUser(orcid, models.Person{Path: orcid})
+	writes := 0
+	s.SetOnWrite(func() { writes++ })
+	before, _ := s.Modified(orcid, sectionWork)
+
+	time.Sleep(2 * time.Millisecond)
+	if err := s.UpdateItems(orcid, sectionWork, func(map[int]*Item) error { return errItemNotFound }); err != errItemNotFound {
+		t.Errorf("Expected the callback's error back, got %v", err)
+	}
+	if s.DeleteItem(orcid, sectionWork, 1) {
+		t.Error("Expected deleting a missing item to report it missing")
+	}
+	if after, _ := s.Modified(orcid, sectionWork); !after.Equal(before) || writes != 0 {
+		t.Errorf("Expected rejected writes to change nothing, got %v then %v and %d writes", before, after, writes)
+	}
+}
@@ -0,0 +1,215 @@
+package moat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --- Stubs ---
+//
+// A stub is a canned response, or a sequence of them, registered at runtime
+// through POST /__admin/stubs, so a test can shape answers without
+// restarting moat. It overrides moat's handlers (and scenarios) for the
+// requests it matches; the newest matching stub wins. /__admin/ is never
+// stubbed, and POST /__admin/reset drops every stub.
+
+// Stub matches requests and answers them with a canned response
+type Stub struct {
+	ID int `json:"id"`
+	// Method and Path match requests as a fault rule's do
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	// Query holds parameters the request must have, with these values
+	Query map[string]string `json:"query,omitempty"`
+	// BodyContains is a substring and BodyMatches a regular expression the
+	// request body must have
+	BodyContains string `json:"body_contains,omitempty"`
+	BodyMatches  string `json:"body_matches,omitempty"`
+	CannedResponse
+	// Responses, instead of a single response, are given in turn, one per
+	// matching request, and the last repeats. An empty one lets moat answer.
+	Responses []CannedResponse `json:"responses,omitempty"`
+	// Calls counts the requests the stub has matched
+	Calls int `json:"calls"`
+
+	body *regexp.Regexp
+}
+
+var (
+	stubs      []*Stub
+	nextStubID = 1
+	stubMutex  sync.Mutex
+)
+
+// validate checks s and compiles its body pattern
+func (s *Stub) validate() error {
+	switch {
+	case len(s.Responses) > 0 && !s.empty():
+		return errors.New("responses excludes status, headers and body")
+	case len(s.Responses) == 0 && s.empty():
+		return errors.New("a stub needs a status, headers, body or responses")
+	}
+	if err := s.CannedResponse.validate(); err != nil {
+		return err
+	}
+	for i := range s.Responses {
+		if err := s.Responses[i].validate(); err != nil {
+			return fmt.Errorf("response %d: %w", i, err)
+		}
+	}
+	if _, err := path.Match(s.Path, ""); err != nil {
+		return fmt.Errorf("invalid path pattern %q", s.Path)
+	}
+	if s.BodyMatches != "" {
+		var err error
+		if s.body, err = regexp.Compile(s.BodyMatches); err != nil {
+			return fmt.Errorf("invalid body_matches: %w", err)
+		}
+	}
+	return nil
+}
+
+// matches reports whether r is one of the requests s answers
+func (s *Stub) matches(r *http.Request) bool {
+	if !matchRequest(r, s.Method, s.Path) {
+		return false
+	}
+	q := r.URL.Query()
+	for k, v := range s.Query {
+		if !q.Has(k) || q.Get(k) != v {
+			return false
+		}
+	}
+	if s.BodyContains == "" && s.body == nil {
+		return true
+	}
+	body := peekBody(r)
+	return strings.Contains(body, s.BodyContains) && (s.body == nil || s.body.MatchString(body))
+}
+
+// peekBody reads r's body and puts it back for the handler
+func peekBody(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	data, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	return string(data)
+}
+
+// addStub registers s, returning it with its id
+func addStub(s Stub) Stub {
+	stubMutex.Lock()
+	defer stubMutex.Unlock()
+	s.ID = nextStubID
+	nextStubID++
+	stubs = append(stubs, &s)
+	return s
+}
+
+// listStubs returns a copy of the current stubs, oldest first
+func listStubs() []Stub {
+	stubMutex.Lock()
+	defer stubMutex.Unlock()
+	list := make([]Stub, len(stubs))
+	for i, s := range stubs {
+		list[i] = *s
+	}
+	return list
+}
+
+// removeStub drops the stub with id, reporting whether there was one
+func removeStub(id int) bool {
+	stubMutex.Lock()
+	defer stubMutex.Unlock()
+	for i, s := range stubs {
+		if s.ID == id {
+			stubs = append(stubs[:i], stubs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// clearStubs drops every stub
+func clearStubs() {
+	stubMutex.Lock()
+	defer stubMutex.Unlock()
+	stubs = nil
+}
+
+// next counts a call to s and returns the response it gives
+func (s *Stub) next() CannedResponse {
+	s.Calls++
+	if len(s.Responses) == 0 {
+		return s.CannedResponse
+	}
+	return s.Responses[min(s.Calls, len(s.Responses))-1]
+}
+
+// playStub answers r from the newest stub that matches it, reporting whether
+// it did; a sequence's empty response leaves r to moat
+func playStub(w http.ResponseWriter, r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/__admin/") {
+		return false
+	}
+	stubMutex.Lock()
+	var resp CannedResponse
+	matched := false
+	for i := len(stubs) - 1; i >= 0; i-- {
+		if stubs[i].matches(r) {
+			resp, matched = stubs[i].next(), true
+			break
+		}
+	}
+	stubMutex.Unlock()
+	if !matched || resp.empty() {
+		return false
+	}
+	resp.write(w, r)
+	return true
+}
+
+// handleAdminListStubs lists the stubs, oldest first
+func handleAdminListStubs(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, r, listStubs())
+}
+
+// handleAdminAddStub registers a stub ahead of the existing ones
+func handleAdminAddStub(w http.ResponseWriter, r *http.Request) {
+	var s Stub
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, "Invalid stub: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.validate(); err != nil {
+		http.Error(w, "Invalid stub: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeResponseStatus(w, r, http.StatusCreated, addStub(s))
+}
+
+// handleAdminDeleteStub removes one stub
+func handleAdminDeleteStub(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || !removeStub(id) {
+		http.Error(w, "Stub not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAdminClearStubs removes every stub
+func handleAdminClearStubs(w http.ResponseWriter, r *http.Request) {
+	clearStubs()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,140 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStubs(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	t.Cleanup(clearStubs)
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/__admin/stubs", `{"method": "GET", "path": "/v3.0/*/person", "status": 200, "body": "{\"stubbed\": true}"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the stub to be added, got %v: %s", w.Code, w.Body)
+	}
+	var first Stub
+	json.Unmarshal(w.Body.Bytes(), &first)
+
+	if w := do("GET", "/v3.0/"+orcid+"/person", ""); w.Body.String() != `{"stubbed": true}` || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("Expected the stubbed person, got %q: %s", w.Header().Get("Content-Type"), w.Body)
+	}
+	if w := do("GET", "/v3.0/"+orcid+"/record", ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "stubbed") {
+		t.Errorf("Expected other requests to reach moat, got %v: %s", w.Code, w.Body)
+	}
+
+	// Newer stubs win, and can match on the query and body
+	do("POST", "/__admin/stubs", `{"path": "/v3.0/*/person", "query": {"v": "2"}, "status": 404, "headers": {"X-Stub": "query"}}`)
+	if w := do("GET", "/v3.0/"+orcid+"/person?v=2", ""); w.Code != http.StatusNotFound || w.Header().Get("X-Stub") != "query" {
+		t.Errorf("Expected the query stub, got %v", w.Code)
+	}
+	if w := do("GET", "/v3.0/"+orcid+"/person?v=3", ""); w.Body.String() != `{"stubbed": true}` {
+		t.Errorf("Expected the first stub for another query, got %s", w.Body)
+	}
+	do("POST", "/__admin/stubs", `{"method": "POST", "path": "/v3.0/*/work", "body_matches": "\"value\": \"Reject", "status": 400, "body": "no"}`)
+	if w := do("POST", "/v3.0/"+orcid+"/work", `{"type": "book", "title": {"title": {"value": "Reject me"}}}`); w.Code != http.StatusBadRequest || w.Body.String() != "no" {
+		t.Errorf("Expected the body stub, got %v: %s", w.Code, w.Body)
+	}
+	if w := do("POST", "/v3.0/"+orcid+"/work", `{"type": "book", "title": {"title": {"value": "Keep me"}}}`); w.Code != http.StatusCreated {
+		t.Errorf("Expected a non-matching body to reach moat with its body intact, got %v: %s", w.Code, w.Body)
+	}
+
+	var list []Stub
+	json.Unmarshal(do("GET", "/__admin/stubs", "").Body.Bytes(), &list)
+	if len(list) != 3 || list[0].ID != first.ID {
+		t.Errorf("Expected 3 stubs, oldest first, got %+v", list)
+	}
+	if w := do("DELETE", "/__admin/stubs/"+strconv.Itoa(first.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %v", w.Code)
+	}
+	if w := do("GET", "/v3.0/"+orcid+"/person", ""); strings.Contains(w.Body.String(), "stubbed") {
+		t.Errorf("Expected the removed stub to stop answering, got %s", w.Body)
+	}
+
+	do("POST", "/__admin/reset", "")
+	if list := listStubs(); len(list) != 0 {
+		t.Errorf("Expected reset to drop every stub, got %+v", list)
+	}
+}
+
+func TestAdminAddStubRejects(t *testing.T) {
+	t.Cleanup(clearStubs)
+	handler := setupRouter()
+	for _, body := range []string{
+		`{"path": "/v3.0/*/person"}`,
+		`{"status": 42}`,
+		`{"path": "[", "status": 200}`,
+		`{"body_matches": "(", "status": 200}`,
+		`not json`,
+	} {
+		req := httptest.NewRequest("POST", "/__admin/stubs", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", body, w.Code)
+		}
+	}
+}
+
+func TestStubSequence(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	t.Cleanup(clearStubs)
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/__admin/stubs", `{"method": "POST", "path": "/v3.0/*/work", "responses": [
+		{"status": 503, "headers": {"Retry-After": "1"}}, {"status": 503}, {}
+	]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the stub to be added, got %v: %s", w.Code, w.Body)
+	}
+	work := `{"type": "book", "title": {"title": {"value": "Third Time Lucky"}}}`
+	for i, want := range []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusCreated, http.StatusCreated} {
+		if w := do("POST", "/v3.0/"+orcid+"/work", work); w.Code != want {
+			t.Errorf("Call %d: expected %v, got %v: %s", i+1, want, w.Code, w.Body)
+		}
+	}
+	if list := listStubs(); len(list) != 1 || list[0].Calls != 4 {
+		t.Errorf("Expected the stub to count 4 calls, got %+v", list)
+	}
+
+	// The last response repeats
+	do("POST", "/__admin/stubs", `{"path": "/v3.0/*/person", "responses": [{"status": 500}, {"status": 200, "body": "ok"}]}`)
+	for i, want := range []int{http.StatusInternalServerError, http.StatusOK, http.StatusOK} {
+		if w := do("GET", "/v3.0/"+orcid+"/person", ""); w.Code != want {
+			t.Errorf("Person call %d: expected %v, got %v", i+1, want, w.Code)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"status": 200, "responses": [{"status": 500}]}`,
+		`{"responses": [{"status": 42}]}`,
+	} {
+		if w := do("POST", "/__admin/stubs", bad); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", bad, w.Code)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package moat
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"moat/orciderr"
+)
+
+// --- Public and Member Surfaces ---
+//
+// Real ORCID splits its API between pub.orcid.org, which is read-only and
+// shows public data to anyone, and api.orcid.org, which needs a member token.
+// With MOAT_PUBLIC_PORT set, moat serves the public surface on that port and
+// the member surface on the main port. Without it, one listener serves
+// everything, and needs a token only if MOAT_REQUIRE_TOKEN is set.
+//
+// MOAT_HOSTS picks the surface by Host header instead, so a client that
+// switches between pub.orcid.org, api.orcid.org and the sandbox can be
+// pointed at one moat: "pub.orcid.org=public,api.orcid.org=member", or
+// "orcid" for all of ORCID's hostnames. Other hosts get the port's surface.
+//
+// A listener only labels its requests with their surface (onSurface); the
+// surface's rules are applied in setupRouter's middleware (offSurface), so
+// the requests it turns away get a request id, CORS headers, an access log
+// line and a journal entry like any other.
+
+type surface int
+
+const (
+	// combinedSurface is the single listener used when no split is configured
+	combinedSurface surface = iota
+	publicSurface
+	memberSurface
+)
+
+type surfaceKey struct{}
+
+// surfaceNames are the surfaces MOAT_HOSTS can name
+var surfaceNames = map[string]surface{
+	"all":    combinedSurface,
+	"public": publicSurface,
+	"member": memberSurface,
+}
+
+// orcidHosts is the MOAT_HOSTS=orcid shorthand: ORCID's production and
+// sandbox hostnames, with the site hosts (OAuth) serving everything
+const orcidHosts = "orcid.org=all,pub.orcid.org=public,api.orcid.org=member," +
+	"sandbox.orcid.org=all,pub.sandbox.orcid.org=public,api.sandbox.orcid.org=member"
+
+// listenerSurfaces is what a listener serves: its own surface, and the
+// surfaces MOAT_HOSTS gives particular hosts
+type listenerSurfaces struct {
+	surface surface
+	hosts   map[string]surface
+}
+
+// requestSurface reports which surface r arrived on
+func requestSurface(r *http.Request) surface {
+	l, _ := r.Context().Value(surfaceKey{}).(listenerSurfaces)
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if s, ok := l.hosts[strings.ToLower(host)]; ok {
+		return s
+	}
+	return l.surface
+}
+
+// getPublicPort returns the public listener address, or "" for no split
+func getPublicPort() string {
+	port := os.Getenv("MOAT_PUBLIC_PORT")
+	if port != "" && !strings.HasPrefix(port, ":") {
+		return ":" + port
+	}
+	return port
+}
+
+// requireToken reports whether MOAT_REQUIRE_TOKEN asks for member-style
+// token checks on a single listener
+func requireToken() bool {
+	return os.Getenv("MOAT_REQUIRE_TOKEN") != ""
+}
+
+// getHosts parses MOAT_HOSTS into the surface for each host
+func getHosts() (map[string]surface, error) {
+	v := os.Getenv("MOAT_HOSTS")
+	switch v {
+	case "":
+		return nil, nil
+	case "orcid":
+		v = orcidHosts
+	}
+	hosts := map[string]surface{}
+	for _, entry := range strings.Split(v, ",") {
+		host, name, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		s, known := surfaceNames[name]
+		if !ok || host == "" || !known {
+			return nil, fmt.Errorf(`MOAT_HOSTS entries must be host=public, host=member or host=all, got %q`, entry)
+		}
+		hosts[strings.ToLower(host)] = s
+	}
+	return hosts, nil
+}
+
+// onSurface serves next, setupRouter's handler, as a listener for surface
+// s, with hosts (from MOAT_HOSTS, or nil) choosing another surface by Host
+func onSurface(s surface, hosts map[string]surface, next http.Handler) http.Handler {
+	l := listenerSurfaces{surface: s, hosts: hosts}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), surfaceKey{}, l)))
+	})
+}
+
+// publicAPI serves next as the public surface: API reads only, and no admin
+// or interactive OAuth routes
+func publicAPI(next http.Handler) http.Handler {
+	return onSurface(publicSurface, nil, next)
+}
+
+// memberAPI serves next as the member surface, where API calls need a bearer
+// token that moat issued
+func memberAPI(next http.Handler) http.Handler {
+	return onSurface(memberSurface, nil, next)
+}
+
+// offSurface answers r if the surface it arrived on doesn't serve it,
+// reporting whether it did. Preflights never get this far (see withCORS).
+func offSurface(w http.ResponseWriter, r *http.Request) bool {
+	switch requestSurface(r) {
+	case publicSurface:
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/__admin/"), r.URL.Path == "/oauth/authorize":
+			http.NotFound(w, r)
+			return true
+		case strings.HasPrefix(r.URL.Path, "/v3.0/") && r.Method != http.MethodGet && r.Method != http.MethodHead:
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "The public API is read-only", http.StatusMethodNotAllowed)
+			return true
+		}
+	case memberSurface:
+		if !strings.HasPrefix(r.URL.Path, "/v3.0/") {
+			return false
+		}
+		token := bearerToken(r)
+		if token == "" {
+			writeTokenError(w, r, orciderr.New(orciderr.UnauthorizedNoToken))
+			return true
+		}
+		t, ok := lookupToken(token)
+		if !ok {
+			writeTokenError(w, r, orciderr.Newf(orciderr.InvalidToken, "Unauthorized: Invalid access token %s", token))
+			return true
+		}
+		if t.expired() {
+			writeTokenError(w, r, orciderr.Newf(orciderr.TokenExpired, "Unauthorized: Access token expired %s", token))
+			return true
+		}
+	}
+	return false
+}
+
+// writeTokenError sends a 401 ORCID error with the matching WWW-Authenticate
+// challenge
+func writeTokenError(w http.ResponseWriter, r *http.Request, e *orciderr.Error) {
+	challenge := `Bearer realm="ORCID T2 API"`
+	switch e.ErrorCode {
+	case orciderr.InvalidToken:
+		challenge += `, error="invalid_token"`
+	case orciderr.TokenExpired:
+		challenge += `, error="invalid_token", error_description="token expired"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeResponseStatus(w, r, e.ResponseCode, e)
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
@@ -0,0 +1,177 @@
+package moat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"moat/models"
+	"moat/orciderr"
+)
+
+func TestPublicSurfaceIsReadOnlyAndPublic(t *testing.T) {
+	handler := publicAPI(setupRouter())
+	orcid := "0000-0005-7007-8008"
+
+	store.UpdatePerson(orcid, func(p *models.Person) error {
+		p.Addresses = &models.Addresses{Addresses: []*models.Address{
+			{Visibility: "PUBLIC", PutCode: "1", Country: "GB"},
+			{Visibility: "LIMITED", PutCode: "2", Country: "FR"},
+		}}
+		return nil
+	})
+
+	req := httptest.NewRequest("GET", "/v3.0/"+orcid+"/address", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if body := w.Body.String(); !strings.Contains(body, "GB") || strings.Contains(body, "FR") {
+		t.Errorf("Expected only the public address, got %s", body)
+	}
+
+	req = httptest.NewRequest("POST", "/v3.0/"+orcid+"/address", strings.NewReader(`{"Country": "DE"}`))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status Method Not Allowed, got %v", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/__admin/users/"+orcid+"/items", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected admin routes hidden on the public surface, got %v", w.Code)
+	}
+}
+
+func TestMemberSurfaceRequiresToken(t *testing.T) {
+	handler := memberAPI(setupRouter())
+
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized, got %v", w.Code)
+	}
+	e, err := orciderr.Decode(w.Body)
+	if err != nil || e.ErrorCode != orciderr.UnauthorizedNoToken {
+		t.Errorf("Expected no-token error body, got %+v (%v)", e, err)
+	}
+
+	req = httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer some-token")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized for a token moat never issued, got %v", w.Code)
+	}
+	if e, err := orciderr.Decode(w.Body); err != nil || e.ErrorCode != orciderr.InvalidToken {
+		t.Errorf("Expected invalid-token error body, got %+v (%v)", e, err)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); !strings.Contains(got, "invalid_token") {
+		t.Errorf("Expected an invalid_token challenge, got %q", got)
+	}
+
+	token := defaultTokenResponse(context.Background())
+	recordToken("APP-123", token)
+	req = httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil)
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status OK with an issued token, got %v", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/oauth/token", strings.NewReader("client_id=APP-123&grant_type=client_credentials"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the token endpoint to need no token, got %v", w.Code)
+	}
+}
+
+func TestMemberSurfaceRejectionIsServed(t *testing.T) {
+	clearJournal()
+	t.Cleanup(clearJournal)
+	handler := memberAPI(setupRouter())
+
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil)
+	req.Header.Set("Origin", "http://localhost:5173")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized, got %v", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") == "" || w.Header().Get(requestIDHeader) == "" {
+		t.Errorf("Expected the 401 to carry CORS headers and a request id, got %v", w.Header())
+	}
+	if entries := journalEntries(); len(entries) != 1 || entries[0].Status != http.StatusUnauthorized {
+		t.Errorf("Expected the 401 in the journal, got %+v", entries)
+	}
+}
+
+func TestMemberSurfaceRejectsExpiredToken(t *testing.T) {
+	handler := memberAPI(setupRouter())
+
+	token := defaultTokenResponse(context.Background())
+	token.ExpiresIn = 0
+	recordToken("APP-123", token)
+
+	req := httptest.NewRequest("GET", "/v3.0/0000-0001-2345-6789/record", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status Unauthorized, got %v", w.Code)
+	}
+	if e, err := orciderr.Decode(w.Body); err != nil || e.ErrorCode != orciderr.TokenExpired {
+		t.Errorf("Expected token-expired error body, got %+v (%v)", e, err)
+	}
+}
+
+func TestHostSurfaces(t *testing.T) {
+	t.Setenv("MOAT_HOSTS", "orcid")
+	hosts, err := getHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := onSurface(memberSurface, hosts, setupRouter())
+	do := func(method, host, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Host = host
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	record := "/v3.0/0000-0001-2345-6789/record"
+
+	tests := []struct {
+		method, host, path string
+		want               int
+	}{
+		{"GET", "pub.orcid.org", record, http.StatusOK},
+		{"POST", "pub.orcid.org", "/v3.0/0000-0001-2345-6789/work", http.StatusMethodNotAllowed},
+		{"GET", "api.orcid.org", record, http.StatusUnauthorized},
+		{"GET", "API.Sandbox.ORCID.org:443", record, http.StatusUnauthorized},
+		{"GET", "pub.sandbox.orcid.org:8080", record, http.StatusOK},
+		{"GET", "sandbox.orcid.org", "/__admin/users", http.StatusOK},
+		{"GET", "localhost:8080", record, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := do(tt.method, tt.host, tt.path); got != tt.want {
+			t.Errorf("%s %s%s: expected %v, got %v", tt.method, tt.host, tt.path, tt.want, got)
+		}
+	}
+
+	for _, v := range []string{"pub.orcid.org", "pub.orcid.org=private", "=public"} {
+		t.Setenv("MOAT_HOSTS", v)
+		if _, err := getHosts(); err == nil {
+			t.Errorf("Expected an error for MOAT_HOSTS=%s", v)
+		}
+	}
+}
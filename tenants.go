@@ -0,0 +1,121 @@
+package moat
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// --- Tenants ---
+//
+// Parallel CI pipelines sharing one moat can each work in a tenant: an
+// isolated copy of the store, chosen with an X-Moat-Tenant header or a
+// /tenants/{name}/ path prefix. A tenant starts as a copy of the seeded state
+// the first time it is named and lives until it is deleted through the admin
+// API, and goes through OAuth journeys on its own. Requests that name no
+// tenant use the default store. OAuth clients, codes and tokens are shared by
+// every tenant, and MOAT_DATA_DIR saves only the default store.
+//
+// Handlers reach the store through storeFor(r) rather than the package-level
+// store.
+
+const tenantHeader = "X-Moat-Tenant"
+
+var tenantName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+var (
+	tenants      = make(map[string]*Store)
+	tenantsMutex sync.Mutex
+)
+
+type tenantKey struct{}
+
+// storeFor returns the store r's tenant works in
+func storeFor(r *http.Request) *Store {
+	if s, ok := r.Context().Value(tenantKey{}).(*Store); ok {
+		return s
+	}
+	return store
+}
+
+// tenantStore returns the named tenant's store, creating it from the seeded
+// state if it doesn't exist yet
+func tenantStore(name string) *Store {
+	tenantsMutex.Lock()
+	defer tenantsMutex.Unlock()
+	s, ok := tenants[name]
+	if !ok {
+		s = NewStore()
+		s.Restore(seedFor(store))
+		tenants[name] = s
+	}
+	return s
+}
+
+// tenantStores returns every tenant's store, for work like expiry that
+// covers them all
+func tenantStores() []*Store {
+	tenantsMutex.Lock()
+	defer tenantsMutex.Unlock()
+	list := make([]*Store, 0, len(tenants))
+	for _, s := range tenants {
+		list = append(list, s)
+	}
+	return list
+}
+
+// withTenant serves next with the tenant named by the request, stripping a
+// /tenants/{name} prefix from the path first
+func withTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(tenantHeader)
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/tenants/"); ok {
+			prefix, path, _ := strings.Cut(rest, "/")
+			name = prefix
+			r = r.Clone(r.Context())
+			r.URL.Path = "/" + path
+			r.URL.RawPath = ""
+		}
+		if name == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !tenantName.MatchString(name) {
+			http.Error(w, "Invalid tenant name "+name, http.StatusBadRequest)
+			return
+		}
+		ctx := context.WithValue(r.Context(), tenantKey{}, tenantStore(name))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func handleAdminListTenants(w http.ResponseWriter, r *http.Request) {
+	tenantsMutex.Lock()
+	names := make([]string, 0, len(tenants))
+	for name := range tenants {
+		names = append(names, name)
+	}
+	tenantsMutex.Unlock()
+
+	slices.Sort(names)
+	writeResponse(w, r, names)
+}
+
+// handleAdminDeleteTenant drops a tenant's store; naming it again starts a
+// fresh copy of the seeded state
+func handleAdminDeleteTenant(w http.ResponseWriter, r *http.Request) {
+	tenantsMutex.Lock()
+	s, ok := tenants[r.PathValue("name")]
+	delete(tenants, r.PathValue("name"))
+	tenantsMutex.Unlock()
+
+	if !ok {
+		http.Error(w, "Tenant not found", http.StatusNotFound)
+		return
+	}
+	resetJourneys(s)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,118 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestTenantsAreIsolated(t *testing.T) {
+	t.Cleanup(func() {
+		tenantsMutex.Lock()
+		clear(tenants)
+		tenantsMutex.Unlock()
+	})
+	handler := withTenant(setupRouter())
+	orcid := "0000-0001-2345-6789"
+
+	do := func(method, path, tenant, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		if tenant != "" {
+			req.Header.Set(tenantHeader, tenant)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/v3.0/"+orcid+"/work", "ci-1", `{"type": "book", "title": {"title": {"value": "Tenant work"}}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v", w.Code)
+	}
+	loc := w.Header().Get("Location")
+	item := loc[strings.Index(loc, "/v3.0/"):]
+
+	if w := do("GET", item, "ci-1", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the tenant to see its work, got %v", w.Code)
+	}
+	if w := do("GET", "/tenants/ci-1"+item, "", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the path prefix to select the tenant, got %v", w.Code)
+	}
+	if w := do("GET", item, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the default store not to see the work, got %v", w.Code)
+	}
+	if w := do("GET", item, "ci-2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected another tenant not to see the work, got %v", w.Code)
+	}
+	if w := do("GET", "/v3.0/"+orcid+"/work/123456", "ci-2", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected a new tenant to start from the seeded state, got %v", w.Code)
+	}
+	if w := do("GET", "/v3.0/"+orcid+"/record", "../etc", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid tenant name to be rejected, got %v", w.Code)
+	}
+
+	var names []string
+	json.NewDecoder(do("GET", "/__admin/tenants", "", "").Body).Decode(&names)
+	if strings.Join(names, ",") != "ci-1,ci-2" {
+		t.Errorf("Expected tenants ci-1 and ci-2, got %v", names)
+	}
+
+	if w := do("DELETE", "/__admin/tenants/ci-1", "", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status No Content, got %v", w.Code)
+	}
+	if w := do("GET", item, "ci-1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a deleted tenant to start again from the seeded state, got %v", w.Code)
+	}
+}
+
+func TestTenantAuthorize(t *testing.T) {
+	t.Cleanup(func() {
+		tenantsMutex.Lock()
+		clear(tenants)
+		tenantsMutex.Unlock()
+	})
+	handler := withTenant(setupRouter())
+	authorize := func(tenant, orcid string) *httptest.ResponseRecorder {
+		q := url.Values{"client_id": {"APP-123"}, "redirect_uri": {"http://example.com/cb"}, "moat_user": {orcid}}
+		req := httptest.NewRequest("GET", "/oauth/authorize?"+q.Encode(), nil)
+		if tenant != "" {
+			req.Header.Set(tenantHeader, tenant)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	req := httptest.NewRequest("POST", "/__admin/users", strings.NewReader(`{"given-names": "Ada"}`))
+	req.Header.Set(tenantHeader, "ci-1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	orcid := path.Base(w.Header().Get("Location"))
+
+	w = authorize("ci-1", orcid)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected the tenant's user authorized, got %v", w.Code)
+	}
+	if w := authorize("", orcid); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the default store not to know the tenant's user, got %v", w.Code)
+	}
+
+	loc, _ := url.Parse(w.Header().Get("Location"))
+	form := url.Values{"client_id": {"APP-123"}, "grant_type": {"authorization_code"},
+		"redirect_uri": {"http://example.com/cb"}, "code": {loc.Query().Get("code")}}
+	req = httptest.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(tenantHeader, "ci-1")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var resp TokenResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.ORCID != orcid || resp.Name != "Ada " {
+		t.Errorf("Expected the tenant user's name on the token, got %q (%v)", resp.Name, w.Code)
+	}
+}
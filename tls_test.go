@@ -0,0 +1,97 @@
+package moat
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTLSConfig(t *testing.T) {
+	if c, err := tlsConfig("", "", false); c != nil || err != nil {
+		t.Errorf("Expected plain HTTP, got %v, %v", c, err)
+	}
+	for _, args := range [][2]string{{"cert.pem", ""}, {"", "key.pem"}} {
+		if _, err := tlsConfig(args[0], args[1], false); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+	if _, err := tlsConfig("cert.pem", "key.pem", true); err == nil {
+		t.Error("Expected --tls-self-signed to exclude a certificate")
+	}
+
+	c, err := tlsConfig("", "", true)
+	if err != nil || c == nil || len(c.Certificates) != 1 {
+		t.Fatalf("Expected a self-signed certificate, got %v", err)
+	}
+	cert, err := x509.ParseCertificate(c.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.VerifyHostname("localhost"); err != nil {
+		t.Errorf("Expected the certificate to be good for localhost: %v", err)
+	}
+	if err := cert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("Expected the certificate to be good for 127.0.0.1: %v", err)
+	}
+
+	// The same certificate from files
+	dir := t.TempDir()
+	key, err := x509.MarshalPKCS8PrivateKey(c.Certificates[0].PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0o600)
+	if c, err := tlsConfig(certFile, keyFile, false); err != nil || len(c.Certificates) != 1 {
+		t.Errorf("Expected the certificate loaded from files, got %v", err)
+	}
+	if _, err := tlsConfig(filepath.Join(dir, "missing.pem"), keyFile, false); err == nil {
+		t.Error("Expected an error for a missing certificate")
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	c, err := tlsConfig("", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(c.Certificates[0].Certificate[0])
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	addr := freeAddr(t)
+	srv := &http.Server{Addr: addr, TLSConfig: c, Handler: setupRouter()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- serve(ctx, []*http.Server{srv}, nil, time.Second) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var resp *http.Response
+	for range 50 {
+		if resp, err = client.Get("https://" + addr + "/.well-known/openid-configuration"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Expected an HTTPS answer: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil || !strings.Contains(string(body), "https://"+addr+"/oauth/token") {
+		t.Errorf("Expected https discovery over TLS, got %v: %s", resp.StatusCode, body)
+	}
+}
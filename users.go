@@ -0,0 +1,196 @@
+package moat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"moat/models"
+)
+
+// --- Admin Users ---
+//
+// Tests can build the researchers they need at runtime instead of relying
+// on the demo users: /__admin/users creates, updates and deletes them in
+// the request's store. A new user takes the same shape as a fixture file
+// user, works and employments included.
+
+// AdminUser is a user as /__admin/users lists it
+type AdminUser struct {
+	ORCID      string        `json:"orcid"`
+	GivenNames string        `json:"given-names"`
+	FamilyName string        `json:"family-name,omitempty"`
+	Status     *RecordStatus `json:"status,omitempty"`
+}
+
+// mockEmails returns verified public emails from the record's owner, the
+// first of them primary
+func mockEmails(orcid string, addresses ...string) *models.Emails {
+	now := *timestamp()
+	emails := &models.Emails{}
+	for i, address := range addresses {
+		verified, primary := true, i == 0
+		created, modified := now, now
+		emails.Emails = append(emails.Emails, &models.Email{
+			Visibility:       "PUBLIC",
+			Verified:         &verified,
+			Primary:          &primary,
+			CreatedDate:      &created,
+			LastModifiedDate: &modified,
+			Email:            address,
+			Source: &models.Source{
+				SourceOrcid: &models.SourceOrcid{
+					Uri:  fmt.Sprintf("https://orcid.org/%s", orcid),
+					Path: orcid,
+					Host: "orcid.org",
+				},
+				SourceName: &models.SourceName{
+					Value: "MOAT Service",
+				},
+			},
+		})
+	}
+	return emails
+}
+
+// newUserORCID returns a valid iD no user in s has, in the 0000-0009 block
+// ORCID uses for test records
+func newUserORCID(s *Store) string {
+	rng := ids.Rand()
+	for {
+		orcid := orcidFromNumber(90_000_000 + rng.IntN(10_000_000))
+		if !s.HasUser(orcid) {
+			return orcid
+		}
+	}
+}
+
+// handleAdminListUsers lists every user in the store
+func handleAdminListUsers(w http.ResponseWriter, r *http.Request) {
+	s := storeFor(r)
+	list := []AdminUser{}
+	for _, orcid := range s.ORCIDs() {
+		u := AdminUser{ORCID: orcid, Status: s.Status(orcid)}
+		if p, ok := s.Person(orcid); ok && p.Name != nil {
+			u.GivenNames, u.FamilyName = p.Name.GivenNames, p.Name.FamilyName
+		}
+		list = append(list, u)
+	}
+	writeResponse(w, r, list)
+}
+
+// handleAdminGetUser returns a user's whole record
+func handleAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	record, ok := storeFor(r).Record(r.PathValue("orcid"))
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	writeResponse(w, r, record)
+}
+
+// handleAdminCreateUser adds a user, with an iD generated if none is given.
+// Its works and employments are checked as the API would check them.
+func handleAdminCreateUser(w http.ResponseWriter, r *http.Request) {
+	var u FixtureUser
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		http.Error(w, "Invalid user: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if u.GivenNames == "" {
+		http.Error(w, "Invalid user: given-names is required", http.StatusBadRequest)
+		return
+	}
+	for i := range u.Works {
+		if e := validateActivity(&u.Works[i]); e != nil {
+			http.Error(w, fmt.Sprintf("Invalid user: work %d: %s", i, e.DeveloperMessage), http.StatusBadRequest)
+			return
+		}
+	}
+	for i := range u.Employments {
+		if e := validateActivity(&u.Employments[i]); e != nil {
+			http.Error(w, fmt.Sprintf("Invalid user: employment %d: %s", i, e.DeveloperMessage), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s := storeFor(r)
+	switch {
+	case u.ORCID == "":
+		u.ORCID = newUserORCID(s)
+	case !validORCID(u.ORCID):
+		http.Error(w, "Invalid user: "+u.ORCID+" is not a valid ORCID iD", http.StatusBadRequest)
+		return
+	case s.HasUser(u.ORCID):
+		http.Error(w, "User "+u.ORCID+" already exists", http.StatusConflict)
+		return
+	}
+	seedFixtureUser(s, u)
+
+	record, _ := s.Record(u.ORCID)
+	w.Header().Set("Location", "/__admin/users/"+u.ORCID)
+	writeResponseStatus(w, r, http.StatusCreated, record)
+}
+
+// handleAdminUpdateUser changes a user's name, biography and emails; fields
+// left out keep their values
+func handleAdminUpdateUser(w http.ResponseWriter, r *http.Request) {
+	var u FixtureUser
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		http.Error(w, "Invalid user: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(u.Works) > 0 || len(u.Employments) > 0 {
+		http.Error(w, "Invalid user: add activities through the API", http.StatusBadRequest)
+		return
+	}
+	orcid := r.PathValue("orcid")
+	s := storeFor(r)
+	err := s.UpdatePerson(orcid, func(p *models.Person) error {
+		if u.GivenNames != "" || u.FamilyName != "" {
+			name := models.PersonName{Visibility: "PUBLIC", CreatedDate: timestamp()}
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if u.GivenNames != "" {
+				name.GivenNames = u.GivenNames
+			}
+			if u.FamilyName != "" {
+				name.FamilyName = u.FamilyName
+			}
+			if name.GivenNames != "" {
+				name.CreditName = fmt.Sprintf("%s. %s", string(name.GivenNames[0]), name.FamilyName)
+			}
+			name.LastModifiedDate = timestamp()
+			p.Name = &name
+		}
+		if u.Biography != "" {
+			bio := models.Biography{Visibility: "PUBLIC", CreatedDate: timestamp()}
+			if p.Biography != nil {
+				bio = *p.Biography
+			}
+			bio.Content = u.Biography
+			bio.LastModifiedDate = timestamp()
+			p.Biography = &bio
+		}
+		if len(u.Emails) > 0 {
+			p.Emails = mockEmails(orcid, u.Emails...)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	record, _ := s.Record(orcid)
+	writeResponse(w, r, record)
+}
+
+// handleAdminDeleteUser removes a user and everything they hold
+func handleAdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	if !storeFor(r).DeleteUser(r.PathValue("orcid")) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
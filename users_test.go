@@ -0,0 +1,92 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdminUsers(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/__admin/users", `{"given-names": "Ada", "family-name": "Lovelace", "biography": "Analyst",
+		"emails": ["ada@example.edu", "ada@example.com"],
+		"works": [{"type": "journal-article", "title": {"title": {"value": "Notes"}}}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %v: %s", w.Code, w.Body)
+	}
+	var record OrcidRecord
+	if err := json.Unmarshal(w.Body.Bytes(), &record); err != nil {
+		t.Fatalf("Unable to decode record: %v", err)
+	}
+	orcid := record.OrcidIdentifier.Path
+	if !validORCID(orcid) || w.Header().Get("Location") != "/__admin/users/"+orcid {
+		t.Fatalf("Expected a generated iD and its Location, got %q and %q", orcid, w.Header().Get("Location"))
+	}
+	emails := record.Person.Emails.Emails
+	if len(emails) != 2 || emails[0].Email != "ada@example.edu" || !*emails[0].Primary || *emails[1].Primary {
+		t.Errorf("Expected two emails, the first primary, got %+v", emails)
+	}
+	if w := do("GET", "/v3.0/"+orcid+"/record", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Notes") {
+		t.Errorf("Expected the API to serve the new user's work, got %v: %s", w.Code, w.Body)
+	}
+
+	if w := do("POST", "/__admin/users", `{"orcid": "`+orcid+`", "given-names": "Ada"}`); w.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an existing user, got %v", w.Code)
+	}
+	if w := do("POST", "/__admin/users", `{"orcid": "0000-0000-0000-0000", "given-names": "Ada"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid iD, got %v", w.Code)
+	}
+	if w := do("POST", "/__admin/users", `{"given-names": "Ada", "works": [{"type": "novel", "title": {"title": {"value": "Notes"}}}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid work, got %v", w.Code)
+	}
+
+	var users []AdminUser
+	json.Unmarshal(do("GET", "/__admin/users", "").Body.Bytes(), &users)
+	found := false
+	for _, u := range users {
+		found = found || (u.ORCID == orcid && u.GivenNames == "Ada" && u.FamilyName == "Lovelace")
+	}
+	if !found {
+		t.Errorf("Expected the new user listed, got %+v", users)
+	}
+
+	w = do("PUT", "/__admin/users/"+orcid, `{"family-name": "King", "emails": ["countess@example.org"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %v: %s", w.Code, w.Body)
+	}
+	json.Unmarshal(w.Body.Bytes(), &record)
+	if name := record.Person.Name; name.GivenNames != "Ada" || name.FamilyName != "King" || name.CreditName != "A. King" {
+		t.Errorf("Expected the family name changed alone, got %+v", name)
+	}
+	if emails := record.Person.Emails.Emails; len(emails) != 1 || emails[0].Email != "countess@example.org" {
+		t.Errorf("Expected the emails replaced, got %+v", emails)
+	}
+	if record.Person.Biography.Content != "Analyst" {
+		t.Errorf("Expected the biography kept, got %q", record.Person.Biography.Content)
+	}
+
+	if w := do("DELETE", "/__admin/users/"+orcid, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %v", w.Code)
+	}
+	if w := do("GET", "/__admin/users/"+orcid, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %v", w.Code)
+	}
+	if w := do("DELETE", "/__admin/users/"+orcid, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 deleting twice, got %v", w.Code)
+	}
+	if w := do("PUT", "/__admin/users/"+orcid, `{"given-names": "Ada"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 updating a deleted user, got %v", w.Code)
+	}
+}
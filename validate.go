@@ -0,0 +1,194 @@
+package moat
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"moat/orciderr"
+)
+
+// --- Payload Validation ---
+//
+// Activity bodies are checked after decoding, the way ORCID's schema
+// validation would: required elements (9046), type enumerations and date
+// formats (9001). Seeded and imported data skip the checks.
+
+// validatedActivity is implemented by activity types with required fields
+type validatedActivity interface {
+	validate() *orciderr.Error
+}
+
+// validateActivity checks v if its type has rules
+func validateActivity(v any) *orciderr.Error {
+	if a, ok := v.(validatedActivity); ok {
+		return a.validate()
+	}
+	return nil
+}
+
+// workTypes are the work types ORCID's v3.0 schema accepts
+var workTypes = []string{
+	"annotation", "artistic-performance", "book", "book-chapter", "book-review",
+	"cartographic-material", "conference-abstract", "conference-paper", "conference-poster",
+	"data-management-plan", "data-set", "design", "dictionary-entry", "disclosure",
+	"dissertation-thesis", "edited-book", "encyclopedia-entry", "image", "invention",
+	"journal-article", "journal-issue", "learning-object", "lecture-speech", "license",
+	"magazine-article", "manual", "moving-image", "musical-composition", "newsletter-article",
+	"newspaper-article", "online-resource", "other", "patent", "physical-object", "preprint",
+	"registered-copyright", "report", "research-technique", "research-tool", "review",
+	"software", "sound", "spin-off-company", "standards-and-policy",
+	"supervised-student-publication", "technical-standard", "test", "trademark",
+	"translation", "undefined", "website", "working-paper",
+}
+
+// fundingTypes are the funding types ORCID's v3.0 schema accepts
+var fundingTypes = []string{"award", "contract", "grant", "salary-award"}
+
+// citationTypes are the work citation formats ORCID's v3.0 schema accepts
+var citationTypes = []string{
+	"bibtex", "formatted-apa", "formatted-chicago", "formatted-harvard", "formatted-ieee",
+	"formatted-mla", "formatted-unspecified", "formatted-vancouver", "ris",
+}
+
+// relationships are the external-id relationships ORCID's v3.0 schema accepts
+var relationships = []string{"self", "part-of", "version-of", "funded-by"}
+
+// contributorSequences and contributorRoles are the work contributor
+// attributes ORCID's v3.0 schema accepts
+var (
+	contributorSequences = []string{"first", "additional"}
+	contributorRoles     = []string{
+		"author", "assignee", "editor", "chair-or-translator", "co-investigator", "co-inventor",
+		"graduate-student", "other-inventor", "principal-investigator", "postdoctoral-researcher",
+		"support-staff",
+	}
+)
+
+func missingElement(item, element string) *orciderr.Error {
+	return orciderr.Newf(orciderr.MissingRequiredElement, "Bad Request: %s is missing its required %s", item, element)
+}
+
+func invalidElement(item, element, value string) *orciderr.Error {
+	return orciderr.Newf(orciderr.InvalidMessage, "Bad Request: Invalid incoming message: %s has an invalid %s %q", item, element, value)
+}
+
+var (
+	yearPattern  = regexp.MustCompile(`^\d{4}$`)
+	monthPattern = regexp.MustCompile(`^(0[1-9]|1[0-2])$`)
+	dayPattern   = regexp.MustCompile(`^(0[1-9]|[12]\d|3[01])$`)
+)
+
+// validateDate checks a fuzzy date: a four-digit year, a two-digit month
+// and a day that exists in that month, each part needing the one before it.
+// A nil or empty date is valid.
+func validateDate(item, element string, d *DateYear) *orciderr.Error {
+	if d == nil || (d.Year.Value == "" && d.Month == nil && d.Day == nil) {
+		return nil
+	}
+	if !yearPattern.MatchString(d.Year.Value) {
+		return invalidElement(item, element+" year", d.Year.Value)
+	}
+	if d.Month == nil {
+		if d.Day != nil {
+			return invalidElement(item, element, "day without a month")
+		}
+		return nil
+	}
+	if !monthPattern.MatchString(d.Month.Value) {
+		return invalidElement(item, element+" month", d.Month.Value)
+	}
+	if d.Day == nil {
+		return nil
+	}
+	if !dayPattern.MatchString(d.Day.Value) {
+		return invalidElement(item, element+" day", d.Day.Value)
+	}
+	year, _ := strconv.Atoi(d.Year.Value)
+	month, _ := strconv.Atoi(d.Month.Value)
+	day, _ := strconv.Atoi(d.Day.Value)
+	if time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Day() != day {
+		return invalidElement(item, element, d.Year.Value+"-"+d.Month.Value+"-"+d.Day.Value)
+	}
+	return nil
+}
+
+func (w *GenericWorkResponse) validate() *orciderr.Error {
+	switch {
+	case w.Title.Title.Value == "":
+		return missingElement("work", "title")
+	case w.Type == "":
+		return missingElement("work", "type")
+	case !slices.Contains(workTypes, w.Type):
+		return invalidElement("work", "type", w.Type)
+	}
+	if c := w.Citation; c != nil {
+		if c.Value == "" {
+			return missingElement("work", "citation-value")
+		}
+		if !slices.Contains(citationTypes, c.Type) {
+			return invalidElement("work", "citation-type", c.Type)
+		}
+	}
+	if e := validateExternalIDs("work", w.ExternalIDs); e != nil {
+		return e
+	}
+	if w.Contributors != nil {
+		for _, c := range w.Contributors.Contributor {
+			if a := c.Attributes; a != nil {
+				if a.Sequence != "" && !slices.Contains(contributorSequences, a.Sequence) {
+					return invalidElement("work", "contributor-sequence", a.Sequence)
+				}
+				if a.Role != "" && !slices.Contains(contributorRoles, a.Role) {
+					return invalidElement("work", "contributor-role", a.Role)
+				}
+			}
+		}
+	}
+	return validateDate("work", "publication-date", &w.PublicationDate)
+}
+
+// validateExternalIDs checks each external id has a type, a value and, if
+// any, a relationship ORCID knows
+func validateExternalIDs(item string, ids *ExternalIDs) *orciderr.Error {
+	if ids == nil {
+		return nil
+	}
+	for _, id := range ids.ExternalID {
+		switch {
+		case id.Type == "":
+			return missingElement(item, "external-id-type")
+		case id.Value == "":
+			return missingElement(item, "external-id-value")
+		case id.Relationship != "" && !slices.Contains(relationships, id.Relationship):
+			return invalidElement(item, "external-id-relationship", id.Relationship)
+		}
+	}
+	return nil
+}
+
+func (f *GenericFundingResponse) validate() *orciderr.Error {
+	switch {
+	case f.Title.Title.Value == "":
+		return missingElement("funding", "title")
+	case f.Type == "":
+		return missingElement("funding", "type")
+	case !slices.Contains(fundingTypes, f.Type):
+		return invalidElement("funding", "type", f.Type)
+	}
+	if e := validateDate("funding", "start-date", &f.StartDate); e != nil {
+		return e
+	}
+	return validateDate("funding", "end-date", f.EndDate)
+}
+
+func (a *Affiliation) validate() *orciderr.Error {
+	if a.Organization.Name == "" {
+		return missingElement("affiliation", "organization name")
+	}
+	if e := validateDate("affiliation", "start-date", a.StartDate); e != nil {
+		return e
+	}
+	return validateDate("affiliation", "end-date", a.EndDate)
+}
@@ -0,0 +1,77 @@
+package moat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"moat/orciderr"
+)
+
+func TestPayloadValidation(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0001-2345-6789"
+
+	tests := []struct {
+		name, section, body string
+		code                orciderr.Code
+	}{
+		{"work without title", "work", `{"type": "book"}`, orciderr.MissingRequiredElement},
+		{"work without type", "work", `{"title": {"title": {"value": "Untyped"}}}`, orciderr.MissingRequiredElement},
+		{"unknown work type", "work", `{"type": "blog-post", "title": {"title": {"value": "Typed"}}}`, orciderr.InvalidMessage},
+		{"two-digit year", "work", `{"type": "book", "title": {"title": {"value": "Y2K"}}, "publication-date": {"year": {"value": "99"}}}`, orciderr.InvalidMessage},
+		{"unpadded month", "work", `{"type": "book", "title": {"title": {"value": "May"}}, "publication-date": {"year": {"value": "2020"}, "month": {"value": "5"}}}`, orciderr.InvalidMessage},
+		{"day without month", "work", `{"type": "book", "title": {"title": {"value": "Day"}}, "publication-date": {"year": {"value": "2020"}, "day": {"value": "05"}}}`, orciderr.InvalidMessage},
+		{"no such day", "work", `{"type": "book", "title": {"title": {"value": "Leap"}}, "publication-date": {"year": {"value": "2023"}, "month": {"value": "02"}, "day": {"value": "29"}}}`, orciderr.InvalidMessage},
+		{"unknown citation type", "work", `{"type": "book", "title": {"title": {"value": "Cited"}}, "citation": {"citation-type": "harvard", "citation-value": "Doe (2020)"}}`, orciderr.InvalidMessage},
+		{"citation without value", "work", `{"type": "book", "title": {"title": {"value": "Cited"}}, "citation": {"citation-type": "bibtex"}}`, orciderr.MissingRequiredElement},
+		{"unknown relationship", "work", `{"type": "book", "title": {"title": {"value": "Related"}}, "external-ids": {"external-id": [{"external-id-type": "doi", "external-id-value": "10.1/x", "external-id-relationship": "sibling"}]}}`, orciderr.InvalidMessage},
+		{"external id without value", "work", `{"type": "book", "title": {"title": {"value": "Related"}}, "external-ids": {"external-id": [{"external-id-type": "doi"}]}}`, orciderr.MissingRequiredElement},
+		{"unknown contributor role", "work", `{"type": "book", "title": {"title": {"value": "Credited"}}, "contributors": {"contributor": [{"credit-name": {"value": "A. Doe"}, "contributor-attributes": {"contributor-role": "ghostwriter"}}]}}`, orciderr.InvalidMessage},
+		{"unknown funding type", "funding", `{"type": "gift", "title": {"title": {"value": "Gift"}}}`, orciderr.InvalidMessage},
+		{"funding without title", "funding", `{"type": "grant"}`, orciderr.MissingRequiredElement},
+		{"employment without organization", "employment", `{"role-title": "Lecturer"}`, orciderr.MissingRequiredElement},
+		{"employment with a bad end date", "employment", `{"organization": {"name": "Example University"}, "end-date": {"year": {"value": "20XX"}}}`, orciderr.InvalidMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v3.0/"+orcid+"/"+tt.section, strings.NewReader(tt.body))
+			req.Header.Set("Accept", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("Expected status Bad Request, got %v", w.Code)
+			}
+			if e, err := orciderr.Decode(w.Body); err != nil || e.ErrorCode != tt.code {
+				t.Errorf("Expected error code %d, got %+v, %v", tt.code, e, err)
+			}
+		})
+	}
+
+	// PUT is checked too
+	req := httptest.NewRequest("PUT", "/v3.0/"+orcid+"/work/123456", strings.NewReader(`{"type": "book"}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid PUT to be refused, got %v", w.Code)
+	}
+}
+
+func TestValidateDate(t *testing.T) {
+	v := func(s string) *Value { return &Value{Value: s} }
+	valid := []*DateYear{
+		nil,
+		{},
+		{Year: Value{Value: "2024"}},
+		{Year: Value{Value: "2024"}, Month: v("02"), Day: v("29")},
+	}
+	for _, d := range valid {
+		if e := validateDate("work", "publication-date", d); e != nil {
+			t.Errorf("Expected %+v to be valid, got %v", d, e.DeveloperMessage)
+		}
+	}
+	if e := validateDate("work", "publication-date", &DateYear{Year: Value{Value: "2024"}, Month: v("13")}); e == nil {
+		t.Error("Expected month 13 to be invalid")
+	}
+}
@@ -0,0 +1,161 @@
+package moat
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"moat/models"
+)
+
+// --- Visibility ---
+//
+// Person items and activities carry ORCID's visibility, and responses only
+// include what the caller may see: PUBLIC items for everyone, LIMITED ones
+// for a /read-limited token on that record, and PRIVATE ones only for the
+// client that is their source. Requests without a token, and everything on
+// the public surface, see PUBLIC items only.
+
+// viewer is what a caller is allowed to see of one record
+type viewer struct {
+	// limited is set for /read-limited tokens issued for the record
+	limited bool
+	// clientID is the caller's client, which sees the items it is source of
+	clientID string
+}
+
+// viewerFor works out what r's caller may see of orcid's record
+func viewerFor(r *http.Request, orcid string) viewer {
+	if requestSurface(r) == publicSurface {
+		return viewer{}
+	}
+	t, ok := lookupToken(bearerToken(r))
+	if !ok || t.expired() {
+		return viewer{}
+	}
+	return viewer{
+		limited:  t.ORCID == orcid && hasScope(t.Scope, "/read-limited"),
+		clientID: t.ClientID,
+	}
+}
+
+// tokenClientID returns the client of r's bearer token, or "" without one
+func tokenClientID(r *http.Request) string {
+	t, ok := lookupToken(bearerToken(r))
+	if !ok {
+		return ""
+	}
+	return t.ClientID
+}
+
+// sees reports whether v may see an item with visibility, written by the
+// client sourceClient ("" for items no client wrote)
+func (v viewer) sees(visibility, sourceClient string) bool {
+	own := sourceClient != "" && sourceClient == v.clientID
+	switch strings.ToLower(visibility) {
+	case "", "public":
+		return true
+	case "limited", "registered-only":
+		return v.limited || own
+	}
+	return own
+}
+
+// item reports whether v may see a stored activity
+func (v viewer) item(it *Item) bool {
+	var meta ActivityMeta
+	json.Unmarshal(it.Data, &meta)
+	return v.activity(&meta)
+}
+
+// activity reports whether v may see an activity with the given attribution
+func (v viewer) activity(m *ActivityMeta) bool {
+	return v.sees(m.Visibility, m.Source.clientID())
+}
+
+// visibleActivity reports whether v may see a decoded activity; types
+// without attribution are always visible
+func (v viewer) visibleActivity(a any) bool {
+	if m, ok := a.(attributedActivity); ok {
+		return v.activity(m.activityMeta())
+	}
+	return true
+}
+
+// sourceClientID returns the client a person item's source names, if any
+func sourceClientID(s *models.Source) string {
+	if s == nil || s.SourceClientID == nil {
+		return ""
+	}
+	return s.SourceClientID.Path
+}
+
+// personFor fetches orcid's person as the caller may see it
+func personFor(r *http.Request, orcid string) (models.Person, bool) {
+	person, ok := storeFor(r).Person(orcid)
+	if !ok {
+		return person, false
+	}
+	return viewerFor(r, orcid).person(person), true
+}
+
+// visibleOnly keeps the items of a list section v may see
+func visibleOnly[T any](v viewer, items []*T, meta func(*T) (string, *models.Source)) []*T {
+	var kept []*T
+	for _, it := range items {
+		if visibility, source := meta(it); v.sees(visibility, sourceClientID(source)) {
+			kept = append(kept, it)
+		}
+	}
+	return kept
+}
+
+// person returns a copy of p without the items v may not see. Sections are
+// replaced rather than modified, since p shares them with the store.
+func (v viewer) person(p models.Person) models.Person {
+	if p.Name != nil && !v.sees(p.Name.Visibility, "") {
+		p.Name = nil
+	}
+	if p.Biography != nil && !v.sees(p.Biography.Visibility, "") {
+		p.Biography = nil
+	}
+	if p.OtherNames != nil {
+		p.OtherNames = &models.OtherNames{
+			LastModifiedDate: p.OtherNames.LastModifiedDate,
+			OtherNames: visibleOnly(v, p.OtherNames.OtherNames, func(o *models.OtherName) (string, *models.Source) {
+				return o.Visibility, o.Source
+			}),
+		}
+	}
+	if p.ResearcherUrls != nil {
+		p.ResearcherUrls = &models.ResearcherUrls{
+			LastModifiedDate: p.ResearcherUrls.LastModifiedDate,
+			ResearcherUrls: visibleOnly(v, p.ResearcherUrls.ResearcherUrls, func(u *models.ResearcherUrl) (string, *models.Source) {
+				return u.Visibility, u.Source
+			}),
+		}
+	}
+	if p.Emails != nil {
+		p.Emails = &models.Emails{Emails: visibleOnly(v, p.Emails.Emails, func(e *models.Email) (string, *models.Source) {
+			return e.Visibility, e.Source
+		})}
+	}
+	if p.Addresses != nil {
+		p.Addresses = &models.Addresses{Addresses: visibleOnly(v, p.Addresses.Addresses, func(a *models.Address) (string, *models.Source) {
+			return a.Visibility, a.Source
+		})}
+	}
+	if p.Keywords != nil {
+		p.Keywords = &models.Keywords{Keywords: visibleOnly(v, p.Keywords.Keywords, func(k *models.Keyword) (string, *models.Source) {
+			return k.Visibility, k.Source
+		})}
+	}
+	if p.ExternalIdentifiers != nil {
+		p.ExternalIdentifiers = &models.ExternalIdentifiers{
+			ExternalIdentifiers: visibleOnly(v, p.ExternalIdentifiers.ExternalIdentifiers, func(e *models.ExternalIdentifier) (string, *models.Source) {
+				return e.Visibility, e.Source
+			}),
+		}
+	}
+	return p
+}
@@ -0,0 +1,135 @@
+package moat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"moat/models"
+)
+
+// testToken records an access token for clientID on orcid with scope
+func testToken(clientID, orcid, scope string) string {
+	token := defaultTokenResponse(context.Background())
+	token.ORCID, token.Scope = orcid, scope
+	recordToken(clientID, token)
+	return token.AccessToken
+}
+
+func TestActivityVisibility(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0003-3003-4004"
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	owner := testToken("APP-OWNER", orcid, "/read-limited /activities/update")
+	limited := testToken("APP-OTHER", orcid, "/read-limited")
+	elsewhere := testToken("APP-OTHER", "0000-0001-2345-6789", "/read-limited")
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	post := func(visibility string) string {
+		body := `{"type": "journal-article", "title": {"title": {"value": "A ` + visibility + ` paper"}}, "visibility": "` + visibility + `"}`
+		w := do("POST", "/v3.0/"+orcid+"/work", owner, body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status Created, got %v", w.Code)
+		}
+		loc := w.Header().Get("Location")
+		return loc[strings.Index(loc, "/v3.0/"):]
+	}
+	public, limitedWork, private := post("public"), post("limited"), post("private")
+
+	tests := []struct {
+		name  string
+		token string
+		want  map[string]bool
+	}{
+		{"no token", "", map[string]bool{public: true, limitedWork: false, private: false}},
+		{"read-limited on another record", elsewhere, map[string]bool{public: true, limitedWork: false, private: false}},
+		{"read-limited", limited, map[string]bool{public: true, limitedWork: true, private: false}},
+		{"source", owner, map[string]bool{public: true, limitedWork: true, private: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for path, visible := range tt.want {
+				if w := do("GET", path, tt.token, ""); (w.Code == http.StatusOK) != visible {
+					t.Errorf("Expected %s visible=%v, got %v", path, visible, w.Code)
+				}
+			}
+
+			var activities Activities
+			json.NewDecoder(do("GET", "/v3.0/"+orcid+"/activities", tt.token, "").Body).Decode(&activities)
+			seen := 0
+			for _, g := range activities.Works.Group {
+				if strings.HasSuffix(g.WorkSummary[0].Title.Title.Value, "paper") {
+					seen++
+				}
+			}
+			want := 0
+			for _, visible := range tt.want {
+				if visible {
+					want++
+				}
+			}
+			if seen != want {
+				t.Errorf("Expected %d works in the summary, got %d", want, seen)
+			}
+		})
+	}
+
+	// The public surface shows public items whatever the token
+	req := httptest.NewRequest("GET", limitedWork, nil)
+	req.Header.Set("Authorization", "Bearer "+owner)
+	w := httptest.NewRecorder()
+	publicAPI(handler).ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the limited work hidden on the public surface, got %v", w.Code)
+	}
+}
+
+func TestPersonVisibility(t *testing.T) {
+	handler := setupRouter()
+	orcid := "0000-0005-7007-8008"
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+
+	store.UpdatePerson(orcid, func(p *models.Person) error {
+		p.Keywords = &models.Keywords{Keywords: []*models.Keyword{
+			{Visibility: "PUBLIC", PutCode: "1", Content: "open"},
+			{Visibility: "LIMITED", PutCode: "2", Content: "trusted"},
+			{Visibility: "PRIVATE", PutCode: "3", Content: "secret", Source: mockSource(orcid, "APP-OWNER")},
+		}}
+		return nil
+	})
+
+	get := func(token string) string {
+		req := httptest.NewRequest("GET", "/v3.0/"+orcid+"/person", nil)
+		req.Header.Set("Accept", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	if body := get(""); !strings.Contains(body, "open") || strings.Contains(body, "trusted") || strings.Contains(body, "secret") {
+		t.Errorf("Expected only the public keyword without a token, got %s", body)
+	}
+	if body := get(testToken("APP-OTHER", orcid, "/read-limited")); !strings.Contains(body, "trusted") || strings.Contains(body, "secret") {
+		t.Errorf("Expected the limited keyword with /read-limited, got %s", body)
+	}
+	if body := get(testToken("APP-OWNER", orcid, "/read-public")); !strings.Contains(body, "secret") || strings.Contains(body, "trusted") {
+		t.Errorf("Expected the source to see its private keyword, got %s", body)
+	}
+}
@@ -0,0 +1,171 @@
+package moat
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"moat/models"
+)
+
+// --- Work XML ---
+//
+// Works are stored and served in JSON as GenericWorkResponse, but in XML they
+// are ORCID's v3.0 work element, models.Work: namespaced, with the put-code
+// as an attribute, plain-text titles and dates, and no publication-date
+// unless the work has one. Works posted in XML are read the same way.
+
+// MarshalXML writes w as an ORCID work element
+func (w GenericWorkResponse) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.Encode(w.model())
+}
+
+// UnmarshalXML reads an ORCID work element into w
+func (w *GenericWorkResponse) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var m models.Work
+	if err := d.DecodeElement(&m, &start); err != nil {
+		return err
+	}
+	return w.fromModel(m)
+}
+
+// model converts w to ORCID's XML work
+func (w GenericWorkResponse) model() models.Work {
+	m := models.Work{
+		Visibility:       w.Visibility,
+		CreatedDate:      orcidTime(w.CreatedDate),
+		LastModifiedDate: orcidTime(w.LastModifiedDate),
+		Source:           w.Source.model(),
+		Title:            &models.WorkTitle{Title: w.Title.Title.Value},
+		JournalTitle:     valueOf(w.JournalTitle),
+		ShortDescription: w.ShortDescription,
+		Type:             w.Type,
+		Url:              valueOf(w.URL),
+		LanguageCode:     w.LanguageCode,
+	}
+	if w.PutCode != 0 {
+		m.PutCode = strconv.Itoa(w.PutCode)
+	}
+	if w.Citation != nil {
+		m.Citation = &models.WorkCitation{CitationType: w.Citation.Type, CitationValue: w.Citation.Value}
+	}
+	if d := w.PublicationDate; d.Year.Value != "" {
+		m.PublicationDate = &models.PublicationDate{Year: d.Year.Value, Month: valueOf(d.Month), Day: valueOf(d.Day)}
+	}
+	if w.ExternalIDs != nil {
+		m.ExternalIds = &models.ExternalIds{}
+		for _, id := range w.ExternalIDs.ExternalID {
+			m.ExternalIds.ExternalIds = append(m.ExternalIds.ExternalIds, &models.ExternalId{
+				ExternalIdType:         id.Type,
+				ExternalIdValue:        id.Value,
+				ExternalIdUrl:          valueOf(id.URL),
+				ExternalIdRelationship: id.Relationship,
+			})
+		}
+	}
+	if w.Contributors != nil {
+		m.Contributors = &models.WorkContributors{}
+		for _, c := range w.Contributors.Contributor {
+			mc := &models.WorkContributor{CreditName: valueOf(c.CreditName), ContributorEmail: valueOf(c.ContributorEmail)}
+			if id := c.ContributorORCID; id != nil {
+				mc.ContributorOrcid = &models.ContributorOrcid{Uri: id.Uri, Path: id.Path, Host: id.Host}
+			}
+			if a := c.Attributes; a != nil {
+				mc.ContributorAttributes = &models.ContributorAttributes{ContributorSequence: a.Sequence, ContributorRole: a.Role}
+			}
+			m.Contributors.Contributors = append(m.Contributors.Contributors, mc)
+		}
+	}
+	return m
+}
+
+// fromModel sets w from ORCID's XML work. The dates and source are left for
+// stampActivity to fill in, as they are for JSON.
+func (w *GenericWorkResponse) fromModel(m models.Work) error {
+	*w = GenericWorkResponse{
+		Type:             m.Type,
+		JournalTitle:     optionalValue(m.JournalTitle),
+		ShortDescription: m.ShortDescription,
+		URL:              optionalValue(m.Url),
+		LanguageCode:     m.LanguageCode,
+	}
+	w.Visibility = m.Visibility
+	if m.PutCode != "" {
+		putCode, err := strconv.Atoi(m.PutCode)
+		if err != nil {
+			return fmt.Errorf("invalid put-code %q", m.PutCode)
+		}
+		w.PutCode = putCode
+	}
+	if m.Title != nil {
+		w.Title.Title.Value = m.Title.Title
+	}
+	if m.Citation != nil {
+		w.Citation = &Citation{Type: m.Citation.CitationType, Value: m.Citation.CitationValue}
+	}
+	if d := m.PublicationDate; d != nil {
+		w.PublicationDate = DateYear{Year: Value{Value: d.Year}, Month: optionalValue(d.Month), Day: optionalValue(d.Day)}
+	}
+	if m.ExternalIds != nil {
+		w.ExternalIDs = &ExternalIDs{}
+		for _, id := range m.ExternalIds.ExternalIds {
+			w.ExternalIDs.ExternalID = append(w.ExternalIDs.ExternalID, ExternalID{
+				Type:         id.ExternalIdType,
+				Value:        id.ExternalIdValue,
+				URL:          optionalValue(id.ExternalIdUrl),
+				Relationship: id.ExternalIdRelationship,
+			})
+		}
+	}
+	if m.Contributors != nil {
+		w.Contributors = &WorkContributors{}
+		for _, mc := range m.Contributors.Contributors {
+			c := WorkContributor{CreditName: optionalValue(mc.CreditName), ContributorEmail: optionalValue(mc.ContributorEmail)}
+			if id := mc.ContributorOrcid; id != nil {
+				c.ContributorORCID = &OrcidIdentifier{Uri: id.Uri, Path: id.Path, Host: id.Host}
+			}
+			if a := mc.ContributorAttributes; a != nil {
+				c.Attributes = &ContributorAttributes{Sequence: a.ContributorSequence, Role: a.ContributorRole}
+			}
+			w.Contributors.Contributor = append(w.Contributors.Contributor, c)
+		}
+	}
+	return nil
+}
+
+// model converts s to ORCID's XML source
+func (s *ActivitySource) model() *models.Source {
+	if s == nil {
+		return nil
+	}
+	m := &models.Source{}
+	if id := s.SourceOrcid; id != nil {
+		m.SourceOrcid = &models.SourceOrcid{Uri: id.Uri, Path: id.Path, Host: id.Host}
+	}
+	if id := s.SourceClientID; id != nil {
+		m.SourceClientID = &models.SourceClientID{Uri: id.Uri, Path: id.Path, Host: id.Host}
+	}
+	if s.SourceName != nil {
+		m.SourceName = &models.SourceName{Value: s.SourceName.Value}
+	}
+	return m
+}
+
+// orcidTime formats a millisecond timestamp the way ORCID's XML does, e.g.
+// 2019-06-05T13:11:59.870Z
+func orcidTime(t *LastModified) *string {
+	if t == nil {
+		return nil
+	}
+	s := time.UnixMilli(t.Value).UTC().Format("2006-01-02T15:04:05.000Z")
+	return &s
+}
+
+// valueOf returns v's value, or "" if it is unset
+func valueOf(v *Value) string {
+	if v == nil {
+		return ""
+	}
+	return v.Value
+}
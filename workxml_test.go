@@ -0,0 +1,118 @@
+package moat
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"moat/models"
+)
+
+func TestWorkXML(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+
+	body := `{"type": "book", "title": {"title": {"value": "Undated"}},
+		"external-ids": {"external-id": [{"external-id-type": "doi", "external-id-value": "10.1/undated", "external-id-relationship": "self"}]}}`
+	req := httptest.NewRequest("POST", "/v3.0/0000-0001-2345-6789/work", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v: %s", w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest("GET", strings.TrimPrefix(w.Header().Get("Location"), "https://api.orcid.org"), nil)
+	req.Header.Set("Accept", "application/vnd.orcid+xml")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	got := w.Body.String()
+	if !strings.Contains(got, `<work xmlns="http://www.orcid.org/ns/work"`) {
+		t.Errorf("Expected a work in the work namespace, got %s", got)
+	}
+	if strings.Contains(got, "publication-date") {
+		t.Errorf("Expected no publication-date on an undated work, got %s", got)
+	}
+
+	var work models.Work
+	if err := xml.Unmarshal(w.Body.Bytes(), &work); err != nil {
+		t.Fatalf("Failed to decode work XML: %v", err)
+	}
+	if work.PutCode == "" || work.Title == nil || work.Title.Title != "Undated" ||
+		work.ExternalIds == nil || len(work.ExternalIds.ExternalIds) != 1 || work.ExternalIds.ExternalIds[0].ExternalIdValue != "10.1/undated" {
+		t.Errorf("Expected the posted work back as an ORCID work, got %+v", work)
+	}
+	if work.Source == nil || work.Source.SourceName == nil || work.Source.SourceName.Value != "MOAT Service" ||
+		work.CreatedDate == nil || !strings.HasSuffix(*work.CreatedDate, "Z") {
+		t.Errorf("Expected the source and an ORCID timestamp, got %+v", work)
+	}
+}
+
+func TestPostWorkXML(t *testing.T) {
+	saved := store.Snapshot()
+	t.Cleanup(func() { store.Restore(saved) })
+	handler := setupRouter()
+
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<work:work xmlns:common="http://www.orcid.org/ns/common" xmlns:work="http://www.orcid.org/ns/work">
+  <work:title><common:title>Toward a Unified Theory</common:title></work:title>
+  <work:journal-title>Journal of Psychoceramics</work:journal-title>
+  <work:type>journal-article</work:type>
+  <common:publication-date><common:year>2008</common:year><common:month>08</common:month></common:publication-date>
+  <common:external-ids>
+    <common:external-id>
+      <common:external-id-type>doi</common:external-id-type>
+      <common:external-id-value>10.5555/12345678</common:external-id-value>
+      <common:external-id-url>https://doi.org/10.5555/12345678</common:external-id-url>
+      <common:external-id-relationship>self</common:external-id-relationship>
+    </common:external-id>
+  </common:external-ids>
+  <work:contributors>
+    <work:contributor>
+      <work:credit-name>Josiah Carberry</work:credit-name>
+      <work:contributor-attributes><work:contributor-sequence>first</work:contributor-sequence><work:contributor-role>author</work:contributor-role></work:contributor-attributes>
+    </work:contributor>
+  </work:contributors>
+</work:work>`
+	req := httptest.NewRequest("POST", "/v3.0/0000-0001-2345-6789/work", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/vnd.orcid+xml")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected an XML work to be created, got %v: %s", w.Code, w.Body)
+	}
+	location := strings.TrimPrefix(w.Header().Get("Location"), "https://api.orcid.org")
+
+	req = httptest.NewRequest("GET", location, nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var work GenericWorkResponse
+	if err := json.NewDecoder(w.Body).Decode(&work); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if work.Title.Title.Value != "Toward a Unified Theory" || work.JournalTitle == nil || work.JournalTitle.Value != "Journal of Psychoceramics" ||
+		work.PublicationDate.Year.Value != "2008" || work.PublicationDate.Month == nil || work.PublicationDate.Month.Value != "08" {
+		t.Errorf("Expected the title and dates of the XML work, got %+v", work)
+	}
+	if work.ExternalIDs == nil || len(work.ExternalIDs.ExternalID) != 1 || work.ExternalIDs.ExternalID[0].URL == nil ||
+		work.Contributors == nil || len(work.Contributors.Contributor) != 1 || work.Contributors.Contributor[0].Attributes.Role != "author" {
+		t.Errorf("Expected the external ID and contributor of the XML work, got %+v", work)
+	}
+
+	req = httptest.NewRequest("GET", location, nil)
+	req.Header.Set("Accept", "application/vnd.orcid+xml")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var again GenericWorkResponse
+	if err := xml.Unmarshal(w.Body.Bytes(), &again); err != nil {
+		t.Fatalf("Failed to decode work XML: %v", err)
+	}
+	if again.PutCode != work.PutCode || again.Title != work.Title || again.Type != work.Type {
+		t.Errorf("Expected the XML work to read back the same, got %+v", again)
+	}
+}